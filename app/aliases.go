@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	shellAliasKey  = "app_shell_alias" // key for commands annotation
+	aliasesCmdName = "aliases"
+)
+
+var shellAliasRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func setShellAlias(cmd *cobra.Command, alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if !shellAliasRegexp.MatchString(alias) {
+		return errors.E("setShellAlias", errors.K.Invalid, ErrInvalidSpec,
+			"reason", "invalid shell alias",
+			"command", cmd.Name(),
+			"shell_alias", alias)
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[shellAliasKey] = alias
+	return nil
+}
+
+// ShellAliases returns the shell aliases of the commands of the app - as set
+// with "shell_alias" in the spec - mapped to the path of their command, e.g.
+// "mcl" -> "myapp content list".
+func (a *App) ShellAliases() (map[string]string, error) {
+	root, err := a.Cobra()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	var walk func(c *cobra.Command) error
+	walk = func(c *cobra.Command) error {
+		if alias := c.Annotations[shellAliasKey]; alias != "" {
+			if path, ok := ret[alias]; ok {
+				return errors.E("ShellAliases", errors.K.Invalid, ErrInvalidSpec,
+					"reason", "duplicate shell alias",
+					"shell_alias", alias,
+					"commands", []string{path, c.CommandPath()})
+			}
+			ret[alias] = c.CommandPath()
+		}
+		for _, sub := range c.Commands() {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err = walk(root); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GenAliases writes shell functions running the commands with a shell alias
+// to w, for the given shell: bash, zsh or fish. Extra arguments of the
+// functions are passed to the command. With "shell_alias": "mcl" on the
+// 'content list' command of 'myapp', the bash function is:
+//
+//	mcl() { myapp content list "$@"; }
+//
+// The functions are typically loaded from a shell profile with:
+//
+//	source <(myapp aliases bash)
+func (a *App) GenAliases(w io.Writer, shell string) error {
+	e := errors.Template("GenAliases", errors.K.Invalid)
+	var format string
+	switch shell {
+	case "bash", "zsh":
+		format = "%s() { %s \"$@\"; }\n"
+	case "fish":
+		format = "function %s; %s $argv; end\n"
+	default:
+		return e("reason", "unsupported shell", "shell", shell)
+	}
+	aliases, err := a.ShellAliases()
+	if err != nil {
+		return e(err)
+	}
+	for _, alias := range sortedNames(aliases) {
+		if _, err = fmt.Fprintf(w, format, alias, aliases[alias]); err != nil {
+			return e(errors.K.IO, err)
+		}
+	}
+	return nil
+}
+
+// addAliasesCmd adds the 'aliases' command to the root command if a command of
+// the spec has a shell alias and the root has no command with that name.
+func (a *App) addAliasesCmd() {
+	if !hasShellAlias(a.root) {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == aliasesCmdName {
+			return
+		}
+	}
+	a.root.AddCommand(&cobra.Command{
+		Use:       aliasesCmdName + " bash|zsh|fish",
+		Short:     "Generate shell functions for the aliases of commands",
+		Long:      "Generate shell functions for the aliases of commands. Load them in the current shell with:\n\n\tsource <(" + a.root.Name() + " " + aliasesCmdName + " bash)",
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.GenAliases(cmd.OutOrStdout(), args[0])
+		},
+	})
+}
+
+func hasShellAlias(c *cobra.Command) bool {
+	if c.Annotations[shellAliasKey] != "" {
+		return true
+	}
+	for _, sub := range c.Commands() {
+		if hasShellAlias(sub) {
+			return true
+		}
+	}
+	return false
+}
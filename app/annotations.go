@@ -0,0 +1,68 @@
+package app
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const specAnnotationsKey = "spec-annotations" // key of the annotations of the spec in the command state
+
+// setSpecAnnotations attaches a copy of the annotations of the spec to the
+// command: unlike the annotations of the cobra command, they do not include
+// the annotations added by the app or by bflags.
+func setSpecAnnotations(cmd *cobra.Command, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	bflags.AddToCmdCtx(cmd, specAnnotationsKey, copyAnnotations(annotations))
+}
+
+// AnnotationsFromCommand returns a copy of the annotations declared in the
+// spec of the given command - see Cmd.Annotations - or nil if it has none.
+// Middlewares and validators can switch behavior based on this declarative
+// metadata - e.g. for "read-only" or "mutating" commands - rather than on
+// hard-coded command paths.
+func AnnotationsFromCommand(cmd *cobra.Command) map[string]string {
+	v, ok := bflags.GetFromCmdCtx(cmd, specAnnotationsKey)
+	if !ok {
+		return nil
+	}
+	return copyAnnotations(v.(map[string]string))
+}
+
+// CategoryFromCommand returns the category of the given command declared in
+// its spec - see Cmd.Category and Cmd.GroupID - or an empty string.
+func CategoryFromCommand(cmd *cobra.Command) string {
+	if cmd == nil {
+		return ""
+	}
+	return cmd.Annotations[categoryKey]
+}
+
+// Annotations returns a copy of the annotations declared in the spec of the
+// command running with this context. See AnnotationsFromCommand.
+func (c *CmdCtx) Annotations() map[string]string {
+	return AnnotationsFromCommand(c.command())
+}
+
+// Annotation returns the annotation with the given key declared in the spec
+// of the command running with this context.
+func (c *CmdCtx) Annotation(key string) string {
+	v, _ := bflags.GetFromCmdCtx(c.command(), specAnnotationsKey)
+	m, _ := v.(map[string]string)
+	return m[key]
+}
+
+// Category returns the category declared in the spec of the command running
+// with this context. See CategoryFromCommand.
+func (c *CmdCtx) Category() string {
+	return CategoryFromCommand(c.command())
+}
+
+// command returns the command running with this context or nil.
+func (c *CmdCtx) command() *cobra.Command {
+	v, _ := c.Get(CtxCmd)
+	cmd, _ := v.(*cobra.Command)
+	return cmd
+}
@@ -4,25 +4,31 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 
 	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/ecobra-go/params/credentials"
 	"github.com/eluv-io/errors-go"
 )
 
 func SpecOf(cmd *cobra.Command) *spec {
-	f := cmd.Flags().Lookup(SpecKey)
-	if f == nil {
+	v, ok := bflags.GetFromCmdCtx(cmd, SpecKey)
+	if !ok {
 		return nil
 	}
-	s, ok := f.Value.(*spec)
+	s, ok := v.(*spec)
 	if !ok {
 		return nil
 	}
@@ -51,13 +57,16 @@ type Ctor func() interface{}
 type Runfn interface{}
 
 type Runtime struct {
-	cobraFns map[string]CobraFunction
-	inputs   map[string]Ctor
-	runFns   map[string]interface{}
+	cobraFns      map[string]CobraFunction
+	inputs        map[string]Ctor
+	runFns        map[string]interface{}
+	completions   map[string]CompletionFn
+	argValidators map[string]ValidatorCtor      // constructors of args validators referenced in specs
+	decodeHooks   []mapstructure.DecodeHookFunc // hooks decoding default values of inputs
 }
 
 func isRunFn(name string, fn interface{}) error {
-	e := errors.Template("rt function")
+	e := errors.Template("rt function", errors.K.Invalid, ErrInvalidSpec)
 	f := reflect.ValueOf(fn)
 	if f.Kind() != reflect.Func {
 		return e("reason", "not a function", "function", name)
@@ -95,7 +104,7 @@ func isRunFn(name string, fn interface{}) error {
 //     return) the returned value of the function is returned as the input.
 //   - otherwise input is returned unchanged
 func inputCtor(input interface{}) (interface{}, error) {
-	e := errors.Template("input ctor", errors.K.Invalid)
+	e := errors.Template("input ctor", errors.K.Invalid, ErrInvalidSpec)
 	fn := reflect.ValueOf(input)
 	if fn.Kind() != reflect.Func {
 		// not a function, return as is
@@ -148,7 +157,17 @@ const SpecKey = "$spec"
 
 type spec struct {
 	Categories []*CmdCategory `json:"categories"`
-	CmdRoot    *Cmd           `json:"cmd_root"`
+	// category of cobra's built-in help and completion commands: help is
+	// listed in the first category and completion in the default one if empty,
+	// both are omitted from categories if "-"
+	BuiltinCategory string `json:"builtin_category,omitempty"`
+	// default values of flags per profile - see App.WithProfiles
+	Profiles map[string]map[string]interface{} `json:"profiles,omitempty"`
+	// command templates that commands extend by name - see Cmd.Extends
+	CmdTemplates []*Cmd     `json:"cmd_templates,omitempty"`
+	CmdRoot      *Cmd       `json:"cmd_root"`
+	strMu        sync.Mutex // protects str
+	str          *string    // cached string representation
 }
 
 func NewSpec(categories []*CmdCategory, cmdRoot *Cmd) *spec {
@@ -159,31 +178,55 @@ func NewSpec(categories []*CmdCategory, cmdRoot *Cmd) *spec {
 }
 
 func (s *spec) setFor(cmd *cobra.Command) {
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   SpecKey,
-		Hidden: true,
-		Value:  s,
-	})
+	s.clearString()
+	bflags.AddToCmdCtx(cmd, SpecKey, s)
 }
 
-// spec implements flag.Value in order to be stored in a hidden flag
+// spec implements flag.Value
 var _ flag.Value = (*spec)(nil)
 
+// String returns the json representation of the spec. The representation is
+// computed once and cached: the cache is cleared when the cobra commands of an
+// app are built.
 func (s *spec) String() string {
+	s.strMu.Lock()
+	defer s.strMu.Unlock()
+	if s.str != nil {
+		return *s.str
+	}
 	buf := bytes.NewBuffer(make([]byte, 0))
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(false)
 	enc.SetIndent("", "  ")
 	err := enc.Encode(s)
 	if err != nil {
-		panic("Failed to marshal json: " + err.Error())
+		// don't cache errors
+		return "error marshaling spec: " + err.Error()
 	}
-	return string(buf.Bytes())
+	str := string(buf.Bytes())
+	s.str = &str
+	return str
+}
+
+func (s *spec) clearString() {
+	s.strMu.Lock()
+	defer s.strMu.Unlock()
+	s.str = nil
 }
 
-// Set is needed to satisfy the Value interface but is not intended to be called
-func (s *spec) Set(string) error {
-	return errors.E("spec.Set", errors.K.Invalid)
+// Set replaces the categories and commands of the spec with the ones of the
+// given json representation, as returned by String. Functions of commands are
+// referenced by name and resolved in the runtime when an app is created with
+// the spec.
+func (s *spec) Set(v string) error {
+	ns, err := readSpec(v)
+	if err != nil {
+		return errors.E("spec.Set", errors.K.Invalid, err)
+	}
+	s.Categories, s.BuiltinCategory, s.CmdTemplates, s.CmdRoot = ns.Categories, ns.BuiltinCategory, ns.CmdTemplates, ns.CmdRoot
+	s.Profiles = ns.Profiles
+	s.clearString()
+	return nil
 }
 
 func (s *spec) Type() string {
@@ -193,6 +236,10 @@ func (s *spec) Type() string {
 // ----- App -----
 
 type CobraFunction func(cmd *cobra.Command, args []string) error
+
+// CommandStart is invoked immediately before a command runs with the flags and
+// args set for the command, as returned by bflags.GetFlagArgSet. Use
+// bflags.GetFlagArgs(cmd) for typed values and set-state.
 type CommandStart func(cmd *cobra.Command, flagsAndArgs map[string]string, in interface{})
 type CommandEnd func(cmd *cobra.Command, out interface{}, err error)
 
@@ -200,16 +247,56 @@ type App struct {
 	spec          *spec
 	root          *cobra.Command
 	rt            *Runtime
-	customFlags   bflags.Flagger // flag support for specific types
-	flagsChecker  CobraFunction  // support for flags checking before command run
-	cmdStart      CommandStart   // cmdStart is invoked immediately before the command runs
-	cmdEnd        CommandEnd     // cmdEnd is invoked after the command ran
-	results       []*CmdResult   // monitored results
-	printResultFn PrintResultFn  // user provided func to print results (default is used if nil)
+	customFlags   bflags.Flagger          // flag support for specific types
+	flagsChecker  CobraFunction           // support for flags checking before command run
+	cmdStart      CommandStart            // cmdStart is invoked immediately before the command runs
+	cmdEnd        CommandEnd              // cmdEnd is invoked after the command ran
+	lifecycle     Lifecycle               // receives the lifecycle events of commands
+	results       []*CmdResult            // monitored results
+	resultsMu     sync.Mutex              // protects results
+	stopMonitor   func()                  // unregisters the exit handler printing monitored results
+	resultSink    ResultSink              // receives monitored results as they are added
+	resultsWriter io.Writer               // writer of the monitored results printed on exit
+	printResultFn PrintResultFn           // user provided func to print results (default is used if nil)
+	exampleVars   map[string]interface{}  // variables of example templates
+	errRenderer   *ErrorRenderer          // renders errors returned by Execute
+	matching      CommandMatching         // matching of command names in Execute
+	args          []string                // args of Execute - os.Args[1:] if nil
+	authorizer    Authorizer              // authorizes commands before they run
+	stateDir      string                  // directory of state persisted across processes
+	cacheDir      string                  // directory of cached data
+	dirFlags      bool                    // add the --state-dir and --cache-dir flags
+	configCmd     bool                    // enable the config file and add the built-in 'config' command
+	configFile    string                  // path of the config file
+	creds         credentials.Store       // store of credentials
+	authCmd       bool                    // enable credentials and add the built-in 'auth' command
+	login         LoginFunc               // returns the secret stored by 'auth login'
+	templates     bflags.Templates        // app-wide help and usage templates
+	flagOrder     bflags.FlagOrder        // order of flags and args in usages
+	envCmd        bool                    // add the built-in 'env' command
+	schemaCmd     bool                    // add the built-in 'schema' command
+	phaseTimer    PhaseTimer              // notified of the duration of the phases of commands
+	execStart     time.Time               // start of the current Execute
+	deps          *Deps                   // replaceable dependencies of commands
+	providers     map[string]Provider     // constructors of dependencies - see Provide
+	httpOpts      *HTTPOptions            // options of the HTTP client of commands
+	httpFlags     bool                    // add the persistent flags of the HTTP client
+	debugBindings bool                    // add the hidden --debug-bindings flag
+	copyInput     bool                    // run all commands with a copy of their input
+	categoryOpts  categoryOptions         // validation of the categories of commands
+	watchOpts     WatchOptions            // options of the watch mode of commands
+	scheduleOpts  ScheduleOptions         // options of the scheduled runs of commands
+	scheduleCmd   bool                    // add the built-in 'schedule' command
+	output        bool                    // print the output of commands
+	outputFormats map[string]OutputFormat // custom output formats
+	color         ColorPolicy             // color policy of help and output
+	profiles      bool                    // add the --profile flag
+	profileCmd    bool                    // add the built-in 'profile' command
+	cmdTracer     CmdTracer               // creates the spans of commands
 }
 
 func NewApp(spec *spec, rtSpec *Runtime) (*App, error) {
-	e := errors.Template("new app", errors.K.Invalid)
+	e := errors.Template("new app", errors.K.Invalid, ErrInvalidSpec)
 	if spec == nil {
 		return nil, e("reason", "nil spec")
 	}
@@ -223,11 +310,20 @@ func NewApp(spec *spec, rtSpec *Runtime) (*App, error) {
 	if spec.CmdRoot == nil {
 		return nil, e("reason", "no root command")
 	}
+	if err := spec.resolveExtends(); err != nil {
+		return nil, e(err)
+	}
 	a := &App{
 		spec: spec,
 		rt:   rtSpec,
 	}
-	a.spec.CmdRoot.app = a
+	a.spec.CmdRoot.setApp(a)
+	for _, t := range a.spec.CmdTemplates {
+		t.setApp(a)
+	}
+	if err := validateInputs(spec.CmdRoot); err != nil {
+		return nil, e(err)
+	}
 	return a, nil
 }
 
@@ -249,6 +345,41 @@ func (a *App) WithFlagsChecker(flagsChecker CobraFunction) *App {
 	return a
 }
 
+// WithExampleVars sets variables available to templates in examples of
+// commands, in addition to the default AppName, CmdPath, ConfigDir and Flags.
+// See bflags.RenderExample.
+func (a *App) WithExampleVars(vars map[string]interface{}) *App {
+	if a.exampleVars == nil {
+		a.exampleVars = make(map[string]interface{})
+	}
+	for k, v := range vars {
+		a.exampleVars[k] = v
+	}
+	return a
+}
+
+// WithErrorRenderer sets the renderer used by Execute to print errors returned
+// by commands. Errors of the root command are silenced in cobra when a
+// renderer is set.
+func (a *App) WithErrorRenderer(r *ErrorRenderer) *App {
+	a.errRenderer = r
+	return a
+}
+
+// WithTemplates sets app-wide help and usage templates. They override the
+// default templates of all commands, except those with templates in the spec.
+func (a *App) WithTemplates(t bflags.Templates) *App {
+	a.templates = t
+	return a
+}
+
+// WithFlagOrder sets the order of flags and args in the usage of all commands.
+// Flags are sorted by name and args listed by position by default.
+func (a *App) WithFlagOrder(order bflags.FlagOrder) *App {
+	a.flagOrder = order
+	return a
+}
+
 func readSpec(jspec string) (*spec, error) {
 	spec := &spec{}
 	if err := json.Unmarshal([]byte(jspec), spec); err != nil {
@@ -263,32 +394,143 @@ func (a *App) Spec() *spec {
 
 func (a *App) Cobra() (*cobra.Command, error) {
 	if a.root == nil {
+		start := time.Now()
+		if err := a.checkCategories(); err != nil {
+			return nil, err
+		}
+		a.registerTagCompletions()
 		r, err := a.spec.CmdRoot.ToCobra(nil, a.customFlags)
 		if err != nil {
 			return nil, err
 		}
+		if a.templates != (bflags.Templates{}) {
+			// templates of the root spec take precedence over app-wide ones
+			err = bflags.SetCmdTemplates(r, a.templates)
+			if err == nil && a.spec.CmdRoot.Templates != nil {
+				err = bflags.SetCmdTemplates(r, *a.spec.CmdRoot.Templates)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		bflags.SetFlagOrder(r, a.flagOrder)
 		a.spec.setFor(r)
 		a.root = r
+		a.setColor()
+		a.setExampleVars()
 		a.configureHelp()
+		a.addSchemaCmd()
+		a.addEnvCmd()
+		a.addAliasesCmd()
+		a.addScheduleCmd()
+		a.addConfigCmd()
+		a.addProfileCmd()
+		a.addAuthCmd()
+		if err = a.addOutputFlags(); err == nil {
+			err = a.addDirFlags()
+		}
+		if err == nil {
+			err = a.addHTTPFlags()
+		}
+		if err == nil {
+			err = a.addDebugBindingsFlag()
+		}
+		if err == nil {
+			err = a.addProfileFlag()
+		}
+		if err == nil {
+			// persistent flags added by the app may be shadowed as well
+			err = bflags.CheckShadowing(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if a.errRenderer != nil {
+			a.root.SilenceErrors = true
+		}
+		a.timePhase(PhaseBind, start)
 	}
 	return a.root, nil
 }
 
+// Execute executes the root command of the app and returns the error returned
+// by the command. The command line arguments are the ones set with SetArgs if
+// any, or the ones set on the root command with cobra or os.Args[1:] like for
+// cobra. Prefixes of command names or their case are resolved if enabled with
+// WithPrefixMatching or WithCaseInsensitive. If an ErrorRenderer was set, the
+// error is rendered to the error output of the root command.
+func (a *App) Execute() error {
+	root, err := a.Cobra()
+	if err != nil {
+		return err
+	}
+	a.execStart = time.Now()
+	defer func() { a.execStart = time.Time{} }()
+	if a.args != nil || !a.matching.IsZero() {
+		args := a.args
+		if args == nil {
+			args = os.Args[1:]
+		}
+		if !a.matching.IsZero() {
+			args, err = a.matching.Resolve(root, args)
+		}
+		if err == nil {
+			root.SetArgs(args)
+		}
+	}
+	if err == nil {
+		err = root.Execute()
+	}
+	if err != nil && a.errRenderer != nil {
+		a.errRenderer.Render(root.ErrOrStderr(), err)
+	}
+	return err
+}
+
+// NewCobra builds new cobra commands for the app, as Cobra does for the first
+// time. Inputs bound to the previous commands are restored to their values at
+// bind time - see bflags.ResetCommand - such that flags, args and appended
+// slices of previous executions don't leak into the new commands and one app
+// can be executed repeatedly, e.g. by a REPL, a server or tests.
 func (a *App) NewCobra() (*cobra.Command, error) {
+	if err := bflags.ResetCommand(a.root); err != nil {
+		return nil, err
+	}
+	bflags.ClearCmdState(a.root)
 	a.root = nil
 	return a.Cobra()
 }
 
-func (a *App) configureHelp() {
-	// configure categories and template functions
-	if len(a.spec.Categories) > 0 {
-		AddTemplateFunc("categories",
-			func(cmdRoot *cobra.Command) []*CmdCategory {
-				return NewCategories(a.spec.Categories, cmdRoot).GetCategories()
-			})
-	} else {
-		AddTemplateFunc("categories", func() string { return "" })
+// setExampleVars sets the variables of example templates to the root command:
+// ConfigDir defaults to the directory named after the app in the user config
+// directory.
+func (a *App) setExampleVars() {
+	vars := make(map[string]interface{})
+	if dir, err := os.UserConfigDir(); err == nil {
+		vars["ConfigDir"] = filepath.Join(dir, a.root.Name())
 	}
+	for k, v := range a.exampleVars {
+		vars[k] = v
+	}
+	bflags.SetExampleVars(a.root, vars)
+}
+
+func (a *App) configureHelp() {
+	// configure categories and template functions: template functions are
+	// global, hence categories are retrieved from the spec of the root command
+	AddTemplateFunc("categories",
+		func(cmdRoot *cobra.Command) []*CmdCategory {
+			s := SpecOf(cmdRoot.Root())
+			if s == nil || len(s.Categories) == 0 {
+				return nil
+			}
+			return newCategoriesBuilder().
+				with(s.Categories).
+				withBuiltin(s.BuiltinCategory).
+				fillWith(cmdRoot.Commands()).
+				build()
+		})
+	AddTemplateFunc("heading", heading)
 	bflags.ConfigureHelpFuncs()
 
 	// configure help
@@ -300,8 +542,9 @@ func (a *App) Command(path ...string) (*Cmd, error) {
 	if len(path) == 0 {
 		return a.spec.CmdRoot, nil
 	}
-	if path[0] != a.spec.CmdRoot.Name() {
-		return nil, e(errors.K.NotExist)
+	root := a.spec.CmdRoot.Name()
+	if path[0] != root && !(a.matching.CaseInsensitive && strings.EqualFold(path[0], root)) {
+		return nil, e(errors.K.NotExist, ErrCommandNotFound)
 	}
 	if len(path) == 1 {
 		return a.spec.CmdRoot, nil
@@ -322,28 +565,26 @@ func (a *App) onExit() {
 }
 
 func (a *App) getResults() []*CmdResult {
-	return a.results
-}
-
-func (a *App) printResults(reason string) {
-	if a.printResultFn != nil {
-		a.printResultFn(a.results)
-		return
-	}
-	if len(a.results) == 0 {
-		return
-	}
-	fmt.Println("\n" + reason + " - intermediary results") // avoid ^Cxx stick in front of result
-	for _, r := range a.results {
-		fmt.Println(r.String())
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	if a.results == nil {
+		return nil
 	}
-	fmt.Println()
+	return append([]*CmdResult{}, a.results...)
 }
 
+// SetMonitorResults enables the monitoring of the intermediate results of
+// commands if b is true: results added with the AddResultFn of the command
+// context are printed on exit signals and flushed to the result sink as they
+// arrive - see WithResultSink.
 func (a *App) SetMonitorResults(b bool) {
+	if a.stopMonitor != nil {
+		a.stopMonitor()
+		a.stopMonitor = nil
+	}
 	if b {
 		a.results = make([]*CmdResult, 0)
-		registerSignalHandler(a.onExit, false)
+		a.stopMonitor = registerSignalHandler(a.onExit, false)
 	} else {
 		a.results = nil
 	}
@@ -360,30 +601,221 @@ func (a *App) retrieveContext(cmd *cobra.Command) *CmdCtx {
 	return ctx
 }
 
+// Completer may be implemented by the input of a command in order to fill
+// derived fields once the command line was parsed.
+type Completer interface {
+	Complete(ctx *CmdCtx) error
+}
+
+// setupInput runs the lifecycle functions of the input of a command. Once flags
+// and args are set to the input, the following functions are called in order if
+// the input implements them:
+//   - Normalize() error: mutate or canonicalize fields
+//   - Complete(ctx *CmdCtx) error: fill derived fields
+//   - Validate() error: validate the input
+//
+// The run function of the command is called after.
+func (a *App) setupInput(ctx *CmdCtx, in interface{}) error {
+	err := bflags.Normalize(in)
+	if err != nil {
+		return err
+	}
+	if c, ok := in.(Completer); ok {
+		err = c.Complete(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return bflags.Validate(in)
+}
+
+// commandFailed returns the template of the errors of the given command.
+func commandFailed(cmd *cobra.Command, args []string) errors.TemplateFn {
+	return errors.Template("command failed", errors.K.Invalid, "cmd", cmd.Name(),
+		"args", "["+strings.Join(args, ",")+"]")
+}
+
+// withInvocation adds the invocation of the given command as run to err, for
+// bug reports.
+func withInvocation(cmd *cobra.Command, err error) error {
+	if ee, ok := err.(*errors.Error); ok {
+		return ee.With("path", cmd.CommandPath(), "invocation", bflags.CmdLine(cmd))
+	}
+	return err
+}
+
+// setupDeps sets the dependencies of the app to the context of the given
+// command: deps, HTTP client, directories, active profile, credentials,
+// providers and result functions.
+func (a *App) setupDeps(cmd *cobra.Command, ctx *CmdCtx) error {
+	a.deps.set(ctx)
+	if err := a.setHTTPClient(ctx); err != nil {
+		return err
+	}
+	a.setDirs(ctx)
+	a.setProfile(ctx)
+	a.setCredentials(ctx)
+	a.setProviders(ctx)
+	if a.results != nil {
+		// if result monitoring is enabled make sure the add result function
+		// is on the cmdCtx
+		ctx.Set(CtxAddResultFn, a.addResultFn(cmd))
+		ctx.Set(CtxPrintResultFn, a.printResults)
+		ctx.Set(CtxGetResultFn, a.getResults)
+	}
+	return nil
+}
+
+// ctxPrepared is the key of the command prepared by its pre-run function in
+// the context of the command.
+const ctxPrepared = "prepared-cmd"
+
+// preparedCmd is a command whose context is set up and whose input is bound -
+// see prepare.
+type preparedCmd struct {
+	cmd     *cobra.Command
+	ctx     *CmdCtx
+	in      interface{}
+	endSpan func(err error)
+}
+
+// prepare sets up the context of the given command and binds its flags and
+// args to its input, once the config, the active profile and the credentials
+// are applied. The command is then authorized if the app has an authorizer.
+// The span of the command is ended if an error is returned.
+func (a *App) prepare(cmd *cobra.Command, args []string) (p *preparedCmd, err error) {
+	e := commandFailed(cmd, args)
+	ctx := a.retrieveContext(cmd)
+	ctx.Set(CtxCmd, cmd)
+	bridgeContext(cmd, ctx)
+	endSpan := a.startSpan(cmd, ctx)
+	defer func() {
+		if err != nil {
+			endSpan(err)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			err = e("cause", r)
+		}
+	}()
+	if err = checkDeprecation(cmd); err != nil {
+		return nil, e(err)
+	}
+	if err = a.setupDeps(cmd, ctx); err != nil {
+		return nil, e(err)
+	}
+	if err = a.applyConfig(cmd); err == nil {
+		err = a.applyProfile(cmd)
+	}
+	if err == nil {
+		err = a.applyCredentials(cmd)
+	}
+	if err != nil {
+		return nil, e(err)
+	}
+	bindStart := time.Now()
+	m, err := bflags.SetArgs(cmd, args)
+	if err != nil {
+		return nil, e(err, "reason", "error retrieving flag, arg or input")
+	}
+	a.printBindings(cmd, time.Since(bindStart))
+	m, err = copyInput(cmd, m)
+	if err != nil {
+		return nil, e(err, "reason", "error copying input")
+	}
+	if a.authorizer != nil {
+		ctx.Set(CtxRoles, RequiredRoles(cmd))
+		err = a.authorizer(ctx, cmd.CommandPath(), m)
+		if err != nil {
+			return nil, e(errors.K.Permission, err, "reason", "not authorized")
+		}
+	}
+	return &preparedCmd{cmd: cmd, ctx: ctx, in: m, endSpan: endSpan}, nil
+}
+
+// takePrepared returns the given command as prepared by its pre-run function
+// - see authorizeFirst - or prepares it.
+func (a *App) takePrepared(cmd *cobra.Command, args []string) (*preparedCmd, error) {
+	ctx := a.retrieveContext(cmd)
+	if v, _ := ctx.Get(ctxPrepared); v != nil {
+		ctx.Set(ctxPrepared, nil)
+		if p, ok := v.(*preparedCmd); ok && p.cmd == cmd {
+			return p, nil
+		}
+	}
+	return a.prepare(cmd, args)
+}
+
+// authorizeFirst returns the persistent pre-run function of the runnable
+// command c of an app with an authorizer: c is prepared and authorized before
+// the pre-run functions run, such that they don't run for unauthorized
+// callers. The pre-run functions are the given persistent pre-run function -
+// or the one of the closest parent if nil, as with cobra - followed by the
+// given pre-run function of c.
+func (a *App) authorizeFirst(c *cobra.Command, persistentPre, pre CobraFunction) CobraFunction {
+	return func(cmd *cobra.Command, args []string) (err error) {
+		if cmd != c {
+			// c is the closest parent with a persistent pre-run function
+			return runPersistentPreRun(c, persistentPre, cmd, args)
+		}
+		setupCmdCtx(cmd)
+		p, err := a.prepare(cmd, args)
+		if err != nil {
+			return withInvocation(cmd, err)
+		}
+		p.ctx.Set(ctxPrepared, p)
+		defer func() {
+			if err != nil {
+				p.ctx.Set(ctxPrepared, nil)
+				p.endSpan(err)
+			}
+		}()
+		err = runPersistentPreRun(c, persistentPre, cmd, args)
+		if err == nil && pre != nil {
+			err = pre(cmd, args)
+		}
+		return err
+	}
+}
+
+// runPersistentPreRun runs the given persistent pre-run function of c for cmd,
+// or the one of the closest parent of c if nil.
+func runPersistentPreRun(c *cobra.Command, persistentPre CobraFunction, cmd *cobra.Command, args []string) error {
+	if persistentPre != nil {
+		return persistentPre(cmd, args)
+	}
+	for p := c.Parent(); p != nil; p = p.Parent() {
+		if p.PersistentPreRunE != nil {
+			return p.PersistentPreRunE(cmd, args)
+		}
+		if p.PersistentPreRun != nil {
+			p.PersistentPreRun(cmd, args)
+			return nil
+		}
+	}
+	return nil
+}
+
 func (a *App) runStub(fn interface{}, name string) CobraFunction {
 
 	return func(cmd *cobra.Command, args []string) (err error) {
-		e := errors.Template("command failed", errors.K.Invalid, "cmd", cmd.Name(),
-			"args", "["+strings.Join(args, ",")+"]")
+		e := commandFailed(cmd, args)
+		defer func() { err = withInvocation(cmd, err) }()
+		p, err := a.takePrepared(cmd, args)
+		if err != nil {
+			return err
+		}
+		ctx, m := p.ctx, p.in
+		defer func() { p.endSpan(err) }()
 		defer func() {
 			if r := recover(); r != nil {
 				err = e("cause", r)
 			}
 		}()
-		ctx := a.retrieveContext(cmd)
-		if a.results != nil {
-			// if result monitoring is enabled make sure the add result function
-			// is on the cmdCtx
-			var arfn AddResultFn = func(key string, out interface{}, err error) {
-				a.results = append(a.results, newCommandResult(key, out, err))
-			}
-			ctx.Set(CtxAddResultFn, arfn)
-			ctx.Set(CtxPrintResultFn, a.printResults)
-			ctx.Set(CtxGetResultFn, a.getResults)
-		}
-		m, err := bflags.SetArgs(cmd, args)
+		err = a.setupInput(ctx, m)
 		if err != nil {
-			return e(err, "reason", "error retrieving flag, arg or input")
+			return e(err, "reason", "invalid input")
 		}
 		if a.flagsChecker != nil {
 			err = a.flagsChecker(cmd, args)
@@ -402,41 +834,104 @@ func (a *App) runStub(fn interface{}, name string) CobraFunction {
 		if err := isRunFn(name, fn); err != nil {
 			return e(err)
 		}
+		if err = a.checkRateLimit(cmd); err != nil {
+			return e(errors.K.Unavailable, err)
+		}
 		if a.cmdStart != nil {
 			a.cmdStart(cmd, bflags.GetFlagArgSet(cmd), m)
 		}
+		ev := a.startEvent(ctx, cmd, m, true)
 
-		res, err := a.callFn(name, f, ctx, m)
+		inputs, keys, err := fanOutInputs(cmd, m)
 		if err != nil {
-			// definition of function to call is invalid or panic'ed
 			return e(err)
 		}
 
-		// now, unwrap result of function call
-		outCount := len(res)
-		if outCount < 1 || outCount > 2 {
-			return e("reason", "expected 1 or 2 returned values",
-				"returned values", outCount)
-		}
-		var out interface{}
-		last := 0
-		if outCount == 2 {
-			out = res[0].Interface()
-			last = 1
+		a.timePhase(PhaseParse, a.execStart)
+		run := func() (interface{}, error, error) {
+			if inputs != nil {
+				return a.runFanOut(cmd, name, f, ctx, m, inputs, keys)
+			}
+			sp := a.newStreamPrinter(cmd)
+			ctx.Set(CtxEmitFn, EmitFn(sp.print))
+			out, err, invalid := a.callRunFn(name, f, ctx, m)
+			if err == nil && invalid == nil {
+				out, err = sp.streamChannel(out)
+			}
+			return out, err, invalid
 		}
-		if r, ok := res[last].Interface().(error); ok && !reflect.ValueOf(r).IsNil() {
-			err = r
+		// finish ends the run started with the given event: the end hook is
+		// called and the output printed
+		finish := func(ev *CommandEvent, out interface{}, err error) error {
+			if a.cmdEnd != nil {
+				defer a.cmdEnd(cmd, out, err)
+			}
+			a.endEvent(ev, out, err)
+			if err != nil {
+				return e(err)
+			}
+			ctx.Set(CtxResult, out)
+			return a.printOutput(cmd, out)
 		}
-		if a.cmdEnd != nil {
-			defer a.cmdEnd(cmd, out, err)
+		out, err, invalid := a.timeRun(run)
+		if invalid != nil {
+			return e(invalid)
 		}
-		if err != nil {
-			return e(err)
+		err = finish(ev, out, err)
+		if !isWatching(cmd) {
+			return err
 		}
-		ctx.Set(CtxResult, out)
-		return nil
+		return a.watch(cmd, err, func() (error, error) {
+			ev := a.startEvent(ctx, cmd, m, true)
+			out, err, invalid := a.timeRun(run)
+			if invalid != nil {
+				return nil, e(invalid)
+			}
+			return finish(ev, out, err), nil
+		})
+	}
+
+}
+
+// callRunFn calls the run function with the given context and input and
+// returns its output and error. invalid is not nil if the function could not
+// be called or does not return the expected values.
+func (a *App) callRunFn(name string, f reflect.Value, ctx *CmdCtx, in interface{}) (out interface{}, err error, invalid error) {
+	res, err := a.callFn(name, f, ctx, in)
+	if err != nil {
+		// definition of function to call is invalid or panic'ed
+		return nil, nil, err
+	}
+
+	// now, unwrap result of function call
+	outCount := len(res)
+	if outCount < 1 || outCount > 2 {
+		return nil, nil, errors.E("callRunFn", errors.K.Invalid,
+			"reason", "expected 1 or 2 returned values",
+			"returned values", outCount)
 	}
+	out, err = fnResult(res)
+	return out, err, nil
+}
 
+// timeRun calls the given run function and times the run phase.
+func (a *App) timeRun(run func() (interface{}, error, error)) (interface{}, error, error) {
+	start := time.Now()
+	defer a.timePhase(PhaseRun, start)
+	return run()
+}
+
+// fnResult returns the output and the error returned by a run function.
+func fnResult(res []reflect.Value) (out interface{}, err error) {
+	last := 0
+	if len(res) == 2 {
+		out = res[0].Interface()
+		last = 1
+	}
+	if r, ok := res[last].Interface().(error); ok && !reflect.ValueOf(r).IsNil() {
+		err = r
+	}
+	return out, err
 }
 
 func (a *App) callFn(name string, fn reflect.Value, params ...interface{}) (v []reflect.Value, err error) {
@@ -563,6 +1058,7 @@ func (m *mstring) UnmarshalJSON(data []byte) error {
 	err := json.Unmarshal(data, s)
 	if err == nil {
 		*m = mstring(*s)
+		return nil
 	}
 	sb := make([]string, 0)
 	err = json.Unmarshal(data, &sb)
@@ -585,38 +1081,56 @@ func (m *mstring) MarshalJSON() ([]byte, error) {
 type CmdInput interface{}
 type Cmd struct {
 	app                        *App
-	Use                        string            `json:"use"`
-	Aliases                    []string          `json:"aliases,omitempty"`
-	SuggestFor                 []string          `json:"suggest_for,omitempty"`
-	Short                      string            `json:"short"`
-	Long                       mstring           `json:"long"`
-	Category                   string            `json:"category"`
-	Example                    mstring           `json:"example"`
-	ValidArgs                  []string          `json:"valid_args,omitempty"`
-	Args                       string            `json:"args,omitempty"`
-	ArgsValidator              ValidatorCtor     `json:"-"` // additional validator
-	ArgAliases                 []string          `json:"arg_aliases,omitempty"`
-	BashCompletionFunction     string            `json:"bash_completion_function,omitempty"`
-	Deprecated                 string            `json:"deprecated,omitempty"`
-	Hidden                     bool              `json:"hidden,omitempty"`
-	Annotations                map[string]string `json:"annotations,omitempty"`
-	Version                    string            `json:"version,omitempty"`
-	PersistentPreRunE          CobraFunc         `json:"persistent_pre_run_e,omitempty"`
-	PreRunE                    CobraFunc         `json:"pre_run_e,omitempty"`
-	RunE                       RunFunc           `json:"run_e"`
-	PostRunE                   CobraFunc         `json:"post_run_e,omitempty"`
-	PersistentPostRunE         CobraFunc         `json:"persistent_post_run_e,omitempty"`
-	SilenceErrors              bool              `json:"silence_errors,omitempty"`
-	SilenceUsage               bool              `json:"silence_usage,omitempty"`
-	DisableFlagParsing         bool              `json:"disable_flag_parsing,omitempty"`
-	DisableAutoGenTag          bool              `json:"disable_auto_gen_tag,omitempty"`
-	DisableFlagsInUseLine      bool              `json:"disable_flags_in_use_line,omitempty"`
-	DisableSuggestions         bool              `json:"disable_suggestions,omitempty"`
-	SuggestionsMinimumDistance int               `json:"suggestions_minimum_distance,omitempty"`
-	TraverseChildren           bool              `json:"traverse_children,omitempty"`
-	InputCtor                  string            `json:"input_ctor"`             // name of input in app's map
-	Input                      CmdInput          `json:"input,omitempty"`        // json of input or input object
-	SubCommands                []*Cmd            `json:"sub_commands,omitempty"` // sub commands
+	Use                        string             `json:"use"`
+	Extends                    string             `json:"extends,omitempty"` // name of the command template the command inherits from
+	Aliases                    []string           `json:"aliases,omitempty"`
+	HiddenAliases              []string           `json:"hidden_aliases,omitempty"` // aliases not shown in help
+	SuggestFor                 []string           `json:"suggest_for,omitempty"`
+	Short                      string             `json:"short"`
+	Long                       mstring            `json:"long"`
+	Category                   string             `json:"category"`
+	GroupID                    string             `json:"group_id,omitempty"` // cobra's group: alternative to Category
+	Topic                      bool               `json:"topic,omitempty"`    // true for help topics: Long is the content of the topic
+	Example                    mstring            `json:"example"`
+	SeeAlso                    []string           `json:"see_also,omitempty"` // paths of related commands
+	Roles                      []string           `json:"roles,omitempty"`    // roles required to run the command and its sub-commands
+	RateLimit                  *RateLimit         `json:"rate_limit,omitempty"`
+	Templates                  *bflags.Templates  `json:"templates,omitempty"`   // help and usage templates of the command and its sub-commands
+	ShellAlias                 string             `json:"shell_alias,omitempty"` // name of the shell function generated for the command by GenAliases
+	FanOut                     *FanOut            `json:"fan_out,omitempty"`     // run the command once per value of its variadic last arg
+	Watch                      bool               `json:"watch,omitempty"`       // add the --watch flag re-running the command when its input files change
+	CopyInput                  bool               `json:"copy_input,omitempty"`  // run with a deep copy of the bound input, isolating invocations
+	ValidArgs                  []string           `json:"valid_args,omitempty"`
+	ValidArgsFunction          CompletionFunc     `json:"valid_args_function,omitempty"`
+	Args                       string             `json:"args,omitempty"`
+	ArgsValidator              ValidatorCtor      `json:"-"`                        // additional validator
+	ArgsValidatorName          string             `json:"args_validator,omitempty"` // name of a validator registered in the runtime: alternative to ArgsValidator
+	ArgAliases                 []string           `json:"arg_aliases,omitempty"`
+	BashCompletionFunction     string             `json:"bash_completion_function,omitempty"`
+	Deprecated                 string             `json:"deprecated,omitempty"`
+	Deprecation                *Deprecation       `json:"deprecation,omitempty"` // deprecation timeline: takes precedence over Deprecated
+	Hidden                     bool               `json:"hidden,omitempty"`
+	Annotations                map[string]string  `json:"annotations,omitempty"`
+	Version                    string             `json:"version,omitempty"`
+	PersistentPreRunE          CobraFunc          `json:"persistent_pre_run_e,omitempty"`
+	PreRunE                    CobraFunc          `json:"pre_run_e,omitempty"`
+	RunE                       RunFunc            `json:"run_e"`
+	PostRunE                   CobraFunc          `json:"post_run_e,omitempty"`
+	PersistentPostRunE         CobraFunc          `json:"persistent_post_run_e,omitempty"`
+	SilenceErrors              bool               `json:"silence_errors,omitempty"`
+	SilenceUsage               bool               `json:"silence_usage,omitempty"`
+	DisableFlagParsing         bool               `json:"disable_flag_parsing,omitempty"`
+	DisableAutoGenTag          bool               `json:"disable_auto_gen_tag,omitempty"`
+	DisableFlagsInUseLine      bool               `json:"disable_flags_in_use_line,omitempty"`
+	DisableSuggestions         bool               `json:"disable_suggestions,omitempty"`
+	SuggestionsMinimumDistance int                `json:"suggestions_minimum_distance,omitempty"`
+	TraverseChildren           bool               `json:"traverse_children,omitempty"`
+	CompletionOptions          *CompletionOptions `json:"completion_options,omitempty"` // root command only
+	FlagCompletions            map[string]string  `json:"flag_completions,omitempty"`   // flag name -> name of completion function
+	ArgCompletions             map[string]string  `json:"arg_completions,omitempty"`    // arg name -> name of completion function
+	InputCtor                  string             `json:"input_ctor"`                   // name of input in app's map
+	Input                      CmdInput           `json:"input,omitempty"`              // json of input or input object
+	SubCommands                []*Cmd             `json:"sub_commands,omitempty"`       // sub commands
 }
 
 func (c *Cmd) Name() string {
@@ -628,6 +1142,11 @@ func (c *Cmd) Name() string {
 	return name
 }
 
+// UpdateExamples replaces the examples of the command and its sub-commands with
+// the result of upd.
+//
+// Deprecated: examples are templates rendered when help is displayed, with
+// variables like {{.AppName}} or {{.ConfigDir}}. See App.WithExampleVars.
 func (c *Cmd) UpdateExamples(upd func(s string) string) {
 	if upd == nil {
 		return
@@ -639,19 +1158,23 @@ func (c *Cmd) UpdateExamples(upd func(s string) string) {
 }
 
 func (c *Cmd) Sub(path []string) (*Cmd, error) {
+	return c.sub(path, c.app != nil && c.app.matching.CaseInsensitive)
+}
+
+func (c *Cmd) sub(path []string, fold bool) (*Cmd, error) {
 	e := errors.Template("Sub", errors.K.Invalid, "path", strings.Join(path, ","))
 	if len(path) == 0 {
 		return nil, e("reason", "empty path")
 	}
 	for _, sub := range c.SubCommands {
-		if path[0] == sub.Name() {
+		if path[0] == sub.Name() || (fold && strings.EqualFold(path[0], sub.Name())) {
 			if len(path) == 1 {
 				return sub, nil
 			}
-			return sub.Sub(path[1:])
+			return sub.sub(path[1:], fold)
 		}
 	}
-	return nil, e(errors.K.NotExist)
+	return nil, e(errors.K.NotExist, ErrCommandNotFound)
 }
 
 func (c *Cmd) cobraFn(cf CobraFunc) CobraFunction {
@@ -668,6 +1191,27 @@ func (c *Cmd) cobraFn(cf CobraFunc) CobraFunction {
 	return fn
 }
 
+// setupCmdCtx sets the context of the root command - or a new context - to the
+// given command and to the root.
+func setupCmdCtx(cmd *cobra.Command) {
+	root := cmd.Root()
+	var ctx *CmdCtx
+	c, ok := bflags.GetCmdCtx(root)
+	if ok {
+		ctx, _ = c.(*CmdCtx)
+	}
+	if ctx == nil {
+		ctx = NewCmdCtx()
+	}
+	ctx.Set(CtxCmd, cmd)
+	bflags.SetCmdCtx(cmd, ctx)
+	bridgeContext(cmd, ctx)
+	if cmd != root && !ok {
+		// also set it on root
+		bflags.SetCmdCtx(root, ctx)
+	}
+}
+
 func (c *Cmd) persistentPreRunE(parent *cobra.Command, cf CobraFunc) CobraFunction {
 	res := c.cobraFn(cf)
 	if parent == nil {
@@ -675,20 +1219,12 @@ func (c *Cmd) persistentPreRunE(parent *cobra.Command, cf CobraFunc) CobraFuncti
 		f := func(cmd *cobra.Command, args []string) error {
 			// the context might have been set on root
 			root := cmd.Root()
-			var ctx *CmdCtx
-			c, ok := bflags.GetCmdCtx(root)
-			if ok {
-				ctx, _ = c.(*CmdCtx)
-			}
-			if ctx == nil {
-				ctx = NewCmdCtx()
-			}
-			ctx.Set(CtxCmd, cmd)
-			bflags.SetCmdCtx(cmd, ctx)
-			if cmd != root && !ok {
-				// also set it on root
-				bflags.SetCmdCtx(root, ctx)
+			if cmd.Name() == cobra.ShellCompRequestCmd {
+				// completions are registered only when requested since cobra
+				// keeps them for the lifetime of the program
+				bflags.RegisterCompletions(root)
 			}
+			setupCmdCtx(cmd)
 			if res == nil {
 				return nil
 			}
@@ -700,116 +1236,106 @@ func (c *Cmd) persistentPreRunE(parent *cobra.Command, cf CobraFunc) CobraFuncti
 }
 
 func (c *Cmd) runFn(fn RunFunc) (CobraFunction, error) {
-	f := fn.fn
-	if f == nil {
-		if fn.name == "" {
-			return nil, nil
-		}
-		ok := false
-		f, ok = c.app.rt.runFns[fn.name]
-		if !ok {
-			return nil, errors.E("runFn", errors.K.NotExist, "function", fn.name)
-		}
+	name, f, err := c.runFunction(fn)
+	if err != nil || f == nil {
+		return nil, err
 	}
-	return c.app.runStub(f, fn.name), nil
+	return c.app.runStub(f, name), nil
 }
 
-func (c *Cmd) decodeInput() (interface{}, error) {
-	e := errors.Template("make input")
-	if c.InputCtor == "" {
-		return inputCtor(c.Input)
+// runFunction returns the name and the function of the given run function,
+// looked up in the runtime if necessary, or a nil function if fn is nil.
+func (c *Cmd) runFunction(fn RunFunc) (string, interface{}, error) {
+	if fn.fn != nil {
+		return fn.name, fn.fn, nil
 	}
-	ctor, ok := c.app.rt.inputs[c.InputCtor]
+	if fn.name == "" {
+		return "", nil, nil
+	}
+	f, ok := c.app.rt.runFns[fn.name]
 	if !ok {
-		return nil, e(errors.K.NotExist, "reason", "input not found", "input", c.InputCtor)
+		return "", nil, errors.E("runFn", errors.K.NotExist, ErrFunctionNotFound, "function", fn.name)
 	}
-	in := ctor()
-	if c.Input != nil {
+	return fn.name, f, nil
+}
 
-		cfg := &mapstructure.DecoderConfig{
-			TagName: "json",
-			Result:  in,
-		}
-		decoder, err := mapstructure.NewDecoder(cfg)
-		if err != nil {
-			return nil, err
-		}
-		err = decoder.Decode(c.Input)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return in, nil
+func (c *Cmd) decodeInput() (interface{}, error) {
+	in, unused, err := c.decodeInputKeys()
+	if err == nil && len(unused) > 0 {
+		err = errors.E("make input", errors.K.Invalid, ErrInvalidSpec,
+			"reason", "unknown input keys",
+			"input", c.InputCtor,
+			"keys", strings.Join(unused, ", "))
+	}
+	return in, err
 }
 
-func parsePositional(s string) (string, int, int, error) {
-	e := errors.Template("parse positional", "args", s)
-	if s == "" {
-		return "", 0, 0, nil
-	}
-	s = strings.Trim(s, " ")
-	ndx := strings.Index(s, "(")
-	if ndx < 0 {
-		return s, 0, 0, nil
-	}
-	edx := strings.Index(s, ")")
-	if edx < 0 {
-		return "", 0, 0, e("reason", "unclosed (")
+// decodeInputKeys makes the input of the command and returns the keys of the
+// default values of the spec that don't match any field of the input.
+func (c *Cmd) decodeInputKeys() (interface{}, []string, error) {
+	e := errors.Template("make input")
+	if c.InputCtor == "" {
+		in, err := inputCtor(c.Input)
+		return in, nil, err
 	}
-	name := s[0:ndx]
-	val := s[ndx+1 : edx]
-	cx := strings.Index(val, ",")
-	if cx < 0 {
-		n, err := strconv.Atoi(val)
-		if err != nil {
-			return "", 0, 0, e(err, "converting val", val)
-		}
-		return name, n, 0, nil
+	ctor, ok := c.app.rt.inputs[c.InputCtor]
+	if !ok {
+		return nil, nil, e(errors.K.NotExist, ErrFunctionNotFound, "reason", "input not found", "input", c.InputCtor)
 	}
-	n, err := strconv.Atoi(val[:cx])
+	in := ctor()
+	if c.Input == nil {
+		return in, nil, nil
+	}
+	md := &mapstructure.Metadata{}
+	cfg := &mapstructure.DecoderConfig{
+		DecodeHook: c.app.rt.decodeHook(),
+		Metadata:   md,
+		Squash:     true, // flatten embedded structs like encoding/json
+		TagName:    "json",
+		Result:     in,
+	}
+	decoder, err := mapstructure.NewDecoder(cfg)
 	if err != nil {
-		return "", 0, 0, e(err, "converting val", val[:cx])
+		return nil, nil, err
 	}
-	m, err := strconv.Atoi(strings.TrimSpace(val[cx+1:]))
+	err = decoder.Decode(c.Input)
 	if err != nil {
-		return "", 0, 0, e(err, "converting val", val[cx+1:])
+		return nil, nil, err
 	}
-	return name, n, m, nil
+	sort.Strings(md.Unused)
+	return in, md.Unused, nil
 }
 
 func (c *Cmd) ToCobra(parent *cobra.Command, f bflags.Flagger) (*cobra.Command, error) {
 
 	e := errors.Template("to_cobra")
-	var positional cobra.PositionalArgs
-	pos, n, m, err := parsePositional(c.Args)
+	positional, err := parsePositional(c.Args, c.app.rt.argValidators)
 	if err != nil {
 		return nil, e(err)
 	}
-	switch pos {
-	case "NoArgs":
-		positional = cobra.NoArgs
-	case "OnlyValidArgs":
-		positional = cobra.OnlyValidArgs
-	case "ArbitraryArgs":
-		positional = cobra.ArbitraryArgs
-	case "MinimumNArgs":
-		positional = cobra.MinimumNArgs(n)
-	case "MaximumNArgs":
-		positional = cobra.MaximumNArgs(n)
-	case "ExactArgs":
-		positional = cobra.ExactArgs(n)
-	case "RangeArgs":
-		positional = cobra.RangeArgs(n, m)
-	case "":
-	default:
-		return nil, e("reason", "unknown positional function",
-			"positional function", pos)
+	if c.Topic && (!c.RunE.IsNil() || len(c.SubCommands) > 0) {
+		return nil, e(errors.K.Invalid, ErrInvalidSpec, "reason", "help topic with run function or sub commands",
+			"topic", c.Name())
+	}
+	category := c.Category
+	if category == "" {
+		category = c.GroupID
+	} else if c.GroupID != "" && c.GroupID != c.Category {
+		return nil, e(errors.K.Invalid, ErrInvalidSpec, "reason", "category and group id differ",
+			"category", c.Category,
+			"group_id", c.GroupID)
 	}
 	runE, err := c.runFn(c.RunE)
 	if err != nil {
 		return nil, e(err)
 	}
 
+	deprecated := c.Deprecated
+	if c.Deprecation != nil {
+		// the deprecation is checked and reported by the app
+		deprecated = ""
+	}
+
 	cmd := &cobra.Command{
 		Use:                        c.Use,
 		Aliases:                    c.Aliases,
@@ -819,11 +1345,10 @@ func (c *Cmd) ToCobra(parent *cobra.Command, f bflags.Flagger) (*cobra.Command,
 		Example:                    string(c.Example),
 		ValidArgs:                  c.ValidArgs,
 		ArgAliases:                 c.ArgAliases,
-		Args:                       positional,
 		BashCompletionFunction:     c.BashCompletionFunction,
-		Deprecated:                 c.Deprecated,
+		Deprecated:                 deprecated,
 		Hidden:                     c.Hidden,
-		Annotations:                c.Annotations,
+		Annotations:                copyAnnotations(c.Annotations),
 		Version:                    c.Version,
 		PersistentPreRunE:          c.persistentPreRunE(parent, c.PersistentPreRunE),
 		PreRunE:                    c.cobraFn(c.PreRunE),
@@ -839,8 +1364,50 @@ func (c *Cmd) ToCobra(parent *cobra.Command, f bflags.Flagger) (*cobra.Command,
 		SuggestionsMinimumDistance: c.SuggestionsMinimumDistance,
 		TraverseChildren:           c.TraverseChildren,
 	}
-	if c.Category != "" {
-		annotateCmdCategory(cmd, c.Category)
+	if positional != nil {
+		cmd.Args = positional(cmd)
+	}
+	if runE != nil && c.app.authorizer != nil {
+		cmd.PersistentPreRunE = c.app.authorizeFirst(cmd, cmd.PersistentPreRunE, cmd.PreRunE)
+		cmd.PreRunE = nil
+	}
+	if category != "" {
+		annotateCmdCategory(cmd, category)
+	}
+	setSpecAnnotations(cmd, c.Annotations)
+	if c.CompletionOptions != nil {
+		cmd.CompletionOptions = c.CompletionOptions.cobra()
+	}
+	bflags.SetHiddenAliases(cmd, c.HiddenAliases...)
+	bflags.SetSeeAlso(cmd, c.SeeAlso...)
+	setRoles(cmd, c.Roles)
+	if err = setShellAlias(cmd, c.ShellAlias); err != nil {
+		return nil, e(err)
+	}
+	if err = setFanOut(cmd, c.FanOut); err != nil {
+		return nil, e(err)
+	}
+	setWatch(cmd, c.Watch)
+	setCopyInput(cmd, c.CopyInput || c.app.copyInput, c.inputCtor())
+	version := c.Version
+	if parent != nil {
+		version = parent.Root().Version
+	}
+	if err = setDeprecation(cmd, c.deprecation(), version); err != nil {
+		return nil, e(err)
+	}
+	if err = setRateLimit(cmd, c.RateLimit); err != nil {
+		return nil, e(err)
+	}
+	if c.Templates != nil {
+		if err = bflags.SetCmdTemplates(cmd, *c.Templates); err != nil {
+			return nil, e(errors.K.Invalid, ErrInvalidSpec, "reason", "invalid template",
+				"command", c.Name(),
+				"template_error", errors.GetRootCause(err).Error())
+		}
+	}
+	if c.Topic {
+		configureTopic(cmd)
 	}
 	var in interface{}
 	in, err = c.decodeInput()
@@ -850,12 +1417,28 @@ func (c *Cmd) ToCobra(parent *cobra.Command, f bflags.Flagger) (*cobra.Command,
 		}
 		err = bflags.BindCustom(cmd, f, in)
 	}
+	if err == nil {
+		err = bflags.CheckShadowing(cmd)
+	}
+	if err == nil {
+		err = c.registerCompletions(cmd)
+	}
+	if err == nil {
+		err = configureFanOut(cmd)
+	}
+	if err == nil {
+		err = configureWatch(cmd)
+	}
+	var validator ValidatorCtor
+	if err == nil {
+		validator, err = c.argsValidator()
+	}
 	if err != nil {
 		return nil, err
 	}
-	if c.ArgsValidator != nil {
+	if validator != nil {
 		// additional 'positional' function that can do further validation
-		cmd.Args = c.ArgsValidator(cmd)
+		cmd.Args = validator(cmd)
 	}
 
 	for _, sub := range c.SubCommands {
@@ -868,58 +1451,105 @@ func (c *Cmd) ToCobra(parent *cobra.Command, f bflags.Flagger) (*cobra.Command,
 	return cmd, nil
 }
 
+// JCmd is the canonical serializable form of a Cmd, used to marshal and
+// unmarshal commands. See the contract of round-trips in Cmd.MarshalJSON.
 type JCmd struct {
 	app                        *App
-	Use                        string            `json:"use"`
-	Aliases                    []string          `json:"aliases,omitempty"`
-	SuggestFor                 []string          `json:"suggest_for,omitempty"`
-	Short                      string            `json:"short"`
-	Long                       mstring           `json:"long,omitempty"`
-	Category                   string            `json:"category,omitempty"`
-	Example                    mstring           `json:"example,omitempty"`
-	ValidArgs                  []string          `json:"valid_args,omitempty"`
-	Args                       string            `json:"args,omitempty"`
-	ArgsValidator              ValidatorCtor     `json:"-"` // additional validator
-	ArgAliases                 []string          `json:"arg_aliases,omitempty"`
-	BashCompletionFunction     string            `json:"bash_completion_function,omitempty"`
-	Deprecated                 string            `json:"deprecated,omitempty"`
-	Hidden                     bool              `json:"hidden,omitempty"`
-	Annotations                map[string]string `json:"annotations,omitempty"`
-	Version                    string            `json:"version,omitempty"`
-	PersistentPreRunE          string            `json:"persistent_pre_run_e,omitempty"`
-	PreRunE                    string            `json:"pre_run_e,omitempty"`
-	RunE                       string            `json:"run_e,omitempty"`
-	PostRunE                   string            `json:"post_run_e,omitempty"`
-	PersistentPostRunE         string            `json:"persistent_post_run_e,omitempty"`
-	SilenceErrors              bool              `json:"silence_errors,omitempty"`
-	SilenceUsage               bool              `json:"silence_usage,omitempty"`
-	DisableFlagParsing         bool              `json:"disable_flag_parsing,omitempty"`
-	DisableAutoGenTag          bool              `json:"disable_auto_gen_tag,omitempty"`
-	DisableFlagsInUseLine      bool              `json:"disable_flags_in_use_line,omitempty"`
-	DisableSuggestions         bool              `json:"disable_suggestions,omitempty"`
-	SuggestionsMinimumDistance int               `json:"suggestions_minimum_distance,omitempty"`
-	TraverseChildren           bool              `json:"traverse_children,omitempty"`
-	InputCtor                  string            `json:"input_ctor,omitempty"`   // name of input in app's map
-	Input                      CmdInput          `json:"input,omitempty"`        // json of input or input object
-	SubCommands                []*Cmd            `json:"sub_commands,omitempty"` // sub commands
+	Use                        string             `json:"use"`
+	Extends                    string             `json:"extends,omitempty"`
+	Aliases                    []string           `json:"aliases,omitempty"`
+	HiddenAliases              []string           `json:"hidden_aliases,omitempty"`
+	SuggestFor                 []string           `json:"suggest_for,omitempty"`
+	Short                      string             `json:"short"`
+	Long                       mstring            `json:"long,omitempty"`
+	Category                   string             `json:"category,omitempty"`
+	GroupID                    string             `json:"group_id,omitempty"`
+	Topic                      bool               `json:"topic,omitempty"`
+	Example                    mstring            `json:"example,omitempty"`
+	SeeAlso                    []string           `json:"see_also,omitempty"`
+	Roles                      []string           `json:"roles,omitempty"`
+	RateLimit                  *RateLimit         `json:"rate_limit,omitempty"`
+	Templates                  *bflags.Templates  `json:"templates,omitempty"`
+	ShellAlias                 string             `json:"shell_alias,omitempty"`
+	FanOut                     *FanOut            `json:"fan_out,omitempty"`
+	Watch                      bool               `json:"watch,omitempty"`
+	CopyInput                  bool               `json:"copy_input,omitempty"`
+	ValidArgs                  []string           `json:"valid_args,omitempty"`
+	ValidArgsFunction          string             `json:"valid_args_function,omitempty"`
+	Args                       string             `json:"args,omitempty"`
+	ArgsValidator              ValidatorCtor      `json:"-"` // additional validator
+	ArgsValidatorName          string             `json:"args_validator,omitempty"`
+	ArgAliases                 []string           `json:"arg_aliases,omitempty"`
+	BashCompletionFunction     string             `json:"bash_completion_function,omitempty"`
+	Deprecated                 string             `json:"deprecated,omitempty"`
+	Deprecation                *Deprecation       `json:"deprecation,omitempty"`
+	Hidden                     bool               `json:"hidden,omitempty"`
+	Annotations                map[string]string  `json:"annotations,omitempty"`
+	Version                    string             `json:"version,omitempty"`
+	PersistentPreRunE          string             `json:"persistent_pre_run_e,omitempty"`
+	PreRunE                    string             `json:"pre_run_e,omitempty"`
+	RunE                       string             `json:"run_e,omitempty"`
+	PostRunE                   string             `json:"post_run_e,omitempty"`
+	PersistentPostRunE         string             `json:"persistent_post_run_e,omitempty"`
+	SilenceErrors              bool               `json:"silence_errors,omitempty"`
+	SilenceUsage               bool               `json:"silence_usage,omitempty"`
+	DisableFlagParsing         bool               `json:"disable_flag_parsing,omitempty"`
+	DisableAutoGenTag          bool               `json:"disable_auto_gen_tag,omitempty"`
+	DisableFlagsInUseLine      bool               `json:"disable_flags_in_use_line,omitempty"`
+	DisableSuggestions         bool               `json:"disable_suggestions,omitempty"`
+	SuggestionsMinimumDistance int                `json:"suggestions_minimum_distance,omitempty"`
+	TraverseChildren           bool               `json:"traverse_children,omitempty"`
+	CompletionOptions          *CompletionOptions `json:"completion_options,omitempty"`
+	FlagCompletions            map[string]string  `json:"flag_completions,omitempty"` // flag name -> name of completion function
+	ArgCompletions             map[string]string  `json:"arg_completions,omitempty"`  // arg name -> name of completion function
+	InputCtor                  string             `json:"input_ctor,omitempty"`       // name of input in app's map
+	Input                      CmdInput           `json:"input,omitempty"`            // json of input or input object
+	SubCommands                []*Cmd             `json:"sub_commands,omitempty"`     // sub commands
 }
 
+// MarshalJSON marshals the command in its canonical form, JCmd: functions
+// and input constructors are referenced by their name and inline inputs are
+// marshaled as default values of the input constructor registered for their
+// type.
+//
+// A spec whose functions and inputs are all referenced by the name they are
+// registered with in the runtime - see RunFnWithName, CobraFnWithName,
+// CompletionFnWithName, ArgsValidatorName and InputCtor - can be round-tripped
+// byte-for-byte: marshaling the spec, creating an app with NewAppFromSpec and
+// marshaling again yields the same JSON. Functions cannot be compared: those
+// given as values - see RunFn - are marshaled with their Go name, even if
+// registered, and ArgsValidator is not marshaled.
 func (c *Cmd) MarshalJSON() ([]byte, error) {
 	jc := JCmd{
 		app:                        c.app,
 		Use:                        c.Use,
+		Extends:                    c.Extends,
 		Aliases:                    c.Aliases,
+		HiddenAliases:              c.HiddenAliases,
 		SuggestFor:                 c.SuggestFor,
 		Short:                      c.Short,
 		Long:                       c.Long,
 		Category:                   c.Category,
+		GroupID:                    c.GroupID,
+		Topic:                      c.Topic,
 		Example:                    c.Example,
+		SeeAlso:                    c.SeeAlso,
+		Roles:                      c.Roles,
+		RateLimit:                  c.RateLimit,
+		Templates:                  c.Templates,
+		ShellAlias:                 c.ShellAlias,
+		FanOut:                     c.FanOut,
+		Watch:                      c.Watch,
+		CopyInput:                  c.CopyInput,
 		ValidArgs:                  c.ValidArgs,
+		ValidArgsFunction:          c.ValidArgsFunction.String(),
 		Args:                       c.Args,
 		ArgsValidator:              c.ArgsValidator,
+		ArgsValidatorName:          c.ArgsValidatorName,
 		ArgAliases:                 c.ArgAliases,
 		BashCompletionFunction:     c.BashCompletionFunction,
 		Deprecated:                 c.Deprecated,
+		Deprecation:                c.Deprecation,
 		Hidden:                     c.Hidden,
 		Annotations:                c.Annotations,
 		Version:                    c.Version,
@@ -936,14 +1566,12 @@ func (c *Cmd) MarshalJSON() ([]byte, error) {
 		DisableSuggestions:         c.DisableSuggestions,
 		SuggestionsMinimumDistance: c.SuggestionsMinimumDistance,
 		TraverseChildren:           c.TraverseChildren,
-		InputCtor:                  c.InputCtor,
-		Input:                      c.Input,
+		CompletionOptions:          c.CompletionOptions,
+		FlagCompletions:            c.FlagCompletions,
+		ArgCompletions:             c.ArgCompletions,
 		SubCommands:                c.SubCommands,
 	}
-	ti := reflect.TypeOf(jc.Input)
-	if ti != nil && ti.Kind() == reflect.Func {
-		jc.Input = runtime.FuncForPC(reflect.ValueOf(jc.Input).Pointer()).Name()
-	}
+	jc.InputCtor, jc.Input = c.jsonInput()
 
 	buf := bytes.NewBuffer(make([]byte, 0))
 	enc := json.NewEncoder(buf)
@@ -961,9 +1589,11 @@ type AddResultFn func(key string, out interface{}, err error)
 type PrintResultFn func(results []*CmdResult)
 
 type CmdResult struct {
-	Key    string      `json:"key"`
-	Result interface{} `json:"result,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	Key        string      `json:"key" table:"KEY"`
+	Result     interface{} `json:"result,omitempty" table:"RESULT,60"`
+	Error      string      `json:"error,omitempty" table:"ERROR,60"`
+	Command    string      `json:"command,omitempty"`    // path of the command that failed
+	Invocation string      `json:"invocation,omitempty"` // redacted command line of the command that failed
 }
 
 func newCommandResult(key string, out interface{}, err error) *CmdResult {
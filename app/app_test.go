@@ -1,33 +1,3470 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/ecobra-go/params"
+	"github.com/eluv-io/ecobra-go/params/credentials"
 )
 
 func TestParsePositional(t *testing.T) {
+	validators := map[string]ValidatorCtor{
+		"noDash": func(c *cobra.Command) func(c *cobra.Command, args []string) error {
+			return func(c *cobra.Command, args []string) error {
+				for _, arg := range args {
+					if strings.HasPrefix(arg, "-") {
+						return errors.E("noDash", errors.K.Invalid, "arg", arg)
+					}
+				}
+				return nil
+			}
+		},
+	}
 	type test struct {
-		val    string
-		ename  string
-		eint0  int
-		eint1  int
-		hasErr bool
+		val     string
+		valid   [][]string // valid args
+		invalid [][]string // invalid args
 	}
 	tests := []*test{
-		{"NoArgs       ", "NoArgs", 0, 0, false},
-		{"OnlyValidArgs", "OnlyValidArgs", 0, 0, false},
-		{"ExactArgs(1)", "ExactArgs", 1, 0, false},
-		{"RangeArgs(1,2)", "RangeArgs", 1, 2, false},
-		{"ExactArgs(1", "", 0, 0, true},
+		{"", [][]string{{}, {"a", "b"}}, nil},
+		{"NoArgs       ", [][]string{{}}, [][]string{{"a"}}},
+		{"OnlyValidArgs", [][]string{{"a"}, {"b", "a"}}, [][]string{{"c"}}},
+		{"ExactArgs(1)", [][]string{{"x"}}, [][]string{{}, {"x", "y"}}},
+		{"RangeArgs(1,2)", [][]string{{"x"}, {"x", "y"}}, [][]string{{}, {"x", "y", "z"}}},
+		{"RangeArgs( 1 , 2 )", [][]string{{"x"}}, [][]string{{}}},
+		{"MatchAll(ExactArgs(2),OnlyValidArgs)", [][]string{{"a", "b"}}, [][]string{{"a"}, {"a", "c"}}},
+		{"MatchAll(MinimumNArgs(1), noDash)", [][]string{{"x"}}, [][]string{{}, {"x", "-y"}}},
+		{"noDash", [][]string{{"x"}}, [][]string{{"-x"}}},
 	}
-
 	for _, te := range tests {
-		v, i0, i1, err := parsePositional(te.val)
-		require.Equal(t, te.hasErr, err != nil)
-		require.Equal(t, te.ename, v)
-		require.Equal(t, te.eint0, i0)
-		require.Equal(t, te.eint1, i1)
+		ctor, err := parsePositional(te.val, validators)
+		require.NoError(t, err, te.val)
+		if te.val == "" {
+			require.Nil(t, ctor)
+			continue
+		}
+		c := &cobra.Command{Use: "test", ValidArgs: []string{"a", "b"}}
+		pa := ctor(c)
+		for _, args := range te.valid {
+			require.NoError(t, pa(c, args), "%s %v", te.val, args)
+		}
+		for _, args := range te.invalid {
+			require.Error(t, pa(c, args), "%s %v", te.val, args)
+		}
+	}
+
+	for _, te := range []struct {
+		val        string
+		expression string
+		position   int
+	}{
+		{"ExactArgs(1", "ExactArgs(1", 0},
+		{"ExactArgs(x)", "x", 10},
+		{"ExactArgs()", "ExactArgs()", 0},
+		{"RangeArgs(1)", "RangeArgs(1)", 0},
+		{"NoArgs(1)", "NoArgs(1)", 0},
+		{"MatchAll(ExactArgs(2) OnlyValidArgs)", "O", 22},
+		{"MatchAll(ExactArgs(2),)", ")", 22},
+		{"MatchAll(1)", "MatchAll(1)", 0},
+		{"ExactArgs(1) x", "x", 13},
+		{"MatchAll(ExactArgs(2),Unknown)", "Unknown", 22},
+	} {
+		_, err := parsePositional(te.val, validators)
+		require.Error(t, err, te.val)
+		if strings.Contains(te.val, "Unknown") || te.val == "ExactArgs(x)" {
+			require.True(t, errors.Is(err, ErrFunctionNotFound), err)
+		} else {
+			require.True(t, errors.Is(err, ErrInvalidSpec), err)
+		}
+		e, ok := err.(*errors.Error)
+		require.True(t, ok)
+		require.Equal(t, te.expression, e.Field("expression"), te.val)
+		require.Equal(t, te.position, e.Field("position"), te.val)
+		require.Equal(t, te.val, e.Field("args"), te.val)
+	}
+}
+
+func TestSpecString(t *testing.T) {
+	s := NewSpec(nil, &Cmd{Use: "cli", Short: "first"})
+	str := s.String()
+	require.Contains(t, str, "first")
+
+	// cached
+	s.CmdRoot.Short = "second"
+	require.Equal(t, str, s.String())
+
+	// cleared when building the app
+	a, err := NewApp(s, nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.NoError(t, err)
+	require.Contains(t, s.String(), "second")
+}
+
+func TestSentinelErrors(t *testing.T) {
+	err := isRunFn("fn", func() {})
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+
+	_, err = NewApp(nil, nil)
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+
+	root := &Cmd{Use: "root", SubCommands: []*Cmd{{Use: "sub"}}}
+	_, err = root.Sub([]string{"other"})
+	require.True(t, errors.Is(err, ErrCommandNotFound), err)
+	require.True(t, errors.IsKind(errors.K.NotExist, err))
+	sub, err := root.Sub([]string{"sub"})
+	require.NoError(t, err)
+	require.Equal(t, "sub", sub.Use)
+
+	a, err := NewApp(&spec{CmdRoot: &Cmd{Use: "root", RunE: RunFunc{name: "missing"}}}, nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrFunctionNotFound), err)
+}
+
+func TestExampleTemplates(t *testing.T) {
+	type input struct {
+		Qid string `cmd:"flag,qid,content id"`
+	}
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use:     "cli",
+		Example: "{{.AppName}} get --qid x",
+		SubCommands: []*Cmd{{
+			Use:     "get",
+			Example: "{{.CmdPath}} --qid {{.Flags.qid}} --config {{.ConfigDir}}/{{.File}}",
+			RunE:    RunFn(func(ctx *CmdCtx, in *input) error { return nil }),
+			Input:   &input{},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.WithExampleVars(map[string]interface{}{"ConfigDir": "/etc/cli", "File": "cfg.json"})
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	help := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(args)
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Contains(t, help("--help"), "cli get --qid x")
+	require.Contains(t, help("get", "--help"), "cli get --qid <qid> --config /etc/cli/cfg.json")
+}
+
+func TestSeeAlso(t *testing.T) {
+	run := RunFn(func(ctx *CmdCtx) error { return nil })
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{
+			{
+				Use:   "content",
+				Short: "content commands",
+				SubCommands: []*Cmd{
+					{Use: "list", Short: "list contents", RunE: run,
+						SeeAlso: []string{"content get", "cli other", "unknown cmd"}},
+					{Use: "get", Short: "get a content", RunE: run},
+				},
+			},
+			{Use: "other", Short: "other command", RunE: run},
+		},
+	}), nil)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	out := &strings.Builder{}
+	root.SetOut(out)
+	root.SetArgs([]string{"content", "list", "--help"})
+	require.NoError(t, root.Execute())
+	require.Contains(t, out.String(), `
+See also:
+  cli content get get a content
+  cli other       other command
+  unknown cmd`)
+
+	bb, err := json.Marshal(a.Spec().CmdRoot)
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"see_also":["content get","cli other","unknown cmd"]`)
+}
+
+func TestHelpTopic(t *testing.T) {
+	a, err := NewAppFromSpec(`{
+	"categories": [
+		{"name": "base", "title": "Base commands", "default": true}
+	],
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "auth-model", "short": "how authentication works", "topic": true,
+			 "long": ["# Auth model", "", "Tokens are **signed** with the `+"`private key`"+`:", "* client tokens", "## Expiry", "tokens expire"]},
+			{"use": "config", "short": "configure the cli", "category": "base", "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	run := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(args)
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	usage := run("--help")
+	require.Contains(t, usage, "Base commands\n  completion")
+	require.Contains(t, usage, "  config      configure the cli")
+	require.Contains(t, usage, "Help topics\n  auth-model  how authentication works")
+	require.NotContains(t, usage, "Help topics:")
+
+	require.Equal(t, `AUTH MODEL
+==========
+
+Tokens are signed with the private key:
+  • client tokens
+Expiry
+------
+tokens expire
+`, run("help", "auth-model"))
+
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "topic", Topic: true, RunE: RunFnWithName("config")}},
+	}), mustRt(t))
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+
+	// without categories, help topics are listed apart
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{
+			{Use: "topic", Short: "a topic", Topic: true},
+			{Use: "config", Short: "configure the cli", RunE: RunFnWithName("config")},
+		},
+	}), mustRt(t))
+	require.NoError(t, err)
+	root, err = a.Cobra()
+	require.NoError(t, err)
+	require.Contains(t, run("--help"), "Help topics:\n  cli topic      a topic")
+}
+
+func TestErrorRenderer(t *testing.T) {
+	r := NewErrorRenderer().
+		WithHint(errors.K.NotExist, "list available ids with 'cli list'").
+		WithDocURL(errors.K.NotExist, "https://docs.example.com/errors#not-exist").
+		WithHint(errors.K.Invalid, "check the arguments")
+
+	var err error = errors.E("command failed", errors.K.Invalid, "cmd", "get",
+		errors.E("fetch", errors.K.NotExist, "id", "abc", "reason", "unknown id"))
+	require.Equal(t, `Error: command failed
+  kind   invalid
+  cmd    get
+  cause
+    op      fetch
+    kind    item does not exist
+    id      abc
+    reason  unknown id
+
+Hint: list available ids with 'cli list'
+See:  https://docs.example.com/errors#not-exist
+`, r.String(err))
+	require.Contains(t, r.WithStacktrace(true).String(err), "app_test.go")
+	require.NotContains(t, r.WithStacktrace(false).String(err), "app_test.go")
+
+	require.Equal(t, "Error: boom\n", NewErrorRenderer().String(errors.Str("boom")))
+	require.Equal(t, "", r.String(nil))
+
+	rt, err := RtFunctions(nil, nil, map[string]Runfn{
+		"fail": func(ctx *CmdCtx) error { return errors.E("fail", errors.K.Permission) },
+	})
+	require.NoError(t, err)
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "fail", RunE: RunFnWithName("fail")}},
+	}), rt)
+	require.NoError(t, err)
+	a.WithErrorRenderer(NewErrorRenderer().WithHint(errors.K.Permission, "log in first"))
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	out := &strings.Builder{}
+	root.SetErr(out)
+	root.SetOut(out)
+	root.SetArgs([]string{"fail"})
+	err = a.Execute()
+	require.True(t, errors.IsKind(errors.K.Permission, err), err)
+	require.Contains(t, out.String(), "Error: command failed\n  kind        invalid\n")
+	require.Contains(t, out.String(), "\n  path        cli fail\n  invocation  cli fail\n")
+	require.Contains(t, out.String(), "\nHint: log in first\n")
+}
+
+func TestPrefixMatching(t *testing.T) {
+	a, err := NewAppFromSpec(`{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "content", "sub_commands": [
+				{"use": "list", "run_e": "config"},
+				{"use": "link", "run_e": "config"}
+			]},
+			{"use": "config", "aliases": ["cfg"], "run_e": "config"},
+			{"use": "secret", "hidden": true, "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"cont", "lis"}, []string{"content", "list"}},
+		{[]string{"cf"}, []string{"config"}},
+		{[]string{"cont", "--help", "lis", "x"}, []string{"content", "--help", "list", "x"}},
+		{[]string{"help", "cont", "lis"}, []string{"help", "content", "list"}},
+		{[]string{"sec"}, []string{"sec"}},
+		{[]string{"config", "cont"}, []string{"config", "cont"}},
+	} {
+		args, err := ResolvePrefixes(root, tc.args)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, args)
+	}
+
+	_, err = ResolvePrefixes(root, []string{"c"})
+	require.True(t, errors.Is(err, ErrAmbiguousCommand), err)
+	_, err = ResolvePrefixes(root, []string{"content", "li"})
+	require.True(t, errors.Is(err, ErrAmbiguousCommand), err)
+	require.Equal(t, "link, list", errors.Field(err, "candidates"))
+
+	a.WithPrefixMatching(true)
+	a.SetArgs([]string{"cont", "lis"})
+	require.NoError(t, a.Execute())
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	a, err := NewAppFromSpec(`{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "Content", "sub_commands": [
+				{"use": "getMeta", "aliases": ["gm"], "run_e": "config"},
+				{"use": "getmeta", "run_e": "config"}
+			]},
+			{"use": "Config", "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	m := CommandMatching{CaseInsensitive: true}
+	args, err := m.Resolve(root, []string{"content", "GM", "x"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Content", "getMeta", "x"}, args)
+	args, err = m.Resolve(root, []string{"content", "getmeta"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Content", "getmeta"}, args)
+	_, err = m.Resolve(root, []string{"content", "GETMETA"})
+	require.True(t, errors.Is(err, ErrAmbiguousCommand), err)
+
+	m.Prefix = true
+	args, err = m.Resolve(root, []string{"conf"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Config"}, args)
+
+	_, err = a.Command("cli", "content")
+	require.True(t, errors.IsNotExist(err), err)
+	a.WithCaseInsensitive(true)
+	cmd, err := a.Command("CLI", "content", "GETMETA")
+	require.NoError(t, err)
+	require.Equal(t, "getMeta", cmd.Name())
+
+	a.SetArgs([]string{"config"})
+	require.NoError(t, a.Execute())
+}
+
+func TestCobraParity(t *testing.T) {
+	a, err := NewAppFromSpec(`{
+	"categories": [
+		{"name": "base", "title": "Base commands"},
+		{"name": "others", "title": "Other commands", "default": true}
+	],
+	"cmd_root": {
+		"use": "cli",
+		"completion_options": {"hidden_default_cmd": true},
+		"sub_commands": [
+			{"use": "config", "short": "configure", "group_id": "base",
+			 "aliases": ["cfg"], "hidden_aliases": ["setup"], "run_e": "config"},
+			{"use": "other", "short": "other", "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	require.True(t, root.CompletionOptions.HiddenDefaultCmd)
+
+	run := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(args)
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Contains(t, run("--help"), "Base commands\n  config      configure")
+	usage := run("setup", "--help")
+	require.Contains(t, usage, "Aliases:\n  config, cfg\n")
+	require.NotContains(t, usage, "setup")
+
+	bb, err := json.Marshal(a.Spec().CmdRoot)
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"hidden_aliases":["setup"]`)
+	require.Contains(t, string(bb), `"group_id":"base"`)
+	require.Contains(t, string(bb), `"completion_options":{"hidden_default_cmd":true}`)
+
+	a, err = NewApp(NewSpec(nil, &Cmd{Use: "cli", Category: "base", GroupID: "other"}), mustRt(t))
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+func TestAuthorize(t *testing.T) {
+	a, err := NewAppFromSpec(`{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "admin", "roles": ["admin"], "sub_commands": [
+				{"use": "purge", "roles": ["admin", "ops"], "run_e": "config"}
+			]},
+			{"use": "config", "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+	require.NoError(t, err)
+
+	var granted []string
+	var paths []string
+	a.WithAuthorizer(func(ctx *CmdCtx, cmdPath string, input interface{}) error {
+		paths = append(paths, cmdPath)
+		return RequireRoles(func(*CmdCtx) ([]string, error) { return granted, nil })(ctx, cmdPath, input)
+	})
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	root.SilenceUsage = true
+	purge, _, err := root.Find([]string{"admin", "purge"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin", "ops"}, RequiredRoles(purge))
+
+	a.SetArgs([]string{"config"})
+	require.NoError(t, a.Execute())
+
+	a.SetArgs([]string{"admin", "purge"})
+	granted = []string{"admin"}
+	err = a.Execute()
+	require.True(t, errors.Is(err, ErrUnauthorized), err)
+	require.True(t, errors.IsKind(errors.K.Permission, err))
+	require.Equal(t, "ops", errors.Field(err, "missing_roles"))
+
+	granted = []string{"ops", "admin"}
+	require.NoError(t, a.Execute())
+	require.Equal(t, []string{"cli config", "cli admin purge", "cli admin purge"}, paths)
+
+	bb, err := json.Marshal(a.Spec().CmdRoot.SubCommands[0])
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"roles":["admin"]`)
+
+	// pre-run functions don't run for unauthorized callers
+	var hooks []string
+	hook := func(name string) CobraFunc {
+		return CobraFn(func(cmd *cobra.Command, _ []string) error {
+			hooks = append(hooks, name+" "+cmd.Name())
+			return nil
+		})
+	}
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:               "cli",
+		PersistentPreRunE: hook("persistent"),
+		SubCommands: []*Cmd{
+			{Use: "purge", Roles: []string{"ops"}, PreRunE: hook("pre"), RunE: RunFnWithName("config")},
+			{Use: "list", RunE: RunFnWithName("config")},
+		},
+	}), mustRt(t))
+	require.NoError(t, err)
+	a.WithAuthorizer(RequireRoles(func(*CmdCtx) ([]string, error) { return granted, nil }))
+	_, err = a.Cobra()
+	require.NoError(t, err)
+	granted = nil
+	a.SetArgs([]string{"purge"})
+	require.True(t, errors.Is(a.Execute(), ErrUnauthorized))
+	require.Empty(t, hooks)
+
+	granted = []string{"ops"}
+	require.NoError(t, a.Execute())
+	a.SetArgs([]string{"list"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, []string{"persistent purge", "pre purge", "persistent list"}, hooks)
+
+	// without authorizer, the pre-run functions are left as is
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:               "cli",
+		PersistentPreRunE: hook("persistent"),
+		SubCommands: []*Cmd{
+			{Use: "purge", PreRunE: hook("pre"), RunE: RunFnWithName("config")},
+		},
+	}), mustRt(t))
+	require.NoError(t, err)
+	root, err = a.Cobra()
+	require.NoError(t, err)
+	purge, _, err = root.Find([]string{"purge"})
+	require.NoError(t, err)
+	require.NotNil(t, root.PersistentPreRunE)
+	require.Nil(t, purge.PersistentPreRunE)
+	require.NotNil(t, purge.PreRunE)
+	hooks = nil
+	a.SetArgs([]string{"purge"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, []string{"persistent purge", "pre purge"}, hooks)
+}
+
+func TestRateLimit(t *testing.T) {
+	spec := `{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "publish", "run_e": "config", "rate_limit": {"count": 2, "window": "1h"}},
+			{"use": "sync", "run_e": "config", "rate_limit": {"count": 1, "window": "1h", "warn": true}}
+		]
+	}
+}`
+	dir := t.TempDir()
+	newApp := func() *App {
+		a, err := NewAppFromSpec(spec, mustRt(t))
+		require.NoError(t, err)
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+		return a.WithStateDir(dir)
+	}
+
+	// invocations are counted across apps - i.e. processes
+	for i := 0; i < 2; i++ {
+		a := newApp()
+		a.SetArgs([]string{"publish"})
+		require.NoError(t, a.Execute())
+	}
+	a := newApp()
+	a.SetArgs([]string{"publish"})
+	err := a.Execute()
+	require.True(t, errors.Is(err, ErrRateLimited), err)
+	require.True(t, errors.IsKind(errors.K.Unavailable, err))
+	require.Equal(t, "1h0m0s", errors.Field(err, "retry_after"))
+
+	out := &strings.Builder{}
+	root, _ := a.Cobra()
+	root.SetErr(out)
+	for i := 0; i < 2; i++ {
+		a.SetArgs([]string{"sync"})
+		require.NoError(t, a.Execute())
+	}
+	require.Equal(t, "Warning: cli sync ran more than 1 times in 1h\n", out.String())
+
+	a, err = NewAppFromSpec(strings.Replace(spec, `"window": "1h"}`, `"window": "soon"}`, 1), mustRt(t))
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+func TestTemplates(t *testing.T) {
+	spec := `{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "config", "short": "configure", "run_e": "config"},
+			{"use": "status", "short": "show status", "run_e": "config", "templates": {"help": "status: {{.Short}}\n"}}
+		]
+	}
+}`
+	a, err := NewAppFromSpec(spec, mustRt(t))
+	require.NoError(t, err)
+	a.WithTemplates(bflags.Templates{Help: "{{.CommandPath}}: {{.Short}}\n"})
+	help := func(args ...string) string {
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		a.SetArgs(append(args, "--help"))
+		require.NoError(t, a.Execute())
+		return out.String()
+	}
+	require.Equal(t, "cli config: configure\n", help("config"))
+	require.Equal(t, "status: show status\n", help("status"))
+
+	a, err = NewAppFromSpec(strings.Replace(spec, "{{.Short}}", "{{.Short", 1), mustRt(t))
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+func TestEnvCommand(t *testing.T) {
+	type input struct {
+		Qid      string `cmd:"flag,qid,content id" env:"CLI_QID"`
+		Password string `cmd:"flag,password,the password"`
+		Path     string `cmd:"arg,path,the path,0"`
+	}
+	newApp := func() (*App, *cobra.Command) {
+		in := &input{Qid: "iq__default", Password: "pwd", Path: "/"}
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				RunE:  RunFn(func(ctx *CmdCtx, in *input) error { return nil }),
+				Input: in,
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.WithEnvCommand(true).Cobra()
+		require.NoError(t, err)
+		return a, root
+	}
+
+	a, root := newApp()
+	a.SetArgs([]string{"get", "--qid", "iq__other"})
+	require.NoError(t, a.Execute())
+	get, _, err := root.Find([]string{"get"})
+	require.NoError(t, err)
+	require.Equal(t, []*FlagSource{
+		{Command: "cli get", Flag: "password", Default: bflags.RedactedValue, Value: bflags.RedactedValue, Source: SourceDefault},
+		{Command: "cli get", Flag: "path", Arg: true, Default: "/", Value: "/", Source: SourceDefault},
+		{Command: "cli get", Flag: "qid", Env: "CLI_QID", Default: "iq__default", Value: "iq__other", Source: SourceFlag},
+	}, FlagSources(get))
+
+	a, root = newApp()
+	out := &strings.Builder{}
+	root.SetOut(out)
+	a.SetArgs([]string{"env", "get"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, `COMMAND  FLAG        ENV      DEFAULT      VALUE        SOURCE
+cli get  --password  -        ***          ***          default
+cli get  <path>      -        /            /            default
+cli get  --qid       CLI_QID  iq__default  iq__default  default
+`, out.String())
+
+	// environment variables apply to commands that are not executed
+	t.Setenv("CLI_QID", "iq__env")
+	a, root = newApp()
+	out.Reset()
+	root.SetOut(out)
+	a.SetArgs([]string{"env", "get"})
+	require.NoError(t, a.Execute())
+	require.Contains(t, out.String(), "cli get  --qid       CLI_QID  iq__default  iq__env  env\n")
+
+	a.SetArgs([]string{"env", "unknown"})
+	require.True(t, errors.Is(a.Execute(), ErrCommandNotFound))
+}
+
+func TestShellAliases(t *testing.T) {
+	spec := `{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "content", "sub_commands": [
+				{"use": "list", "shell_alias": "mcl", "run_e": "config"},
+				{"use": "get", "shell_alias": "mcg", "run_e": "config"}
+			]},
+			{"use": "config", "run_e": "config"}
+		]
+	}
+}`
+	a, err := NewAppFromSpec(spec, mustRt(t))
+	require.NoError(t, err)
+	aliases, err := a.ShellAliases()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"mcl": "cli content list", "mcg": "cli content get"}, aliases)
+
+	out := &strings.Builder{}
+	root, _ := a.Cobra()
+	root.SetOut(out)
+	a.SetArgs([]string{"aliases", "bash"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, "mcg() { cli content get \"$@\"; }\nmcl() { cli content list \"$@\"; }\n", out.String())
+
+	out.Reset()
+	require.NoError(t, a.GenAliases(out, "fish"))
+	require.Equal(t, "function mcg; cli content get $argv; end\nfunction mcl; cli content list $argv; end\n", out.String())
+	require.Error(t, a.GenAliases(out, "cmd.exe"))
+
+	for _, s := range []string{
+		strings.Replace(spec, `"mcg"`, `"mc g"`, 1),
+		strings.Replace(spec, `"mcg"`, `"mcl"`, 1),
+	} {
+		a, err = NewAppFromSpec(s, mustRt(t))
+		require.NoError(t, err)
+		_, err = a.ShellAliases()
+		require.True(t, errors.Is(err, ErrInvalidSpec), err)
+	}
+}
+
+type sumInput struct {
+	Values []int `cmd:"arg,values,values to sum,0"`
+}
+
+func (in *sumInput) Validate() error {
+	if len(in.Values) == 0 {
+		return errors.E("validate", errors.K.Invalid, "reason", "no values")
+	}
+	return nil
+}
+
+func TestInvoke(t *testing.T) {
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{
+			{
+				Use: "sum",
+				RunE: RunFn(func(ctx *CmdCtx, in *sumInput) (int, error) {
+					sum := 0
+					for _, v := range in.Values {
+						sum += v
+					}
+					return sum, nil
+				}),
+				Input: &sumInput{},
+			},
+			{Use: "ping", RunE: RunFn(func(ctx *CmdCtx) (string, error) { return "pong", nil })},
+			{Use: "admin", Roles: []string{"admin"}, RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+		},
+	}), nil)
+	require.NoError(t, err)
+	a.WithAuthorizer(RequireRoles(func(ctx *CmdCtx) ([]string, error) { return nil, nil }))
+
+	out, err := a.Invoke(nil, []string{"cli", "sum"}, &sumInput{Values: []int{1, 2, 3}})
+	require.NoError(t, err)
+	require.Equal(t, 6, out)
+
+	ctx := NewCmdCtx()
+	out, err = a.Invoke(ctx, []string{"cli", "ping"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "pong", out)
+	res, _ := ctx.Get(CtxResult)
+	require.Equal(t, "pong", res)
+
+	_, err = a.Invoke(nil, []string{"cli", "sum"}, &sumInput{})
+	require.Error(t, err)
+	for _, input := range []interface{}{nil, sumInput{Values: []int{1}}, &struct{ Values []int }{}} {
+		_, err = a.Invoke(nil, []string{"cli", "sum"}, input)
+		require.True(t, errors.Is(err, bflags.ErrInvalidInput), err)
+	}
+	_, err = a.Invoke(nil, []string{"cli", "ping"}, &sumInput{})
+	require.True(t, errors.Is(err, bflags.ErrInvalidInput), err)
+	_, err = a.Invoke(nil, []string{"cli", "unknown"}, nil)
+	require.True(t, errors.Is(err, ErrCommandNotFound), err)
+	_, err = a.Invoke(nil, []string{"cli", "admin"}, nil)
+	require.True(t, errors.Is(err, ErrUnauthorized), err)
+}
+
+func TestInvokePipeline(t *testing.T) {
+	type input struct {
+		Limit int `cmd:"flag,limit,max number of results"`
+	}
+	t.Setenv("CLI_PROFILE", "staging")
+	dir := t.TempDir()
+	var got *input
+	var profile string
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:       "list",
+			Input:     &input{},
+			RateLimit: &RateLimit{Count: 1, Window: "1h"},
+			RunE: RunFn(func(ctx *CmdCtx, in *input) (int, error) {
+				got, profile = in, ctx.Profile()
+				return in.Limit, nil
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.Spec().Profiles = map[string]map[string]interface{}{"staging": {"limit": 30}}
+	a.WithProfiles(true).WithConfigCommand(true).WithConfigFile(filepath.Join(dir, "config.json")).
+		WithStateDir(filepath.Join(dir, "state"))
+	a.SetArgs([]string{"config", "set", "limit", "20"})
+	require.NoError(t, a.Execute())
+	starts := 0
+	a.SetCommandStart(func(cmd *cobra.Command, flags map[string]string, in interface{}) { starts++ })
+	var events []*CommandEvent
+	a.WithLifecycle(func(ev *CommandEvent) { events = append(events, ev) })
+
+	// the active profile is set to the context, config and profile values are
+	// not applied to the input
+	out, err := a.Invoke(nil, []string{"cli", "list"}, &input{Limit: 5})
+	require.NoError(t, err)
+	require.Equal(t, 5, out)
+	require.Equal(t, &input{Limit: 5}, got)
+	require.Equal(t, "staging", profile)
+
+	// lifecycle events are sent without flags and args, CommandStart is not
+	// called
+	require.Len(t, events, 2)
+	require.Equal(t, EventStart, events[0].Type)
+	require.Equal(t, EventEnd, events[1].Type)
+	require.Equal(t, 5, events[1].Output)
+	require.Nil(t, events[0].FlagsAndArgs)
+	require.Equal(t, 0, starts)
+
+	// the rate limit is shared with command lines
+	_, err = a.Invoke(nil, []string{"cli", "list"}, &input{Limit: 5})
+	require.True(t, errors.Is(err, ErrRateLimited), err)
+	require.Len(t, events, 2)
+}
+
+type getInput struct {
+	Id string `cmd:"arg,id,the id,0"`
+}
+
+type deleteInput struct {
+	Force bool     `cmd:"flag,force,force deletion"`
+	Ids   []string `cmd:"arg,ids,content ids,0"`
+}
+
+func TestFanOut(t *testing.T) {
+	mu := sync.Mutex{}
+	var deleted []string
+	var out interface{}
+	stderr := &strings.Builder{}
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:    "delete",
+				FanOut: &FanOut{Parallelism: 2},
+				RunE: RunFn(func(ctx *CmdCtx, in *deleteInput) (string, error) {
+					if len(in.Ids) != 1 || !in.Force {
+						return "", errors.E("delete", errors.K.Invalid, "ids", in.Ids)
+					}
+					if in.Ids[0] == "bad" {
+						return "", errors.E("delete", errors.K.NotExist, "id", in.Ids[0])
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					deleted = append(deleted, in.Ids[0])
+					return "deleted " + in.Ids[0], nil
+				}),
+				Input: &deleteInput{},
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.SetCommandEnd(func(cmd *cobra.Command, o interface{}, err error) { out = o })
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+		stderr.Reset()
+		root.SetErr(stderr)
+		return a
+	}
+
+	a := newApp()
+	a.SetArgs([]string{"delete", "--force", "a", "b", "c"})
+	require.NoError(t, a.Execute())
+	sort.Strings(deleted)
+	require.Equal(t, []string{"a", "b", "c"}, deleted)
+	require.Equal(t, []*CmdResult{
+		{Key: "a", Result: "deleted a"},
+		{Key: "b", Result: "deleted b"},
+		{Key: "c", Result: "deleted c"},
+	}, out)
+	require.Equal(t, "cli delete: 3 runs, 3 succeeded, 0 failed\n", stderr.String())
+
+	a = newApp()
+	a.SetArgs([]string{"delete", "--force", "a", "bad"})
+	err := a.Execute()
+	require.Error(t, err)
+	require.Equal(t, 1, errors.Field(err, "failed"))
+	require.Len(t, out, 2)
+	require.Equal(t, "cli delete: 2 runs, 1 succeeded, 1 failed\n", stderr.String())
+
+	// a single value runs the command once, without summary
+	a = newApp()
+	a.SetArgs([]string{"delete", "--force", "d"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, "deleted d", out)
+	require.Empty(t, stderr.String())
+
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:    "get",
+			FanOut: &FanOut{},
+			RunE:   RunFn(func(ctx *CmdCtx, in *getInput) error { return nil }),
+			Input:  &getInput{},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+type fanOutMeta struct {
+	Runs int
+}
+
+type labelInput struct {
+	Labels []string    `cmd:"flag,label,labels"`
+	Meta   *fanOutMeta `cmd:"-"`
+	Ids    []string    `cmd:"arg,ids,content ids,0"`
+}
+
+func TestFanOutIsolation(t *testing.T) {
+	var out interface{}
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:    "label",
+			FanOut: &FanOut{Parallelism: 4},
+			RunE: RunFn(func(ctx *CmdCtx, in *labelInput) (string, error) {
+				// runs changing nested values don't see the changes of others
+				if in.Meta.Runs != 0 || in.Labels[0] != "x" {
+					return "", errors.E("label", errors.K.Invalid, "runs", in.Meta.Runs, "labels", in.Labels)
+				}
+				in.Meta.Runs++
+				in.Labels[0] = in.Ids[0]
+				return in.Labels[0], nil
+			}),
+			Input: &labelInput{Meta: &fanOutMeta{}},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.SetCommandEnd(func(cmd *cobra.Command, o interface{}, err error) { out = o })
+	a.SetArgs([]string{"label", "--label", "x", "a", "b", "c", "d", "e", "f"})
+	require.NoError(t, a.Execute())
+	require.Len(t, out, 6)
+	for _, res := range out.([]*CmdResult) {
+		require.Equal(t, res.Key, res.Result)
+	}
+}
+
+func TestFanOutCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	fail := true
+	var ran []string
+	stderr := &strings.Builder{}
+	newApp := func(args ...string) *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:    "delete",
+				FanOut: &FanOut{Checkpoint: true},
+				RunE: RunFn(func(ctx *CmdCtx, in *deleteInput) error {
+					ran = append(ran, in.Ids[0])
+					if fail && in.Ids[0] == "bad" {
+						return errors.E("delete", errors.K.Unavailable, "id", in.Ids[0])
+					}
+					return nil
+				}),
+				Input: &deleteInput{},
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.WithStateDir(dir).Cobra()
+		require.NoError(t, err)
+		root.SilenceUsage = true
+		root.SilenceErrors = true
+		stderr.Reset()
+		root.SetErr(stderr)
+		a.SetArgs(args)
+		return a
+	}
+	checkpoints := func() []string {
+		files, err := filepath.Glob(filepath.Join(dir, "checkpoint-cli_delete-*.jsonl"))
+		require.NoError(t, err)
+		return files
+	}
+
+	require.Error(t, newApp("delete", "a", "bad", "c", "a").Execute())
+	require.Len(t, checkpoints(), 1)
+	file := checkpoints()[0]
+
+	// the checkpoint of other inputs is not used
+	ran = nil
+	require.Error(t, newApp("delete", "--resume", "a", "bad").Execute())
+	require.ElementsMatch(t, []string{"a", "bad"}, ran)
+	require.Len(t, checkpoints(), 2)
+	for _, f := range checkpoints() {
+		if f != file {
+			require.NoError(t, os.Remove(f))
+		}
+	}
+
+	// the checkpoint is locked while the command runs
+	release, err := holdLock(file)
+	require.NoError(t, err)
+	require.Error(t, newApp("delete", "--resume", "a", "bad", "c", "a").Execute())
+	release()
+
+	// values that succeeded are skipped with --resume, repeated values are
+	// kept apart
+	fail = false
+	ran = nil
+	require.NoError(t, newApp("delete", "--resume", "a", "bad", "c", "a").Execute())
+	require.Equal(t, []string{"bad"}, ran)
+	require.Equal(t, "cli delete: 1 runs, 1 succeeded, 0 failed, 3 skipped\n", stderr.String())
+	require.NoFileExists(t, file)
+
+	// all values run without --resume
+	ran = nil
+	require.NoError(t, newApp("delete", "a", "c").Execute())
+	require.Equal(t, []string{"a", "c"}, ran)
+}
+
+type renderInput struct {
+	Template *params.FilePath `cmd:"arg,template,the template,0"`
+}
+
+func TestWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tmpl.txt")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0600))
+
+	runs := make(chan string, 10)
+	done := make(chan struct{})
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:   "render",
+			Watch: true,
+			RunE: RunFn(func(ctx *CmdCtx, in *renderInput) (string, error) {
+				bb, err := os.ReadFile(string(*in.Template))
+				if string(bb) == "bad" {
+					err = errors.E("render", errors.K.Invalid, "reason", "bad template")
+				}
+				return "rendered " + string(bb), err
+			}),
+			Input: &renderInput{Template: new(params.FilePath)},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.WithWatchOptions(WatchOptions{Interval: 5 * time.Millisecond, Debounce: 10 * time.Millisecond, Done: done})
+	a.WithOutput(true)
+	// the output of each run is printed and the end hook called before the
+	// next run
+	a.SetCommandEnd(func(cmd *cobra.Command, out interface{}, err error) {
+		runs <- fmt.Sprint(out)
+	})
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+
+	a.SetArgs([]string{"render", "--watch", file})
+	res := make(chan error)
+	go func() { res <- a.Execute() }()
+
+	next := func() string {
+		select {
+		case s := <-runs:
+			return s
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timeout")
+			return ""
+		}
+	}
+	require.Equal(t, "rendered v1", next())
+	require.Contains(t, stdout.String(), "rendered v1")
+	require.NoError(t, os.WriteFile(file, []byte("bad"), 0600))
+	require.Equal(t, "rendered bad", next())
+	require.NoError(t, os.WriteFile(file, []byte("v3 "), 0600))
+	require.Equal(t, "rendered v3 ", next())
+	close(done)
+	require.NoError(t, <-res)
+	require.Contains(t, stdout.String(), "rendered v3")
+
+	out := stderr.String()
+	require.Contains(t, out, "watching "+file)
+	require.Contains(t, out, "--- cli render: run 3 at ")
+	require.Contains(t, out, "bad template")
+
+	// watch requires a file path
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:   "cli",
+		Watch: true,
+		RunE:  RunFn(func(ctx *CmdCtx, in *getInput) error { return nil }),
+		Input: &getInput{},
+	}), nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		require.NoError(t, err)
+		return tm
+	}
+	now := at("2024-03-15 10:07") // a Friday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", at("2024-03-15 10:08")},
+		{"*/15 * * * *", at("2024-03-15 10:15")},
+		{"0 9-17 * * 1-5", at("2024-03-15 11:00")},
+		{"30 8 * * 1", at("2024-03-18 08:30")},
+		{"0 0 1 * *", at("2024-04-01 00:00")},
+		{"0 0 29 2 *", at("2024-02-29 00:00").AddDate(4, 0, 0)},
+		{"0 0 13 * 5", at("2024-03-22 00:00")},   // 13th or any Friday
+		{"0 0 */2 * 1", at("2024-03-25 00:00")},  // odd day and Monday
+		{"0 0 13 * */2", at("2024-04-13 00:00")}, // 13th and Sunday, Tuesday, Thursday or Saturday
+		{"0 0 * * 7", at("2024-03-17 00:00")},
+		{"@daily", at("2024-03-16 00:00")},
+		{"@hourly", at("2024-03-15 11:00")},
+		{"@every 90s", now.Add(90 * time.Second)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, tt.want, s.next(now), tt.expr)
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "x * * * *", "@every -1s"} {
+		_, err := parseCron(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestRunScheduled(t *testing.T) {
+	runs := make(chan string, 10)
+	count := 0
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use: "get",
+			RunE: RunFn(func(ctx *CmdCtx, in *getInput) (string, error) {
+				runs <- in.Id
+				// runs get a copy of the input
+				in.Id += "-changed"
+				count++
+				if count == 2 {
+					return "", errors.E("get", errors.K.Unavailable)
+				}
+				return in.Id, nil
+			}),
+			Input: &getInput{},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	var ends []error
+	a.SetCommandEnd(func(cmd *cobra.Command, out interface{}, err error) {
+		ends = append(ends, err)
+	})
+	var events []*CommandEvent
+	a.WithLifecycle(func(ev *CommandEvent) { events = append(events, ev) })
+	done := make(chan struct{})
+	a.WithScheduleOptions(ScheduleOptions{Jitter: time.Millisecond, Done: done})
+
+	res := make(chan error)
+	go func() { res <- a.RunScheduled("@every 5ms", []string{"cli", "get"}, &getInput{Id: "id1"}) }()
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-runs:
+			require.Equal(t, "id1", id)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timeout")
+		}
+	}
+	close(done)
+	require.NoError(t, <-res)
+	require.GreaterOrEqual(t, len(ends), 3)
+	require.Error(t, ends[1])
+	require.Equal(t, 2*len(ends), len(events))
+	require.Equal(t, EventEnd, events[3].Type)
+	require.Equal(t, events[2].InvocationID, events[3].InvocationID)
+	require.NotEqual(t, events[1].InvocationID, events[3].InvocationID)
+	require.Error(t, events[3].Err)
+
+	err = a.RunScheduled("* *", []string{"cli", "get"}, &getInput{})
+	require.Error(t, err)
+
+	// exit handlers are unregistered when scheduling stops
+	hooks := func() int {
+		signalHooks.mu.Lock()
+		defer signalHooks.mu.Unlock()
+		return len(signalHooks.hooks)
+	}
+	before := hooks()
+	unregister := registerSignalHandler(func() {}, false)
+	require.Equal(t, before+1, hooks())
+	unregister()
+	require.Equal(t, before, hooks())
+	err = a.RunScheduled("@hourly", []string{"cli", "put"}, nil)
+	require.True(t, errors.Is(err, ErrCommandNotFound), err)
+
+	// the schedule command parses the command line once
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use: "get",
+			RunE: RunFn(func(ctx *CmdCtx, in *getInput) error {
+				runs <- in.Id
+				return nil
+			}),
+			Input: &getInput{},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	done = make(chan struct{})
+	a.WithScheduleCommand(true).WithScheduleOptions(ScheduleOptions{Done: done})
+	a.SetArgs([]string{"schedule", "@every 5ms", "get", "id2"})
+	go func() { res <- a.Execute() }()
+	for i := 0; i < 2; i++ {
+		select {
+		case id := <-runs:
+			require.Equal(t, "id2", id)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timeout")
+		}
+	}
+	close(done)
+	require.NoError(t, <-res)
+}
+
+type item struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestOutputFormat(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "item.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("{{.Command}}: {{.Out.Name}}\n"), 0600))
+
+	run := func(args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "get",
+				RunE: RunFn(func(ctx *CmdCtx, in *getInput) (*item, error) {
+					return &item{Id: in.Id, Name: "name-" + in.Id}, nil
+				}),
+				Input: &getInput{},
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.WithOutput(true).WithOutputFormat("id", func(w io.Writer, cmd *cobra.Command, out interface{}) error {
+			_, err := fmt.Fprintln(w, out.(*item).Id)
+			return err
+		})
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		stdout := &bytes.Buffer{}
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(args)
+		err = a.Execute()
+		return stdout.String(), err
+	}
+
+	out, err := run("get", "x1")
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"id\": \"x1\",\n  \"name\": \"name-x1\"\n}\n", out)
+
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"json", "{\n  \"id\": \"x1\",\n  \"name\": \"name-x1\"\n}\n"},
+		{"{{.Out.Name}}", "name-x1\n"},
+		{"go-template={{json .Out}}", `{"id":"x1","name":"name-x1"}` + "\n"},
+		{"go-template-file=" + tmpl, "cli get: name-x1\n"},
+		{"id", "x1\n"},
+	} {
+		out, err = run("get", "x1", "--format", tc.format)
+		require.NoError(t, err, tc.format)
+		require.Equal(t, tc.want, out, tc.format)
+	}
+
+	for _, format := range []string{"xml", "{{.Out", "go-template-file=" + tmpl + ".none"} {
+		_, err = run("get", "x1", "--format", format)
+		require.True(t, errors.Is(err, ErrInvalidFormat), format, err)
+	}
+	_, err = run("get", "x1", "--format", "{{.Out.Missing}}")
+	require.Error(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	type doc struct {
+		Items []*item             `json:"items"`
+		Meta  map[string]string   `json:"meta"`
+		Tags  map[string][]string `json:"tags,omitempty"`
+	}
+	d := &doc{
+		Items: []*item{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "c", Name: "C"}},
+		Meta:  map[string]string{"version": "1", "owner": "me"},
+	}
+	for _, tc := range []struct {
+		query string
+		want  interface{}
+	}{
+		{"$", map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"id": "a", "name": "A"},
+				map[string]interface{}{"id": "b", "name": "B"},
+				map[string]interface{}{"id": "c", "name": "C"},
+			},
+			"meta": map[string]interface{}{"version": "1", "owner": "me"},
+		}},
+		{"$.meta.version", "1"},
+		{"meta['owner']", "me"},
+		{"$.items[1].id", "b"},
+		{"$.items[-1].id", "c"},
+		{"$.items[*].id", []interface{}{"a", "b", "c"}},
+		{"$.items[1:].name", []interface{}{"B", "C"}},
+		{"$.items[:-2].name", []interface{}{"A"}},
+		{"$.meta.*", []interface{}{"me", "1"}},
+		{"$..id", []interface{}{"a", "b", "c"}},
+		{".items[].id", []interface{}{"a", "b", "c"}},
+		{".items[0]", map[string]interface{}{"id": "a", "name": "A"}},
+		{"$.items[*].missing", []interface{}{}},
+	} {
+		q, err := parseQuery(tc.query)
+		require.NoError(t, err, tc.query)
+		res, err := q.eval(d)
+		require.NoError(t, err, tc.query)
+		require.Equal(t, tc.want, res, tc.query)
+	}
+
+	for _, expr := range []string{"$.items[", "$.items[x]", "$.items[1:y]", "$..", "$items"} {
+		_, err := parseQuery(expr)
+		require.True(t, errors.Is(err, ErrInvalidQuery), expr, err)
+	}
+	q, err := parseQuery("$.items[5].id")
+	require.NoError(t, err)
+	_, err = q.eval(d)
+	require.True(t, errors.IsNotExist(err), err)
+
+	// numbers are not rounded to float64
+	q, err = parseQuery("$.n")
+	require.NoError(t, err)
+	res, err := q.eval(map[string]int64{"n": 9007199254740993})
+	require.NoError(t, err)
+	require.Equal(t, json.Number("9007199254740993"), res)
+}
+
+func TestOutputQuery(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "list",
+				RunE: RunFn(func(ctx *CmdCtx) ([]*item, error) {
+					return []*item{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}}, nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.WithOutput(true).Cobra()
+		require.NoError(t, err)
+		stdout := &bytes.Buffer{}
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(args)
+		err = a.Execute()
+		return stdout.String(), err
+	}
+
+	out, err := run("list", "--query", "$[1].name")
+	require.NoError(t, err)
+	require.Equal(t, "B\n", out)
+	out, err = run("list", "--query", "[*].id", "--format", "{{range .Out}}{{.}} {{end}}")
+	require.NoError(t, err)
+	require.Equal(t, "a b \n", out)
+	_, err = run("list", "--query", "[x]")
+	require.True(t, errors.Is(err, ErrInvalidQuery), err)
+}
+
+type TableMeta struct {
+	Owner string `table:"OWNER"`
+}
+
+type tableItem struct {
+	Id    string `json:"id" table:"ID"`
+	Title string `json:"title" table:"TITLE,8"`
+	Size  int64  `json:"size" table:",,right"`
+	Notes string `json:"notes"`
+	TableMeta
+}
+
+func TestOutputTable(t *testing.T) {
+	run := func(out interface{}, args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "list",
+				RunE: RunFn(func(ctx *CmdCtx) (interface{}, error) {
+					return out, nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.WithOutput(true).Cobra()
+		require.NoError(t, err)
+		stdout := &bytes.Buffer{}
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(append([]string{"list"}, args...))
+		err = a.Execute()
+		return stdout.String(), err
+	}
+	items := []*tableItem{
+		{Id: "a1", Title: "short", Size: 5, Notes: "n", TableMeta: TableMeta{Owner: "me"}},
+		{Id: "b22", Title: "a rather long title", Size: 1234},
+	}
+
+	out, err := run(items, "--format", "table")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"ID    TITLE      SIZE   OWNER\n"+
+		"a1    short         5   me\n"+
+		"b22   a rathe…   1234\n", out)
+
+	out, err = run(items, "--format", "wide", "--no-headers")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"a1    short                    5   me\n"+
+		"b22   a rather long title   1234\n", out)
+
+	out, err = run(items, "--format", "table", "--columns", "size,id")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"SIZE   ID\n"+
+		"   5   a1\n"+
+		"1234   b22\n", out)
+
+	// untagged structs and maps
+	out, err = run([]*item{{Id: "x", Name: "X"}}, "--format", "table")
+	require.NoError(t, err)
+	require.Equal(t, "ID   NAME\nx    X\n", out)
+	out, err = run(items[0], "--format", "table", "--query", "$", "--columns", "id,notes")
+	require.NoError(t, err)
+	require.Equal(t, "ID   NOTES\na1   n\n", out)
+	type secretItem struct {
+		Id     string `json:"id"`
+		Secret string `json:"-"`
+	}
+	out, err = run([]*secretItem{{Id: "x", Secret: "s"}}, "--format", "table")
+	require.NoError(t, err)
+	require.Equal(t, "ID\nx\n", out)
+
+	// typed nil pointers have no rows
+	out, err = run((*tableItem)(nil), "--format", "table")
+	require.NoError(t, err)
+	require.Equal(t, "ID   TITLE   SIZE   OWNER\n", out)
+
+	_, err = run(items, "--format", "table", "--columns", "id,color")
+	require.True(t, errors.Is(err, ErrInvalidFormat), err)
+	_, err = run([]string{"a"}, "--format", "table")
+	require.True(t, errors.Is(err, ErrInvalidFormat), err)
+}
+
+func TestColor(t *testing.T) {
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "list",
+				RunE: RunFn(func(ctx *CmdCtx) ([]*item, error) {
+					return []*item{{Id: "a", Name: "A"}}, nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a
+	}
+	run := func(a *App, args ...string) (string, error) {
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		stdout := &bytes.Buffer{}
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(args)
+		err = a.Execute()
+		return stdout.String(), err
+	}
+
+	// not a terminal: no color by default
+	out, err := run(newApp().WithOutput(true), "list", "--query", "$[0]")
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"id\": \"a\",\n  \"name\": \"A\"\n}\n", out)
+
+	out, err = run(newApp().WithOutput(true), "list", "--query", "$[0]", "--color", "always")
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \x1b[34m\"id\"\x1b[0m: \x1b[32m\"a\"\x1b[0m,\n  \x1b[34m\"name\"\x1b[0m: \x1b[32m\"A\"\x1b[0m\n}\n", out)
+
+	out, err = run(newApp().WithOutput(true).WithColor(ColorAlways), "list", "--format", "table")
+	require.NoError(t, err)
+	require.Equal(t, "\x1b[1mID   NAME\x1b[0m\na    A\n", out)
+
+	out, err = run(newApp().WithOutput(true).WithColor(ColorAlways), "list", "--format", "table", "--color", "never")
+	require.NoError(t, err)
+	require.Equal(t, "ID   NAME\na    A\n", out)
+
+	_, err = run(newApp().WithOutput(true), "list", "--color", "sometimes")
+	require.Error(t, err)
+
+	// help headings
+	out, err = run(newApp().WithColor(ColorAlways), "--help")
+	require.NoError(t, err)
+	require.Contains(t, out, "\x1b[1mUsage:\x1b[0m")
+	out, err = run(newApp(), "--help")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out, "Usage:\n"), out)
+
+	require.Equal(t, "\x1b[1mTITLE\x1b[0m\n=====\n", renderTopic("# Title", true))
+	y := func(s string) string { return "\x1b[33m" + s + "\x1b[0m" }
+	require.Equal(t, "["+y("1")+","+y("true")+","+y("null")+",\x1b[32m\"a\\\"b\"\x1b[0m]",
+		colorJSON(`[1,true,null,"a\"b"]`))
+}
+
+func TestDiffAgainst(t *testing.T) {
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.json")
+	require.NoError(t, os.WriteFile(saved, []byte(`[
+		{"id": "a", "name": "A"},
+		{"id": "b", "name": "old", "x-tag": 1},
+		{"id": "c", "name": "C"}
+	]`), 0600))
+
+	run := func(args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "list",
+				RunE: RunFn(func(ctx *CmdCtx) ([]*item, error) {
+					return []*item{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}}, nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.WithOutput(true).Cobra()
+		require.NoError(t, err)
+		stdout := &bytes.Buffer{}
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(append([]string{"list"}, args...))
+		err = a.Execute()
+		return stdout.String(), err
+	}
+
+	out, err := run("--diff-against", "@"+saved)
+	require.True(t, errors.Is(err, ErrOutputDiffers), err)
+	require.Equal(t, ""+
+		"~ $[1].name: \"old\" -> \"B\"\n"+
+		"- $[1]['x-tag']: 1\n"+
+		"- $[2]: {\"id\":\"c\",\"name\":\"C\"}\n", out)
+
+	out, err = run("--diff-against", saved, "--format", "json", "--query", "$[*].name")
+	require.True(t, errors.Is(err, ErrOutputDiffers), err)
+	require.Equal(t, "[\n  {\n    \"path\": \"$[1]\",\n    \"change\": \"changed\",\n    \"old\": \"old\",\n    \"new\": \"B\"\n  },\n"+
+		"  {\n    \"path\": \"$[2]\",\n    \"change\": \"removed\",\n    \"old\": \"C\"\n  }\n]\n", out)
+
+	// no differences
+	same := filepath.Join(dir, "same.json")
+	require.NoError(t, os.WriteFile(same, []byte(`[{"id": "a", "name": "A"}, {"id": "b", "name": "B"}]`), 0600))
+	out, err = run("--diff-against", "@"+same)
+	require.NoError(t, err)
+	require.Equal(t, "", out)
+
+	_, err = run("--diff-against", "@"+filepath.Join(dir, "none.json"))
+	require.True(t, errors.IsNotExist(err), err)
+
+	// numbers are compared by value
+	require.Empty(t, diffValues("$", json.Number("1.0"), json.Number("1"), nil))
+	require.Len(t, diffValues("$", json.Number("9007199254740993"), json.Number("9007199254740992"), nil), 1)
+	_, err = decodeJSON([]byte(`{"a": 1} x`))
+	require.Error(t, err)
+}
+
+func TestDirs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", filepath.Join(tmp, "xdg-state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "xdg-cache"))
+
+	var stateDir, cacheDir string
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "my-cli",
+			SubCommands: []*Cmd{{
+				Use: "sync",
+				RunE: RunFn(func(ctx *CmdCtx) error {
+					var err error
+					if stateDir, err = ctx.StateDir(); err != nil {
+						return err
+					}
+					cacheDir, err = ctx.CacheDir()
+					return err
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a
+	}
+	run := func(a *App, args ...string) {
+		a.SetArgs(append([]string{"sync"}, args...))
+		require.NoError(t, a.Execute())
+		require.DirExists(t, stateDir)
+		require.DirExists(t, cacheDir)
+	}
+
+	a := newApp()
+	require.Equal(t, filepath.Join(tmp, "xdg-state", "my-cli"), a.StateDir())
+	require.NoDirExists(t, a.StateDir())
+	run(a)
+	require.Equal(t, filepath.Join(tmp, "xdg-state", "my-cli"), stateDir)
+	require.Equal(t, filepath.Join(tmp, "xdg-cache", "my-cli"), cacheDir)
+
+	a = newApp().WithStateDir(filepath.Join(tmp, "opt-state")).WithCacheDir(filepath.Join(tmp, "opt-cache"))
+	run(a)
+	require.Equal(t, filepath.Join(tmp, "opt-state"), stateDir)
+	require.Equal(t, filepath.Join(tmp, "opt-cache"), cacheDir)
+
+	t.Setenv("MY_CLI_STATE_DIR", filepath.Join(tmp, "env-state"))
+	run(newApp().WithStateDir(filepath.Join(tmp, "opt-state")))
+	require.Equal(t, filepath.Join(tmp, "env-state"), stateDir)
+
+	run(newApp().WithDirFlags(true), "--state-dir", filepath.Join(tmp, "flag-state"), "--cache-dir", filepath.Join(tmp, "flag-cache"))
+	require.Equal(t, filepath.Join(tmp, "flag-state"), stateDir)
+	require.Equal(t, filepath.Join(tmp, "flag-cache"), cacheDir)
+
+	// flags are opt-in
+	a = newApp()
+	a.SetArgs([]string{"sync", "--state-dir", tmp})
+	require.Error(t, a.Execute())
+}
+
+func TestConfigCommand(t *testing.T) {
+	type input struct {
+		Library  string   `cmd:"flag,library,library id"`
+		Limit    int      `cmd:"flag,limit,max number of results"`
+		Tags     []string `cmd:"flag,tags,tags to match"`
+		Password string   `cmd:"flag,password,the password"`
+	}
+	file := filepath.Join(t.TempDir(), "cli", "config.json")
+	var got *input
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "list",
+				Input: &input{Limit: 10},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					got = in
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithConfigCommand(true).WithConfigFile(file)
 	}
+	run := func(args ...string) (string, error) {
+		a := newApp()
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		a.SetArgs(args)
+		err = a.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("config", "path")
+	require.NoError(t, err)
+	require.Equal(t, file+"\n", out)
+
+	out, err = run("config", "list")
+	require.NoError(t, err)
+	require.Empty(t, out)
+
+	_, err = run("config", "set", "library", "ilib123")
+	require.NoError(t, err)
+	_, err = run("config", "set", "limit", "5")
+	require.NoError(t, err)
+	_, err = run("config", "set", "tags", "a,b")
+	require.NoError(t, err)
+
+	out, err = run("config", "get", "limit")
+	require.NoError(t, err)
+	require.Equal(t, "5\n", out)
+	out, err = run("config", "list")
+	require.NoError(t, err)
+	require.Equal(t, "library=ilib123\nlimit=5\ntags=a,b\n", out)
+
+	bb, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"library":"ilib123","limit":5,"tags":["a","b"]}`, string(bb))
+
+	_, err = run("config", "set", "limit", "x")
+	require.True(t, errors.Is(err, ErrInvalidConfig), err)
+	_, err = run("config", "set", "unknown", "x")
+	require.True(t, errors.IsNotExist(err), err)
+	_, err = run("config", "set", "password", "pwd")
+	require.True(t, errors.IsKind(errors.K.Permission, err), err)
+	_, err = run("config", "get", "password")
+	require.True(t, errors.IsNotExist(err), err)
+
+	// flags not set on the command line take their value from the config
+	_, err = run("list", "--limit", "20")
+	require.NoError(t, err)
+	require.Equal(t, &input{Library: "ilib123", Limit: 20, Tags: []string{"a", "b"}}, got)
+
+	_, err = run("env", "list")
+	require.Error(t, err) // env command not enabled
+
+	a := newApp().WithEnvCommand(true)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	sb := &strings.Builder{}
+	root.SetOut(sb)
+	a.SetArgs([]string{"env", "list"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, `COMMAND   FLAG        ENV  DEFAULT  VALUE    SOURCE
+cli list  --library   -             ilib123  config
+cli list  --limit     -    10       5        config
+cli list  --password  -                      default
+cli list  --tags      -    []       [a,b]    config
+`, sb.String())
+
+	_, err = run("config", "unset", "library")
+	require.NoError(t, err)
+	out, err = run("config", "list")
+	require.NoError(t, err)
+	require.Equal(t, "limit=5\ntags=a,b\n", out)
+
+	// the config is validated when edited
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	require.NoError(t, os.WriteFile(editor, []byte("#!/bin/sh\necho '{\"limit\":\"many\"}' > \"$1\"\n"), 0755))
+	t.Setenv("VISUAL", editor)
+	_, err = run("config", "edit")
+	require.True(t, errors.Is(err, ErrInvalidConfig), err)
+	_, err = run("list")
+	require.True(t, errors.Is(err, ErrInvalidConfig), err)
+}
+
+func TestCredentials(t *testing.T) {
+	type input struct {
+		Qid    string        `cmd:"flag,qid,content id"`
+		ApiKey params.Secret `cmd:"flag,api-key,the api key"`
+	}
+	store := credentials.File(filepath.Join(t.TempDir(), "credentials.json"))
+	var got *input
+	var fromCtx string
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				Input: &input{},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					got = in
+					fromCtx, _ = ctx.Credential("api-key")
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithCredentials(store).WithAuthCommand(true).WithEnvCommand(true)
+	}
+	run := func(a *App, stdin string, args ...string) (string, error) {
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetErr(io.Discard)
+		root.SetIn(strings.NewReader(stdin))
+		a.SetArgs(args)
+		err = a.Execute()
+		return out.String(), err
+	}
+
+	out, err := run(newApp(), "", "auth", "status")
+	require.NoError(t, err)
+	require.Equal(t, "api-key: not stored\n", out)
+
+	_, err = run(newApp(), "k3y\n", "auth", "login")
+	require.NoError(t, err)
+	out, err = run(newApp(), "", "auth", "status")
+	require.NoError(t, err)
+	require.Equal(t, "api-key: stored\n", out)
+
+	// secret flags not set on the command line take their value from the store
+	_, err = run(newApp(), "", "get")
+	require.NoError(t, err)
+	require.Equal(t, params.Secret("k3y"), got.ApiKey)
+	require.Equal(t, "k3y", fromCtx)
+	_, err = run(newApp(), "", "get", "--api-key", "other")
+	require.NoError(t, err)
+	require.Equal(t, params.Secret("other"), got.ApiKey)
+
+	out, err = run(newApp(), "", "env", "get")
+	require.NoError(t, err)
+	require.Equal(t, `COMMAND  FLAG       ENV  DEFAULT  VALUE  SOURCE
+cli get  --api-key  -             ***    credentials
+cli get  --qid      -                    default
+`, out)
+
+	_, err = run(newApp().WithLogin(func(cmd *cobra.Command, name string) (string, error) {
+		return "from-" + name, nil
+	}), "", "auth", "login")
+	require.NoError(t, err)
+	_, err = run(newApp(), "", "get")
+	require.NoError(t, err)
+	require.Equal(t, params.Secret("from-api-key"), got.ApiKey)
+
+	_, err = run(newApp(), "", "auth", "logout", "api-key")
+	require.NoError(t, err)
+	_, err = run(newApp(), "", "get")
+	require.NoError(t, err)
+	require.Equal(t, params.Secret(""), got.ApiKey)
+	_, err = store.Get("api-key")
+	require.True(t, errors.Is(err, credentials.ErrNotFound), err)
+
+	// secrets are not stored in the config
+	_, err = run(newApp().WithConfigCommand(true).WithConfigFile(filepath.Join(t.TempDir(), "config.json")),
+		"", "config", "set", "api-key", "k3y")
+	require.True(t, errors.IsKind(errors.K.Permission, err), err)
+}
+
+func TestHTTPClient(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var failures int32
+	var userAgent, proxied string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		if r.URL.IsAbs() {
+			proxied = r.URL.String()
+		}
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caBundle,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw}), 0600))
+
+	type input struct {
+		Url string `cmd:"arg,url,the url,0"`
+	}
+	var body string
+	newApp := func(o *HTTPOptions) *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use:     "cli",
+			Version: "1.2.3",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				Input: &input{},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					resp, err := ctx.HTTPClient().Get(in.Url)
+					if err != nil {
+						return err
+					}
+					defer resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						return errors.E("get", errors.K.Unavailable, "status", resp.StatusCode)
+					}
+					bb, err := io.ReadAll(resp.Body)
+					body = string(bb)
+					return err
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithHTTPOptions(o).WithHTTPFlags(true)
+	}
+	run := func(a *App, args ...string) error {
+		body = ""
+		a.SetArgs(append([]string{"get"}, args...))
+		return a.Execute()
+	}
+
+	require.NoError(t, run(newApp(nil), srv.URL))
+	require.Equal(t, "ok", body)
+	require.Equal(t, "cli/1.2.3", userAgent)
+
+	// retries
+	failures = 2
+	require.Error(t, run(newApp(&HTTPOptions{Retries: 1}), srv.URL))
+	failures = 2
+	require.NoError(t, run(newApp(&HTTPOptions{Retries: 1}), srv.URL, "--http-retries", "2", "--user-agent", "test/1"))
+	require.Equal(t, "ok", body)
+	require.Equal(t, "test/1", userAgent)
+
+	// TLS
+	require.Error(t, run(newApp(nil), tlsSrv.URL))
+	require.NoError(t, run(newApp(nil), tlsSrv.URL, "--tls-skip-verify"))
+	require.NoError(t, run(newApp(&HTTPOptions{CABundle: caBundle}), tlsSrv.URL))
+	err := run(newApp(nil), tlsSrv.URL, "--ca-bundle", filepath.Join(t.TempDir(), "none.pem"))
+	require.True(t, errors.IsKind(errors.K.IO, err), err)
+
+	// proxy
+	require.NoError(t, run(newApp(nil), "http://example.invalid/path", "--http-proxy", srv.URL))
+	require.Equal(t, "http://example.invalid/path", proxied)
+
+	// timeout
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	require.Error(t, run(newApp(nil), slow.URL, "--http-timeout", "20ms"))
+
+	// a client set with WithDeps takes precedence
+	deps := &http.Client{Transport: http.DefaultTransport}
+	a := newApp(nil).WithDeps(&Deps{HTTPClient: deps})
+	require.NoError(t, run(a, srv.URL, "--user-agent", "ignored"))
+	require.NotEqual(t, "ignored", userAgent)
+
+	// requests with http.NoBody and without GetBody are retried
+	cl, err := NewHTTPClient(&HTTPOptions{Retries: 1})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, srv.URL, http.NoBody)
+	require.NoError(t, err)
+	req.GetBody = nil
+	failures = 1
+	resp, err := cl.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTraceHTTP(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	var failures int32
+	var requestIds []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIds = append(requestIds, r.Header.Get("X-Request-Id"))
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	var traces []*HTTPTrace
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "get",
+				RunE: RunFn(func(ctx *CmdCtx) error {
+					resp, err := ctx.HTTPClient().Get(strings.Replace(srv.URL, "http://", "http://joe:pwd@", 1) + "/p?id=1&api_token=abc")
+					if err == nil {
+						_ = resp.Body.Close()
+					}
+					return err
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithHTTPOptions(&HTTPOptions{
+			Retries: 1,
+			Tracer:  func(t *HTTPTrace) { traces = append(traces, t) },
+		}).WithHTTPFlags(true)
+	}
+
+	a := newApp()
+	a.SetArgs([]string{"get"})
+	require.NoError(t, a.Execute())
+	require.Empty(t, traces)
+	require.Equal(t, []string{""}, requestIds)
+
+	failures = 1
+	requestIds = nil
+	a = newApp()
+	a.SetArgs([]string{"get", "--trace-http"})
+	require.NoError(t, a.Execute())
+	require.Len(t, traces, 2)
+	require.Len(t, requestIds, 2)
+	require.NotEmpty(t, requestIds[0])
+	require.Equal(t, requestIds[0], requestIds[1])
+	for i, tr := range traces {
+		require.Equal(t, "GET", tr.Method)
+		require.Equal(t, strings.Replace(srv.URL, "http://", "http://***@", 1)+"/p?id=1&api_token=***", tr.URL)
+		require.Equal(t, requestIds[0], tr.CorrelationID)
+		require.Equal(t, i, tr.Attempt)
+		require.NoError(t, tr.Err)
+		require.Greater(t, tr.Duration, time.Duration(0))
+	}
+	require.Equal(t, http.StatusBadGateway, traces[0].Status)
+	require.Equal(t, http.StatusOK, traces[1].Status)
+}
+
+func TestLifecycle(t *testing.T) {
+	var events []*CommandEvent
+	var ids []string
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "get",
+				RunE: RunFn(func(ctx *CmdCtx, in *getInput) (string, error) {
+					ids = append(ids, ctx.InvocationID())
+					time.Sleep(time.Millisecond)
+					if in.Id == "bad" {
+						return "", errors.E("get", errors.K.Invalid)
+					}
+					return "out-" + in.Id, nil
+				}),
+				Input: &getInput{},
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithLifecycle(func(ev *CommandEvent) {
+			events = append(events, ev)
+		})
+	}
+
+	a := newApp()
+	a.SetArgs([]string{"get", "id1"})
+	require.NoError(t, a.Execute())
+	require.Len(t, events, 2)
+	start, end := events[0], events[1]
+	require.Equal(t, EventStart, start.Type)
+	require.Equal(t, EventEnd, end.Type)
+	require.Len(t, ids, 1)
+	require.NotEmpty(t, ids[0])
+	for _, ev := range events {
+		require.Equal(t, ids[0], ev.InvocationID)
+		require.Equal(t, "cli get", ev.Path)
+		require.Equal(t, &getInput{Id: "id1"}, ev.Input)
+		require.Equal(t, map[string]string{"id": "id1"}, ev.FlagsAndArgs)
+		require.Equal(t, start.Start, ev.Start)
+	}
+	require.Nil(t, start.Output)
+	require.True(t, start.End.IsZero())
+	require.Equal(t, "out-id1", end.Output)
+	require.NoError(t, end.Err)
+	require.GreaterOrEqual(t, end.Duration, time.Millisecond)
+	require.Equal(t, end.End.Sub(end.Start), end.Duration)
+
+	events = nil
+	a = newApp()
+	a.SetArgs([]string{"get", "bad"})
+	require.Error(t, a.Execute())
+	require.Len(t, events, 2)
+	require.Error(t, events[1].Err)
+	require.Len(t, ids, 2)
+	require.NotEqual(t, ids[0], ids[1])
+	require.Equal(t, ids[1], events[1].InvocationID)
+}
+
+func TestCmdContext(t *testing.T) {
+	// lib only receives a context.Context
+	lib := func(c context.Context) string {
+		ctx, ok := CmdCtxFromContext(c)
+		if !ok {
+			return ""
+		}
+		v, _ := ctx.Get("user")
+		return fmt.Sprint(v)
+	}
+	type key string
+	var user string
+	var parentValue interface{}
+	newApp := func() (*App, *cobra.Command) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				Input: &getInput{},
+				RunE: RunFn(func(ctx *CmdCtx, in *getInput) error {
+					ctx.Set("user", in.Id)
+					user = lib(ctx.Context())
+					parentValue = ctx.Context().Value(key("k"))
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		return a, root
+	}
+
+	a, _ := newApp()
+	a.SetArgs([]string{"get", "joe"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, "joe", user)
+
+	// the context of ExecuteContext is the parent
+	_, root := newApp()
+	root.SetArgs([]string{"get", "ann"})
+	require.NoError(t, root.ExecuteContext(context.WithValue(context.Background(), key("k"), "v")))
+	require.Equal(t, "ann", user)
+	require.Equal(t, "v", parentValue)
+
+	// contexts of Invoke are not bound to a running command
+	_, err := a.Invoke(nil, []string{"cli", "get"}, &getInput{Id: "bob"})
+	require.NoError(t, err)
+	require.Equal(t, "bob", user)
+}
+
+// signalWriter signals each write
+type signalWriter struct {
+	bytes.Buffer
+	written chan struct{}
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	w.written <- struct{}{}
+	return n, err
+}
+
+func (w *signalWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func TestStreamOutput(t *testing.T) {
+	items := []*item{{Id: "1", Name: "one"}, {Id: "22", Name: "two"}, {Id: "333", Name: "three"}}
+	var ends []interface{}
+	var incremental, checkIncremental bool
+	run := func(output bool, emit bool, args ...string) (string, error) {
+		stdout := &signalWriter{written: make(chan struct{}, 100)}
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "list",
+				RunE: RunFn(func(ctx *CmdCtx) (<-chan *item, error) {
+					if emit {
+						for _, it := range items {
+							if err := ctx.Emit(it); err != nil {
+								return nil, err
+							}
+						}
+						return nil, nil
+					}
+					ch := make(chan *item)
+					go func() {
+						defer close(ch)
+						incremental = true
+						for _, it := range items {
+							ch <- it
+							if !checkIncremental {
+								continue
+							}
+							select {
+							case <-stdout.written:
+							case <-time.After(time.Second):
+								incremental = false
+							}
+						}
+					}()
+					return ch, nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.SetCommandEnd(func(cmd *cobra.Command, out interface{}, err error) {
+			ends = append(ends, out)
+		})
+		root, err := a.WithOutput(output).Cobra()
+		require.NoError(t, err)
+		root.SetOut(stdout)
+		root.SetErr(io.Discard)
+		a.SetArgs(append([]string{"list"}, args...))
+		err = a.Execute()
+		return stdout.String(), err
+	}
+
+	// items are printed as they arrive from the channel
+	checkIncremental = true
+	out, err := run(true, false, "--format", "table")
+	checkIncremental = false
+	require.NoError(t, err)
+	require.True(t, incremental)
+	require.Equal(t, ""+
+		"ID   NAME\n"+
+		"1    one\n"+
+		"22   two\n"+
+		"333   three\n", out)
+	require.Equal(t, &StreamOutput{Items: 3}, ends[0])
+
+	out, err = run(true, true, "--query", "$.name")
+	require.NoError(t, err)
+	require.Equal(t, "one\ntwo\nthree\n", out)
+
+	out, err = run(true, true)
+	require.NoError(t, err)
+	require.Equal(t, `{
+  "id": "1",
+  "name": "one"
+}
+{
+  "id": "22",
+  "name": "two"
+}
+{
+  "id": "333",
+  "name": "three"
+}
+`, out)
+
+	// items are collected with --diff-against
+	saved := filepath.Join(t.TempDir(), "saved.json")
+	require.NoError(t, os.WriteFile(saved, []byte(`[{"id":"1","name":"one"},{"id":"22","name":"deux"}]`), 0600))
+	out, err = run(true, false, "--diff-against", "@"+saved)
+	require.True(t, errors.Is(err, ErrOutputDiffers), err)
+	require.Equal(t, "~ $[1].name: \"deux\" -> \"two\"\n+ $[2]: {\"id\":\"333\",\"name\":\"three\"}\n", out)
+
+	// items are not printed when output is disabled
+	ends = nil
+	out, err = run(false, false)
+	require.NoError(t, err)
+	require.Empty(t, out)
+	require.Equal(t, []interface{}{&StreamOutput{Items: 3}}, ends)
+
+	// Emit requires an emit function
+	require.Error(t, NewCmdCtx().Emit(items[0]))
+}
+
+func TestResultSink(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "results.jsonl")
+	var flushed string
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use: "copy",
+			RunE: RunFn(func(ctx *CmdCtx) error {
+				v, ok := ctx.Get(CtxAddResultFn)
+				if !ok {
+					return errors.E("copy", errors.K.Invalid, "reason", "no add result function")
+				}
+				add := v.(AddResultFn)
+				add("a", &item{Id: "a", Name: "first"}, nil)
+				// flushed before the command ends
+				bb, _ := os.ReadFile(file)
+				flushed = string(bb)
+				add("b", nil, errors.Str("copy failed"))
+				return nil
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.SetMonitorResults(true)
+	defer a.SetMonitorResults(false)
+	a.WithResultSink(ResultFileSink(file, true))
+	a.SetArgs([]string{"copy"})
+	require.NoError(t, a.Execute())
+
+	require.Equal(t, `{"key":"a","result":{"id":"a","name":"first"}}`+"\n", flushed)
+	bb, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, flushed+`{"key":"b","error":"copy failed","command":"cli copy","invocation":"cli copy"}`+"\n", string(bb))
+	require.Len(t, a.getResults(), 2)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, ResultJSONLSink(buf)(newCommandResult("c", "done", nil)))
+	require.Equal(t, `{"key":"c","result":"done"}`+"\n", buf.String())
+}
+
+func TestPrintResults(t *testing.T) {
+	newApp := func(buf *bytes.Buffer) *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use: "copy",
+				RunE: RunFn(func(ctx *CmdCtx) error {
+					v, _ := ctx.Get(CtxAddResultFn)
+					v.(AddResultFn)("a", &item{Id: "a", Name: "first"}, nil)
+					v.(AddResultFn)("b", nil, errors.Str("copy failed"))
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.SetMonitorResults(true)
+		t.Cleanup(func() { a.SetMonitorResults(false) })
+		return a.WithOutput(true).WithResultsWriter(buf)
+	}
+	print := func(args ...string) string {
+		buf := &bytes.Buffer{}
+		a := newApp(buf)
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		root.SetOut(io.Discard)
+		a.SetArgs(append([]string{"copy"}, args...))
+		require.NoError(t, a.Execute())
+		a.printResults("exit signal")
+		return buf.String()
+	}
+
+	require.Equal(t, `
+exit signal - intermediary results
+a: {"id":"a","name":"first"}
+b: no result
+error: copy failed
+
+`, print())
+	require.Equal(t, print(), print("--format", "plain"))
+	require.Equal(t, ""+
+		"KEY   RESULT                      ERROR\n"+
+		"a     {\"id\":\"a\",\"name\":\"first\"}\n"+
+		"b                                 copy failed\n", print("--format", "table"))
+	require.JSONEq(t, `[{"key":"a","result":{"id":"a","name":"first"}},`+
+		`{"key":"b","error":"copy failed","command":"cli copy","invocation":"cli copy"}]`,
+		print("--format", "json"))
+
+	var printed []*CmdResult
+	a := newApp(&bytes.Buffer{}).WithPrintResults(func(results []*CmdResult) { printed = results })
+	a.SetArgs([]string{"copy"})
+	require.NoError(t, a.Execute())
+	a.printResults("exit signal")
+	require.Len(t, printed, 2)
+
+	// plain output format
+	buf := &bytes.Buffer{}
+	require.NoError(t, formatPlain(buf, nil, []interface{}{"a", 1, map[string]int{"b": 2}, &CmdResult{Key: "k", Result: "r"}}))
+	require.Equal(t, "a\n1\n{\"b\":2}\nk: r\n", buf.String())
+}
+
+func TestProvide(t *testing.T) {
+	type client struct{ url string }
+	type service struct{ cl *client }
+	constructed := 0
+	var resolved []*client
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use: "get",
+			RunE: RunFn(func(ctx *CmdCtx) (string, error) {
+				svc, err := Resolve[*service](ctx, "service")
+				if err != nil {
+					return "", err
+				}
+				cl, err := Resolve[*client](ctx, "client")
+				if err != nil {
+					return "", err
+				}
+				resolved = append(resolved, cl)
+				require.Same(t, cl, svc.cl)
+				return cl.url, nil
+			}),
+		}, {
+			Use: "fail",
+			RunE: RunFn(func(ctx *CmdCtx) error {
+				_, err := ctx.Resolve("broken")
+				return err
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.Provide("client", func(ctx *CmdCtx) (interface{}, error) {
+		constructed++
+		return &client{url: "https://host"}, nil
+	}).Provide("service", func(ctx *CmdCtx) (interface{}, error) {
+		cl, err := Resolve[*client](ctx, "client")
+		return &service{cl: cl}, err
+	}).Provide("broken", func(ctx *CmdCtx) (interface{}, error) {
+		return nil, errors.E("connect", errors.K.Unavailable, "reason", "no backend")
+	})
+
+	// constructed once per invocation
+	for i := 1; i <= 2; i++ {
+		out, err := a.Invoke(nil, []string{"cli", "get"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, "https://host", out)
+		require.Equal(t, i, constructed)
+	}
+	require.NotSame(t, resolved[0], resolved[1])
+
+	a.SetArgs([]string{"get"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, 3, constructed)
+
+	_, err = a.Invoke(nil, []string{"cli", "fail"}, nil)
+	require.True(t, errors.IsKind(errors.K.Unavailable, err), err)
+
+	ctx := NewCmdCtx()
+	a.setProviders(ctx)
+	_, err = ctx.Resolve("unknown")
+	require.True(t, errors.Is(err, ErrDependencyNotFound), err)
+	_, err = Resolve[*client](NewCmdCtx(), "client")
+	require.True(t, errors.Is(err, ErrDependencyNotFound), err)
+	_, err = Resolve[string](ctx, "client")
+	require.True(t, errors.IsKind(errors.K.Invalid, err), err)
+	require.Contains(t, err.Error(), "expected [string]")
+}
+
+func TestDeprecation(t *testing.T) {
+	run := RunFn(func(ctx *CmdCtx) error { return nil })
+	newApp := func(version string) *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use:     "cli",
+			Version: version,
+			SubCommands: []*Cmd{
+				{Use: "old", Short: "old command", RunE: run, Deprecated: "use 'new' instead",
+					Deprecation: &Deprecation{Since: "v1.2", Removal: "v2.0"}},
+				{Use: "gone", RunE: run, Deprecation: &Deprecation{Removal: "1.5", Enforce: true}},
+			},
+		}), nil)
+		require.NoError(t, err)
+		return a
+	}
+	exec := func(a *App, args ...string) (string, error) {
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		stderr := &strings.Builder{}
+		root.SetErr(stderr)
+		root.SetOut(io.Discard)
+		a.SetArgs(args)
+		err = a.Execute()
+		return stderr.String(), err
+	}
+
+	for _, tc := range []struct {
+		version string
+		want    string
+	}{
+		{"1.1", `Notice: command "old" will be deprecated in v1.2 and removed in v2.0: use 'new' instead`},
+		{"1.2.3", `Warning: command "old" is deprecated since v1.2 and will be removed in v2.0: use 'new' instead`},
+		{"", `Warning: command "old" is deprecated since v1.2 and will be removed in v2.0: use 'new' instead`},
+		{"dev", `Warning: command "old" is deprecated since v1.2 and will be removed in v2.0: use 'new' instead`},
+		{"v2.0.0-rc1", `Error: command "old" is deprecated and due for removal since v2.0: use 'new' instead`},
+	} {
+		stderr, err := exec(newApp(tc.version), "old")
+		require.NoError(t, err, tc.version)
+		require.Equal(t, tc.want+"\n", stderr, tc.version)
+	}
+
+	// hard failure after the enforced removal version
+	stderr, err := exec(newApp("1.4"), "gone")
+	require.NoError(t, err)
+	require.Contains(t, stderr, `Warning: command "gone" is deprecated and will be removed in 1.5`)
+	_, err = exec(newApp("1.5"), "gone")
+	require.True(t, errors.Is(err, ErrCommandRemoved), err)
+	_, err = newApp("1.5").Invoke(nil, []string{"cli", "gone"}, nil)
+	require.True(t, errors.Is(err, ErrCommandRemoved), err)
+
+	// help
+	a := newApp("1.3")
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	out := &strings.Builder{}
+	root.SetOut(out)
+	a.SetArgs([]string{"old", "--help"})
+	require.NoError(t, a.Execute())
+	require.True(t, strings.HasPrefix(out.String(), ""+
+		`DEPRECATED: command "old" is deprecated since v1.2 and will be removed in v2.0: use 'new' instead`+"\n\n"+
+		"old command\n"), out.String())
+	require.Empty(t, root.Commands()[0].Deprecated)
+
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "old", RunE: run, Deprecation: &Deprecation{Since: "one"}}},
+	}), nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrInvalidSpec), err)
+}
+
+func TestSpecAnnotations(t *testing.T) {
+	var category string
+	run := RunFn(func(ctx *CmdCtx) error {
+		category = ctx.Category()
+		return nil
+	})
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{
+			{Use: "get", Category: "content", Roles: []string{"reader"}, RunE: run,
+				Annotations: map[string]string{"mode": "read-only"}},
+			{Use: "delete", GroupID: "admin", RunE: run,
+				Annotations: map[string]string{"mode": "mutating"}},
+			{Use: "version", RunE: run},
+		},
+	}), nil)
+	require.NoError(t, err)
+	readOnly := false
+	a.WithAuthorizer(func(ctx *CmdCtx, path string, in interface{}) error {
+		if readOnly && ctx.Annotation("mode") != "read-only" {
+			return errors.E("authorize", errors.K.Permission, ErrUnauthorized, "reason", "read-only mode")
+		}
+		return nil
+	})
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	get, _, err := root.Find([]string{"get"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"mode": "read-only"}, AnnotationsFromCommand(get))
+	require.Equal(t, "content", CategoryFromCommand(get))
+	AnnotationsFromCommand(get)["mode"] = "changed"
+	require.Equal(t, "read-only", AnnotationsFromCommand(get)["mode"])
+	version, _, err := root.Find([]string{"version"})
+	require.NoError(t, err)
+	require.Nil(t, AnnotationsFromCommand(version))
+	require.Empty(t, CategoryFromCommand(version))
+
+	readOnly = true
+	a.SetArgs([]string{"get"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, "content", category)
+	a.SetArgs([]string{"delete"})
+	require.True(t, errors.Is(a.Execute(), ErrUnauthorized))
+	readOnly = false
+	_, err = a.Invoke(nil, []string{"cli", "delete"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "admin", category)
+
+	ctx := NewCmdCtx()
+	require.Nil(t, ctx.Annotations())
+	require.Empty(t, ctx.Annotation("mode"))
+	require.Empty(t, ctx.Category())
+}
+
+func TestFailedInvocation(t *testing.T) {
+	type loginInput struct {
+		User     string `cmd:"flag,user,the user"`
+		Password string `cmd:"flag,password,the password"`
+		Host     string `cmd:"arg,host,the host,0"`
+	}
+	var results []*CmdResult
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:   "login",
+			Input: &loginInput{},
+			RunE: RunFn(func(ctx *CmdCtx, in *loginInput) error {
+				v, _ := ctx.Get(CtxAddResultFn)
+				v.(AddResultFn)(in.Host, nil, errors.Str("unreachable"))
+				return errors.E("login", errors.K.Unavailable)
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.SetMonitorResults(true)
+	defer a.SetMonitorResults(false)
+	a.WithPrintResults(func(res []*CmdResult) { results = res })
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	root.SetErr(io.Discard)
+	root.SetOut(io.Discard)
+
+	a.SetArgs([]string{"login", "--user", "joe", "--password", "pwd", "my host"})
+	err = a.Execute()
+	require.Error(t, err)
+	e, ok := err.(*errors.Error)
+	require.True(t, ok)
+	require.Equal(t, "cli login", e.Field("path"))
+	require.Equal(t, "cli login --password *** --user joe 'my host'", e.Field("invocation"))
+	require.NotContains(t, err.Error(), "pwd")
+
+	a.printResults("exit signal")
+	require.Len(t, results, 1)
+	require.Equal(t, "cli login", results[0].Command)
+	require.Equal(t, "cli login --password *** --user joe 'my host'", results[0].Invocation)
+}
+
+func TestArgValidators(t *testing.T) {
+	maxTwo := func(c *cobra.Command) func(c *cobra.Command, args []string) error {
+		return cobra.MaximumNArgs(2)
+	}
+	rt := mustRt(t).WithArgValidators(map[string]ValidatorCtor{"maxTwo": maxTwo})
+	spec := `{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "tag", "run_e": "config", "args_validator": "maxTwo"}
+		]
+	}
+}`
+	a, err := NewAppFromSpec(spec, rt)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	tag, _, err := root.Find([]string{"tag"})
+	require.NoError(t, err)
+	require.NoError(t, tag.Args(tag, []string{"a", "b"}))
+	require.Error(t, tag.Args(tag, []string{"a", "b", "c"}))
+
+	// code-defined apps marshal validators referenced by name
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "tag", RunE: RunFnWithName("config"), ArgsValidatorName: "maxTwo"}},
+	}), rt)
+	require.NoError(t, err)
+	bb, err := json.Marshal(a.spec.CmdRoot)
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"args_validator":"maxTwo"`)
+
+	a, err = NewAppFromSpec(strings.Replace(spec, "maxTwo", "unknown", 1), rt)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, ErrFunctionNotFound), err)
+}
+
+func TestDebugBindings(t *testing.T) {
+	type loginInput struct {
+		User     string `cmd:"flag,user,the user"`
+		Password string `cmd:"flag,password,the password"`
+		Retries  int    `cmd:"flag,retries,number of retries"`
+		Host     string `cmd:"arg,host,the host,0"`
+		Port     int    `cmd:"arg,port,the port,1"`
+	}
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:   "login",
+			Input: &loginInput{Retries: 3},
+			RunE: RunFn(func(ctx *CmdCtx, in *loginInput) error {
+				return nil
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	a.WithDebugBindings(true)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	f := root.PersistentFlags().Lookup(debugBindingsFlag)
+	require.NotNil(t, f)
+	require.True(t, f.Hidden)
+
+	stderr := &bytes.Buffer{}
+	root.SetErr(stderr)
+	root.SetOut(io.Discard)
+	a.SetArgs([]string{"login", "--user", "joe", "--password", "pwd", "host", "8080"})
+	require.NoError(t, a.Execute())
+	require.Empty(t, stderr.String())
+
+	a.SetArgs([]string{"login", "--debug-bindings", "--user", "joe", "--password", "pwd", "host", "8080"})
+	require.NoError(t, a.Execute())
+	out := stderr.String()
+	require.NotContains(t, out, "pwd")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 8, out)
+	require.Equal(t, "bindings of 'cli login'", lines[0])
+	require.Equal(t, []string{"FLAG", "KIND", "ORDER", "TYPE", "DEFAULT", "VALUE", "SOURCE", "CONFIG", "KEY"},
+		strings.Fields(lines[1]))
+	require.Equal(t, []string{"--password", "flag", "string", "***", "flag"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"--retries", "flag", "int", "3", "3", "default"}, strings.Fields(lines[3]))
+	require.Equal(t, []string{"--user", "flag", "string", "joe", "flag"}, strings.Fields(lines[4]))
+	require.Equal(t, []string{"<host>", "arg", "0", "string", "host", "flag"}, strings.Fields(lines[5]))
+	require.Equal(t, []string{"<port>", "arg", "1", "int", "0", "8080", "flag"}, strings.Fields(lines[6]))
+	require.True(t, strings.HasPrefix(lines[7], "5 bindings (2 args) bound in "), lines[7])
+
+	// the env toggle
+	stderr.Reset()
+	t.Setenv("CLI_DEBUG_BINDINGS", "true")
+	a.SetArgs([]string{"login", "host", "8080"})
+	require.NoError(t, a.Execute())
+	require.Contains(t, stderr.String(), "bindings of 'cli login'")
+}
+
+func TestSpecSet(t *testing.T) {
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "tag", Short: "tag content", RunE: RunFunc{name: "config"}}},
+	}), mustRt(t))
+	require.NoError(t, err)
+	s := a.Spec().String()
+
+	restored := NewSpec(nil, nil)
+	require.NoError(t, restored.Set(s))
+	require.Equal(t, "cli", restored.CmdRoot.Use)
+	require.Len(t, restored.CmdRoot.SubCommands, 1)
+	require.Equal(t, "tag content", restored.CmdRoot.SubCommands[0].Short)
+	require.Equal(t, s, restored.String())
+
+	a2, err := NewApp(restored, mustRt(t))
+	require.NoError(t, err)
+	_, err = a2.Cobra()
+	require.NoError(t, err)
+
+	err = restored.Set("{")
+	require.Error(t, err)
+	require.Equal(t, s, restored.String())
+}
+
+func TestNewCobraReset(t *testing.T) {
+	type tagInput struct {
+		Tags  []string `cmd:"flag,tags,some tags"`
+		Force bool     `cmd:"flag,force,force tagging"`
+		Id    string   `cmd:"arg,id,content id,0"`
+	}
+	var got []tagInput
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:   "tag",
+			Input: &tagInput{Tags: []string{"default"}},
+			RunE: RunFn(func(ctx *CmdCtx, in *tagInput) error {
+				got = append(got, *in)
+				return nil
+			}),
+		}},
+	}), nil)
+	require.NoError(t, err)
+
+	for _, args := range [][]string{
+		{"tag", "--tags", "a", "--tags", "b", "--force", "iq__1"},
+		{"tag", "--tags", "c", "iq__2"},
+		{"tag", "iq__3"},
+	} {
+		root, err := a.NewCobra()
+		require.NoError(t, err)
+		root.SetOut(io.Discard)
+		a.SetArgs(args)
+		require.NoError(t, a.Execute())
+	}
+	require.Equal(t, []tagInput{
+		{Tags: []string{"a", "b"}, Force: true, Id: "iq__1"},
+		{Tags: []string{"c"}, Id: "iq__2"},
+		{Tags: []string{"default"}, Id: "iq__3"},
+	}, got)
+}
+
+type copiedInput struct {
+	Tags  []string `cmd:"flag,tags,some tags"`
+	Inner *struct {
+		Level int `cmd:"flag,level,a level"`
+	}
+	serial int // set by the constructor
+}
+
+func TestInputCopy(t *testing.T) {
+	serial := 0
+	newInput := func() interface{} {
+		serial++
+		in := &copiedInput{Tags: []string{"default"}, serial: serial}
+		in.Inner = &struct {
+			Level int `cmd:"flag,level,a level"`
+		}{Level: 1}
+		return in
+	}
+	var got []copiedInput
+	var levels []int
+	runFn := func(ctx *CmdCtx, in *copiedInput) error {
+		got = append(got, *in)
+		levels = append(levels, in.Inner.Level)
+		// mutations don't leak into the bound input
+		in.Tags = append(in.Tags, "mutated")
+		in.Inner.Level++
+		return nil
+	}
+
+	// per command, with the constructor of the runtime
+	rt, err := RtFunctions(nil, map[string]Ctor{"copied": newInput}, map[string]Runfn{"tag": runFn})
+	require.NoError(t, err)
+	a, err := NewAppFromSpec(`{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "tag", "run_e": "tag", "input_ctor": "copied", "copy_input": true}
+		]
+	}
+}`, rt)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	root.SetOut(io.Discard)
+	tag, _, err := root.Find([]string{"tag"})
+	require.NoError(t, err)
+	bound, _ := bflags.GetCmdInput(tag)
+	for _, args := range [][]string{{"tag", "--level", "2"}, {"tag"}} {
+		a.SetArgs(args)
+		require.NoError(t, a.Execute())
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, []string{"default"}, got[1].Tags)
+	require.Equal(t, []int{2, 2}, levels) // the flag was set by the previous parse
+	require.Equal(t, []string{"default"}, bound.(*copiedInput).Tags)
+	require.Equal(t, 2, bound.(*copiedInput).Inner.Level)
+	require.NotEqual(t, got[0].serial, got[1].serial)
+	require.NotEqual(t, bound.(*copiedInput).serial, got[0].serial)
+	require.NotSame(t, got[0].Inner, got[1].Inner)
+
+	// app-wide, with an input object
+	got, levels = nil, nil
+	in := newInput().(*copiedInput)
+	a, err = NewApp(NewSpec(nil, &Cmd{
+		Use:         "cli",
+		SubCommands: []*Cmd{{Use: "tag", Input: in, RunE: RunFn(runFn)}},
+	}), nil)
+	require.NoError(t, err)
+	a.WithInputCopy(true)
+	root, err = a.Cobra()
+	require.NoError(t, err)
+	root.SetOut(io.Discard)
+	for i := 0; i < 2; i++ {
+		a.SetArgs([]string{"tag"})
+		require.NoError(t, a.Execute())
+	}
+	require.Len(t, got, 2)
+	require.Equal(t, []int{1, 1}, levels)
+	require.Equal(t, got[0].Tags, got[1].Tags)
+	require.Equal(t, []string{"default"}, in.Tags)
+	require.Equal(t, 1, in.Inner.Level)
+}
+
+func TestFlagShadowing(t *testing.T) {
+	type rootInput struct {
+		Env string `cmd:"flag,env,the environment,e,true"`
+	}
+	type tagInput struct {
+		Env string `cmd:"flag,env,the environment of the tag"`
+	}
+	type overrideInput struct {
+		Env string `cmd:"flag,env,the environment of the tag" meta:"override"`
+	}
+	newApp := func(in interface{}) *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use:   "cli",
+			Input: &rootInput{},
+			SubCommands: []*Cmd{{
+				Use:         "content",
+				SubCommands: []*Cmd{{Use: "tag", Input: in, RunE: RunFn(func(ctx *CmdCtx, in interface{}) error { return nil })}},
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a
+	}
+
+	_, err := newApp(&tagInput{}).Cobra()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, bflags.ErrDuplicateFlag))
+	require.Contains(t, err.Error(), "cli content tag")
+
+	in := &overrideInput{}
+	a := newApp(in)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	root.SetOut(io.Discard)
+	a.SetArgs([]string{"content", "tag", "--env", "prod"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, "prod", in.Env)
+}
+
+func TestUnknownCategory(t *testing.T) {
+	newSpec := func() *spec {
+		return NewSpec(
+			[]*CmdCategory{{Name: "base", Title: "Base commands", Default: true}, {Name: "tools", Title: "Tools"}},
+			&Cmd{
+				Use: "cli",
+				SubCommands: []*Cmd{
+					{Use: "get", Category: "base", RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+					{Use: "fmt", Category: "tool", RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+					{Use: "conf", GroupID: "config", SubCommands: []*Cmd{
+						{Use: "set", Category: "tools", RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+					}},
+				},
+			})
+	}
+	a, err := NewApp(newSpec(), nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidSpec))
+	e := err.(*errors.Error)
+	require.Equal(t, "tool, config", e.Field("categories"))
+	require.Equal(t, "cli fmt, cli conf", e.Field("commands"))
+	require.Equal(t, "base, tools", e.Field("known"))
+
+	a, err = NewApp(newSpec(), nil)
+	require.NoError(t, err)
+	_, err = a.WithCategoryWarnings(true).Cobra()
+	require.NoError(t, err)
+
+	// categories are not validated without declared categories
+	s := newSpec()
+	s.Categories = nil
+	a, err = NewApp(s, nil)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.NoError(t, err)
+}
+
+func TestNoDefaultCategory(t *testing.T) {
+	newSpec := func() *spec {
+		return NewSpec(
+			[]*CmdCategory{{Name: "base", Title: "Base commands"}},
+			&Cmd{
+				Use: "cli",
+				SubCommands: []*Cmd{
+					{Use: "get", Short: "get content", Category: "base", RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+					{Use: "fmt", Short: "format content", RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+					{Use: "debug", Hidden: true, RunE: RunFn(func(ctx *CmdCtx) error { return nil })},
+				},
+			})
+	}
+	s := newSpec()
+	a, err := NewApp(s, nil)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	root.SetOut(out)
+	a.SetArgs([]string{"--help"})
+	require.NoError(t, a.Execute())
+	require.Contains(t, out.String(), "Base commands\n  get ")
+	require.Contains(t, out.String(), otherCommandsTitle+"\n")
+	require.Regexp(t, `(?s)other commands.*fmt\s+format content`, out.String())
+	require.Len(t, s.Categories, 1)
+
+	a, err = NewApp(newSpec(), nil)
+	require.NoError(t, err)
+	_, err = a.WithExplicitCategories(true).Cobra()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidSpec))
+	require.Contains(t, err.Error(), "commands without category")
+	require.Contains(t, err.Error(), "cli fmt")
+	require.NotContains(t, err.Error(), "cli debug")
+}
+
+func TestBuiltinCategory(t *testing.T) {
+	help := func(builtin string) (string, error) {
+		a, err := NewAppFromSpec(`{
+	"categories": [
+		{"name": "base", "title": "Base commands", "default": true},
+		{"name": "tools", "title": "Tools"}
+	],
+	"builtin_category": "`+builtin+`",
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "get", "short": "get content", "category": "base", "run_e": "config"},
+			{"use": "fmt", "short": "format content", "category": "tools", "run_e": "config"}
+		]
+	}
+}`, mustRt(t))
+		if err != nil {
+			return "", err
+		}
+		root, err := a.Cobra()
+		if err != nil {
+			return "", err
+		}
+		out := &bytes.Buffer{}
+		root.SetOut(out)
+		a.SetArgs([]string{"--help"})
+		err = a.Execute()
+		return out.String(), err
+	}
+
+	out, err := help("")
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)Base commands\n\s+completion .*\n\s+get .*\n\s+help .*\nTools`, out)
+
+	out, err = help("tools")
+	require.NoError(t, err)
+	require.Regexp(t, `(?s)Base commands\n\s+get [^\n]*\n\nTools\n\s+completion .*\n\s+fmt .*\n\s+help `, out)
+
+	out, err = help("-")
+	require.NoError(t, err)
+	require.NotRegexp(t, `\n\s+completion `, out)
+	require.NotRegexp(t, `\n\s+help `, out)
+	require.Contains(t, out, "fmt")
+
+	_, err = help("unknown")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidSpec))
+	require.Contains(t, err.Error(), "builtin_category")
+}
+
+func TestMount(t *testing.T) {
+	type storageIn struct {
+		Bucket string `cmd:"arg,bucket,the bucket,0"`
+	}
+	var ran []string
+	newApps := func() (*App, *App) {
+		a, err := NewAppFromSpec(`{
+	"categories": [{"name": "base", "title": "Base commands", "default": true}],
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [{"use": "get", "short": "get content", "run_e": "config"}]
+	}
+}`, mustRt(t))
+		require.NoError(t, err)
+		rt, err := RtFunctions(nil, nil, map[string]Runfn{
+			"ls": func(ctx *CmdCtx, in *storageIn) error {
+				ran = append(ran, in.Bucket)
+				return nil
+			},
+		})
+		require.NoError(t, err)
+		RegisterInput[storageIn](rt, "storage")
+		other, err := NewAppFromSpec(`{
+	"categories": [
+		{"name": "base", "title": "Base commands", "default": true},
+		{"name": "storage", "title": "Storage commands"}
+	],
+	"cmd_root": {
+		"use": "storage-cli",
+		"sub_commands": [
+			{"use": "ls", "short": "list a bucket", "category": "storage", "run_e": "ls", "input_ctor": "storage"}
+		]
+	}
+}`, rt)
+		require.NoError(t, err)
+		return a, other
+	}
+
+	a, other := newApps()
+	require.NoError(t, a.Mount("storage", other))
+	require.Equal(t, []string{"base", "storage"}, []string{a.Spec().Categories[0].Name, a.Spec().Categories[1].Name})
+	require.False(t, a.Spec().Categories[1].Default)
+	a.SetArgs([]string{"storage", "ls", "b1"})
+	require.NoError(t, a.Execute())
+
+	a, other = newApps()
+	require.NoError(t, a.Mount("", other))
+	a.SetArgs([]string{"ls", "b2"})
+	require.NoError(t, a.Execute())
+	require.Equal(t, []string{"b1", "b2"}, ran)
+
+	// conflicting command
+	a, other = newApps()
+	err := a.Mount("get", other)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, bflags.ErrDuplicateCommand))
+	require.Len(t, a.Spec().CmdRoot.SubCommands, 1)
+
+	// conflicting category
+	a, other = newApps()
+	other.Spec().Categories[0].Title = "Other base commands"
+	err = a.Mount("storage", other)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidSpec))
+
+	// conflicting run function
+	a, other = newApps()
+	other.rt.runFns["config"] = func(ctx *CmdCtx) error { return errors.Str("other") }
+	err = a.Mount("storage", other)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conflicting run functions")
+	require.Len(t, a.rt.runFns, 1)
+
+	// functions can't be compared: closures of the same function literal may
+	// be different functions
+	greet := func(greeting string) func(ctx *CmdCtx) error {
+		return func(ctx *CmdCtx) error { return errors.Str(greeting) }
+	}
+	a, other = newApps()
+	a.rt.runFns["hello"] = greet("hello")
+	other.rt.runFns["hello"] = greet("bye")
+	err = a.Mount("storage", other)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conflicting run functions")
+
+	// apps sharing their runtime don't conflict
+	rt := mustRt(t)
+	a, err = NewApp(NewSpec(nil, &Cmd{Use: "cli", SubCommands: []*Cmd{{Use: "get", RunE: RunFnWithName("config")}}}), rt)
+	require.NoError(t, err)
+	other, err = NewApp(NewSpec(nil, &Cmd{Use: "other", SubCommands: []*Cmd{{Use: "ls", RunE: RunFnWithName("config")}}}), rt)
+	require.NoError(t, err)
+	require.NoError(t, a.Mount("other", other))
+	a.SetArgs([]string{"other", "ls"})
+	require.NoError(t, a.Execute())
+}
+
+func TestExtends(t *testing.T) {
+	type crudIn struct {
+		Kind  string `cmd:"flag,kind,kind of object"`
+		Limit int    `cmd:"flag,limit,max objects"`
+		ID    string `cmd:"arg,id,object id,0"`
+	}
+	var ran []crudIn
+	rt, err := RtFunctions(nil, nil, map[string]Runfn{
+		"crud": func(ctx *CmdCtx, in *crudIn) error {
+			ran = append(ran, *in)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	RegisterInput[crudIn](rt, "crud")
+
+	a, err := NewAppFromSpec(`{
+	"cmd_templates": [
+		{
+			"use": "base",
+			"example": "{{.CmdPath}} abc",
+			"annotations": {"a": "1", "b": "1"},
+			"input_ctor": "crud",
+			"input": {"kind": "any", "limit": 10}
+		},
+		{"use": "crud", "extends": "base", "run_e": "crud", "aliases": ["c"]}
+	],
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "user", "short": "get a user", "extends": "crud", "annotations": {"b": "2"}, "input": {"kind": "user"}},
+			{"use": "group", "short": "get a group", "extends": "crud", "example": "{{.CmdPath}} admins"}
+		]
+	}
+}`, rt)
+	require.NoError(t, err)
+	user, err := a.Command("cli", "user")
+	require.NoError(t, err)
+	require.Equal(t, "crud", user.InputCtor)
+	require.Equal(t, "{{.CmdPath}} abc", string(user.Example))
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, user.Annotations)
+	require.Empty(t, user.Aliases)
+	group, err := a.Command("cli", "group")
+	require.NoError(t, err)
+	require.Equal(t, "{{.CmdPath}} admins", string(group.Example))
+	require.Equal(t, map[string]string{"a": "1", "b": "1"}, group.Annotations)
+	require.Contains(t, a.Spec().String(), `"extends": "crud"`)
+
+	for _, args := range [][]string{{"user", "u1"}, {"group", "g1", "--limit", "5"}} {
+		a.SetArgs(args)
+		require.NoError(t, a.Execute())
+	}
+	require.Equal(t, []crudIn{
+		{Kind: "user", Limit: 10, ID: "u1"},
+		{Kind: "any", Limit: 5, ID: "g1"},
+	}, ran)
+
+	for _, templates := range []string{
+		`[]`,
+		`[{"use": "crud", "extends": "base"}, {"use": "base", "extends": "crud"}]`,
+		`[{"use": "crud"}, {"use": "crud"}]`,
+	} {
+		_, err = NewAppFromSpec(`{
+	"cmd_templates": `+templates+`,
+	"cmd_root": {"use": "cli", "sub_commands": [{"use": "user", "extends": "crud"}]}
+}`, rt)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrInvalidSpec))
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	type input struct {
+		Endpoint string   `cmd:"flag,endpoint,service endpoint"`
+		Limit    int      `cmd:"flag,limit,max number of results"`
+		Tags     []string `cmd:"flag,tags,tags to match"`
+	}
+	file := filepath.Join(t.TempDir(), "cli", "config.json")
+	var got *input
+	var sources map[string]string
+	run := func(args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "list",
+				Input: &input{Endpoint: "https://example.com", Limit: 10},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					got = in
+					sources = make(map[string]string)
+					v, _ := ctx.Get(CtxCmd)
+					for _, s := range FlagSources(v.(*cobra.Command)) {
+						sources[s.Flag] = s.Source
+					}
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.Spec().Profiles = map[string]map[string]interface{}{
+			"staging": {"endpoint": "https://staging.example.com", "tags": []interface{}{"a", "b"}},
+		}
+		a.WithProfiles(true).WithConfigCommand(true).WithConfigFile(file)
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		a.SetArgs(args)
+		err = a.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("config", "set", "limit", "20")
+	require.NoError(t, err)
+	_, err = run("list")
+	require.NoError(t, err)
+	require.Equal(t, &input{Endpoint: "https://example.com", Limit: 20}, got)
+
+	_, err = run("list", "--profile", "staging", "--tags", "c")
+	require.NoError(t, err)
+	require.Equal(t, &input{Endpoint: "https://staging.example.com", Limit: 20, Tags: []string{"c"}}, got)
+	require.Equal(t, SourceProfile, sources["endpoint"])
+	require.Equal(t, SourceConfig, sources["limit"])
+	require.Equal(t, SourceFlag, sources["tags"])
+
+	// the config commands manage the config file of the active profile
+	t.Setenv("CLI_PROFILE", "staging")
+	out, err := run("config", "path")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(filepath.Dir(file), "config.staging.json")+"\n", out)
+	_, err = run("config", "set", "limit", "30")
+	require.NoError(t, err)
+	_, err = run("list")
+	require.NoError(t, err)
+	require.Equal(t, &input{Endpoint: "https://staging.example.com", Limit: 30, Tags: []string{"a", "b"}}, got)
+
+	_, err = run("list", "--profile", "prod")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidConfig))
+	_, err = run("--profile", "prod", "config", "set", "limit", "40")
+	require.NoError(t, err)
+	_, err = run("list", "--profile", "prod")
+	require.NoError(t, err)
+	require.Equal(t, &input{Endpoint: "https://example.com", Limit: 40}, got)
+}
+
+func TestCompleteTag(t *testing.T) {
+	type input struct {
+		Library string `cmd:"flag,library,library id" complete:"libraries"`
+		Config  string `cmd:"flag,config,config file" complete:"file:json"`
+	}
+	rt := mustRt(t).WithCompletions(map[string]CompletionFn{
+		"libraries": func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return []string{"ilib1", "ilib2"}, cobra.ShellCompDirectiveNoFileComp
+		},
+	})
+	a, err := NewApp(NewSpec(nil, &Cmd{
+		Use: "cli",
+		SubCommands: []*Cmd{{
+			Use:   "list",
+			Input: &input{},
+			RunE:  RunFn(func(ctx *CmdCtx, in *input) error { return nil }),
+		}},
+	}), rt)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	complete := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd, "list"}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Equal(t, "ilib1\nilib2\n:4\n", complete("--library", ""))
+	require.Equal(t, "json\n:8\n", complete("--config", ""))
+
+	// completions are registered when requested, hence after a rebuild too
+	root, err = a.NewCobra()
+	require.NoError(t, err)
+	list, _, err := root.Find([]string{"list"})
+	require.NoError(t, err)
+	require.NoError(t, list.RegisterFlagCompletionFunc("config", nil))
+	require.Equal(t, "ilib1\nilib2\n:4\n", complete("--library", ""))
+}
+
+func TestProfileCommand(t *testing.T) {
+	type input struct {
+		Endpoint string `cmd:"flag,endpoint,service endpoint"`
+	}
+	dir := t.TempDir()
+	var got *input
+	var profile string
+	run := func(args ...string) (string, error) {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				Input: &input{Endpoint: "https://example.com"},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					got, profile = in, ctx.Profile()
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		a.Spec().Profiles = map[string]map[string]interface{}{
+			"staging": {"endpoint": "https://staging.example.com"},
+		}
+		a.WithProfileCommand(true).WithStateDir(filepath.Join(dir, "state")).
+			WithConfigCommand(true).WithConfigFile(filepath.Join(dir, "config", "config.json"))
+		root, err := a.Cobra()
+		require.NoError(t, err)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		a.SetArgs(args)
+		err = a.Execute()
+		return out.String(), err
+	}
+
+	_, err := run("--profile", "prod", "config", "set", "endpoint", "https://prod.example.com")
+	require.NoError(t, err)
+	out, err := run("profile", "list")
+	require.NoError(t, err)
+	require.Equal(t, "  prod\n  staging\n", out)
+
+	_, err = run("profile", "use", "staging")
+	require.NoError(t, err)
+	out, err = run("profile", "list")
+	require.NoError(t, err)
+	require.Equal(t, "  prod\n* staging\n", out)
+	out, err = run("profile", "show")
+	require.NoError(t, err)
+	require.Equal(t, "profile: staging\nendpoint=https://staging.example.com\n", out)
+	_, err = run("get")
+	require.NoError(t, err)
+	require.Equal(t, "staging", profile)
+	require.Equal(t, "https://staging.example.com", got.Endpoint)
+
+	// the flag takes precedence over the persisted profile
+	_, err = run("get", "--profile", "prod")
+	require.NoError(t, err)
+	require.Equal(t, "prod", profile)
+	require.Equal(t, "https://prod.example.com", got.Endpoint)
+
+	_, err = run("profile", "use", "unknown")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidConfig))
+
+	_, err = run("profile", "unset")
+	require.NoError(t, err)
+	_, err = run("get")
+	require.NoError(t, err)
+	require.Equal(t, "", profile)
+	require.Equal(t, "https://example.com", got.Endpoint)
+	_, err = run("profile", "show")
+	require.Error(t, err)
+}
+
+type testSpanKey struct{}
+
+// testSpan is a CmdSpan recording its attributes and end.
+type testSpan struct {
+	id    string
+	name  string
+	attrs map[string]string
+	ended bool
+	err   error
+}
+
+func (s *testSpan) SetAttributes(attrs map[string]string) {
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+// testCmdTracer is a CmdTracer propagating the ID of spans as traceparent.
+type testCmdTracer struct {
+	spans []*testSpan
+}
+
+func (tr *testCmdTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, CmdSpan) {
+	span := &testSpan{id: fmt.Sprintf("span-%d", len(tr.spans)), name: name, attrs: map[string]string{}}
+	span.SetAttributes(attrs)
+	tr.spans = append(tr.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (tr *testCmdTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		header.Set("traceparent", span.id)
+	}
+}
+
+func TestCmdTracer(t *testing.T) {
+	type input struct {
+		User     string `cmd:"flag,user,user name"`
+		Password string `cmd:"flag,password,user password"`
+	}
+	var traceparents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+	}))
+	defer srv.Close()
+
+	tracer := &testCmdTracer{}
+	newApp := func() *App {
+		a, err := NewApp(NewSpec(nil, &Cmd{
+			Use: "cli",
+			SubCommands: []*Cmd{{
+				Use:   "get",
+				Input: &input{},
+				RunE: RunFn(func(ctx *CmdCtx, in *input) error {
+					// a request with the context of the command and one without
+					req, err := http.NewRequestWithContext(ctx.Context(), http.MethodGet, srv.URL, nil)
+					require.NoError(t, err)
+					for _, r := range []*http.Request{req, httptest.NewRequest(http.MethodGet, srv.URL, nil)} {
+						r.RequestURI = ""
+						resp, err := ctx.HTTPClient().Do(r)
+						require.NoError(t, err)
+						_ = resp.Body.Close()
+					}
+					if in.User == "bad" {
+						return errors.E("get", errors.K.Permission)
+					}
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithCmdTracer(tracer)
+	}
+
+	a := newApp()
+	a.SetArgs([]string{"get", "--user", "joe", "--password", "pwd"})
+	require.NoError(t, a.Execute())
+	require.Len(t, tracer.spans, 1)
+	span := tracer.spans[0]
+	require.Equal(t, "cli get", span.name)
+	require.True(t, span.ended)
+	require.NoError(t, span.err)
+	require.Equal(t, "cli get", span.attrs[SpanAttrPath])
+	require.Equal(t, "ok", span.attrs[SpanAttrExitStatus])
+	require.NotEmpty(t, span.attrs[SpanAttrInvocationID])
+	require.Equal(t, "joe", span.attrs[SpanAttrFlagPrefix+"user"])
+	require.Equal(t, bflags.RedactedValue, span.attrs[SpanAttrFlagPrefix+"password"])
+	require.Equal(t, []string{"span-0", "span-0"}, traceparents)
+
+	a = newApp()
+	a.SetArgs([]string{"get", "--user", "bad"})
+	require.Error(t, a.Execute())
+	require.Len(t, tracer.spans, 2)
+	span = tracer.spans[1]
+	require.True(t, span.ended)
+	require.Error(t, span.err)
+	require.Equal(t, "error", span.attrs[SpanAttrExitStatus])
+	require.Equal(t, string(errors.K.Permission), span.attrs[SpanAttrErrorKind])
+	require.Equal(t, []string{"span-0", "span-0", "span-1", "span-1"}, traceparents)
+}
 
+func mustRt(t *testing.T) *Runtime {
+	rt, err := RtFunctions(nil, nil, map[string]Runfn{
+		"config": func(ctx *CmdCtx) error { return nil },
+	})
+	require.NoError(t, err)
+	return rt
 }
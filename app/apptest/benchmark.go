@@ -0,0 +1,55 @@
+// Package apptest provides helpers to test and benchmark apps built with the
+// app package.
+package apptest
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eluv-io/ecobra-go/app"
+)
+
+// Benchmark executes the command of the app with the given args b.N times,
+// with empty input and discarded outputs. The commands are created and their
+// inputs bound again for each iteration, such that binding is measured as well.
+//
+// In addition to the usual metrics, the average duration of each phase of the
+// execution is reported: 'bind-ns/op', 'parse-ns/op' and 'run-ns/op' (see
+// app.Phase). Typical use in a consuming repo:
+//
+//	func BenchmarkContentGet(b *testing.B) {
+//		apptest.Benchmark(b, newApp(), "content", "get", "--qid", "iq__x")
+//	}
+//
+// The phase timer of the app is replaced.
+func Benchmark(b *testing.B, a *app.App, args ...string) {
+	b.Helper()
+	phases := []app.Phase{app.PhaseBind, app.PhaseParse, app.PhaseRun}
+	totals := make(map[app.Phase]time.Duration)
+	a.WithPhaseTimer(func(phase app.Phase, d time.Duration) {
+		totals[phase] += d
+	})
+	a.SetArgs(args)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root, err := a.NewCobra()
+		if err != nil {
+			b.Fatal(err)
+		}
+		root.SetIn(strings.NewReader(""))
+		root.SetOut(io.Discard)
+		root.SetErr(io.Discard)
+		if err = a.Execute(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	for _, phase := range phases {
+		b.ReportMetric(float64(totals[phase].Nanoseconds())/float64(b.N), string(phase)+"-ns/op")
+	}
+}
@@ -0,0 +1,48 @@
+package apptest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/eluv-io/ecobra-go/app"
+)
+
+type getInput struct {
+	Qid     string   `cmd:"flag,qid,content id"`
+	Verbose bool     `cmd:"flag,verbose,verbose output,v"`
+	Paths   []string `cmd:"arg,paths,some paths,0"`
+}
+
+func newApp(t testing.TB, runs *int) *app.App {
+	a, err := app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use: "cli",
+		SubCommands: []*app.Cmd{{
+			Use: "get",
+			RunE: app.RunFn(func(ctx *app.CmdCtx, in *getInput) error {
+				*runs++
+				return nil
+			}),
+			Input: &getInput{},
+		}},
+	}), nil)
+	require.NoError(t, err)
+	return a
+}
+
+func TestBenchmark(t *testing.T) {
+	runs := 0
+	res := testing.Benchmark(func(b *testing.B) {
+		Benchmark(b, newApp(t, &runs), "get", "--qid", "iq__x", "-v", "a", "b")
+	})
+	require.Greater(t, runs, 0)
+	for _, metric := range []string{"bind-ns/op", "parse-ns/op", "run-ns/op"} {
+		require.Contains(t, res.Extra, metric)
+	}
+	require.Greater(t, res.Extra["bind-ns/op"], float64(0))
+}
+
+func BenchmarkGet(b *testing.B) {
+	runs := 0
+	Benchmark(b, newApp(b, &runs), "get", "--qid", "iq__x", "-v", "a", "b")
+}
@@ -0,0 +1,232 @@
+package apptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/app"
+)
+
+// RecordEnv is the environment variable selecting the record mode in
+// ModeFromEnv.
+const RecordEnv = "APPTEST_RECORD"
+
+// Mode is the mode of a Recorder.
+type Mode int
+
+const (
+	Replay Mode = iota // replay the interactions of the fixture
+	Record             // record interactions with live backends to the fixture
+)
+
+// ModeFromEnv returns Record if the APPTEST_RECORD environment variable is set
+// to a non-empty value and Replay otherwise, such that fixtures are refreshed
+// with:
+//
+//	APPTEST_RECORD=1 go test ./...
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return Record
+	}
+	return Replay
+}
+
+// Fixture holds the interactions of commands with their dependencies.
+type Fixture struct {
+	Seed         int64          `json:"seed"`                   // seed of the source of randomness
+	Times        []time.Time    `json:"times,omitempty"`        // times returned by the clock, in order
+	Interactions []*Interaction `json:"interactions,omitempty"` // HTTP requests and their responses, in order
+}
+
+// Interaction is an HTTP request and its response.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body,omitempty"`
+}
+
+// Recorder provides the dependencies of commands (see app.Deps). In Record
+// mode, it uses the live HTTP backends, the system clock and a random seed and
+// records the interactions to a fixture file with Save. In Replay mode, it
+// replays the interactions of the fixture file instead:
+//
+//	rec, err := apptest.NewRecorder("testdata/get.json", apptest.ModeFromEnv())
+//	a.WithDeps(rec.Deps())
+//	a.SetArgs([]string{"content", "get", "--qid", "iq__x"})
+//	err = a.Execute()
+//	err = rec.Save()
+//
+// HTTP requests are replayed in order and must have the method and URL of the
+// recorded ones. The clock returns the recorded times in order and the last
+// one once all were returned.
+type Recorder struct {
+	mode      Mode
+	path      string
+	transport http.RoundTripper
+	mu        sync.Mutex
+	fixture   *Fixture
+	nextReq   int
+	nextTime  int
+}
+
+// NewRecorder returns a new Recorder in the given mode for the fixture at the
+// given path. In Replay mode, the fixture is read from the file.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		mode:      mode,
+		path:      path,
+		transport: http.DefaultTransport,
+		fixture:   &Fixture{Seed: time.Now().UnixNano()},
+	}
+	if mode == Record {
+		return r, nil
+	}
+	bb, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.E("NewRecorder", errors.K.NotExist, err, "path", path)
+	}
+	if err = json.Unmarshal(bb, r.fixture); err != nil {
+		return nil, errors.E("NewRecorder", errors.K.Invalid, err, "path", path)
+	}
+	return r, nil
+}
+
+// Deps returns the dependencies to set to the app with App.WithDeps.
+func (r *Recorder) Deps() *app.Deps {
+	return &app.Deps{
+		HTTPClient: &http.Client{Transport: r},
+		Clock:      r.now,
+		Rand:       rand.New(rand.NewSource(r.fixture.Seed)),
+	}
+}
+
+// Fixture returns the fixture of the recorder.
+func (r *Recorder) Fixture() *Fixture {
+	return r.fixture
+}
+
+// Save writes the recorded fixture to its file in Record mode and does nothing
+// in Replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	e := errors.Template("Save", errors.K.IO, "path", r.path)
+	r.mu.Lock()
+	bb, err := json.MarshalIndent(r.fixture, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return e(errors.K.Invalid, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return e(err)
+	}
+	if err = os.WriteFile(r.path, append(bb, '\n'), 0644); err != nil {
+		return e(err)
+	}
+	return nil
+}
+
+func (r *Recorder) now() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == Record {
+		t := time.Now()
+		r.fixture.Times = append(r.fixture.Times, t)
+		return t
+	}
+	if len(r.fixture.Times) == 0 {
+		return time.Time{}
+	}
+	if r.nextTime >= len(r.fixture.Times) {
+		return r.fixture.Times[len(r.fixture.Times)-1]
+	}
+	t := r.fixture.Times[r.nextTime]
+	r.nextTime++
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.E("RoundTrip", errors.K.IO, err, "url", req.URL.String())
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	if r.mode == Record {
+		return r.record(req, reqBody)
+	}
+	return r.replay(req)
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, errors.E("RoundTrip", errors.K.IO, err, "url", req.URL.String())
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fixture.Interactions = append(r.fixture.Interactions, &Interaction{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: string(reqBody),
+		Status:      resp.StatusCode,
+		Header:      resp.Header,
+		Body:        string(body),
+	})
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	e := errors.Template("RoundTrip", errors.K.Invalid,
+		"method", req.Method,
+		"url", req.URL.String(),
+		"fixture", r.path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nextReq >= len(r.fixture.Interactions) {
+		return nil, e(errors.K.NotExist, "reason", "no more recorded interactions")
+	}
+	in := r.fixture.Interactions[r.nextReq]
+	if in.Method != req.Method || in.URL != req.URL.String() {
+		return nil, e("reason", "unexpected request",
+			"expected_method", in.Method,
+			"expected_url", in.URL)
+	}
+	r.nextReq++
+	return &http.Response{
+		Status:        http.StatusText(in.Status),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(in.Body))),
+		ContentLength: int64(len(in.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package apptest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/eluv-io/ecobra-go/app"
+)
+
+type output struct {
+	Body  string
+	Now   time.Time
+	Nonce int64
+}
+
+func fetchApp(t *testing.T, url string, out *output) *app.App {
+	a, err := app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use: "cli",
+		RunE: app.RunFn(func(ctx *app.CmdCtx) error {
+			resp, err := ctx.HTTPClient().Get(url)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			bb, err := io.ReadAll(resp.Body)
+			out.Body, out.Now, out.Nonce = string(bb), ctx.Now(), ctx.Rand().Int63()
+			return err
+		}),
+	}), nil)
+	require.NoError(t, err)
+	a.SetArgs([]string{})
+	return a
+}
+
+func TestRecorder(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("hello " + r.URL.Path))
+	}))
+	fixture := filepath.Join(t.TempDir(), "testdata", "fetch.json")
+
+	recorded := &output{}
+	rec, err := NewRecorder(fixture, Record)
+	require.NoError(t, err)
+	require.NoError(t, fetchApp(t, srv.URL+"/x", recorded).WithDeps(rec.Deps()).Execute())
+	require.NoError(t, rec.Save())
+	require.Equal(t, 1, calls)
+	require.Equal(t, "hello /x", recorded.Body)
+	srv.Close()
+
+	// the backend is down: the recorded interactions are replayed
+	replayed := &output{}
+	rec, err = NewRecorder(fixture, Replay)
+	require.NoError(t, err)
+	require.NoError(t, fetchApp(t, srv.URL+"/x", replayed).WithDeps(rec.Deps()).Execute())
+	require.Equal(t, recorded.Body, replayed.Body)
+	require.True(t, recorded.Now.Equal(replayed.Now))
+	require.Equal(t, recorded.Nonce, replayed.Nonce)
+
+	rec, err = NewRecorder(fixture, Replay)
+	require.NoError(t, err)
+	err = fetchApp(t, srv.URL+"/y", replayed).WithDeps(rec.Deps()).Execute()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unexpected request")
+
+	_, err = NewRecorder(filepath.Join(t.TempDir(), "missing.json"), Replay)
+	require.True(t, errors.IsKind(errors.K.NotExist, err), err)
+}
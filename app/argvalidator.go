@@ -0,0 +1,36 @@
+package app
+
+import (
+	"github.com/eluv-io/errors-go"
+)
+
+// WithArgValidators registers the given constructors of args validators by
+// name. They are referenced in the spec of commands - including JSON specs,
+// where ArgsValidator cannot be set - with ArgsValidatorName:
+//
+//	"args_validator": "contentIds"
+func (rt *Runtime) WithArgValidators(validators map[string]ValidatorCtor) *Runtime {
+	if rt.argValidators == nil {
+		rt.argValidators = make(map[string]ValidatorCtor)
+	}
+	for name, ctor := range validators {
+		rt.argValidators[name] = ctor
+	}
+	return rt
+}
+
+// argsValidator returns the additional args validator of the command: its
+// ArgsValidator if set, or the validator registered in the runtime with its
+// ArgsValidatorName. The returned validator is nil if the command has none.
+func (c *Cmd) argsValidator() (ValidatorCtor, error) {
+	if c.ArgsValidator != nil || c.ArgsValidatorName == "" {
+		return c.ArgsValidator, nil
+	}
+	ctor, ok := c.app.rt.argValidators[c.ArgsValidatorName]
+	if !ok {
+		return nil, errors.E("argsValidator", errors.K.NotExist, ErrFunctionNotFound,
+			"function", c.ArgsValidatorName,
+			"command", c.Name())
+	}
+	return ctor, nil
+}
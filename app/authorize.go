@@ -0,0 +1,96 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	rolesKey = "app_roles" // key for commands annotation
+)
+
+// Authorizer authorizes running the command with the given path and input. It
+// is called once flags and args are set to the input, before the pre-run
+// functions of the command and the lifecycle functions of the input (see
+// setupInput), such that none of them runs for unauthorized callers. The roles
+// required by the spec of the command are available in the context as
+// CtxRoles (see RequiredRoles). A non-nil error prevents the command from
+// running.
+type Authorizer func(ctx *CmdCtx, cmdPath string, input interface{}) error
+
+// WithAuthorizer sets the authorizer called before commands run. It must be set
+// before the cobra commands are built - see Cobra: the pre-run functions of
+// runnable commands are then wrapped such that the authorizer is called
+// first. Without authorizer, the pre-run functions are left as is.
+func (a *App) WithAuthorizer(fn Authorizer) *App {
+	a.authorizer = fn
+	return a
+}
+
+// RequireRoles returns an Authorizer checking that the roles required by a
+// command are granted: granted returns the roles or scopes of the current user.
+// Errors wrap ErrUnauthorized and report the missing roles.
+func RequireRoles(granted func(ctx *CmdCtx) ([]string, error)) Authorizer {
+	return func(ctx *CmdCtx, cmdPath string, _ interface{}) error {
+		e := errors.Template("authorize", errors.K.Permission, "command", cmdPath)
+		v, _ := ctx.Get(CtxRoles)
+		required, _ := v.([]string)
+		if len(required) == 0 {
+			return nil
+		}
+		roles, err := granted(ctx)
+		if err != nil {
+			return e(err)
+		}
+		has := make(map[string]bool, len(roles))
+		for _, r := range roles {
+			has[r] = true
+		}
+		var missing []string
+		for _, r := range required {
+			if !has[r] {
+				missing = append(missing, r)
+			}
+		}
+		if len(missing) > 0 {
+			return e(ErrUnauthorized, "missing_roles", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+func setRoles(cmd *cobra.Command, roles []string) {
+	if len(roles) == 0 {
+		return
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[rolesKey] = strings.Join(roles, ",")
+}
+
+// RequiredRoles returns the roles required to run the given command: the roles
+// of the command and of its parents in the spec, without duplicates.
+func RequiredRoles(cmd *cobra.Command) []string {
+	var cmds []*cobra.Command
+	for c := cmd; c != nil; c = c.Parent() {
+		cmds = append([]*cobra.Command{c}, cmds...)
+	}
+	var ret []string
+	seen := make(map[string]bool)
+	for _, c := range cmds {
+		s := c.Annotations[rolesKey]
+		if s == "" {
+			continue
+		}
+		for _, r := range strings.Split(s, ",") {
+			if !seen[r] {
+				seen[r] = true
+				ret = append(ret, r)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const debugBindingsFlag = "debug-bindings"
+
+// WithDebugBindings adds the hidden persistent --debug-bindings flag to the
+// root command if b is true. When the flag is set - or the
+// <APP>_DEBUG_BINDINGS environment variable is true, where <APP> is the
+// upper-case name of the root command - the flags and args bound to the
+// invoked command are printed to its error output before it runs, with their
+// type, default and effective value, the source of the value and their key in
+// the config file:
+//
+//	FLAG      KIND  ORDER  TYPE    DEFAULT  VALUE  SOURCE   CONFIG KEY
+//	--count   flag         int     3        5      config   count
+//	<id>      arg   0      string           abc    flag
+func (a *App) WithDebugBindings(b bool) *App {
+	a.debugBindings = b
+	return a
+}
+
+// addDebugBindingsFlag adds the --debug-bindings flag to the root command if
+// enabled.
+func (a *App) addDebugBindingsFlag() error {
+	if !a.debugBindings {
+		return nil
+	}
+	fs := a.root.PersistentFlags()
+	if fs.Lookup(debugBindingsFlag) != nil {
+		return errors.E("addDebugBindingsFlag", errors.K.Invalid, ErrInvalidSpec, bflags.ErrDuplicateFlag,
+			"flag", debugBindingsFlag)
+	}
+	fs.Bool(debugBindingsFlag, false, "print the flags and args bound to the command with their sources")
+	_ = fs.MarkHidden(debugBindingsFlag)
+	return nil
+}
+
+// debugBindingsEnabled returns true if the bindings of the invoked command are
+// printed.
+func (a *App) debugBindingsEnabled() bool {
+	if !a.debugBindings {
+		return false
+	}
+	if f := a.root.PersistentFlags().Lookup(debugBindingsFlag); f != nil && f.Changed {
+		return f.Value.String() == "true"
+	}
+	b, _ := strconv.ParseBool(os.Getenv(envPrefix(a.spec.CmdRoot.Name()) + "DEBUG_BINDINGS"))
+	return b
+}
+
+// printBindings prints the bindings of the given command, bound in the given
+// duration, to its error output if enabled.
+func (a *App) printBindings(cmd *cobra.Command, elapsed time.Duration) {
+	if a.debugBindingsEnabled() {
+		_ = a.writeBindings(cmd.ErrOrStderr(), cmd, elapsed)
+	}
+}
+
+// writeBindings writes the flags of the given command - sorted by name - and
+// its args - in order - to w as a table, followed by the number of bindings
+// and the time taken to bind them. Values of secret flags are redacted.
+func (a *App) writeBindings(w io.Writer, cmd *cobra.Command, elapsed time.Duration) error {
+	fas := bflags.GetFlagArgs(cmd)
+	var flags []string
+	if fs, err := bflags.GetCmdFlagSet(cmd); err == nil {
+		for name := range fs {
+			flags = append(flags, string(name))
+		}
+	}
+	sort.Strings(flags)
+	var args []string
+	if as, err := bflags.GetCmdArgSet(cmd); err == nil {
+		for _, fb := range as.Flags {
+			args = append(args, string(fb.Name))
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "bindings of '%s'\n", cmd.CommandPath())
+	_, _ = fmt.Fprintln(tw, "FLAG\tKIND\tORDER\tTYPE\tDEFAULT\tVALUE\tSOURCE\tCONFIG KEY")
+	count := 0
+	for i, name := range append(flags, args...) {
+		fa := fas[name]
+		f := cmd.Flags().Lookup(name)
+		if fa == nil || f == nil {
+			continue
+		}
+		s := flagSource(cmd, f, fa)
+		display, kind, order, key := "--"+name, "flag", "", ""
+		if fa.IsArg {
+			display, kind, order = "<"+name+">", "arg", strconv.Itoa(i-len(flags))
+		} else if a.configCmd && !fa.Secret {
+			key = name
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			display, kind, order, f.Value.Type(), s.Default, s.Value, s.Source, key)
+		count++
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d bindings (%d args) bound in %s\n", count, len(args), elapsed)
+	return err
+}
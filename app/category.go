@@ -1,11 +1,18 @@
 package app
 
 import (
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/eluv-io/log-go"
 	"github.com/spf13/cobra"
 )
 
 const (
-	categoryKey = "category" // key for commands annotation
+	categoryKey        = "category"       // key for commands annotation
+	otherCommandsTitle = "other commands" // title of the implicit category of commands without default category
+	helpTopicsTitle    = "Help topics"    // title of the implicit category of help topics
+	hiddenCategory     = "-"              // builtin category omitting built-in commands from categories
 )
 
 type CmdCategories []*CmdCategory
@@ -35,10 +42,106 @@ func annotateCmdCategory(c *cobra.Command, category string) {
 	c.Annotations[categoryKey] = category
 }
 
+// categoryOptions are the options of the validation of the categories of
+// commands.
+type categoryOptions struct {
+	warn     bool // log a warning instead of failing
+	explicit bool // require commands to declare a category
+}
+
+// WithCategoryWarnings makes Cobra log a warning instead of failing if
+// commands declare categories that are not declared in the spec - see
+// validateCategories.
+func (a *App) WithCategoryWarnings(b bool) *App {
+	a.categoryOpts.warn = b
+	return a
+}
+
+// WithExplicitCategories makes Cobra fail if the spec declares categories and
+// commands don't declare one, rather than listing them in the default category
+// - or in an implicit "other commands" category if no category is the
+// default. Hidden commands and help topics are exempt.
+func (a *App) WithExplicitCategories(b bool) *App {
+	a.categoryOpts.explicit = b
+	return a
+}
+
+// checkCategories validates the categories of the commands of the spec of the
+// app.
+func (a *App) checkCategories() error {
+	err := validateCategories(a.spec, a.categoryOpts.explicit)
+	if err != nil && a.categoryOpts.warn {
+		log.Warn("unknown command categories", "error", err)
+		return nil
+	}
+	return err
+}
+
+// validateCategories returns an error wrapping ErrInvalidSpec if commands of
+// the given spec declare a category - or group id - that is not declared in the
+// categories of the spec: such commands would silently be listed in the
+// default category. The error reports the paths of the offending commands and
+// the known categories. If explicit is true, commands other than the root,
+// hidden commands and help topics must declare a category. Categories are not
+// validated if the spec declares none.
+func validateCategories(s *spec, explicit bool) error {
+	if s == nil || len(s.Categories) == 0 || s.CmdRoot == nil {
+		return nil
+	}
+	known := make(map[string]bool)
+	names := make([]string, 0, len(s.Categories))
+	for _, c := range s.Categories {
+		known[c.Name] = true
+		names = append(names, c.Name)
+	}
+	var unknown, paths, uncategorized []string
+	var walk func(c *Cmd, path string)
+	walk = func(c *Cmd, path string) {
+		isRoot := path == ""
+		path = strings.TrimSpace(path + " " + c.Name())
+		category := c.Category
+		if category == "" {
+			category = c.GroupID
+		}
+		if category == "" && explicit && !isRoot && !c.Hidden && !c.Topic {
+			uncategorized = append(uncategorized, path)
+		}
+		if category != "" && !known[category] {
+			unknown = append(unknown, category)
+			paths = append(paths, path)
+		}
+		for _, sub := range c.SubCommands {
+			walk(sub, path)
+		}
+	}
+	walk(s.CmdRoot, "")
+	if s.BuiltinCategory != "" && s.BuiltinCategory != hiddenCategory && !known[s.BuiltinCategory] {
+		unknown = append(unknown, s.BuiltinCategory)
+		paths = append(paths, "builtin_category")
+	}
+	var errs error
+	if len(unknown) > 0 {
+		errs = errors.Append(errs, errors.E("validateCategories", errors.K.Invalid, ErrInvalidSpec,
+			"reason", "unknown categories",
+			"categories", strings.Join(unknown, ", "),
+			"commands", strings.Join(paths, ", "),
+			"known", strings.Join(names, ", ")))
+	}
+	if len(uncategorized) > 0 {
+		errs = errors.Append(errs, errors.E("validateCategories", errors.K.Invalid, ErrInvalidSpec,
+			"reason", "commands without category",
+			"commands", strings.Join(uncategorized, ", "),
+			"known", strings.Join(names, ", ")))
+	}
+	return errs
+}
+
 // ----- builder -----
 type categoriesBuilder struct {
-	groups []*CmdCategory
-	others *CmdCategory
+	groups  []*CmdCategory
+	others  *CmdCategory
+	topics  *CmdCategory // help topics, listed last
+	builtin string       // category of built-in commands, see spec.BuiltinCategory
 }
 
 func ng() []*cobra.Command {
@@ -62,11 +165,26 @@ func (cg *categoriesBuilder) with(appCategories []*CmdCategory) *categoriesBuild
 	return cg
 }
 
+// withBuiltin sets the category of cobra's built-in help and completion
+// commands.
+func (cg *categoriesBuilder) withBuiltin(category string) *categoriesBuilder {
+	cg.builtin = category
+	return cg
+}
+
+// isBuiltin returns true if the given command is cobra's help or completion
+// command.
+func isBuiltin(c *cobra.Command) bool {
+	return c.Annotations[categoryKey] == "" && (c.Name() == "help" || c.Name() == "completion")
+}
+
 func (cg *categoriesBuilder) addCommand(c *cobra.Command) {
 	added := false
 
 	groupName := c.Annotations[categoryKey]
-	if groupName == "" && c.Name() == "help" {
+	if isBuiltin(c) && cg.builtin != "" {
+		groupName = cg.builtin
+	} else if groupName == "" && c.Name() == "help" && len(cg.groups) > 0 {
 		// we don't add 'help' by ourselves but we want it in the base group
 		groupName = cg.groups[0].Name
 	}
@@ -78,6 +196,12 @@ func (cg *categoriesBuilder) addCommand(c *cobra.Command) {
 		}
 	}
 	if !added {
+		if cg.others == nil {
+			// no default category: list the command in an implicit category,
+			// without modifying the categories of the spec
+			cg.others = &CmdCategory{Title: otherCommandsTitle, Cmds: ng()}
+			cg.groups = append(cg.groups[:len(cg.groups):len(cg.groups)], cg.others)
+		}
 		cg.others.Cmds = append(cg.others.Cmds, c)
 	}
 }
@@ -87,11 +211,24 @@ func (cg *categoriesBuilder) fillWith(cmds []*cobra.Command) *categoriesBuilder
 		if c.Hidden {
 			continue
 		}
+		if isTopic(c) {
+			if cg.topics == nil {
+				cg.topics = &CmdCategory{Title: helpTopicsTitle, Cmds: ng()}
+			}
+			cg.topics.Cmds = append(cg.topics.Cmds, c)
+			continue
+		}
+		if cg.builtin == hiddenCategory && isBuiltin(c) {
+			continue
+		}
 		cg.addCommand(c)
 	}
 	return cg
 }
 
 func (cg *categoriesBuilder) build() []*CmdCategory {
+	if cg.topics != nil {
+		return append(cg.groups[:len(cg.groups):len(cg.groups)], cg.topics)
+	}
 	return cg.groups
 }
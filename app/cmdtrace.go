@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// attributes of the spans of commands
+const (
+	SpanAttrPath         = "command.path"          // path of the command
+	SpanAttrInvocationID = "command.invocation_id" // ID of the invocation - see CmdCtx.InvocationID
+	SpanAttrExitStatus   = "command.exit_status"   // "ok" or "error"
+	SpanAttrErrorKind    = "command.error_kind"    // kind of the root error of failed commands
+	SpanAttrFlagPrefix   = "command.flag."         // prefix of the flags and args of the command
+)
+
+// CmdTracer creates a span for each command executed by the app - see
+// App.WithCmdTracer. The app has no dependency on a tracing library: a
+// CmdTracer adapts one, like the OpenTelemetry adapter of the
+// github.com/eluv-io/ecobra-go/app/otel module - see otel.NewCmdTracer.
+type CmdTracer interface {
+	// Start starts a span with the given name and attributes, child of the span
+	// carried by ctx if any, and returns a context carrying the new span.
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, CmdSpan)
+	// Inject injects the trace context carried by ctx into the headers of an
+	// outgoing HTTP request.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// CmdSpan is the span of a command started by a CmdTracer.
+type CmdSpan interface {
+	// SetAttributes sets the given attributes to the span.
+	SetAttributes(attrs map[string]string)
+	// End ends the span, with the error of the command if it failed.
+	End(err error)
+}
+
+// WithCmdTracer sets the tracer creating a span for each command, such that
+// CLI actions appear in distributed traces. The span is named after the path
+// of the command and has the following attributes:
+//   - command.path: the path of the command
+//   - command.invocation_id: the ID of the invocation
+//   - command.flag.<name>: the flags and args set for the command, with the
+//     value of secret flags redacted - see bflags.GetFlagArgSet
+//   - command.exit_status: "ok" or "error"
+//   - command.error_kind: the kind of the root error of failed commands - see
+//     errors.GetRoot
+//
+// The span is carried by the context.Context of the command - see
+// CmdCtx.Context - and its trace context is injected into the requests sent
+// with the HTTP client of the command - see CmdCtx.HTTPClient - unless the
+// client was set with WithDeps. Requests with a context that is not derived
+// from the context of the command are sent with the trace context of the
+// command.
+func (a *App) WithCmdTracer(t CmdTracer) *App {
+	a.cmdTracer = t
+	return a
+}
+
+// startSpan starts the span of the command if a tracer is set and sets the
+// context carrying the span to the command. The returned function ends the
+// span with the given error.
+func (a *App) startSpan(cmd *cobra.Command, ctx *CmdCtx) func(err error) {
+	if a.cmdTracer == nil {
+		return func(error) {}
+	}
+	path := cmd.CommandPath()
+	spanCtx, span := a.cmdTracer.Start(ctx.Context(), path, map[string]string{SpanAttrPath: path})
+	cmd.SetContext(spanCtx)
+	return func(err error) {
+		attrs := map[string]string{SpanAttrExitStatus: "ok"}
+		if id := ctx.InvocationID(); id != "" {
+			attrs[SpanAttrInvocationID] = id
+		}
+		for name, value := range bflags.GetFlagArgSet(cmd) {
+			attrs[SpanAttrFlagPrefix+name] = value
+		}
+		if err != nil {
+			attrs[SpanAttrExitStatus] = "error"
+			if root := errors.GetRoot(err); root != nil && root.Kind() != "" {
+				attrs[SpanAttrErrorKind] = string(root.Kind())
+			}
+		}
+		span.SetAttributes(attrs)
+		span.End(err)
+	}
+}
+
+// injectTraceContext returns the function injecting the trace context into
+// the requests of the HTTP client of the command with the given context, or
+// nil if no tracer is set.
+func (a *App) injectTraceContext(ctx *CmdCtx) func(req *http.Request) {
+	if a.cmdTracer == nil {
+		return nil
+	}
+	return func(req *http.Request) {
+		rctx := req.Context()
+		if cc, _ := CmdCtxFromContext(rctx); cc != ctx {
+			rctx = ctx.Context()
+		}
+		a.cmdTracer.Inject(rctx, req.Header)
+	}
+}
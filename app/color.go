@@ -0,0 +1,172 @@
+package app
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	colorKey  = "app_color" // key for commands annotation
+	colorFlag = "color"
+)
+
+// ColorPolicy defines when help and the output of commands are colored.
+type ColorPolicy string
+
+const (
+	// ColorAuto colors the output if it is a terminal and the NO_COLOR
+	// environment variable is not set.
+	ColorAuto ColorPolicy = "auto"
+	// ColorAlways always colors the output.
+	ColorAlways ColorPolicy = "always"
+	// ColorNever never colors the output.
+	ColorNever ColorPolicy = "never"
+)
+
+// ParseColorPolicy returns the color policy with the given name.
+func ParseColorPolicy(s string) (ColorPolicy, error) {
+	switch p := ColorPolicy(s); p {
+	case ColorAuto, ColorAlways, ColorNever:
+		return p, nil
+	}
+	return "", errors.E("ParseColorPolicy", errors.K.Invalid, ErrInvalidFormat,
+		"reason", "unknown color policy",
+		"color", s)
+}
+
+// String returns the name of the policy.
+func (p *ColorPolicy) String() string {
+	return string(*p)
+}
+
+// Set sets the policy with the given name - used for the --color flag.
+func (p *ColorPolicy) Set(s string) error {
+	v, err := ParseColorPolicy(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// Type returns the type of the policy in usages.
+func (p *ColorPolicy) Type() string {
+	return "string"
+}
+
+// WithColor sets the color policy of help and of the output of commands - see
+// WithOutput. It is ColorAuto by default and overridden by the persistent
+// --color flag of the root command when output is enabled.
+func (a *App) WithColor(p ColorPolicy) *App {
+	a.color = p
+	return a
+}
+
+// setColor sets the color policy of the app to the root command.
+func (a *App) setColor() {
+	if a.color == "" {
+		return
+	}
+	if a.root.Annotations == nil {
+		a.root.Annotations = make(map[string]string)
+	}
+	a.root.Annotations[colorKey] = string(a.color)
+}
+
+// colorPolicy returns the color policy of the given command: the value of the
+// --color flag if set, the policy of the app otherwise.
+func colorPolicy(cmd *cobra.Command) ColorPolicy {
+	root := cmd.Root()
+	if f := root.PersistentFlags().Lookup(colorFlag); f != nil && f.Changed {
+		return ColorPolicy(f.Value.String())
+	}
+	if p := root.Annotations[colorKey]; p != "" {
+		return ColorPolicy(p)
+	}
+	return ColorAuto
+}
+
+// useColor returns true if text written to w by the given command is colored.
+func useColor(cmd *cobra.Command, w io.Writer) bool {
+	switch colorPolicy(cmd) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if _, set := os.LookupEnv("NO_COLOR"); set || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// ANSI escape sequences of colors.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiBlue   = "\x1b[34m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+func colorize(s, color string) string {
+	if s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// colorJSON colors the keys, strings and other literals of the given JSON
+// text.
+func colorJSON(text string) string {
+	sb := &strings.Builder{}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end++
+			if end > len(text) {
+				end = len(text)
+			}
+			color := ansiGreen
+			if rest := strings.TrimLeft(text[end:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				color = ansiBlue
+			}
+			sb.WriteString(colorize(text[i:end], color))
+			i = end
+		case c == '-' || (c >= '0' && c <= '9') || c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(text) && strings.IndexByte(",]} \t\r\n", text[end]) < 0 {
+				end++
+			}
+			sb.WriteString(colorize(text[i:end], ansiYellow))
+			i = end
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// heading returns the given help heading of the command, in bold if the help
+// of the command is colored.
+func heading(cmd *cobra.Command, s string) string {
+	if useColor(cmd, cmd.OutOrStdout()) {
+		return colorize(s, ansiBold)
+	}
+	return s
+}
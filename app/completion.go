@@ -0,0 +1,195 @@
+package app
+
+import (
+	"reflect"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/errors-go"
+)
+
+// CompletionFn is the type of function providing dynamic completion of flags
+// and args, as cobra's ValidArgsFunction. Completion functions are registered
+// by name in the Runtime and referenced in the spec of commands:
+//
+//	"flag_completions": {"qfab": "contentIds"},
+//	"arg_completions":  {"id": "contentIds"}
+type CompletionFn func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+// WithCompletions registers the given completion functions by name.
+func (rt *Runtime) WithCompletions(completions map[string]CompletionFn) *Runtime {
+	if rt.completions == nil {
+		rt.completions = make(map[string]CompletionFn)
+	}
+	for name, fn := range completions {
+		rt.completions[name] = fn
+	}
+	return rt
+}
+
+// CompletionFunc is a completion function or the name of a completion function
+// registered in the Runtime.
+type CompletionFunc struct {
+	name string
+	fn   CompletionFn
+}
+
+func CompletionFnWithName(name string) CompletionFunc {
+	return CompletionFunc{name: name}
+}
+
+func CompletionFnOf(fn CompletionFn) CompletionFunc {
+	return CompletionFunc{fn: fn}
+}
+
+func (c CompletionFunc) IsNil() bool {
+	return c.name == "" && c.fn == nil
+}
+
+func (c *CompletionFunc) String() string {
+	ret, _ := c.MarshalText()
+	return string(ret)
+}
+
+// MarshalText implements custom marshaling using the string representation.
+func (c *CompletionFunc) MarshalText() ([]byte, error) {
+	n := c.name
+	if n == "" && c.fn != nil {
+		n = runtime.FuncForPC(reflect.ValueOf(c.fn).Pointer()).Name()
+	}
+	return []byte(n), nil
+}
+
+// UnmarshalText implements custom unmarshaling from the string representation.
+func (c *CompletionFunc) UnmarshalText(text []byte) error {
+	c.name = string(text)
+	return nil
+}
+
+// registerTagCompletions registers the completion functions of the runtime
+// with bflags, such that fields of inputs can reference them with the
+// 'complete' tag, e.g. `complete:"contentIds"`.
+func (a *App) registerTagCompletions() {
+	for name, fn := range a.rt.completions {
+		bflags.RegisterCompletion(name, bflags.CompletionFunc(fn))
+	}
+}
+
+func (c *Cmd) completionFn(name string) (CompletionFn, error) {
+	fn, ok := c.app.rt.completions[name]
+	if !ok {
+		return nil, errors.E("completionFn", errors.K.NotExist, ErrFunctionNotFound, "function", name)
+	}
+	return fn, nil
+}
+
+// validArgsFn returns the function completing positional args or nil.
+func (c *Cmd) validArgsFn() (CompletionFn, error) {
+	if c.ValidArgsFunction.fn != nil || c.ValidArgsFunction.name == "" {
+		return c.ValidArgsFunction.fn, nil
+	}
+	return c.completionFn(c.ValidArgsFunction.name)
+}
+
+// registerCompletions registers the completion functions referenced in the
+// FlagCompletions, ArgCompletions and ValidArgsFunction of the command. The
+// ValidArgsFunction completes args that have no function in ArgCompletions.
+func (c *Cmd) registerCompletions(cmd *cobra.Command) error {
+	e := errors.Template("register completions", errors.K.Invalid, "cmd", cmd.Name())
+
+	for _, name := range sortedNames(c.FlagCompletions) {
+		fn, err := c.completionFn(c.FlagCompletions[name])
+		if err != nil {
+			return e(err)
+		}
+		if cmd.Flag(name) == nil || isArg(cmd, name) {
+			return e(ErrInvalidSpec, "reason", "flag not found", "flag", name)
+		}
+		err = bflags.SetFlagCompletion(cmd, name, bflags.CompletionFunc(fn))
+		if err != nil {
+			return e(err, "flag", name)
+		}
+	}
+
+	validArgs, err := c.validArgsFn()
+	if err != nil {
+		return e(err)
+	}
+	if len(c.ArgCompletions) == 0 {
+		if validArgs != nil {
+			cmd.ValidArgsFunction = validArgs
+		}
+		return nil
+	}
+	argFns := make(map[string]CompletionFn, len(c.ArgCompletions))
+	for _, name := range sortedNames(c.ArgCompletions) {
+		fn, err := c.completionFn(c.ArgCompletions[name])
+		if err != nil {
+			return e(err)
+		}
+		if !isArg(cmd, name) {
+			return e(ErrInvalidSpec, "reason", "arg not found", "arg", name)
+		}
+		argFns[name] = fn
+	}
+	cmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if fn, ok := argFns[nextArg(cmd, len(args))]; ok {
+			return fn(cmd, args, toComplete)
+		}
+		if validArgs != nil {
+			return validArgs(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return nil
+}
+
+func isArg(cmd *cobra.Command, name string) bool {
+	argset, err := bflags.GetCmdArgSet(cmd)
+	if err != nil {
+		return false
+	}
+	for _, fb := range argset.Flags {
+		if string(fb.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nextArg returns the name of the arg at the given position or an empty string.
+// Positions after the last arg are those of the last arg if it is a slice.
+func nextArg(cmd *cobra.Command, pos int) string {
+	argset, err := bflags.GetCmdArgSet(cmd)
+	if err != nil || len(argset.Flags) == 0 {
+		return ""
+	}
+	if pos < len(argset.Flags) {
+		return string(argset.Flags[pos].Name)
+	}
+	last := argset.Flags[len(argset.Flags)-1]
+	if reflect.Indirect(reflect.ValueOf(last.Value)).Kind() == reflect.Slice {
+		return string(last.Name)
+	}
+	return ""
+}
+
+// CompletionOptions are the options of the default 'completion' command of
+// cobra. They are only used on the root command.
+type CompletionOptions struct {
+	DisableDefaultCmd   bool `json:"disable_default_cmd,omitempty"`  // no default 'completion' command
+	DisableNoDescFlag   bool `json:"disable_no_desc_flag,omitempty"` // no '--no-descriptions' flag
+	DisableDescriptions bool `json:"disable_descriptions,omitempty"` // no completion descriptions
+	HiddenDefaultCmd    bool `json:"hidden_default_cmd,omitempty"`   // hidden 'completion' command
+}
+
+func (o *CompletionOptions) cobra() cobra.CompletionOptions {
+	return cobra.CompletionOptions{
+		DisableDefaultCmd:   o.DisableDefaultCmd,
+		DisableNoDescFlag:   o.DisableNoDescFlag,
+		DisableDescriptions: o.DisableDescriptions,
+		HiddenDefaultCmd:    o.HiddenDefaultCmd,
+	}
+}
@@ -0,0 +1,482 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	configCmdName = "config"
+	configFlagKey = "config" // key for flags annotation: value set from the config file
+)
+
+// WithConfigCommand enables the config file of the app and adds the built-in
+// 'config' command group managing it if b is true:
+//
+//	myapp config set library ilib123
+//	myapp config get library
+//	myapp config unset library
+//	myapp config list
+//	myapp config edit
+//	myapp config path
+//
+// The keys of the config are the names of the flags bound to the commands of
+// the app, and values are validated against the type of these flags. When a
+// command runs, flags not set on the command line take their value from the
+// config file. Secret flags can't be stored in the config. See ConfigFile.
+func (a *App) WithConfigCommand(b bool) *App {
+	a.configCmd = b
+	return a
+}
+
+// WithConfigFile sets the path of the config file of the app. See ConfigFile.
+func (a *App) WithConfigFile(path string) *App {
+	a.configFile = path
+	return a
+}
+
+// ConfigFile returns the path of the config file of the app: the value of the
+// <APP>_CONFIG environment variable, where <APP> is the upper-case name of the
+// root command, the file set with WithConfigFile or config.json in the
+// directory named after the app in the user config directory, in this order of
+// precedence.
+func (a *App) ConfigFile() string {
+	if file := os.Getenv(envPrefix(a.spec.CmdRoot.Name()) + "CONFIG"); file != "" {
+		return file
+	}
+	if a.configFile != "" {
+		return a.configFile
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, a.spec.CmdRoot.Name(), "config.json")
+}
+
+// config is the content of a config file.
+type config map[string]interface{}
+
+// loadConfig reads the config file of the app. An empty config is returned if
+// the file does not exist.
+func (a *App) loadConfig() (config, error) {
+	return a.loadConfigFile(a.ConfigFile())
+}
+
+// loadConfigFile reads the given config file. An empty config is returned if
+// the file does not exist.
+func (a *App) loadConfigFile(file string) (config, error) {
+	e := errors.Template("loadConfig", errors.K.Invalid, ErrInvalidConfig, "file", file)
+	bb, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config{}, nil
+	} else if err != nil {
+		return nil, e(errors.K.IO, "read_error", err.Error())
+	}
+	c := config{}
+	if len(bytes.TrimSpace(bb)) == 0 {
+		return c, nil
+	}
+	if err = json.Unmarshal(bb, &c); err != nil {
+		return nil, e("reason", "invalid JSON", "json_error", err.Error())
+	}
+	return c, nil
+}
+
+// saveConfig writes the given config to the config file of the active profile
+// or of the app if no profile is active - see activeConfigFile.
+func (a *App) saveConfig(c config) error {
+	file := a.activeConfigFile()
+	e := errors.Template("saveConfig", errors.K.IO, "file", file)
+	bb, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return e(errors.K.Invalid, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return e(err)
+	}
+	if err = writeFileAtomic(file, append(bb, '\n')); err != nil {
+		return e(err)
+	}
+	return nil
+}
+
+// configKey is a key of the config: the flags of that name bound to commands.
+type configKey struct {
+	flags  []*pflag.Flag
+	secret bool
+}
+
+// configKeys returns the keys of the config: the names of the flags bound to
+// the given command and its sub-commands.
+func configKeys(root *cobra.Command) map[string]*configKey {
+	ret := make(map[string]*configKey)
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		for name, fa := range bflags.GetFlagArgs(c) {
+			if fa.IsArg {
+				continue
+			}
+			f := c.Flags().Lookup(name)
+			if f == nil {
+				f = c.PersistentFlags().Lookup(name)
+			}
+			if f == nil {
+				continue
+			}
+			k := ret[name]
+			if k == nil {
+				k = &configKey{}
+				ret[name] = k
+			}
+			k.flags = append(k.flags, f)
+			k.secret = k.secret || fa.Secret
+		}
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+	return ret
+}
+
+// checkConfigValue returns the value to store in the config for the given key
+// and string value, or an error if the key is unknown or the value is invalid
+// for the type of its flags.
+func checkConfigValue(keys map[string]*configKey, key string, v interface{}) (interface{}, error) {
+	e := errors.Template("checkConfigValue", errors.K.Invalid, ErrInvalidConfig, "key", key)
+	k := keys[key]
+	if k == nil {
+		return nil, e(errors.K.NotExist, "reason", "unknown key")
+	}
+	if k.secret {
+		return nil, e(errors.K.Permission, "reason", "secret flags can't be stored in the config")
+	}
+	s := configString(v)
+	var ret interface{} = s
+	for _, f := range k.flags {
+		typ := f.Value.Type()
+		val, err := parseFlagValue(typ, s)
+		if err != nil {
+			return nil, e("reason", "invalid value", "value", s, "type", typ, "parse_error", err.Error())
+		}
+		ret = val
+	}
+	return ret, nil
+}
+
+// parseFlagValue parses the given string for a flag of the given pflag type
+// and returns its JSON representation. Values of unknown types are returned as
+// is.
+func parseFlagValue(typ, s string) (interface{}, error) {
+	if elem := strings.TrimSuffix(typ, "Slice"); elem != typ {
+		var ret []interface{}
+		if strings.TrimSpace(s) == "" {
+			return []interface{}{}, nil
+		}
+		for _, item := range strings.Split(s, ",") {
+			v, err := parseFlagValue(elem, strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+	switch typ {
+	case "bool":
+		return strconv.ParseBool(s)
+	case "int", "int8", "int16", "int32", "int64", "count":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return strconv.ParseUint(s, 10, 64)
+	case "float32", "float64":
+		return strconv.ParseFloat(s, 64)
+	case "duration":
+		if _, err := time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// configString returns the string representation of a config value as given on
+// the command line.
+func configString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []interface{}:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = configString(item)
+		}
+		return strings.Join(items, ",")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// checkConfig returns an error if any key or value of the given config is
+// invalid.
+func checkConfig(root *cobra.Command, c config) error {
+	keys := configKeys(root)
+	for _, key := range c.sortedKeys() {
+		if _, err := checkConfigValue(keys, key, c[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c config) sortedKeys() []string {
+	ret := make([]string, 0, len(c))
+	for k := range c {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// applyConfig sets the flags of the command that were not set on the command
+// line to their value in the config file, if the config is enabled.
+func (a *App) applyConfig(cmd *cobra.Command) error {
+	if !a.configCmd {
+		return nil
+	}
+	c, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	e := errors.Template("applyConfig", errors.K.Invalid, ErrInvalidConfig, "file", a.ConfigFile())
+	return setConfigValues(cmd, c, configFlagKey, e)
+}
+
+// setConfigValues sets the flags of the command that were not set on the
+// command line to their value in the given config and annotates them with the
+// given key.
+func setConfigValues(cmd *cobra.Command, c config, key string, e errors.TemplateFn) error {
+	for name, fa := range bflags.GetFlagArgs(cmd) {
+		v, ok := c[name]
+		if !ok || fa.IsArg || fa.Secret {
+			continue
+		}
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		if err := setConfigValue(f, v); err != nil {
+			return e("key", name, "set_error", err.Error())
+		}
+		if f.Annotations == nil {
+			f.Annotations = make(map[string][]string)
+		}
+		f.Annotations[key] = []string{"true"}
+	}
+	return nil
+}
+
+// setConfigValue sets the flag to the given config value. Slices are replaced
+// rather than appended to, such that config values can be layered.
+func setConfigValue(f *pflag.Flag, v interface{}) error {
+	sv, ok := f.Value.(pflag.SliceValue)
+	items, isSlice := v.([]interface{})
+	if !ok || !isSlice {
+		return f.Value.Set(configString(v))
+	}
+	ss := make([]string, len(items))
+	for i, item := range items {
+		ss[i] = configString(item)
+	}
+	return sv.Replace(ss)
+}
+
+// applyConfigTree applies the config, the profile and the credentials to the
+// given command and its sub-commands.
+func (a *App) applyConfigTree(cmd *cobra.Command) error {
+	err := a.applyConfig(cmd)
+	if err == nil {
+		err = a.applyProfile(cmd)
+	}
+	if err == nil {
+		err = a.applyCredentials(cmd)
+	}
+	if err != nil {
+		return err
+	}
+	for _, sub := range cmd.Commands() {
+		if err := a.applyConfigTree(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addConfigCmd adds the 'config' command group to the root command if enabled
+// and the root has no command with that name.
+func (a *App) addConfigCmd() {
+	if !a.configCmd {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == configCmdName {
+			return
+		}
+	}
+	completeKeys := func(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var ret []string
+		for key, k := range configKeys(cmd.Root()) {
+			if !k.secret {
+				ret = append(ret, key)
+			}
+		}
+		sort.Strings(ret)
+		return ret, cobra.ShellCompDirectiveNoFileComp
+	}
+	group := &cobra.Command{
+		Use:   configCmdName,
+		Short: "Manage the config file",
+		Long: `Manage the config file.
+
+The keys of the config are the names of the flags of the commands: flags not
+set on the command line take their value from the config file.`,
+	}
+	group.AddCommand(
+		&cobra.Command{
+			Use:   "path",
+			Short: "Print the path of the config file",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				_, err := fmt.Fprintln(cmd.OutOrStdout(), a.activeConfigFile())
+				return err
+			},
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the keys and values of the config",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				c, err := a.loadConfigFile(a.activeConfigFile())
+				if err != nil {
+					return err
+				}
+				for _, key := range c.sortedKeys() {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s=%s\n", key, configString(c[key]))
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:               "get <key>",
+			Short:             "Print the value of a key of the config",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeKeys,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := a.loadConfigFile(a.activeConfigFile())
+				if err != nil {
+					return err
+				}
+				v, ok := c[args[0]]
+				if !ok {
+					return errors.E("config get", errors.K.NotExist, ErrInvalidConfig, "reason", "key not set", "key", args[0])
+				}
+				_, err = fmt.Fprintln(cmd.OutOrStdout(), configString(v))
+				return err
+			},
+		},
+		&cobra.Command{
+			Use:               "set <key> <value>",
+			Short:             "Set the value of a key of the config",
+			Args:              cobra.ExactArgs(2),
+			ValidArgsFunction: completeKeys,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				v, err := checkConfigValue(configKeys(cmd.Root()), args[0], args[1])
+				if err != nil {
+					return err
+				}
+				c, err := a.loadConfigFile(a.activeConfigFile())
+				if err != nil {
+					return err
+				}
+				c[args[0]] = v
+				return a.saveConfig(c)
+			},
+		},
+		&cobra.Command{
+			Use:               "unset <key>",
+			Short:             "Remove a key from the config",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeKeys,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := a.loadConfigFile(a.activeConfigFile())
+				if err != nil {
+					return err
+				}
+				if _, ok := c[args[0]]; !ok {
+					return nil
+				}
+				delete(c, args[0])
+				return a.saveConfig(c)
+			},
+		},
+		&cobra.Command{
+			Use:   "edit",
+			Short: "Edit the config file with $VISUAL or $EDITOR",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				return a.editConfig(cmd)
+			},
+		},
+	)
+	a.root.AddCommand(group)
+}
+
+// editConfig opens the config file in the editor of the user and validates it
+// once edited.
+func (a *App) editConfig(cmd *cobra.Command) error {
+	file := a.activeConfigFile()
+	e := errors.Template("config edit", errors.K.IO, "file", file)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		if err = a.saveConfig(config{}); err != nil {
+			return err
+		}
+	}
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), file)
+	ed := exec.Command(args[0], args[1:]...)
+	ed.Stdin = cmd.InOrStdin()
+	ed.Stdout = cmd.OutOrStdout()
+	ed.Stderr = cmd.ErrOrStderr()
+	if err := ed.Run(); err != nil {
+		return e(err, "editor", editor)
+	}
+	c, err := a.loadConfigFile(file)
+	if err != nil {
+		return err
+	}
+	return checkConfig(cmd.Root(), c)
+}
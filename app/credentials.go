@@ -0,0 +1,251 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/ecobra-go/params/credentials"
+)
+
+const (
+	authCmdName        = "auth"
+	credentialsFlagKey = "credentials" // key for flags annotation: value set from the credential store
+)
+
+// LoginFunc returns the secret stored under the given name by the 'auth login'
+// command, for example a token obtained from an identity provider.
+type LoginFunc func(cmd *cobra.Command, name string) (string, error)
+
+// WithCredentials sets the store of the credentials of the app and enables
+// them: secret flags (see bflags.FlagBond.IsSecret) not set on the command line
+// take their value from the credential stored under their name, such that
+// tokens never sit in plaintext config or shell history. Run functions get
+// other credentials with CmdCtx.Credential.
+func (a *App) WithCredentials(store credentials.Store) *App {
+	a.creds = store
+	return a
+}
+
+// WithAuthCommand enables credentials - see WithCredentials and Credentials -
+// and adds the built-in 'auth' command group managing them if b is true:
+//
+//	myapp auth login [name]
+//	myapp auth logout [name]
+//	myapp auth status
+//
+// The name of the credential defaults to the name of the secret flag of the
+// app, if there is exactly one.
+func (a *App) WithAuthCommand(b bool) *App {
+	a.authCmd = b
+	return a
+}
+
+// WithLogin sets the function returning the secret stored by 'auth login'. By
+// default, the secret is read from the standard input.
+func (a *App) WithLogin(fn LoginFunc) *App {
+	a.login = fn
+	return a
+}
+
+// Credentials returns the credential store of the app: the store set with
+// WithCredentials or the keyring of the OS, with a fallback to the file
+// credentials.json in the directory of the config file (see ConfigFile).
+func (a *App) Credentials() credentials.Store {
+	if a.creds != nil {
+		return a.creds
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return credentials.Default(a.spec.CmdRoot.Name(), filepath.Join(dir, a.spec.CmdRoot.Name(), "credentials.json"))
+}
+
+// credentialsEnabled returns true if credentials are enabled.
+func (a *App) credentialsEnabled() bool {
+	return a.creds != nil || a.authCmd
+}
+
+// setCredentials sets the credential store in the context if enabled.
+func (a *App) setCredentials(ctx *CmdCtx) {
+	if a.credentialsEnabled() {
+		ctx.Set(CtxCredentials, a.Credentials())
+	}
+}
+
+// Credential returns the credential with the given name from the credential
+// store of the app - see App.WithCredentials. The error wraps
+// credentials.ErrNotFound if there is no such credential.
+func (c *CmdCtx) Credential(name string) (string, error) {
+	v, ok := c.Get(CtxCredentials)
+	if !ok {
+		return "", errors.E("Credential", errors.K.NotExist, credentials.ErrNotFound,
+			"reason", "credentials not enabled",
+			"name", name)
+	}
+	return v.(credentials.Store).Get(name)
+}
+
+// applyCredentials sets the secret flags of the command that were not set on
+// the command line to their value in the credential store, if enabled.
+func (a *App) applyCredentials(cmd *cobra.Command) error {
+	if !a.credentialsEnabled() {
+		return nil
+	}
+	var store credentials.Store
+	for name, fa := range bflags.GetFlagArgs(cmd) {
+		if !fa.Secret || fa.IsArg {
+			continue
+		}
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		if store == nil {
+			store = a.Credentials()
+		}
+		secret, err := store.Get(name)
+		if errors.Is(err, credentials.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err = f.Value.Set(secret); err != nil {
+			return errors.E("applyCredentials", errors.K.Invalid, err, "flag", name)
+		}
+		if f.Annotations == nil {
+			f.Annotations = make(map[string][]string)
+		}
+		f.Annotations[credentialsFlagKey] = []string{"true"}
+	}
+	return nil
+}
+
+// secretFlags returns the sorted names of the secret flags bound to the given
+// command and its sub-commands.
+func secretFlags(root *cobra.Command) []string {
+	var ret []string
+	for name, k := range configKeys(root) {
+		if k.secret {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// readSecret is the default LoginFunc: it reads the secret from the input of
+// the command.
+func readSecret(cmd *cobra.Command, name string) (string, error) {
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: ", name)
+	line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", errors.E("auth login", errors.K.IO, err, "name", name)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", errors.E("auth login", errors.K.Invalid, "reason", "no secret", "name", name)
+	}
+	return secret, nil
+}
+
+// addAuthCmd adds the 'auth' command group to the root command if enabled and
+// the root has no command with that name.
+func (a *App) addAuthCmd() {
+	if !a.authCmd {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == authCmdName {
+			return
+		}
+	}
+	// credentialName returns the name given in args or the default name
+	credentialName := func(cmd *cobra.Command, args []string) (string, error) {
+		if len(args) > 0 {
+			return args[0], nil
+		}
+		if names := secretFlags(cmd.Root()); len(names) == 1 {
+			return names[0], nil
+		}
+		return "", errors.E(cmd.CommandPath(), errors.K.Invalid, "reason", "name of the credential required")
+	}
+	completeNames := func(cmd *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return secretFlags(cmd.Root()), cobra.ShellCompDirectiveNoFileComp
+	}
+	group := &cobra.Command{
+		Use:   authCmdName,
+		Short: "Manage credentials",
+		Long: `Manage the credentials stored in the keyring of the OS.
+
+Secret flags not set on the command line take their value from the credential
+stored under their name.`,
+	}
+	group.AddCommand(
+		&cobra.Command{
+			Use:               "login [name]",
+			Short:             "Store a credential",
+			Args:              cobra.MaximumNArgs(1),
+			ValidArgsFunction: completeNames,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				name, err := credentialName(cmd, args)
+				if err != nil {
+					return err
+				}
+				login := a.login
+				if login == nil {
+					login = readSecret
+				}
+				secret, err := login(cmd, name)
+				if err != nil {
+					return err
+				}
+				return a.Credentials().Set(name, secret)
+			},
+		},
+		&cobra.Command{
+			Use:               "logout [name]",
+			Short:             "Remove a credential",
+			Args:              cobra.MaximumNArgs(1),
+			ValidArgsFunction: completeNames,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				name, err := credentialName(cmd, args)
+				if err != nil {
+					return err
+				}
+				return a.Credentials().Delete(name)
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show the stored credentials of the secret flags",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				store := a.Credentials()
+				for _, name := range secretFlags(cmd.Root()) {
+					status := "stored"
+					if _, err := store.Get(name); errors.Is(err, credentials.ErrNotFound) {
+						status = "not stored"
+					} else if err != nil {
+						return err
+					}
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, status)
+				}
+				return nil
+			},
+		},
+	)
+	a.root.AddCommand(group)
+}
@@ -1,11 +1,30 @@
 package app
 
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
 const (
 	CtxCmd           = "cmd"
 	CtxResult        = "result"
 	CtxAddResultFn   = "add-result-fn"
 	CtxPrintResultFn = "print-result-fn"
 	CtxGetResultFn   = "get-result-fn"
+	CtxRoles         = "roles"
+	CtxHTTPClient    = "http-client"
+	CtxClock         = "clock"
+	CtxRand          = "rand"
+	CtxStateDir      = "state-dir"
+	CtxCacheDir      = "cache-dir"
+	CtxCredentials   = "credentials"
+	CtxInvocationID  = "invocation-id"
+	CtxEmitFn        = "emit-fn"
+	CtxProviders     = "providers"
+	CtxProfile       = "profile"
 	CmdValidate      = "$cmd-validate"
 )
 
@@ -33,3 +52,50 @@ func (c *CmdCtx) Get(k string) (interface{}, bool) {
 func (c *CmdCtx) Set(k string, v interface{}) {
 	c.kv[k] = v
 }
+
+// clone returns a shallow copy of the context.
+func (c *CmdCtx) clone() *CmdCtx {
+	ret := NewCmdCtx()
+	if c != nil {
+		for k, v := range c.kv {
+			ret.kv[k] = v
+		}
+	}
+	return ret
+}
+
+// Context returns the context.Context of the command running with this
+// context. It carries the CmdCtx - see CmdCtxFromContext - such that libraries
+// receiving only a context.Context can reach the command state. A background
+// context carrying the CmdCtx is returned if the CmdCtx is not bound to a
+// running command, e.g. with App.Invoke.
+func (c *CmdCtx) Context() context.Context {
+	if v, ok := c.Get(CtxCmd); ok {
+		if cmd, ok := v.(*cobra.Command); ok && cmd.Context() != nil {
+			if cc, _ := CmdCtxFromContext(cmd.Context()); cc == c {
+				return cmd.Context()
+			}
+		}
+	}
+	return bflags.ContextWithCmdCtx(context.Background(), c)
+}
+
+// CmdCtxFromContext returns the CmdCtx carried by the given context.Context of
+// a command and true if it carries one.
+func CmdCtxFromContext(ctx context.Context) (*CmdCtx, bool) {
+	v, ok := bflags.CmdCtxFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	c, ok := v.(*CmdCtx)
+	return c, ok
+}
+
+// bridgeContext sets a context.Context carrying the given CmdCtx to the
+// command, derived from the current context of the command.
+func bridgeContext(cmd *cobra.Command, ctx *CmdCtx) {
+	if cc, _ := CmdCtxFromContext(cmd.Context()); cc == ctx {
+		return
+	}
+	cmd.SetContext(bflags.ContextWithCmdCtx(cmd.Context(), ctx))
+}
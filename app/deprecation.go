@@ -0,0 +1,211 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const deprecationKey = "app_deprecation" // key for commands annotation
+
+// Deprecation is the deprecation timeline of a command. Versions are compared
+// to the version of the app - the Version of the root command - as dotted
+// numbers, with an optional 'v' prefix.
+//
+// The command warns on use with increasing severity: a notice before the
+// Since version, a warning from the Since version on and an error from the
+// Removal version on, when the command fails if Enforce is true. The notice is
+// also rendered at the top of the help of the command.
+type Deprecation struct {
+	Message string `json:"message,omitempty"` // what to use instead, e.g. "use 'fetch' instead"
+	Since   string `json:"since,omitempty"`   // version of the app deprecating the command
+	Removal string `json:"removal,omitempty"` // version of the app removing the command
+	Enforce bool   `json:"enforce,omitempty"` // fail from the Removal version on instead of warning
+}
+
+// deprecation levels, by increasing severity
+const (
+	deprecationNotice = iota
+	deprecationWarning
+	deprecationRemoved
+)
+
+// deprecation returns the deprecation of the command, whose message defaults to
+// the Deprecated field.
+func (c *Cmd) deprecation() *Deprecation {
+	if c.Deprecation == nil || c.Deprecation.Message != "" || c.Deprecated == "" {
+		return c.Deprecation
+	}
+	d := *c.Deprecation
+	d.Message = c.Deprecated
+	return &d
+}
+
+// setDeprecation sets the deprecation of the given command, whose app has the
+// given version.
+func setDeprecation(cmd *cobra.Command, d *Deprecation, version string) error {
+	if d == nil {
+		return nil
+	}
+	for _, v := range []string{d.Since, d.Removal} {
+		if _, err := parseVersion(v); err != nil {
+			return errors.E("setDeprecation", errors.K.Invalid, ErrInvalidSpec,
+				"reason", "invalid version",
+				"command", cmd.Name(),
+				"version", v)
+		}
+	}
+	bb, err := json.Marshal(d)
+	if err != nil {
+		return errors.E("setDeprecation", errors.K.Invalid, err)
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[deprecationKey] = string(bb)
+	_, notice := d.notice(cmd.Name(), version)
+	bflags.SetDeprecation(cmd, notice)
+	return nil
+}
+
+func getDeprecation(cmd *cobra.Command) *Deprecation {
+	s := cmd.Annotations[deprecationKey]
+	if s == "" {
+		return nil
+	}
+	d := &Deprecation{}
+	if err := json.Unmarshal([]byte(s), d); err != nil {
+		return nil
+	}
+	return d
+}
+
+// isDeprecated returns true if the given command is deprecated, either with
+// cobra's Deprecated field or with a Deprecation.
+func isDeprecated(cmd *cobra.Command) bool {
+	return cmd.Deprecated != "" || cmd.Annotations[deprecationKey] != ""
+}
+
+// checkDeprecation prints the deprecation notice of the given command to its
+// error output and returns an error wrapping ErrCommandRemoved if the command
+// was removed and the removal is enforced.
+func checkDeprecation(cmd *cobra.Command) error {
+	d := getDeprecation(cmd)
+	if d == nil {
+		return nil
+	}
+	level, notice := d.notice(cmd.Name(), cmd.Root().Version)
+	if level == deprecationRemoved && d.Enforce {
+		return errors.E("checkDeprecation", errors.K.NotExist, ErrCommandRemoved,
+			"command", cmd.CommandPath(),
+			"removal", d.Removal,
+			"reason", d.Message)
+	}
+	prefix, color := "Notice: ", ""
+	switch level {
+	case deprecationWarning:
+		prefix, color = "Warning: ", ansiYellow
+	case deprecationRemoved:
+		prefix, color = "Error: ", ansiRed
+	}
+	w := cmd.ErrOrStderr()
+	line := prefix + notice
+	if color != "" && useColor(cmd, w) {
+		line = colorize(line, color)
+	}
+	_, _ = fmt.Fprintln(w, line)
+	return nil
+}
+
+// notice returns the deprecation level of the command with the given name in
+// the given version of the app and the notice describing it. The level is a
+// warning if the version of the app is not known or not a dotted version, e.g.
+// 'dev'.
+func (d *Deprecation) notice(name, version string) (int, string) {
+	level := deprecationWarning
+	if v, err := parseVersion(version); err == nil && v != nil {
+		if d.Removal != "" && compareVersions(version, d.Removal) >= 0 {
+			level = deprecationRemoved
+		} else if d.Since != "" && compareVersions(version, d.Since) < 0 {
+			level = deprecationNotice
+		}
+	}
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("command %q ", name))
+	switch level {
+	case deprecationNotice:
+		sb.WriteString("will be deprecated in " + d.Since)
+		if d.Removal != "" {
+			sb.WriteString(" and removed in " + d.Removal)
+		}
+	case deprecationWarning:
+		sb.WriteString("is deprecated")
+		if d.Since != "" {
+			sb.WriteString(" since " + d.Since)
+		}
+		if d.Removal != "" {
+			sb.WriteString(" and will be removed in " + d.Removal)
+		}
+	case deprecationRemoved:
+		if d.Enforce {
+			sb.WriteString("was removed in " + d.Removal)
+		} else {
+			sb.WriteString("is deprecated and due for removal since " + d.Removal)
+		}
+	}
+	if d.Message != "" {
+		sb.WriteString(": " + d.Message)
+	}
+	return level, sb.String()
+}
+
+// parseVersion parses the numbers of the given version, e.g. [1 2 0] for
+// 'v1.2.0'. Pre-release and build suffixes are ignored.
+func parseVersion(v string) ([]int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	s := strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	ret := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.E("parseVersion", errors.K.Invalid, "reason", "invalid version", "version", v)
+		}
+		ret[i] = n
+	}
+	return ret, nil
+}
+
+// compareVersions compares the given versions and returns -1, 0 or +1 if a is
+// lower than, equal to or greater than b. Missing numbers count as 0.
+func compareVersions(a, b string) int {
+	va, _ := parseVersion(a)
+	vb, _ := parseVersion(b)
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
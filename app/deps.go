@@ -0,0 +1,76 @@
+package app
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Deps are replaceable dependencies of commands. Commands using them through
+// their CmdCtx - rather than directly - can be tested without live backends:
+// see apptest.Recorder.
+type Deps struct {
+	HTTPClient *http.Client     // HTTP client - http.DefaultClient if nil
+	Clock      func() time.Time // current time - time.Now if nil
+	Rand       *rand.Rand       // source of randomness - seeded with the current time if nil
+}
+
+// WithDeps sets the dependencies made available to commands in their CmdCtx.
+func (a *App) WithDeps(d *Deps) *App {
+	a.deps = d
+	return a
+}
+
+// set sets the dependencies to the given context.
+func (d *Deps) set(ctx *CmdCtx) {
+	if d == nil {
+		return
+	}
+	if d.HTTPClient != nil {
+		ctx.Set(CtxHTTPClient, d.HTTPClient)
+	}
+	if d.Clock != nil {
+		ctx.Set(CtxClock, d.Clock)
+	}
+	if d.Rand != nil {
+		ctx.Set(CtxRand, d.Rand)
+	}
+}
+
+// HTTPClient returns the HTTP client set with App.WithDeps, the client built
+// from the HTTP options of the app - see App.WithHTTPOptions - or
+// http.DefaultClient.
+func (c *CmdCtx) HTTPClient() *http.Client {
+	if v, ok := c.Get(CtxHTTPClient); ok {
+		if cl, ok := v.(*http.Client); ok {
+			return cl
+		}
+	}
+	return http.DefaultClient
+}
+
+// Now returns the current time from the clock set with App.WithDeps or
+// time.Now.
+func (c *CmdCtx) Now() time.Time {
+	if v, ok := c.Get(CtxClock); ok {
+		if fn, ok := v.(func() time.Time); ok {
+			return fn()
+		}
+	}
+	return time.Now()
+}
+
+// Rand returns the source of randomness set with App.WithDeps or a source
+// seeded with the current time.
+func (c *CmdCtx) Rand() *rand.Rand {
+	if v, ok := c.Get(CtxRand); ok {
+		if r, ok := v.(*rand.Rand); ok {
+			return r
+		}
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if c != nil {
+		c.Set(CtxRand, r)
+	}
+	return r
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const diffAgainstFlag = "diff-against"
+
+// Change types of a Difference.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Difference is a difference between the output of a command and a saved
+// result.
+type Difference struct {
+	Path   string      `json:"path" table:"PATH"`            // JSONPath of the value
+	Change string      `json:"change" table:"CHANGE"`        // added, removed or changed
+	Old    interface{} `json:"old,omitempty" table:"OLD,40"` // value in the saved result
+	New    interface{} `json:"new,omitempty" table:"NEW,40"` // value in the output
+}
+
+// diffAgainst compares the given output of the command to the result saved in
+// the given file - prefixed with '@' or not - and returns their differences.
+// The query, if not nil, is evaluated against the saved result before the
+// comparison, as it was against the output.
+func diffAgainst(file string, out interface{}, q *query) ([]*Difference, error) {
+	file = strings.TrimPrefix(file, "@")
+	e := errors.Template("diffAgainst", errors.K.Invalid, "file", file)
+	bb, err := os.ReadFile(file)
+	if err != nil {
+		return nil, e(errors.K.NotExist, err)
+	}
+	saved, err := decodeJSON(bb)
+	if err != nil {
+		return nil, e(err, "reason", "invalid JSON")
+	}
+	if q != nil {
+		if saved, err = q.eval(saved); err != nil {
+			return nil, e(err)
+		}
+	}
+	current, err := toJSONValue(out)
+	if err != nil {
+		return nil, e(err)
+	}
+	return diffValues("$", saved, current, []*Difference{}), nil
+}
+
+// toJSONValue returns the generic JSON representation of v.
+func toJSONValue(v interface{}) (interface{}, error) {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(bb)
+}
+
+// decodeJSON decodes the given JSON document into its generic representation.
+// Numbers are decoded as json.Number such that integers are not rounded to
+// float64.
+func decodeJSON(bb []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(bb))
+	dec.UseNumber()
+	var ret interface{}
+	if err := dec.Decode(&ret); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.E("decodeJSON", errors.K.Invalid, "reason", "unexpected data after the JSON value")
+	}
+	return ret, nil
+}
+
+// sameNumber returns true if the given values are numbers with the same value,
+// e.g. 1 and 1.0.
+func sameNumber(a, b interface{}) bool {
+	na, ok := a.(json.Number)
+	if !ok {
+		return false
+	}
+	nb, ok := b.(json.Number)
+	if !ok {
+		return false
+	}
+	ra, ok := new(big.Rat).SetString(string(na))
+	if !ok {
+		return false
+	}
+	rb, ok := new(big.Rat).SetString(string(nb))
+	return ok && ra.Cmp(rb) == 0
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// diffValues appends the differences between the given generic JSON values at
+// the given path to ret.
+func diffValues(path string, old, cur interface{}, ret []*Difference) []*Difference {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := cur.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(o)+len(n))
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, found := o[k]; !found {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "['" + k + "']"
+			if identifier.MatchString(k) {
+				p = path + "." + k
+			}
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			switch {
+			case !inNew:
+				ret = append(ret, &Difference{Path: p, Change: ChangeRemoved, Old: ov})
+			case !inOld:
+				ret = append(ret, &Difference{Path: p, Change: ChangeAdded, New: nv})
+			default:
+				ret = diffValues(p, ov, nv, ret)
+			}
+		}
+		return ret
+	case []interface{}:
+		n, ok := cur.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(n):
+				ret = append(ret, &Difference{Path: p, Change: ChangeRemoved, Old: o[i]})
+			case i >= len(o):
+				ret = append(ret, &Difference{Path: p, Change: ChangeAdded, New: n[i]})
+			default:
+				ret = diffValues(p, o[i], n[i], ret)
+			}
+		}
+		return ret
+	}
+	if !reflect.DeepEqual(old, cur) && !sameNumber(old, cur) {
+		ret = append(ret, &Difference{Path: path, Change: ChangeChanged, Old: old, New: cur})
+	}
+	return ret
+}
+
+// formatDiff is the default output format of differences: one line per
+// difference, prefixed with '+' for added, '-' for removed and '~' for changed
+// values.
+func formatDiff(w io.Writer, cmd *cobra.Command, out interface{}) error {
+	color := useColor(cmd, cmd.OutOrStdout())
+	sb := &strings.Builder{}
+	for _, d := range out.([]*Difference) {
+		var line, c string
+		switch d.Change {
+		case ChangeAdded:
+			line, c = fmt.Sprintf("+ %s: %s", d.Path, compactJSON(d.New)), ansiGreen
+		case ChangeRemoved:
+			line, c = fmt.Sprintf("- %s: %s", d.Path, compactJSON(d.Old)), ansiRed
+		default:
+			line, c = fmt.Sprintf("~ %s: %s -> %s", d.Path, compactJSON(d.Old), compactJSON(d.New)), ansiYellow
+		}
+		if color {
+			line = colorize(line, c)
+		}
+		sb.WriteString(line + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func compactJSON(v interface{}) string {
+	bb, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bb)
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	stateDirFlag = "state-dir"
+	cacheDirFlag = "cache-dir"
+	lockTimeout  = time.Second // max wait for the lock of a state file
+	staleLock    = 10 * time.Second
+)
+
+// WithStateDir sets the directory where the app persists state across
+// processes, like the invocations of rate limited commands. See StateDir.
+func (a *App) WithStateDir(dir string) *App {
+	a.stateDir = dir
+	return a
+}
+
+// WithCacheDir sets the directory where the app caches data. See CacheDir.
+func (a *App) WithCacheDir(dir string) *App {
+	a.cacheDir = dir
+	return a
+}
+
+// WithDirFlags adds the persistent --state-dir and --cache-dir flags to the
+// root command if b is true. The flags override the directories of the app.
+func (a *App) WithDirFlags(b bool) *App {
+	a.dirFlags = b
+	return a
+}
+
+// addDirFlags adds the persistent flags of the directories of the app to the
+// root command if enabled.
+func (a *App) addDirFlags() error {
+	if !a.dirFlags {
+		return nil
+	}
+	fs := a.root.PersistentFlags()
+	for _, name := range []string{stateDirFlag, cacheDirFlag} {
+		if fs.Lookup(name) != nil {
+			return errors.E("addDirFlags", errors.K.Invalid, ErrInvalidSpec, bflags.ErrDuplicateFlag, "flag", name)
+		}
+	}
+	fs.String(stateDirFlag, "", "directory of the state persisted across runs")
+	fs.String(cacheDirFlag, "", "directory of cached data")
+	return nil
+}
+
+// StateDir returns the state directory of the app, which is the first of:
+//   - the value of the --state-dir flag - see WithDirFlags
+//   - the value of the <APP>_STATE_DIR environment variable, where <APP> is the
+//     upper-case name of the root command
+//   - the directory set with WithStateDir
+//   - the directory named after the app in $XDG_STATE_HOME, or in
+//     ~/.local/state on unix systems and in the user cache directory otherwise
+//
+// The directory is not created: see CmdCtx.StateDir.
+func (a *App) StateDir() string {
+	if dir := a.dirOverride(stateDirFlag, "STATE_DIR", a.stateDir); dir != "" {
+		return dir
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil && runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+			dir = filepath.Join(home, ".local", "state")
+		} else if dir, err = os.UserCacheDir(); err != nil {
+			dir = os.TempDir()
+		}
+	}
+	return filepath.Join(dir, a.spec.CmdRoot.Name())
+}
+
+// CacheDir returns the cache directory of the app, which is the first of:
+//   - the value of the --cache-dir flag - see WithDirFlags
+//   - the value of the <APP>_CACHE_DIR environment variable
+//   - the directory set with WithCacheDir
+//   - the directory named after the app in the user cache directory -
+//     $XDG_CACHE_HOME or ~/.cache on unix systems
+//
+// The directory is not created: see CmdCtx.CacheDir.
+func (a *App) CacheDir() string {
+	if dir := a.dirOverride(cacheDirFlag, "CACHE_DIR", a.cacheDir); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, a.spec.CmdRoot.Name())
+}
+
+// dirOverride returns the directory set with the given flag, environment
+// variable suffix or option, in this order of precedence.
+func (a *App) dirOverride(flag, envSuffix, opt string) string {
+	if a.root != nil {
+		if f := a.root.PersistentFlags().Lookup(flag); f != nil && f.Changed {
+			return f.Value.String()
+		}
+	}
+	if dir := os.Getenv(envPrefix(a.spec.CmdRoot.Name()) + envSuffix); dir != "" {
+		return dir
+	}
+	return opt
+}
+
+// envPrefix returns the prefix of the environment variables of the app with
+// the given name, e.g. 'MY_APP_' for 'my-app'.
+func envPrefix(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_", " ", "_").Replace(name)) + "_"
+}
+
+// setDirs sets the functions resolving the directories of the app to the
+// context.
+func (a *App) setDirs(ctx *CmdCtx) {
+	ctx.Set(CtxStateDir, a.StateDir)
+	ctx.Set(CtxCacheDir, a.CacheDir)
+}
+
+// StateDir returns the state directory of the app - see App.StateDir - which
+// is created if necessary.
+func (c *CmdCtx) StateDir() (string, error) {
+	return c.dir(CtxStateDir)
+}
+
+// CacheDir returns the cache directory of the app - see App.CacheDir - which
+// is created if necessary.
+func (c *CmdCtx) CacheDir() (string, error) {
+	return c.dir(CtxCacheDir)
+}
+
+func (c *CmdCtx) dir(key string) (string, error) {
+	v, ok := c.Get(key)
+	if !ok {
+		return "", errors.E("dir", errors.K.NotExist, "reason", "directory not set", "key", key)
+	}
+	dir := v.(func() string)()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.E("dir", errors.K.IO, err, "dir", dir)
+	}
+	return dir, nil
+}
+
+// stateFile returns the path of the file with the given prefix and suffix -
+// e.g. ".json" - holding state of the given command in the state dir, which is
+// created if necessary.
+func (a *App) stateFile(prefix string, cmd *cobra.Command, suffix string) (string, error) {
+	dir := a.StateDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, prefix+"-"+strings.ReplaceAll(cmd.CommandPath(), " ", "_")+suffix), nil
+}
+
+// lockFile acquires an exclusive lock on the given file through a lock file
+// created next to it. Locks older than staleLock are considered abandoned.
+func lockFile(file string) (unlock func(), err error) {
+	lock := file + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, serr := os.Stat(lock); serr == nil && time.Since(fi.ModTime()) > staleLock {
+			_ = os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.E("lockFile", errors.K.Timeout, "lock", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// holdLock acquires the lock of the given file like lockFile and keeps it from
+// becoming stale until released, for locks held longer than staleLock.
+func holdLock(file string) (release func(), err error) {
+	unlock, err := lockFile(file)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(staleLock / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				_ = os.Chtimes(file+".lock", now, now)
+			}
+		}
+	}()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(done)
+			unlock()
+		})
+	}, nil
+}
+
+// writeFileAtomic writes the given file through a temporary file renamed to it.
+// The temporary file has a unique name, such that concurrent writers don't
+// clobber each other.
+func writeFileAtomic(file string, bb []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(bb)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	envCmdName = "env"
+
+	SourceFlag        = "flag"        // the value was set on the command line
+	SourceDefault     = "default"     // the value is the default value
+	SourceConfig      = "config"      // the value was set in the config file - see App.WithConfigCommand
+	SourceCredentials = "credentials" // the value was set from the credential store - see App.WithCredentials
+	SourceEnv         = "env"         // the value was set from an environment variable - see bflags.BindEnv
+	SourceProfile     = "profile"     // the value was set from the active profile - see App.WithProfiles
+)
+
+// FlagSource describes a flag or arg of a command with its environment
+// variable, its default, its effective value and the source of the effective
+// value. Values of secret flags are redacted.
+type FlagSource struct {
+	Command string `json:"command"`       // path of the command
+	Flag    string `json:"flag"`          // name of the flag or arg - also its key in the config file
+	Arg     bool   `json:"arg,omitempty"` // true for positional args
+	Env     string `json:"env,omitempty"` // environment variable of the flag - see bflags.EnvVar
+	Default string `json:"default"`       // default value
+	Value   string `json:"value"`         // effective value
+	Source  string `json:"source"`        // source of the effective value: SourceFlag, SourceConfig etc.
+}
+
+// FlagSources returns the sources of the flags and args bound to the given
+// command and its sub-commands, sorted by command path and flag name. The
+// values of environment variables are applied to flags only when their command
+// executes: for other commands, the effective value of a flag not set on the
+// command line is the value of its environment variable if set.
+func FlagSources(c *cobra.Command) []*FlagSource {
+	var ret []*FlagSource
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		ret = append(ret, cmdFlagSources(c)...)
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(c)
+	return ret
+}
+
+func cmdFlagSources(c *cobra.Command) []*FlagSource {
+	var ret []*FlagSource
+	for name, fa := range bflags.GetFlagArgs(c) {
+		f := c.Flags().Lookup(name)
+		if f == nil {
+			f = c.PersistentFlags().Lookup(name)
+		}
+		if f == nil {
+			continue
+		}
+		ret = append(ret, flagSource(c, f, fa))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Flag < ret[j].Flag
+	})
+	return ret
+}
+
+func flagSource(c *cobra.Command, f *pflag.Flag, fa *bflags.FlagArg) *FlagSource {
+	s := &FlagSource{
+		Command: c.CommandPath(),
+		Flag:    f.Name,
+		Arg:     fa.IsArg,
+		Env:     bflags.EnvVar(c, f.Name),
+		Default: f.DefValue,
+		Value:   bflags.ValueString(f.Value),
+		Source:  SourceDefault,
+	}
+	if f.Changed {
+		s.Source = SourceFlag
+	} else if f.Annotations[bflags.EnvAnnotation] != nil {
+		s.Source = SourceEnv
+	} else if val, ok := os.LookupEnv(s.Env); ok && s.Env != "" {
+		s.Source = SourceEnv
+		s.Value = val
+	} else if f.Annotations[credentialsFlagKey] != nil {
+		s.Source = SourceCredentials
+	} else if f.Annotations[profileFlagKey] != nil {
+		s.Source = SourceProfile
+	} else if f.Annotations[configFlagKey] != nil {
+		s.Source = SourceConfig
+	}
+	if fa.Secret {
+		if s.Default != "" {
+			s.Default = bflags.RedactedValue
+		}
+		if s.Value != "" {
+			s.Value = bflags.RedactedValue
+		}
+	}
+	return s
+}
+
+// WithEnvCommand adds the built-in 'env' command to the app if b is true. The
+// command lists the flags and args of all commands - or of the given command -
+// with their environment variable, default, effective value and its source:
+//
+//	myapp env content get
+func (a *App) WithEnvCommand(b bool) *App {
+	a.envCmd = b
+	return a
+}
+
+// addEnvCmd adds the 'env' command to the root command if enabled and the root
+// has no command with that name.
+func (a *App) addEnvCmd() {
+	if !a.envCmd {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == envCmdName {
+			return
+		}
+	}
+	a.root.AddCommand(&cobra.Command{
+		Use:   envCmdName + " [command...]",
+		Short: "List flags of commands with their default and effective value",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := cmd.Root()
+			if len(args) > 0 {
+				c, rest, err := cmd.Root().Find(args)
+				if err != nil || len(rest) > 0 || c == cmd.Root() {
+					return errorCommandNotFound("env", args)
+				}
+				target = c
+			}
+			if err := a.applyConfigTree(target); err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "COMMAND\tFLAG\tENV\tDEFAULT\tVALUE\tSOURCE")
+			for _, s := range FlagSources(target) {
+				name := "--" + s.Flag
+				if s.Arg {
+					name = "<" + s.Flag + ">"
+				}
+				env := s.Env
+				if env == "" {
+					env = "-"
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Command, name, env, s.Default, s.Value, s.Source)
+			}
+			return tw.Flush()
+		},
+	})
+}
+
+func errorCommandNotFound(op string, args []string) error {
+	return errors.E(op, errors.K.NotExist, ErrCommandNotFound, "command", strings.Join(args, " "))
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"github.com/eluv-io/errors-go"
+)
+
+// Sentinel errors wrapped as the cause of errors returned by app. Callers can
+// test for them with errors.Is. Errors raised while binding inputs wrap the
+// sentinel errors of the bflags package (bflags.ErrMissingArg etc.).
+var (
+	// ErrInvalidSpec is the cause of errors reporting an invalid app spec or
+	// runtime function, like a run function with a wrong signature.
+	ErrInvalidSpec = errors.Str("invalid spec")
+	// ErrCommandNotFound is the cause of errors reporting a command path not
+	// found in the app.
+	ErrCommandNotFound = errors.Str("command not found")
+	// ErrFunctionNotFound is the cause of errors reporting a function or an
+	// input constructor referenced by name but not registered in the runtime.
+	ErrFunctionNotFound = errors.Str("function not found")
+	// ErrAmbiguousCommand is the cause of errors reporting a prefix of a
+	// command name matching several commands.
+	ErrAmbiguousCommand = errors.Str("ambiguous command")
+	// ErrUnauthorized is the cause of errors reporting a command that the
+	// user is not authorized to run.
+	ErrUnauthorized = errors.Str("unauthorized")
+	// ErrRateLimited is the cause of errors reporting a command invoked more
+	// often than allowed by its rate limit.
+	ErrRateLimited = errors.Str("rate limited")
+	// ErrInvalidFormat is the cause of errors reporting an unknown or invalid
+	// output format.
+	ErrInvalidFormat = errors.Str("invalid format")
+	// ErrInvalidQuery is the cause of errors reporting an invalid query of the
+	// output of a command.
+	ErrInvalidQuery = errors.Str("invalid query")
+	// ErrOutputDiffers is the cause of errors reporting differences between
+	// the output of a command and the result it is compared to.
+	ErrOutputDiffers = errors.Str("output differs")
+	// ErrInvalidConfig is the cause of errors reporting an invalid config file
+	// or an invalid key or value of the config.
+	ErrInvalidConfig = errors.Str("invalid config")
+	// ErrCommandRemoved is the cause of errors reporting a deprecated command
+	// run after its enforced removal version - see Deprecation.
+	ErrCommandRemoved = errors.Str("command removed")
+	// ErrDependencyNotFound is the cause of errors reporting a dependency
+	// resolved by name but not registered with App.Provide.
+	ErrDependencyNotFound = errors.Str("dependency not found")
+)
@@ -3,8 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-
-	"github.com/eluv-io/ecobra-go/app"
 )
 
 func Execute() {
@@ -22,9 +20,8 @@ func Execute() {
 		return
 	}
 
-	a, _ = app.NewApp(a.Spec(), nil)
-	initApp(a)
-	root, _ = a.Cobra()
+	// re-execute the same app: flags and args of the previous run are reset
+	root, _ = a.NewCobra()
 	os.Args = []string{"cli", "sample", "my_fox", "-p", "9"}
 	err = root.Execute()
 	if err != nil {
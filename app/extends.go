@@ -0,0 +1,133 @@
+package app
+
+import (
+	"reflect"
+
+	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// notInherited are the fields of a command that are never inherited from the
+// command template it extends: they identify the command or are its own.
+var notInherited = map[string]bool{
+	"Use":           true,
+	"Extends":       true,
+	"Aliases":       true,
+	"HiddenAliases": true,
+	"ShellAlias":    true,
+	"SubCommands":   true,
+}
+
+// resolveExtends sets the fields of the commands extending a command template
+// of the spec - see Cmd.Extends - to the fields of the template they don't
+// set. Templates may extend other templates.
+func (s *spec) resolveExtends() error {
+	e := errors.Template("resolveExtends", errors.K.Invalid, ErrInvalidSpec)
+	templates := make(map[string]*Cmd, len(s.CmdTemplates))
+	for _, t := range s.CmdTemplates {
+		if t == nil || t.Name() == "" {
+			return e("reason", "command template without name")
+		}
+		if _, ok := templates[t.Name()]; ok {
+			return e("reason", "duplicate command template", "template", t.Name())
+		}
+		templates[t.Name()] = t
+	}
+
+	resolved := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var extend func(c *Cmd) error
+	extend = func(c *Cmd) error {
+		if c.Extends == "" {
+			return nil
+		}
+		base, ok := templates[c.Extends]
+		if !ok {
+			return e("reason", "unknown command template",
+				"command", c.Name(),
+				"extends", c.Extends)
+		}
+		if !resolved[base.Name()] {
+			if visiting[base.Name()] {
+				return e("reason", "cyclic command templates", "template", base.Name())
+			}
+			visiting[base.Name()] = true
+			if err := extend(base); err != nil {
+				return err
+			}
+			resolved[base.Name()] = true
+		}
+		c.inherit(base)
+		return nil
+	}
+	var walk func(c *Cmd) error
+	walk = func(c *Cmd) error {
+		if err := extend(c); err != nil {
+			return err
+		}
+		for _, sub := range c.SubCommands {
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(s.CmdRoot)
+}
+
+// inherit sets the fields of the command that are not set to the fields of the
+// given template. Maps - like annotations - are merged, with the values of the
+// command taking precedence.
+func (c *Cmd) inherit(base *Cmd) {
+	cv, bv := reflect.ValueOf(c).Elem(), reflect.ValueOf(base).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		f, bf := cv.Field(i), bv.Field(i)
+		if !f.CanSet() || notInherited[cv.Type().Field(i).Name] || bf.IsZero() {
+			continue
+		}
+		switch {
+		case f.Kind() == reflect.Map:
+			f.Set(mergeMaps(bf, f))
+		case f.Kind() == reflect.Interface:
+			inheritInput(f, bf)
+		case f.IsZero():
+			f.Set(bf)
+		}
+	}
+}
+
+// inheritInput sets the input of a command to the input of its template:
+// default values in json are merged and input objects are copied such that
+// commands don't share their input.
+func inheritInput(in, base reflect.Value) {
+	bv := base.Elem()
+	switch {
+	case bv.Kind() == reflect.Map && (in.IsZero() || in.Elem().Type() == bv.Type()):
+		m := reflect.Zero(bv.Type())
+		if !in.IsZero() {
+			m = in.Elem()
+		}
+		in.Set(mergeMaps(bv, m))
+	case !in.IsZero():
+	case bv.Kind() == reflect.Ptr:
+		if cp, err := bflags.CopyInput(nil, base.Interface()); err == nil {
+			in.Set(reflect.ValueOf(cp))
+		}
+	default:
+		in.Set(base)
+	}
+}
+
+// mergeMaps returns a new map with the entries of base and m, entries of m
+// taking precedence.
+func mergeMaps(base, m reflect.Value) reflect.Value {
+	ret := reflect.MakeMapWithSize(base.Type(), base.Len()+m.Len())
+	for _, v := range []reflect.Value{base, m} {
+		iter := v.MapRange()
+		for iter.Next() {
+			ret.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return ret
+}
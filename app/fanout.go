@@ -0,0 +1,374 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	fanOutKey  = "app_fan_out" // key for commands annotation
+	resumeFlag = "resume"
+)
+
+// FanOut configures a command whose last arg is variadic to run its function
+// once per value of the arg when several values are given, e.g. for a batch
+// operation over many content ids:
+//
+//	{"use": "delete", "fan_out": {"parallelism": 4}}
+//
+// Each run gets a copy of the input with the last arg set to a single value.
+// The output of the command is the list of the CmdResult of the runs, keyed by
+// value, and a summary is printed to the error output of the command. The
+// command fails if any run failed. Keys of repeated values are suffixed with
+// their occurrence, e.g. 'a', 'a#2'.
+//
+// With Checkpoint set, the results of the runs are appended to a checkpoint
+// file in the state dir of the app (see App.StateDir) as they complete, like
+// with ResultFileSink, and the command gets a --resume flag: a re-run with the
+// same input and --resume skips the values that succeeded in the previous
+// runs. The checkpoint is named after a hash of the input and locked while the
+// command runs. It is removed once all values succeeded.
+type FanOut struct {
+	Parallelism int  `json:"parallelism,omitempty"` // max count of concurrent runs - 1 if not set
+	Checkpoint  bool `json:"checkpoint,omitempty"`  // persist results and add the --resume flag
+}
+
+func setFanOut(cmd *cobra.Command, f *FanOut) error {
+	if f == nil {
+		return nil
+	}
+	e := errors.Template("setFanOut", errors.K.Invalid, ErrInvalidSpec, "command", cmd.Name())
+	if f.Parallelism < 0 {
+		return e("reason", "negative parallelism", "parallelism", f.Parallelism)
+	}
+	bb, err := json.Marshal(f)
+	if err != nil {
+		return e(err)
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[fanOutKey] = string(bb)
+	return nil
+}
+
+func getFanOut(cmd *cobra.Command) *FanOut {
+	s := cmd.Annotations[fanOutKey]
+	if s == "" {
+		return nil
+	}
+	f := &FanOut{}
+	if err := json.Unmarshal([]byte(s), f); err != nil {
+		return nil
+	}
+	return f
+}
+
+// fanOutArg returns the last arg of the command if it is variadic.
+func fanOutArg(cmd *cobra.Command) *bflags.FlagBond {
+	args, err := bflags.GetCmdArgSet(cmd)
+	if err != nil || args == nil || len(args.Flags) == 0 {
+		return nil
+	}
+	last := args.Flags[len(args.Flags)-1]
+	v := reflect.ValueOf(last.Value)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	return last
+}
+
+// configureFanOut adds the --resume flag to commands with a checkpointed
+// fan-out. It returns an error if the command has a fan-out but no variadic last
+// arg.
+func configureFanOut(cmd *cobra.Command) error {
+	f := getFanOut(cmd)
+	if f == nil {
+		return nil
+	}
+	e := errors.Template("configureFanOut", errors.K.Invalid, ErrInvalidSpec, "command", cmd.Name())
+	if fanOutArg(cmd) == nil {
+		return e("reason", "fan-out requires a variadic last arg")
+	}
+	if f.Checkpoint {
+		if cmd.Flags().Lookup(resumeFlag) != nil {
+			return e(bflags.ErrDuplicateFlag, "flag", resumeFlag)
+		}
+		cmd.Flags().Bool(resumeFlag, false, "skip the values that succeeded in previous runs")
+	}
+	return nil
+}
+
+// fanOutInputs returns deep copies of the given input with the last arg of
+// the command set to a single value, or nil if the command has no fan-out or the
+// arg has less than two values.
+func fanOutInputs(cmd *cobra.Command, in interface{}) ([]interface{}, []string, error) {
+	if getFanOut(cmd) == nil {
+		return nil, nil, nil
+	}
+	fb := fanOutArg(cmd)
+	if fb == nil || in == nil {
+		return nil, nil, nil
+	}
+	e := errors.Template("fanOutInputs", errors.K.Invalid, ErrInvalidSpec, "command", cmd.Name())
+	field := reflect.ValueOf(fb.Value)
+	values := field.Elem()
+	if values.Len() < 2 {
+		return nil, nil, nil
+	}
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, nil, e("reason", "input is not a pointer to a struct")
+	}
+	path, ok := fieldPath(v.Elem(), field)
+	if !ok {
+		return nil, nil, e("reason", "fan-out arg is not a field of the input", "arg", fb.Name)
+	}
+
+	inputs := make([]interface{}, values.Len())
+	keys := make([]string, values.Len())
+	seen := make(map[string]int)
+	for i := 0; i < values.Len(); i++ {
+		// runs must not share the pointers, slices and maps of the input
+		c, err := bflags.CopyInput(nil, in)
+		if err != nil {
+			return nil, nil, err
+		}
+		cp := reflect.ValueOf(c)
+		arg := cp.Elem().FieldByIndex(path)
+		one := reflect.MakeSlice(values.Type(), 1, 1)
+		one.Index(0).Set(arg.Index(i))
+		arg.Set(one)
+		inputs[i] = c
+		key := fmt.Sprint(values.Index(i).Interface())
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		keys[i] = key
+	}
+	return inputs, keys, nil
+}
+
+// fieldPath returns the index path of the field of the struct s located at the
+// address of the pointer ptr. Only fields of nested struct values are walked:
+// fields of pointed structs would be shared by the copies of the input.
+func fieldPath(s reflect.Value, ptr reflect.Value) ([]int, bool) {
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		if f.Type() == ptr.Elem().Type() && f.Addr().Pointer() == ptr.Pointer() {
+			return []int{i}, true
+		}
+		if f.Kind() == reflect.Struct {
+			if path, ok := fieldPath(f, ptr); ok {
+				return append([]int{i}, path...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// runFanOut runs the function once per input - derived from the input in of
+// the command - with the parallelism of the fan-out of the command and returns
+// the results of the runs - a list of CmdResult - and an error if any run
+// failed.
+func (a *App) runFanOut(cmd *cobra.Command, name string, fn reflect.Value, ctx *CmdCtx, in interface{}, inputs []interface{}, keys []string) (interface{}, error, error) {
+	fo := getFanOut(cmd)
+	parallelism := fo.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	var cp *checkpoint
+	if fo.Checkpoint {
+		resume, _ := cmd.Flags().GetBool(resumeFlag)
+		var err error
+		if cp, err = a.openCheckpoint(cmd, in, resume); err != nil {
+			return nil, err, nil
+		}
+	}
+
+	results := make([]*CmdResult, len(inputs))
+	errs := make([]error, len(inputs))
+	skipped := 0
+	sem := make(chan struct{}, parallelism)
+	wg := sync.WaitGroup{}
+	for i := range inputs {
+		if r := cp.succeeded(keys[i]); r != nil {
+			results[i] = r
+			skipped++
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res, err := a.callFn(name, fn, ctx.clone(), inputs[i])
+			var out interface{}
+			if err == nil {
+				out, err = fnResult(res)
+			}
+			results[i] = newCommandResult(keys[i], out, err)
+			if err != nil {
+				errs[i] = errors.E("fan-out", err, "value", keys[i])
+			}
+			cp.add(results[i])
+		}(i)
+	}
+	wg.Wait()
+
+	failed := 0
+	var list error
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			list = errors.Append(list, err)
+		}
+	}
+	if add, ok := ctx.Get(CtxAddResultFn); ok {
+		for i, r := range results {
+			add.(AddResultFn)(r.Key, r.Result, errs[i])
+		}
+	}
+	summary := fmt.Sprintf("%s: %d runs, %d succeeded, %d failed",
+		cmd.CommandPath(), len(inputs)-skipped, len(inputs)-skipped-failed, failed)
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	_, _ = fmt.Fprintln(cmd.ErrOrStderr(), summary)
+
+	if err := cp.close(failed == 0); err != nil {
+		return results, err, nil
+	}
+	if failed > 0 {
+		return results, errors.E("fan-out", errors.K.Invalid, list,
+			"failed", failed,
+			"total", len(inputs)), nil
+	}
+	return results, nil, nil
+}
+
+// checkpoint persists the results of the runs of a fan-out.
+type checkpoint struct {
+	mu      sync.Mutex
+	file    string
+	sink    ResultSink
+	release func() // releases the lock of the file
+	results map[string]*CmdResult
+	err     error // first error writing the checkpoint
+}
+
+// openCheckpoint locks and returns the checkpoint of the given command and
+// input, with the results of the previous runs if resume is true.
+func (a *App) openCheckpoint(cmd *cobra.Command, in interface{}, resume bool) (*checkpoint, error) {
+	e := errors.Template("checkpoint", errors.K.IO, "command", cmd.CommandPath())
+	file, err := a.stateFile("checkpoint", cmd, "-"+inputHash(cmd, in)+".jsonl")
+	if err != nil {
+		return nil, e(err)
+	}
+	release, err := holdLock(file)
+	if err != nil {
+		return nil, e(err, "reason", "checkpoint in use", "file", file)
+	}
+	cp := &checkpoint{
+		file:    file,
+		sink:    ResultFileSink(file, false),
+		release: release,
+		results: make(map[string]*CmdResult),
+	}
+	if !resume {
+		err = os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			release()
+			return nil, e(err, "file", file)
+		}
+		return cp, nil
+	}
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		release()
+		return nil, e(err, "file", file)
+	}
+	defer func() { _ = f.Close() }()
+	// later results of a key override earlier ones
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		r := &CmdResult{}
+		if err = dec.Decode(r); err != nil {
+			release()
+			return nil, e(errors.K.Invalid, err, "file", file)
+		}
+		cp.results[r.Key] = r
+	}
+	return cp, nil
+}
+
+// inputHash returns a hash of the JSON encoding of the given input of the
+// command - or of its command line if the input can't be encoded - such that
+// runs with other inputs don't share their checkpoint.
+func inputHash(cmd *cobra.Command, in interface{}) string {
+	bb, err := json.Marshal(in)
+	if err != nil {
+		bb = []byte(bflags.CmdLine(cmd))
+	}
+	sum := sha256.Sum256(bb)
+	return hex.EncodeToString(sum[:8])
+}
+
+// succeeded returns the result of the given key if it succeeded in a previous
+// run.
+func (cp *checkpoint) succeeded(key string) *CmdResult {
+	if cp == nil {
+		return nil
+	}
+	if r, ok := cp.results[key]; ok && r.Error == "" {
+		return r
+	}
+	return nil
+}
+
+// add appends the given result to the checkpoint.
+func (cp *checkpoint) add(r *CmdResult) {
+	if cp == nil {
+		return
+	}
+	err := cp.sink(r)
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if err != nil && cp.err == nil {
+		cp.err = err
+	}
+}
+
+// close removes the checkpoint if done, releases its lock and returns the
+// first error writing it.
+func (cp *checkpoint) close(done bool) error {
+	if cp == nil {
+		return nil
+	}
+	defer cp.release()
+	err := cp.err
+	if err == nil && done {
+		if err = os.Remove(cp.file); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return errors.E("checkpoint", errors.K.IO, err, "file", cp.file)
+	}
+	return nil
+}
@@ -17,6 +17,12 @@ type CmdFlag interface {
 	Arg() bool
 }
 
+// CmdFlagChoices is implemented by the CmdFlag values passed to a
+// FlagsValidator: Choices returns the choices of the flag or arg, if any.
+type CmdFlagChoices interface {
+	Choices() []string
+}
+
 type FlagsValidator interface {
 	Validate(t reflect.Type, flags []CmdFlag) error
 }
@@ -60,17 +66,21 @@ type cmdFlag struct {
 	cmdPath  string
 	flagName string
 	isArg    bool
+	choices  []string
 }
 
+var _ CmdFlagChoices = (*cmdFlag)(nil)
+
 func (c *cmdFlag) MarshalJSON() ([]byte, error) {
 	type cf struct {
-		Type     string `json:"type"`
-		CmdPath  string `json:"cmd_path"`
-		FlagName string `json:"flag_name"`
-		Arg      bool   `json:"arg"`
+		Type     string   `json:"type"`
+		CmdPath  string   `json:"cmd_path"`
+		FlagName string   `json:"flag_name"`
+		Arg      bool     `json:"arg"`
+		Choices  []string `json:"choices,omitempty"`
 	}
 	t := reflect.TypeOf(c.value)
-	f := &cf{Type: t.String(), CmdPath: c.cmdPath, FlagName: c.flagName, Arg: c.isArg}
+	f := &cf{Type: t.String(), CmdPath: c.cmdPath, FlagName: c.flagName, Arg: c.isArg, Choices: c.choices}
 	return json.Marshal(f)
 }
 
@@ -90,6 +100,10 @@ func (c *cmdFlag) Arg() bool {
 	return c.isArg
 }
 
+func (c *cmdFlag) Choices() []string {
+	return c.choices
+}
+
 type flagDictionary struct {
 	validator FlagsValidator
 	withArgs  bool
@@ -99,7 +113,7 @@ type flagDictionary struct {
 func (f *flagDictionary) String() string {
 	bb, err := json.MarshalIndent(f.flags, "", "  ")
 	if err != nil {
-		panic(err)
+		return "error marshaling flags dictionary: " + err.Error()
 	}
 	return string(bb)
 }
@@ -134,7 +148,8 @@ func (f *flagDictionary) inspectFlag(name string, flag *bflags.FlagBond, cmdPath
 		value:    flag.Value,
 		cmdPath:  cmdPath,
 		flagName: name,
-		isArg:    arg})
+		isArg:    arg,
+		choices:  flag.Choices})
 	f.flags[tn] = flags
 }
 
@@ -7,30 +7,35 @@ import (
 )
 
 // rootUsageTemplate is the template used for the root command.
-// It adds categories to the default cobra usage template.
-var rootUsageTemplate = `Usage:{{if .Runnable}}
+// It adds categories to the default cobra usage template. Help topics are
+// listed in a last category, or apart if the spec declares no categories.
+// Headings are in bold when the help is colored - see App.WithColor.
+var rootUsageTemplate = `{{heading . "Usage:"}}{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
-  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+  {{.CommandPath}} [command]{{end}}{{if aliases .}}
 
-Aliases:
-  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+{{heading . "Aliases:"}}
+  {{aliases .}}{{end}}{{if .HasExample}}
 
-Examples:
-{{.Example}}{{end}}{{if .HasAvailableSubCommands}}
+{{heading . "Examples:"}}
+{{example .}}{{end}}{{if .HasAvailableSubCommands}}
 
 These are commands grouped by area{{range categories .}}{{if gt (len .Cmds) 0}}
 
 {{.Title}}{{range .Cmds}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
 
-Flags:
-{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+{{heading . "Flags:"}}
+{{flagUsages . .LocalFlags | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
 
-Global Flags:
-{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+{{heading . "Global Flags:"}}
+{{flagUsages . .InheritedFlags | trimTrailingWhitespaces}}{{end}}{{if and .HasHelpSubCommands (not (and .HasAvailableSubCommands (categories .)))}}
 
-Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
-  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+{{heading . "Help topics:"}}{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{with seeAlso .}}
+
+{{heading . "See also:"}}
+{{.}}{{end}}{{if .HasAvailableSubCommands}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
@@ -49,7 +54,12 @@ func configureHelp(cmdRoot *cobra.Command) *cobra.Command {
 	// use defH := cmdRoot.UsageTemplate() to get the default from cobra
 	for _, c := range cmdRoot.Commands() {
 		bflags.ConfigureCommandHelp(c)
+		if c.Annotations[topicKey] == "true" {
+			// restore the help function of topics
+			configureTopic(c)
+		}
 	}
 	cmdRoot.SetUsageTemplate(rootUsageTemplate)
+	bflags.ConfigureRootHelp(cmdRoot)
 	return cmdRoot
 }
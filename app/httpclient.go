@@ -0,0 +1,262 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	httpTimeoutFlag   = "http-timeout"
+	httpRetriesFlag   = "http-retries"
+	httpProxyFlag     = "http-proxy"
+	tlsSkipVerifyFlag = "tls-skip-verify"
+	caBundleFlag      = "ca-bundle"
+	userAgentFlag     = "user-agent"
+	traceHTTPFlag     = "trace-http"
+)
+
+// HTTPOptions are the options of the HTTP client of commands - see
+// App.WithHTTPOptions and CmdCtx.HTTPClient.
+type HTTPOptions struct {
+	Timeout       time.Duration // timeout of requests, including reading the response body - none if zero
+	Retries       int           // retries of idempotent requests failing with a network error or a 429, 502, 503 or 504 status
+	Proxy         string        // URL of the proxy - from HTTPS_PROXY, HTTP_PROXY and NO_PROXY if empty
+	TLSSkipVerify bool          // skip the verification of the TLS certificates of servers
+	CABundle      string        // path of a PEM file with CA certificates trusted in addition to the system ones
+	UserAgent     string        // user agent of requests
+	Trace         bool          // trace requests and responses - see HTTPTrace
+	Tracer        HTTPTracer    // notified of traced requests - logged if nil
+}
+
+// WithHTTPOptions sets the options of the HTTP client returned by
+// CmdCtx.HTTPClient. A client set with WithDeps takes precedence.
+func (a *App) WithHTTPOptions(o *HTTPOptions) *App {
+	a.httpOpts = o
+	return a
+}
+
+// WithHTTPFlags adds persistent flags to the root command overriding the
+// options of the HTTP client returned by CmdCtx.HTTPClient if b is true:
+//
+//	--http-timeout, --http-retries, --http-proxy, --tls-skip-verify,
+//	--ca-bundle, --user-agent and --trace-http
+//
+// The defaults of the flags are the options set with WithHTTPOptions.
+func (a *App) WithHTTPFlags(b bool) *App {
+	a.httpFlags = b
+	return a
+}
+
+// addHTTPFlags adds the persistent HTTP flags to the root command if enabled.
+// The flags are bound to a copy of the HTTP options of the app.
+func (a *App) addHTTPFlags() error {
+	if !a.httpFlags {
+		return nil
+	}
+	fs := a.root.PersistentFlags()
+	for _, name := range []string{httpTimeoutFlag, httpRetriesFlag, httpProxyFlag, tlsSkipVerifyFlag, caBundleFlag, userAgentFlag, traceHTTPFlag} {
+		if fs.Lookup(name) != nil {
+			return errors.E("addHTTPFlags", errors.K.Invalid, ErrInvalidSpec, bflags.ErrDuplicateFlag, "flag", name)
+		}
+	}
+	o := &HTTPOptions{}
+	if a.httpOpts != nil {
+		*o = *a.httpOpts
+	}
+	a.httpOpts = o
+	fs.DurationVar(&o.Timeout, httpTimeoutFlag, o.Timeout, "timeout of HTTP requests, e.g. 30s - none if 0")
+	fs.IntVar(&o.Retries, httpRetriesFlag, o.Retries, "retries of failed idempotent HTTP requests")
+	fs.StringVar(&o.Proxy, httpProxyFlag, o.Proxy, "URL of the HTTP proxy - from HTTPS_PROXY or HTTP_PROXY if not set")
+	fs.BoolVar(&o.TLSSkipVerify, tlsSkipVerifyFlag, o.TLSSkipVerify, "skip the verification of TLS certificates - insecure")
+	fs.StringVar(&o.CABundle, caBundleFlag, o.CABundle, "path of a PEM file with additional trusted CA certificates")
+	fs.StringVar(&o.UserAgent, userAgentFlag, o.UserAgent, "user agent of HTTP requests")
+	fs.BoolVar(&o.Trace, traceHTTPFlag, o.Trace, "log HTTP requests and responses - method, URL, status, duration and correlation ID")
+	return nil
+}
+
+// setHTTPClient sets the HTTP client built from the HTTP options of the app to
+// the given context, unless neither HTTP options nor a command tracer are
+// enabled or the context has a client already - see WithDeps. The default user
+// agent is the name of the root command followed by its version.
+func (a *App) setHTTPClient(ctx *CmdCtx) error {
+	if a.httpOpts == nil && a.cmdTracer == nil {
+		return nil
+	}
+	if _, ok := ctx.Get(CtxHTTPClient); ok {
+		return nil
+	}
+	o := HTTPOptions{}
+	if a.httpOpts != nil {
+		o = *a.httpOpts
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = a.spec.CmdRoot.Name()
+		if v := a.spec.CmdRoot.Version; v != "" {
+			o.UserAgent += "/" + v
+		}
+	}
+	cl, err := newHTTPClient(&o, a.injectTraceContext(ctx))
+	if err != nil {
+		return err
+	}
+	ctx.Set(CtxHTTPClient, cl)
+	return nil
+}
+
+// NewHTTPClient returns a new HTTP client configured with the given options.
+func NewHTTPClient(o *HTTPOptions) (*http.Client, error) {
+	return newHTTPClient(o, nil)
+}
+
+// newHTTPClient returns a new HTTP client configured with the given options
+// and injecting the trace context into requests with the given function if not
+// nil.
+func newHTTPClient(o *HTTPOptions, inject func(req *http.Request)) (*http.Client, error) {
+	e := errors.Template("NewHTTPClient", errors.K.Invalid)
+	if o == nil {
+		o = &HTTPOptions{}
+	}
+	var tracer HTTPTracer
+	if o.Trace {
+		tracer = o.Tracer
+		if tracer == nil {
+			tracer = logHTTPTrace
+		}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, e(err, "proxy", o.Proxy)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	if o.TLSSkipVerify || o.CABundle != "" {
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: o.TLSSkipVerify}
+	}
+	if o.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bb, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, e(errors.K.IO, err, "ca_bundle", o.CABundle)
+		}
+		if !pool.AppendCertsFromPEM(bb) {
+			return nil, e("reason", "no certificate found", "ca_bundle", o.CABundle)
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	return &http.Client{
+		Timeout: o.Timeout,
+		Transport: &clientTransport{
+			next:      tr,
+			retries:   o.Retries,
+			userAgent: o.UserAgent,
+			trace:     tracer,
+			inject:    inject,
+		},
+	}, nil
+}
+
+// clientTransport sets the user agent of requests, retries failed requests
+// and traces them.
+type clientTransport struct {
+	next      http.RoundTripper
+	retries   int
+	userAgent string
+	trace     HTTPTracer
+	inject    func(req *http.Request) // injects the trace context of the command
+}
+
+// retryBackoff is the delay before the first retry of a request, doubled at
+// each retry.
+var retryBackoff = 200 * time.Millisecond
+
+const maxRetryDelay = 10 * time.Second
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	setUserAgent := t.userAgent != "" && req.Header.Get("User-Agent") == ""
+	setRequestId := t.trace != nil && correlationId(req.Header) == ""
+	if setUserAgent || setRequestId || t.inject != nil {
+		req = req.Clone(req.Context())
+		if setUserAgent {
+			req.Header.Set("User-Agent", t.userAgent)
+		}
+		if setRequestId {
+			req.Header.Set(requestIdHeader, newId())
+		}
+		if t.inject != nil {
+			t.inject(req)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := t.next.RoundTrip(req)
+		if t.trace != nil {
+			t.trace(newHTTPTrace(req, resp, err, time.Since(start), attempt))
+		}
+		if attempt >= t.retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		delay := retryBackoff << attempt
+		if resp != nil {
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+				delay = time.Duration(s) * time.Second
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			_ = resp.Body.Close()
+		}
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			// retryable requests with a body have GetBody set
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryable returns true if the given request may be retried after the given
+// response or error.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+	default:
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eluv-io/log-go"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// correlationHeaders are the headers of requests and responses holding their
+// correlation ID, in order of precedence.
+var correlationHeaders = []string{requestIdHeader, "X-Correlation-Id"}
+
+// HTTPTrace is a request and its response traced by the HTTP client of
+// commands with the --trace-http flag - see HTTPOptions. Secrets are removed
+// from the URL: the user info and the values of query parameters with secret
+// names (see bflags.IsSecretName).
+type HTTPTrace struct {
+	Method        string        // method of the request
+	URL           string        // sanitized URL of the request
+	Status        int           // status code of the response - 0 if the request failed
+	Duration      time.Duration // duration of the request until the response headers were received
+	CorrelationID string        // ID of the request - set as X-Request-Id if the request has none
+	Attempt       int           // attempt of the request - 0 for the first one, see HTTPOptions.Retries
+	Err           error         // error of the request
+}
+
+// HTTPTracer is notified of the requests traced by the HTTP client of commands.
+type HTTPTracer func(t *HTTPTrace)
+
+// newHTTPTrace returns the trace of the given request and response or error.
+func newHTTPTrace(req *http.Request, resp *http.Response, err error, d time.Duration, attempt int) *HTTPTrace {
+	t := &HTTPTrace{
+		Method:        req.Method,
+		URL:           sanitizeURL(req.URL),
+		Duration:      d,
+		CorrelationID: correlationId(req.Header),
+		Attempt:       attempt,
+		Err:           err,
+	}
+	if resp != nil {
+		t.Status = resp.StatusCode
+		if t.CorrelationID == "" {
+			t.CorrelationID = correlationId(resp.Header)
+		}
+	}
+	return t
+}
+
+// logHTTPTrace is the default HTTPTracer: it logs the trace at info level.
+func logHTTPTrace(t *HTTPTrace) {
+	fields := []interface{}{"method", t.Method, "url", t.URL, "duration", t.Duration, "correlation_id", t.CorrelationID}
+	if t.Attempt > 0 {
+		fields = append(fields, "attempt", t.Attempt)
+	}
+	if t.Err != nil {
+		log.Warn("http request failed", append(fields, "error", t.Err)...)
+		return
+	}
+	log.Info("http request", append(fields, "status", t.Status)...)
+}
+
+// correlationId returns the correlation ID found in the given headers.
+func correlationId(h http.Header) string {
+	for _, name := range correlationHeaders {
+		if id := h.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// newId returns a new random ID.
+func newId() string {
+	bb := make([]byte, 8)
+	_, _ = rand.Read(bb)
+	return hex.EncodeToString(bb)
+}
+
+// sanitizeURL returns the given URL with its user info and the values of query
+// parameters with secret names redacted.
+func sanitizeURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	ret := *u
+	ret.User = nil
+	if ret.RawQuery != "" {
+		params := strings.Split(ret.RawQuery, "&")
+		for i, p := range params {
+			name, _, _ := strings.Cut(p, "=")
+			if n, err := url.QueryUnescape(name); err == nil && bflags.IsSecretName(n) {
+				params[i] = name + "=" + bflags.RedactedValue
+			}
+		}
+		ret.RawQuery = strings.Join(params, "&")
+	}
+	if u.User != nil {
+		// url.User would escape the redacted value
+		return strings.Replace(ret.String(), "//", "//"+bflags.RedactedValue+"@", 1)
+	}
+	return ret.String()
+}
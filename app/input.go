@@ -0,0 +1,191 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/eluv-io/ecobra-go/params"
+)
+
+// RegisterInput registers the input type T under the given name in the
+// runtime: the constructor returns a new *T and default values of the input in
+// the spec are decoded to *T. In addition to a json object, default values may
+// be given as a string holding the json of the input.
+//
+//	app.RegisterInput[InputSample](rt, "sample")
+func RegisterInput[T any](rt *Runtime, name string) {
+	if rt.inputs == nil {
+		rt.inputs = make(map[string]Ctor)
+	}
+	rt.inputs[name] = func() interface{} { return new(T) }
+	rt.decodeHooks = append(rt.decodeHooks, jsonStringHook(reflect.TypeOf((*T)(nil)).Elem()))
+}
+
+// WithDecodeHooks appends the given hooks to the hooks decoding default values
+// of inputs found in the spec. The hooks are called after the standard hooks
+// returned by DefaultDecodeHooks.
+func (rt *Runtime) WithDecodeHooks(hooks ...mapstructure.DecodeHookFunc) *Runtime {
+	rt.decodeHooks = append(rt.decodeHooks, hooks...)
+	return rt
+}
+
+// decodeHook returns the hook used to decode default values of inputs.
+func (rt *Runtime) decodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(append(DefaultDecodeHooks(), rt.decodeHooks...)...)
+}
+
+// DefaultDecodeHooks returns the standard hooks decoding default values of
+// inputs found in the spec:
+//   - strings to time.Duration, net.IP and net.IPNet
+//   - json values other than strings to params.Json
+//   - strings to params.Bytes
+//   - numbers to integer types, rejecting fractions and overflows
+//   - strings to types implementing encoding.TextUnmarshaler
+func DefaultDecodeHooks() []mapstructure.DecodeHookFunc {
+	return []mapstructure.DecodeHookFunc{
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToIPHookFunc(),
+		mapstructure.StringToIPNetHookFunc(),
+		jsonValueHook,
+		bytesHook,
+		numberHook,
+		mapstructure.TextUnmarshallerHookFunc(),
+	}
+}
+
+var (
+	jsonType  = reflect.TypeOf(params.Json(""))
+	bytesType = reflect.TypeOf(params.Bytes(nil))
+)
+
+// jsonValueHook marshals json values other than strings to params.Json.
+func jsonValueHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != jsonType || from.Kind() == reflect.String {
+		return data, nil
+	}
+	bb, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.E("decode json", errors.K.Invalid, err)
+	}
+	return params.Json(bb), nil
+}
+
+// bytesHook converts strings to params.Bytes.
+func bytesHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != bytesType || from.Kind() != reflect.String {
+		return data, nil
+	}
+	return params.Bytes(data.(string)), nil
+}
+
+// numberHook converts json numbers and floats to integer types. Numbers with a
+// fraction or overflowing the integer type are rejected.
+func numberHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	var f float64
+	switch n := data.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			f = float64(i)
+			if isInt(to) && !reflect.Zero(to).OverflowInt(i) {
+				return reflect.ValueOf(i).Convert(to).Interface(), nil
+			}
+		} else if f, err = n.Float64(); err != nil {
+			return nil, errors.E("decode number", errors.K.Invalid, err, "number", n.String())
+		}
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	default:
+		return data, nil
+	}
+	switch {
+	case isInt(to):
+		if f != math.Trunc(f) || reflect.Zero(to).OverflowInt(int64(f)) ||
+			f > math.MaxInt64 || f < math.MinInt64 {
+			return nil, errors.E("decode number", errors.K.Invalid,
+				"reason", "not a valid integer", "number", f, "type", to.String())
+		}
+		return reflect.ValueOf(int64(f)).Convert(to).Interface(), nil
+	case isUint(to):
+		if f != math.Trunc(f) || f < 0 || f > math.MaxUint64 || reflect.Zero(to).OverflowUint(uint64(f)) {
+			return nil, errors.E("decode number", errors.K.Invalid,
+				"reason", "not a valid unsigned integer", "number", f, "type", to.String())
+		}
+		return reflect.ValueOf(uint64(f)).Convert(to).Interface(), nil
+	}
+	return data, nil
+}
+
+func isInt(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// jsonStringHook returns a decode hook unmarshaling json strings to values of
+// the given type.
+func jsonStringHook(typ reflect.Type) mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to != typ {
+			return data, nil
+		}
+		ret := reflect.New(typ)
+		err := json.Unmarshal([]byte(data.(string)), ret.Interface())
+		if err != nil {
+			return nil, errors.E("decode input", errors.K.Invalid, err, "type", typ.String())
+		}
+		return ret.Elem().Interface(), nil
+	}
+}
+
+// validateInputs returns an error if input constructors referenced by the
+// given command or its sub-commands are not registered in the runtime or if
+// default values of inputs have keys that don't match any field of the input.
+// The error reports the paths of the offending commands. Default values that
+// cannot be decoded are reported when the cobra command is created.
+func validateInputs(c *Cmd) error {
+	var missing, paths []string
+	var errs error
+	var walk func(c *Cmd, path string)
+	walk = func(c *Cmd, path string) {
+		path = strings.TrimSpace(path + " " + c.Name())
+		if c.InputCtor != "" {
+			if _, ok := c.app.rt.inputs[c.InputCtor]; !ok {
+				missing = append(missing, c.InputCtor)
+				paths = append(paths, path)
+			} else if _, unused, err := c.decodeInputKeys(); err == nil && len(unused) > 0 {
+				errs = errors.Append(errs, errors.E("validateInputs", errors.K.Invalid, ErrInvalidSpec,
+					"reason", "unknown input keys",
+					"command", path,
+					"keys", strings.Join(unused, ", ")))
+			}
+		}
+		for _, sub := range c.SubCommands {
+			walk(sub, path)
+		}
+	}
+	walk(c, "")
+	if len(missing) > 0 {
+		return errors.E("validateInputs", errors.K.NotExist, ErrFunctionNotFound,
+			"reason", "input constructor not registered",
+			"input_ctors", strings.Join(missing, ", "),
+			"commands", strings.Join(paths, ", "))
+	}
+	return errs
+}
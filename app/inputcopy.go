@@ -0,0 +1,59 @@
+package app
+
+import (
+	"reflect"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const copyInputKey = "copy-input" // key of the input constructor in the command state
+
+// WithInputCopy makes all commands of the app run with a deep copy of their
+// bound input if b is true - see Cmd.CopyInput.
+func (a *App) WithInputCopy(b bool) *App {
+	a.copyInput = b
+	return a
+}
+
+// inputCtor returns the constructor of the input of the command: the
+// constructor registered in the runtime, the function of the Input or nil if
+// the Input is an object.
+func (c *Cmd) inputCtor() Ctor {
+	if c.InputCtor != "" {
+		return c.app.rt.inputs[c.InputCtor]
+	}
+	if reflect.ValueOf(c.Input).Kind() == reflect.Func {
+		return func() interface{} {
+			in, _ := inputCtor(c.Input)
+			return in
+		}
+	}
+	return nil
+}
+
+// setCopyInput records that the given command runs with a copy of its input,
+// made with the given constructor if not nil.
+func setCopyInput(cmd *cobra.Command, copyInput bool, ctor Ctor) {
+	if !copyInput {
+		return
+	}
+	bflags.AddToCmdCtx(cmd, copyInputKey, ctor)
+}
+
+// copyInput returns a deep copy of the input bound to the given command if the
+// command runs with a copy of its input, or the input itself otherwise. The
+// copy is made with the constructor of the input when available, such that
+// unexported fields are initialized like for a new input.
+func copyInput(cmd *cobra.Command, in interface{}) (interface{}, error) {
+	v, ok := bflags.GetFromCmdCtx(cmd, copyInputKey)
+	if !ok || in == nil {
+		return in, nil
+	}
+	var dst interface{}
+	if ctor, _ := v.(Ctor); ctor != nil {
+		dst = ctor()
+	}
+	return bflags.CopyInput(dst, in)
+}
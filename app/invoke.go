@@ -0,0 +1,158 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// Invoke runs the run function of the command at the given path - starting
+// with the name of the root command as in Command - with the given input and
+// returns the output of the function. Unlike Execute, no command line is
+// parsed: servers and tests can call the logic of commands directly.
+//
+// The input must have the type of the input bound to the command - usually a
+// pointer to a struct - or be nil for commands without input. The context may
+// be nil. Commands are invoked through the same steps as commands run by
+// Execute:
+//   - the deprecation of the command is checked
+//   - the deps, HTTP client, directories, active profile, credentials,
+//     providers and result functions of the app are set to the context
+//   - the authorizer of the app is checked
+//   - the lifecycle functions of the input (Normalize, Complete and Validate)
+//     are called
+//   - the rate limit of the command is checked
+//   - the start and end lifecycle events are sent - see WithLifecycle - without
+//     flags and args
+//
+// The following steps of Execute only apply to command lines and are skipped:
+//   - the values of the config, the active profile and the credential store
+//     are not applied to the input: all its fields are considered as set by
+//     the caller
+//   - the flags checker, the CommandStart and CommandEnd functions of the app
+//     are not called and no span is started - see WithCmdTracer
+//   - fan-out and watch don't apply: the run function is called once, with
+//     the given input
+//   - the output is returned rather than printed
+//
+// Errors wrap ErrCommandNotFound if no command exists at the given path,
+// ErrCommandRemoved if the command was removed - see Deprecation - and
+// bflags.ErrInvalidInput if the input does not have the expected type.
+func (a *App) Invoke(ctx *CmdCtx, path []string, input interface{}) (interface{}, error) {
+	e := errors.Template("Invoke", errors.K.Invalid, "path", strings.Join(path, " "))
+	spec, err := a.Command(path...)
+	if err != nil {
+		return nil, e(err)
+	}
+	cmd, err := a.cobraCommand(path)
+	if err == nil {
+		err = checkDeprecation(cmd)
+	}
+	if err != nil {
+		return nil, e(err)
+	}
+	name, fn, err := spec.runFunction(spec.RunE)
+	if err == nil && fn == nil {
+		err = errors.E("runFunction", errors.K.NotExist, ErrCommandNotFound, "reason", "command not runnable")
+	}
+	if err == nil {
+		err = isRunFn(name, fn)
+	}
+	if err != nil {
+		return nil, e(err)
+	}
+	f := reflect.ValueOf(fn)
+	bound, _ := bflags.GetCmdInput(cmd)
+	if err = checkInputType(f.Type(), bound, input); err != nil {
+		return nil, e(err)
+	}
+
+	if ctx == nil {
+		ctx = NewCmdCtx()
+	}
+	ctx.Set(CtxCmd, cmd)
+	setInvocationID(ctx)
+	if err = a.setupDeps(cmd, ctx); err != nil {
+		return nil, e(err)
+	}
+	if a.authorizer != nil {
+		ctx.Set(CtxRoles, RequiredRoles(cmd))
+		if err = a.authorizer(ctx, cmd.CommandPath(), input); err != nil {
+			return nil, e(errors.K.Permission, err, "reason", "not authorized")
+		}
+	}
+	if input != nil {
+		if err = a.setupInput(ctx, input); err != nil {
+			return nil, e(err, "reason", "invalid input")
+		}
+	}
+	if err = a.checkRateLimit(cmd); err != nil {
+		return nil, e(errors.K.Unavailable, err)
+	}
+
+	ev := a.startEvent(ctx, cmd, input, false)
+	out, err, invalid := a.callRunFn(name, f, ctx, input)
+	if invalid != nil {
+		err = invalid
+	}
+	a.endEvent(ev, out, err)
+	if err != nil {
+		return nil, e(err)
+	}
+	ctx.Set(CtxResult, out)
+	return out, nil
+}
+
+// cobraCommand returns the cobra command at the given path, starting with the
+// name of the root command.
+func (a *App) cobraCommand(path []string) (*cobra.Command, error) {
+	root, err := a.Cobra()
+	if err != nil {
+		return nil, err
+	}
+	args := path[1:]
+	if !a.matching.IsZero() {
+		if args, err = a.matching.Resolve(root, args); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) == 0 {
+		return root, nil
+	}
+	cmd, rest, err := root.Find(args)
+	if err != nil || len(rest) > 0 {
+		return nil, errors.E("cobraCommand", errors.K.NotExist, ErrCommandNotFound, "path", strings.Join(path, " "))
+	}
+	return cmd, nil
+}
+
+// checkInputType returns an error if the given input does not have the type of
+// the input bound to the command or is not accepted by the run function.
+func checkInputType(fnType reflect.Type, bound, input interface{}) error {
+	e := errors.Template("checkInputType", errors.K.Invalid, bflags.ErrInvalidInput)
+	if fnType.NumIn() < 2 {
+		if input != nil {
+			return e("reason", "command takes no input", "input_type", reflect.TypeOf(input).String())
+		}
+		return nil
+	}
+	if input == nil {
+		return e("reason", "nil input", "expected_type", fnType.In(1).String())
+	}
+	typ := reflect.TypeOf(input)
+	if bound != nil && typ != reflect.TypeOf(bound) {
+		return e("reason", "input type mismatch",
+			"expected_type", reflect.TypeOf(bound).String(),
+			"input_type", typ.String())
+	}
+	if !typ.AssignableTo(fnType.In(1)) {
+		return e("reason", "input type mismatch",
+			"expected_type", fnType.In(1).String(),
+			"input_type", typ.String())
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// EventType is the type of a CommandEvent.
+type EventType string
+
+const (
+	// EventStart is the event sent immediately before a command runs.
+	EventStart EventType = "start"
+	// EventEnd is the event sent after a command ran.
+	EventEnd EventType = "end"
+)
+
+// CommandEvent is a lifecycle event of a command invocation, sent to the
+// function set with App.WithLifecycle. The start and end events of an
+// invocation share the same invocation ID, start time and input, such that
+// observability hooks don't have to compute or correlate them.
+type CommandEvent struct {
+	Type         EventType         // EventStart or EventEnd
+	InvocationID string            // unique ID of the invocation - see CmdCtx.InvocationID
+	Command      *cobra.Command    // the command
+	Path         string            // path of the command
+	FlagsAndArgs map[string]string // flags and args set on the command line - see bflags.GetFlagArgSet - nil for Invoke
+	Input        interface{}       // typed input of the command
+	Output       interface{}       // output of the command - end events only
+	Err          error             // error of the command - end events only
+	Start        time.Time         // start of the run
+	End          time.Time         // end of the run - end events only
+	Duration     time.Duration     // duration of the run - end events only
+}
+
+// Lifecycle receives the lifecycle events of commands.
+type Lifecycle func(ev *CommandEvent)
+
+// WithLifecycle sets the function receiving the start and end events of each
+// command invocation - including invocations with Invoke and scheduled runs,
+// see RunScheduled. It is called after the CommandStart function and before
+// the CommandEnd function, if set.
+func (a *App) WithLifecycle(fn Lifecycle) *App {
+	a.lifecycle = fn
+	return a
+}
+
+// InvocationID returns the unique ID of the invocation of the command.
+func (c *CmdCtx) InvocationID() string {
+	if v, ok := c.Get(CtxInvocationID); ok {
+		if id, ok := v.(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// setInvocationID sets a new invocation ID to the context, unless it has one
+// already.
+func setInvocationID(ctx *CmdCtx) string {
+	if id := ctx.InvocationID(); id != "" {
+		return id
+	}
+	id := newId()
+	ctx.Set(CtxInvocationID, id)
+	return id
+}
+
+// startEvent returns the start event of the invocation of the command with the
+// given context and input and sends it to the lifecycle function, if set. The
+// flags and args of the command are reported if it was run from a command
+// line.
+func (a *App) startEvent(ctx *CmdCtx, cmd *cobra.Command, in interface{}, cmdLine bool) *CommandEvent {
+	ev := &CommandEvent{
+		Type:         EventStart,
+		InvocationID: setInvocationID(ctx),
+		Command:      cmd,
+		Path:         cmd.CommandPath(),
+		Input:        in,
+		Start:        time.Now(),
+	}
+	if a.lifecycle != nil {
+		if cmdLine {
+			ev.FlagsAndArgs = bflags.GetFlagArgSet(cmd)
+		}
+		a.lifecycle(ev)
+	}
+	return ev
+}
+
+// endEvent sends the end event of the invocation started with the given event
+// to the lifecycle function, if set.
+func (a *App) endEvent(start *CommandEvent, out interface{}, err error) {
+	if a.lifecycle == nil {
+		return
+	}
+	ev := *start
+	ev.Type = EventEnd
+	ev.Output = out
+	ev.Err = err
+	ev.End = time.Now()
+	ev.Duration = ev.End.Sub(ev.Start)
+	a.lifecycle(&ev)
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// CommandMatching defines how Execute matches command line arguments with the
+// names and aliases of commands, in addition to the exact match of cobra.
+type CommandMatching struct {
+	// Prefix accepts unambiguous prefixes of names and aliases, e.g.
+	//
+	//	myapp cont li  =>  myapp content list
+	Prefix bool
+	// CaseInsensitive ignores the case of names and aliases, e.g.
+	//
+	//	myapp content getmeta  =>  myapp content getMeta
+	CaseInsensitive bool
+}
+
+// IsZero returns true if no matching option is enabled.
+func (m CommandMatching) IsZero() bool {
+	return !m.Prefix && !m.CaseInsensitive
+}
+
+// WithPrefixMatching enables the resolution of unambiguous prefixes of command
+// names and aliases by Execute, e.g.
+//
+//	myapp cont li  =>  myapp content list
+//
+// A prefix matching several commands is rejected with an error listing the
+// candidates.
+func (a *App) WithPrefixMatching(b bool) *App {
+	a.matching.Prefix = b
+	return a
+}
+
+// WithCaseInsensitive enables case-insensitive matching of command names and
+// aliases by Execute and Command.
+func (a *App) WithCaseInsensitive(b bool) *App {
+	a.matching.CaseInsensitive = b
+	return a
+}
+
+// SetArgs sets the arguments used by Execute instead of os.Args[1:].
+func (a *App) SetArgs(args []string) {
+	a.args = args
+}
+
+// ResolvePrefixes returns the given command line arguments with prefixes of
+// command names and aliases replaced by the full name of the command they
+// match. See CommandMatching.Resolve.
+func ResolvePrefixes(root *cobra.Command, args []string) ([]string, error) {
+	return CommandMatching{Prefix: true}.Resolve(root, args)
+}
+
+// Resolve returns the given command line arguments with arguments matching a
+// command replaced by the name of the command. Resolution stops at the first
+// argument that is not a command. Flags and their values are left untouched.
+// Arguments of the help command are resolved from the root command.
+//
+// An error wrapping ErrAmbiguousCommand is returned if an argument matches more
+// than one command.
+func (m CommandMatching) Resolve(root *cobra.Command, args []string) ([]string, error) {
+	ret := make([]string, len(args))
+	copy(ret, args)
+	if len(ret) > 0 &&
+		(ret[0] == cobra.ShellCompRequestCmd || ret[0] == cobra.ShellCompNoDescRequestCmd) {
+		return ret, nil
+	}
+	// the help command is added by cobra when executing: add it now to resolve
+	// its arguments
+	root.InitDefaultHelpCmd()
+
+	cmd := root
+	for i := 0; i < len(ret); i++ {
+		arg := ret[i]
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-") {
+			if flagNeedsValue(cmd, arg) {
+				i++
+			}
+			continue
+		}
+		next, candidates := m.match(cmd, arg)
+		if len(candidates) > 1 {
+			return nil, errors.E("Resolve", errors.K.Invalid, ErrAmbiguousCommand,
+				"command", cmd.CommandPath(),
+				"arg", arg,
+				"candidates", strings.Join(candidates, ", "))
+		}
+		if next == nil {
+			break
+		}
+		ret[i] = next.Name()
+		if cmd == root && next.Name() == "help" {
+			// resolve the path of the command to show the help of
+			continue
+		}
+		cmd = next
+	}
+	return ret, nil
+}
+
+// match returns the sub-command of cmd whose name or alias is arg, or the
+// single command matching arg according to the options. If several commands
+// match, the returned command is nil and the sorted names of the matching
+// commands are returned. Hidden and deprecated commands only match with their
+// full name.
+func (m CommandMatching) match(cmd *cobra.Command, arg string) (*cobra.Command, []string) {
+	for _, c := range cmd.Commands() {
+		if c.Name() == arg || c.HasAlias(arg) {
+			return c, nil
+		}
+	}
+	var matches []*cobra.Command
+	for _, c := range cmd.Commands() {
+		if m.CaseInsensitive && hasNameOrAlias(c, arg, strings.EqualFold) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 && m.Prefix {
+		for _, c := range cmd.Commands() {
+			if c.Hidden || isDeprecated(c) {
+				continue
+			}
+			if hasNameOrAlias(c, arg, m.hasPrefix) {
+				matches = append(matches, c)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+	candidates := make([]string, 0, len(matches))
+	for _, c := range matches {
+		candidates = append(candidates, c.Name())
+	}
+	sort.Strings(candidates)
+	return nil, candidates
+}
+
+func (m CommandMatching) hasPrefix(s, prefix string) bool {
+	if m.CaseInsensitive {
+		return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+	}
+	return strings.HasPrefix(s, prefix)
+}
+
+// hasNameOrAlias returns true if the name or an alias of c matches arg with
+// the given function.
+func hasNameOrAlias(c *cobra.Command, arg string, matches func(s, arg string) bool) bool {
+	if matches(c.Name(), arg) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if matches(alias, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagNeedsValue returns true if the given flag argument of cmd is followed by
+// its value in the next argument.
+func flagNeedsValue(cmd *cobra.Command, arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	name := strings.TrimLeft(arg, "-")
+	fs := cmd.Flags()
+	f := fs.Lookup(name)
+	if f == nil && !strings.HasPrefix(arg, "--") && len(name) == 1 {
+		f = fs.ShorthandLookup(name)
+	}
+	if f == nil {
+		f = cmd.InheritedFlags().Lookup(name)
+	}
+	if f == nil && !strings.HasPrefix(arg, "--") && len(name) == 1 {
+		f = cmd.InheritedFlags().ShorthandLookup(name)
+	}
+	return f != nil && f.NoOptDefVal == ""
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// Mount grafts the command tree of the other app under the root command of
+// this app, such that sub-CLIs shipped as separate apps can be composed into a
+// single binary:
+//   - with a prefix, the root command of other becomes the sub-command 'prefix'
+//     of the root command, with its flags, input and sub-commands
+//   - with an empty prefix, the sub-commands of other are added to the root
+//     command and the root command of other is dropped
+//
+// Categories of other are merged into the categories of this app. They never
+// become the default category. The functions, input constructors, completions
+// and args validators registered in the runtime of other are merged into the
+// runtime of this app.
+//
+// Mount leaves the app unchanged and fails with an error wrapping
+// bflags.ErrDuplicateCommand if a mounted command has the name or an alias of
+// a sub-command of the root command, or wrapping ErrInvalidSpec if:
+//   - the cobra commands of this app were already built
+//   - a category with the same name but another title exists
+//   - a function name is registered in both runtimes - functions cannot be
+//     compared, unless both apps use the same runtime - or an input name with
+//     different input types
+//
+// Only the spec and the runtime of other are mounted: options set with the
+// WithXxx functions of other are ignored. Other must not be used after being
+// mounted.
+func (a *App) Mount(prefix string, other *App) error {
+	e := errors.Template("Mount", errors.K.Invalid, "prefix", prefix)
+	switch {
+	case other == nil || other == a:
+		return e(ErrInvalidSpec, "reason", "invalid app to mount")
+	case a.root != nil || other.root != nil:
+		return e(ErrInvalidSpec, "reason", "cobra commands already built")
+	case strings.ContainsAny(prefix, " \t\n"):
+		return e(ErrInvalidSpec, "reason", "invalid prefix")
+	}
+
+	mounted := other.spec.CmdRoot.SubCommands
+	if prefix != "" {
+		group := *other.spec.CmdRoot
+		group.Use = prefix + strings.TrimPrefix(group.Use, group.Name())
+		group.CompletionOptions = nil
+		mounted = []*Cmd{&group}
+	}
+	if err := a.checkMountedCmds(mounted); err != nil {
+		return e(err)
+	}
+	categories, err := mergeCategories(a.spec.Categories, other.spec.Categories)
+	if err != nil {
+		return e(err)
+	}
+	if err = a.rt.checkMerge(other.rt); err != nil {
+		return e(err)
+	}
+
+	a.rt.merge(other.rt)
+	a.spec.Categories = categories
+	a.spec.CmdRoot.SubCommands = append(a.spec.CmdRoot.SubCommands, mounted...)
+	a.spec.CmdRoot.setApp(a)
+	a.spec.clearString()
+	return nil
+}
+
+// checkMountedCmds returns an error if the name or an alias of a mounted
+// command is the name or an alias of a sub-command of the root command.
+func (a *App) checkMountedCmds(mounted []*Cmd) error {
+	names := make(map[string]string)
+	for _, c := range a.spec.CmdRoot.SubCommands {
+		for _, name := range cmdNames(c) {
+			names[name] = c.Name()
+		}
+	}
+	for _, c := range mounted {
+		for _, name := range cmdNames(c) {
+			if existing, ok := names[name]; ok {
+				return errors.E("checkMountedCmds", errors.K.Invalid, bflags.ErrDuplicateCommand,
+					"command", c.Name(),
+					"name", name,
+					"existing", existing)
+			}
+			names[name] = c.Name()
+		}
+	}
+	return nil
+}
+
+// cmdNames returns the name and the aliases of the command.
+func cmdNames(c *Cmd) []string {
+	ret := append([]string{c.Name()}, c.Aliases...)
+	return append(ret, c.HiddenAliases...)
+}
+
+// mergeCategories returns the categories followed by the mounted categories
+// not in categories. Mounted categories are not default categories.
+func mergeCategories(categories, mounted []*CmdCategory) ([]*CmdCategory, error) {
+	ret := append([]*CmdCategory(nil), categories...)
+	for _, m := range mounted {
+		var existing *CmdCategory
+		for _, c := range ret {
+			if c.Name == m.Name {
+				existing = c
+				break
+			}
+		}
+		if existing == nil {
+			ret = append(ret, &CmdCategory{Name: m.Name, Title: m.Title})
+			continue
+		}
+		if existing.Title != m.Title {
+			return nil, errors.E("mergeCategories", errors.K.Invalid, ErrInvalidSpec,
+				"reason", "conflicting category titles",
+				"category", m.Name,
+				"title", existing.Title,
+				"mounted_title", m.Title)
+		}
+	}
+	return ret, nil
+}
+
+// checkMerge returns an error if a function name is registered in both
+// runtimes, or an input name with constructors of inputs of different types.
+// Runtimes shared by both apps don't conflict.
+func (rt *Runtime) checkMerge(other *Runtime) error {
+	if rt == other {
+		return nil
+	}
+	e := errors.Template("checkMerge", errors.K.Invalid, ErrInvalidSpec)
+	if name, ok := conflictingFn(rt.cobraFns, other.cobraFns); ok {
+		return e("reason", "conflicting cobra functions", "function", name)
+	}
+	if name, ok := conflictingFn(rt.runFns, other.runFns); ok {
+		return e("reason", "conflicting run functions", "function", name)
+	}
+	if name, ok := conflictingFn(rt.completions, other.completions); ok {
+		return e("reason", "conflicting completion functions", "function", name)
+	}
+	if name, ok := conflictingFn(rt.argValidators, other.argValidators); ok {
+		return e("reason", "conflicting args validators", "function", name)
+	}
+	for _, name := range sortedNames(other.inputs) {
+		ctor, ok := rt.inputs[name]
+		if ok && reflect.TypeOf(ctor()) != reflect.TypeOf(other.inputs[name]()) {
+			return e("reason", "conflicting input constructors", "input", name)
+		}
+	}
+	return nil
+}
+
+// conflictingFn returns the first name of other also registered in fns.
+// Functions cannot be compared - closures of the same function literal share
+// their code - such that a name registered in both is a conflict.
+func conflictingFn[F any](fns, other map[string]F) (string, bool) {
+	for _, name := range sortedNames(other) {
+		if _, ok := fns[name]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// merge registers the functions, constructors and hooks of other.
+func (rt *Runtime) merge(other *Runtime) {
+	if rt.cobraFns == nil {
+		rt.cobraFns = make(map[string]CobraFunction)
+	}
+	for name, fn := range other.cobraFns {
+		rt.cobraFns[name] = fn
+	}
+	if rt.inputs == nil {
+		rt.inputs = make(map[string]Ctor)
+	}
+	for name, ctor := range other.inputs {
+		rt.inputs[name] = ctor
+	}
+	if rt.runFns == nil {
+		rt.runFns = make(map[string]interface{})
+	}
+	for name, fn := range other.runFns {
+		rt.runFns[name] = fn
+	}
+	rt.WithCompletions(other.completions)
+	rt.WithArgValidators(other.argValidators)
+	rt.decodeHooks = append(rt.decodeHooks, other.decodeHooks...)
+}
@@ -0,0 +1,38 @@
+package otel_test
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/eluv-io/ecobra-go/app"
+	appotel "github.com/eluv-io/ecobra-go/app/otel"
+)
+
+func ExampleNewCmdTracer() {
+	// the provider is typically configured with the exporter of the tracing
+	// backend, e.g. sdktrace.WithBatcher(exporter)
+	provider := sdktrace.NewTracerProvider()
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	a, err := app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use: "cli",
+		RunE: app.RunFn(func(ctx *app.CmdCtx) error {
+			// requests of the HTTP client carry the trace context of the command
+			resp, err := ctx.HTTPClient().Get("https://example.com")
+			if err != nil {
+				return err
+			}
+			return resp.Body.Close()
+		}),
+	}), nil)
+	if err != nil {
+		panic(err)
+	}
+	// spans are created with the global tracer provider and propagator
+	_ = a.WithCmdTracer(appotel.NewCmdTracer(nil, nil)).Execute()
+}
@@ -0,0 +1,82 @@
+// Package otel adapts OpenTelemetry to the tracing of the commands of apps -
+// see app.App.WithCmdTracer. It is a module of its own such that apps not
+// using OpenTelemetry don't depend on it.
+package otel
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eluv-io/ecobra-go/app"
+)
+
+// TracerName is the name of the tracer obtained from the global tracer
+// provider when NewCmdTracer is called without a tracer.
+const TracerName = "github.com/eluv-io/ecobra-go/app/otel"
+
+// cmdTracer is an app.CmdTracer creating otel spans.
+type cmdTracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewCmdTracer returns a CmdTracer starting the spans of commands with the
+// given tracer and injecting their trace context into HTTP requests with the
+// given propagator. A nil tracer is the tracer named TracerName of the global
+// tracer provider and a nil propagator is the global text map propagator - see
+// otel.SetTracerProvider and otel.SetTextMapPropagator.
+func NewCmdTracer(tracer trace.Tracer, propagator propagation.TextMapPropagator) app.CmdTracer {
+	if tracer == nil {
+		tracer = otel.Tracer(TracerName)
+	}
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	return &cmdTracer{tracer: tracer, propagator: propagator}
+}
+
+func (t *cmdTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, app.CmdSpan) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attributes(attrs)...))
+	return ctx, &cmdSpan{span: span}
+}
+
+func (t *cmdTracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// cmdSpan is an app.CmdSpan wrapping an otel span.
+type cmdSpan struct {
+	span trace.Span
+}
+
+func (s *cmdSpan) SetAttributes(attrs map[string]string) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// End records the error of failed commands and sets the status of their span
+// to codes.Error before ending it.
+func (s *cmdSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes returns the given attributes as otel string attributes, sorted by
+// key.
+func attributes(attrs map[string]string) []attribute.KeyValue {
+	ret := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		ret = append(ret, attribute.String(k, v))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
@@ -0,0 +1,98 @@
+package otel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eluv-io/ecobra-go/app"
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+func TestCmdTracer(t *testing.T) {
+	type input struct {
+		User     string `cmd:"flag,user,user name"`
+		Password string `cmd:"flag,password,user password"`
+	}
+	var traceparents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+	}))
+	defer srv.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewCmdTracer(provider.Tracer("test"), propagation.TraceContext{})
+
+	newApp := func() *app.App {
+		a, err := app.NewApp(app.NewSpec(nil, &app.Cmd{
+			Use: "cli",
+			SubCommands: []*app.Cmd{{
+				Use:   "get",
+				Input: &input{},
+				RunE: app.RunFn(func(ctx *app.CmdCtx, in *input) error {
+					resp, err := ctx.HTTPClient().Get(srv.URL)
+					require.NoError(t, err)
+					_ = resp.Body.Close()
+					if in.User == "bad" {
+						return errors.E("get", errors.K.Permission)
+					}
+					return nil
+				}),
+			}},
+		}), nil)
+		require.NoError(t, err)
+		return a.WithCmdTracer(tracer)
+	}
+	attrs := func(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+		ret := map[attribute.Key]string{}
+		for _, kv := range span.Attributes() {
+			ret[kv.Key] = kv.Value.AsString()
+		}
+		return ret
+	}
+
+	a := newApp()
+	a.SetArgs([]string{"get", "--user", "joe", "--password", "pwd"})
+	require.NoError(t, a.Execute())
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	require.Equal(t, "cli get", span.Name())
+	require.Equal(t, codes.Unset, span.Status().Code)
+	require.Empty(t, span.Events())
+	require.Equal(t, "cli get", attrs(span)[app.SpanAttrPath])
+	require.Equal(t, "ok", attrs(span)[app.SpanAttrExitStatus])
+	require.NotEmpty(t, attrs(span)[app.SpanAttrInvocationID])
+	require.Equal(t, "joe", attrs(span)[app.SpanAttrFlagPrefix+"user"])
+	require.Equal(t, bflags.RedactedValue, attrs(span)[app.SpanAttrFlagPrefix+"password"])
+
+	// the trace context of the span is propagated to the request
+	require.Len(t, traceparents, 1)
+	sc := propagation.TraceContext{}.Extract(t.Context(), propagation.HeaderCarrier{
+		"Traceparent": traceparents,
+	})
+	require.Equal(t, span.SpanContext().TraceID(), trace.SpanContextFromContext(sc).TraceID())
+	require.Equal(t, span.SpanContext().SpanID(), trace.SpanContextFromContext(sc).SpanID())
+
+	a = newApp()
+	a.SetArgs([]string{"get", "--user", "bad"})
+	require.Error(t, a.Execute())
+	spans = recorder.Ended()
+	require.Len(t, spans, 2)
+	span = spans[1]
+	require.Equal(t, codes.Error, span.Status().Code)
+	require.Len(t, span.Events(), 1)
+	require.Equal(t, "exception", span.Events()[0].Name)
+	require.Equal(t, "error", attrs(span)[app.SpanAttrExitStatus])
+	require.Equal(t, string(errors.K.Permission), attrs(span)[app.SpanAttrErrorKind])
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	formatFlag        = "format"
+	noPagerFlag       = "no-pager"
+	goTemplate        = "go-template="
+	goTemplateFile    = "go-template-file="
+	defaultFormatName = "json"
+	plainFormatName   = "plain"
+)
+
+// OutputFormat writes the output of a command to w.
+type OutputFormat func(w io.Writer, cmd *cobra.Command, out interface{}) error
+
+// OutputData is the data of the go templates of the --format flag: the output
+// of the command is accessed with {{.Out}}.
+type OutputData struct {
+	Command string      // path of the command
+	Out     interface{} // output returned by the run function
+}
+
+// WithOutput makes the app print the output returned by the run functions of
+// commands to the output of the command - before the CommandEnd function is
+// called - if b is true. The root command gets a persistent --format flag
+// selecting the format of the output:
+//
+//	json                    indented JSON - the default
+//	plain                   plain text - see formatPlain
+//	table                   an aligned table - see formatTable
+//	wide                    a table without truncated cells
+//	go-template=<template>  a go template - see OutputData
+//	go-template-file=<path> a go template read from a file
+//	<template>              a go template, e.g. '{{.Out.Name}}'
+//
+// or the name of a format registered with WithOutputFormat. The --query flag
+// selects the part of the output to print with a JSONPath expression evaluated
+// against the JSON representation of the output - see parseQuery. Tables are
+// printed without headers with --no-headers and with the given columns only
+// with --columns. Output to a terminal is paged unless --no-pager is set and
+// colored according to the --color flag - see WithColor. --diff-against
+// @file.json compares the output to a result saved by a previous run and fails
+// if they differ, e.g. to detect configuration drift. Run functions may stream
+// their output item by item - see CmdCtx.Emit.
+func (a *App) WithOutput(b bool) *App {
+	a.output = b
+	return a
+}
+
+// WithOutputFormat registers an output format under the given name. See
+// WithOutput.
+func (a *App) WithOutputFormat(name string, f OutputFormat) *App {
+	if a.outputFormats == nil {
+		a.outputFormats = make(map[string]OutputFormat)
+	}
+	a.outputFormats[name] = f
+	return a
+}
+
+// addOutputFlags adds the persistent flags of the output of commands to the
+// root command if output is enabled.
+func (a *App) addOutputFlags() error {
+	if !a.output {
+		return nil
+	}
+	fs := a.root.PersistentFlags()
+	for _, name := range []string{formatFlag, queryFlag, noHeadersFlag, columnsFlag, colorFlag, noPagerFlag, diffAgainstFlag} {
+		if fs.Lookup(name) != nil {
+			return errors.E("addOutputFlags", errors.K.Invalid, ErrInvalidSpec, bflags.ErrDuplicateFlag, "flag", name)
+		}
+	}
+	names := []string{defaultFormatName, plainFormatName, tableFormatName, wideFormatName}
+	for name := range a.outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fs.String(formatFlag, "",
+		"output format: "+strings.Join(names, ", ")+", go-template=<template> or go-template-file=<path>")
+	fs.String(queryFlag, "", "JSONPath expression selecting the part of the output to print, e.g. '$.items[*].id'")
+	fs.Bool(noHeadersFlag, false, "don't print the headers of tables")
+	fs.String(columnsFlag, "", "comma-separated list of the columns of tables")
+	color := colorPolicy(a.root)
+	fs.Var(&color, colorFlag, "color the output and help: auto, always or never")
+	fs.Bool(noPagerFlag, false, "don't page long output")
+	fs.String(diffAgainstFlag, "", "print the differences between the output and the result saved in the given JSON file, e.g. @result.json")
+	return nil
+}
+
+// outputFlag returns the value of the given persistent output flag of the root.
+func outputFlag(cmd *cobra.Command, name string) string {
+	f := cmd.Root().PersistentFlags().Lookup(name)
+	if f == nil {
+		return ""
+	}
+	return f.Value.String()
+}
+
+// printOutput prints the given output of the command in the format selected
+// with the --format flag if output is enabled. The output is first reduced to
+// the values selected by the --query flag, if set. Output to a terminal goes
+// through the pager - less exits right away if the output fits on the screen -
+// unless the --no-pager flag is set.
+//
+// With the --diff-against flag, the differences between the output and the
+// result saved in the given file - reduced by the query as well - are printed
+// instead of the output - one line
+// per difference unless a format is selected - and an error wrapping
+// ErrOutputDiffers is returned if there are any.
+func (a *App) printOutput(cmd *cobra.Command, out interface{}) error {
+	if !a.output || out == nil {
+		return nil
+	}
+	if _, streamed := out.(*StreamOutput); streamed {
+		return nil
+	}
+	format := outputFlag(cmd, formatFlag)
+	f, err := a.outputFormat(format)
+	if err != nil {
+		return err
+	}
+	var q *query
+	if expr := outputFlag(cmd, queryFlag); expr != "" {
+		if q, err = parseQuery(expr); err != nil {
+			return err
+		}
+		if out, err = q.eval(out); err != nil {
+			return err
+		}
+	}
+	var diffs []*Difference
+	file := outputFlag(cmd, diffAgainstFlag)
+	if file != "" {
+		if diffs, err = diffAgainst(file, out, q); err != nil {
+			return err
+		}
+		out = diffs
+		if format == "" {
+			f = formatDiff
+		}
+	}
+	buf := &strings.Builder{}
+	if err = f(buf, cmd, out); err != nil {
+		return errors.E("printOutput", errors.K.Invalid, err, "command", cmd.CommandPath())
+	}
+	page(cmd.OutOrStdout(), buf.String(), outputFlag(cmd, noPagerFlag) != "true")
+	if len(diffs) > 0 {
+		// not a usage error
+		cmd.SilenceUsage = true
+		return errors.E("printOutput", errors.K.Invalid, ErrOutputDiffers,
+			"command", cmd.CommandPath(),
+			"file", strings.TrimPrefix(file, "@"),
+			"differences", len(diffs))
+	}
+	return nil
+}
+
+// outputFormat returns the output format with the given name.
+func (a *App) outputFormat(format string) (OutputFormat, error) {
+	e := errors.Template("outputFormat", errors.K.Invalid, ErrInvalidFormat, "format", format)
+	if f, ok := a.outputFormats[format]; ok {
+		return f, nil
+	}
+	switch {
+	case format == "" || format == defaultFormatName:
+		return formatJSON, nil
+	case format == plainFormatName:
+		return formatPlain, nil
+	case format == tableFormatName:
+		return formatTable(false), nil
+	case format == wideFormatName:
+		return formatTable(true), nil
+	case strings.HasPrefix(format, goTemplateFile):
+		path := strings.TrimPrefix(format, goTemplateFile)
+		bb, err := os.ReadFile(path)
+		if err != nil {
+			return nil, e(errors.K.NotExist, "reason", "template file not found", "read_error", err.Error())
+		}
+		return templateFormat(string(bb))
+	case strings.HasPrefix(format, goTemplate):
+		return templateFormat(strings.TrimPrefix(format, goTemplate))
+	case strings.Contains(format, "{{"):
+		return templateFormat(format)
+	}
+	return nil, e("reason", "unknown format")
+}
+
+func formatJSON(w io.Writer, cmd *cobra.Command, out interface{}) error {
+	if s, ok := out.(string); ok {
+		_, err := io.WriteString(w, s+"\n")
+		return err
+	}
+	sb := &strings.Builder{}
+	enc := json.NewEncoder(sb)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	text := sb.String()
+	if useColor(cmd, cmd.OutOrStdout()) {
+		text = colorJSON(text)
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// formatPlain writes the output as plain text: one line per element of slices
+// and arrays, with strings and fmt.Stringer values as is and other values as
+// compact JSON.
+func formatPlain(w io.Writer, _ *cobra.Command, out interface{}) error {
+	sb := &strings.Builder{}
+	v := reflect.ValueOf(out)
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			sb.WriteString(plainString(v.Index(i)) + "\n")
+		}
+	} else {
+		sb.WriteString(plainString(v) + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// plainString returns the plain text representation of the given value.
+func plainString(v reflect.Value) string {
+	if v.IsValid() && v.CanInterface() {
+		if s, ok := v.Interface().(fmt.Stringer); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+			return s.String()
+		}
+	}
+	return cellString(v)
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		bb, err := json.Marshal(v)
+		return string(bb), err
+	},
+	"join": strings.Join,
+}
+
+// templateFormat returns an output format executing the given go template with
+// OutputData. A new line is added to the output if it has none.
+func templateFormat(text string) (OutputFormat, error) {
+	t, err := template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.E("templateFormat", errors.K.Invalid, ErrInvalidFormat, "template_error", err.Error())
+	}
+	return func(w io.Writer, cmd *cobra.Command, out interface{}) error {
+		sb := &strings.Builder{}
+		if err := t.Execute(sb, &OutputData{Command: cmd.CommandPath(), Out: out}); err != nil {
+			return err
+		}
+		s := sb.String()
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		_, err := io.WriteString(w, s)
+		return err
+	}, nil
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// parsePositional parses the Args expression of a command and returns the
+// constructor of the positional args validator it describes, or nil for an
+// empty expression. Expressions are cobra's validators, possibly composed with
+// MatchAll, and the validators registered by name in the runtime - see
+// Runtime.WithArgValidators:
+//
+//	NoArgs
+//	RangeArgs(1,2)
+//	MatchAll(ExactArgs(2),OnlyValidArgs)
+//	MatchAll(MinimumNArgs(1),contentIds)
+//
+// Errors wrap ErrInvalidSpec - or ErrFunctionNotFound for unknown validators -
+// and report the offending sub-expression and its position in the expression.
+func parsePositional(s string, validators map[string]ValidatorCtor) (ValidatorCtor, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	p := &positionalParser{s: s, validators: validators}
+	ctor, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, p.errorAt(p.pos, len(p.s), "unexpected characters after expression")
+	}
+	return ctor, nil
+}
+
+// countValidators are cobra's validators of the number of args.
+var countValidators = map[string]func(int) cobra.PositionalArgs{
+	"MinimumNArgs":   cobra.MinimumNArgs,
+	"MaximumNArgs":   cobra.MaximumNArgs,
+	"ExactArgs":      cobra.ExactArgs,
+	"ExactValidArgs": cobra.ExactValidArgs,
+}
+
+// positionalParser is a recursive descent parser of Args expressions.
+type positionalParser struct {
+	s          string                   // the expression
+	pos        int                      // current position in the expression
+	validators map[string]ValidatorCtor // validators registered in the runtime
+}
+
+// expr parses a validator with its optional parameters in parentheses:
+// numbers or other validators.
+func (p *positionalParser) expr() (ValidatorCtor, error) {
+	p.skipSpaces()
+	start := p.pos
+	name := p.ident()
+	if name == "" {
+		return nil, p.errorAt(start, start+1, "validator expected")
+	}
+	var nums []int
+	var subs []ValidatorCtor
+	p.skipSpaces()
+	if p.next('(') {
+		for params := 0; ; params++ {
+			p.skipSpaces()
+			if params == 0 && p.next(')') {
+				break
+			}
+			if p.pos < len(p.s) && unicode.IsDigit(rune(p.s[p.pos])) {
+				n, err := p.number()
+				if err != nil {
+					return nil, err
+				}
+				nums = append(nums, n)
+			} else {
+				sub, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				subs = append(subs, sub)
+			}
+			p.skipSpaces()
+			if p.next(',') {
+				continue
+			}
+			if p.next(')') {
+				break
+			}
+			if p.pos >= len(p.s) {
+				return nil, p.errorAt(start, len(p.s), "unclosed (")
+			}
+			return nil, p.errorAt(p.pos, p.pos+1, "',' or ')' expected")
+		}
+	}
+	return p.validator(name, start, nums, subs)
+}
+
+// validator returns the constructor of the validator with the given name and
+// parameters, parsed from the expression starting at the given position.
+func (p *positionalParser) validator(name string, start int, nums []int, subs []ValidatorCtor) (ValidatorCtor, error) {
+	params := func(n int, m int) error {
+		if len(nums) != n || len(subs) != m {
+			expected := "no parameters"
+			switch {
+			case n == 1:
+				expected = "1 number"
+			case n > 1:
+				expected = strconv.Itoa(n) + " numbers"
+			case m > 0:
+				expected = "validators"
+			}
+			return p.errorAt(start, p.pos, "invalid parameters of "+name+": expected "+expected)
+		}
+		return nil
+	}
+	var pa cobra.PositionalArgs
+	var err error
+	switch name {
+	case "NoArgs":
+		pa, err = cobra.NoArgs, params(0, 0)
+	case "OnlyValidArgs":
+		pa, err = cobra.OnlyValidArgs, params(0, 0)
+	case "ArbitraryArgs":
+		pa, err = cobra.ArbitraryArgs, params(0, 0)
+	case "MinimumNArgs", "MaximumNArgs", "ExactArgs", "ExactValidArgs":
+		if err = params(1, 0); err == nil {
+			pa = countValidators[name](nums[0])
+		}
+	case "RangeArgs":
+		if err = params(2, 0); err == nil {
+			pa = cobra.RangeArgs(nums[0], nums[1])
+		}
+	case "MatchAll":
+		if len(subs) == 0 || len(nums) > 0 {
+			return nil, params(0, 1)
+		}
+		return func(c *cobra.Command) func(c *cobra.Command, args []string) error {
+			all := make([]cobra.PositionalArgs, 0, len(subs))
+			for _, sub := range subs {
+				all = append(all, sub(c))
+			}
+			return cobra.MatchAll(all...)
+		}, nil
+	default:
+		ctor, ok := p.validators[name]
+		if !ok {
+			return nil, p.errorWith(ErrFunctionNotFound, start, p.pos, "unknown validator")
+		}
+		return ctor, params(0, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func(*cobra.Command) func(c *cobra.Command, args []string) error {
+		return pa
+	}, nil
+}
+
+// ident parses the name of a validator: a letter or '_' followed by letters,
+// digits, '_', '-' or '.'.
+func (p *positionalParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		r := rune(p.s[p.pos])
+		first := unicode.IsLetter(r) || r == '_'
+		if !first && (p.pos == start || !unicode.IsDigit(r) && r != '-' && r != '.') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// number parses a non-negative integer.
+func (p *positionalParser) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.s) && unicode.IsDigit(rune(p.s[p.pos])) {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return 0, p.errorAt(start, p.pos, "invalid number")
+	}
+	return n, nil
+}
+
+// next consumes the given character if it is the next one.
+func (p *positionalParser) next(c byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *positionalParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// errorAt returns an error reporting the sub-expression between the given
+// positions.
+func (p *positionalParser) errorAt(start, end int, reason string) error {
+	return p.errorWith(ErrInvalidSpec, start, end, reason)
+}
+
+// errorWith is like errorAt with the given cause.
+func (p *positionalParser) errorWith(cause error, start, end int, reason string) error {
+	if end > len(p.s) {
+		end = len(p.s)
+	}
+	return errors.E("parsePositional", errors.K.Invalid, cause,
+		"reason", reason,
+		"expression", p.s[start:end],
+		"position", start,
+		"args", p.s)
+}
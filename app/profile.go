@@ -0,0 +1,305 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	profileFlag    = "profile"
+	profileFlagKey = "profile" // key for flags annotation: value set from the active profile
+	profileCmdName = "profile"
+	profileFile    = "profile" // file of the active profile in the state directory
+)
+
+// WithProfiles adds the persistent --profile flag to the root command if b is
+// true. A profile - e.g. 'staging' or 'prod' - overrides the default values of
+// flags with the values declared for the profile:
+//   - in the "profiles" of the spec, keyed by profile then flag name:
+//     "profiles": {"staging": {"endpoint": "https://staging.example.com"}}
+//   - in the config file of the profile - see ProfileConfigFile - if the config
+//     is enabled with WithConfigCommand
+//
+// When a command runs, flags not set on the command line take their value from
+// the config file of the profile, the spec and the config file of the app, in
+// this order of precedence. The built-in 'config' commands manage the config
+// file of the active profile. See Profile.
+func (a *App) WithProfiles(b bool) *App {
+	a.profiles = b
+	return a
+}
+
+// WithProfileCommand enables profiles - see WithProfiles - and adds the
+// built-in 'profile' command group managing the active profile if b is true:
+//
+//	myapp profile list
+//	myapp profile use staging
+//	myapp profile show
+//	myapp profile unset
+//
+// The profile selected with 'profile use' is persisted in the state directory
+// of the app and is active until unset, unless another profile is selected
+// with the --profile flag or the <APP>_PROFILE environment variable.
+func (a *App) WithProfileCommand(b bool) *App {
+	a.profileCmd = b
+	if b {
+		a.profiles = true
+	}
+	return a
+}
+
+// addProfileFlag adds the --profile flag to the root command if enabled.
+func (a *App) addProfileFlag() error {
+	if !a.profiles {
+		return nil
+	}
+	fs := a.root.PersistentFlags()
+	if fs.Lookup(profileFlag) != nil {
+		return errors.E("addProfileFlag", errors.K.Invalid, ErrInvalidSpec, bflags.ErrDuplicateFlag,
+			"flag", profileFlag)
+	}
+	fs.String(profileFlag, "", "profile overriding the default values of flags")
+	return nil
+}
+
+// Profile returns the active profile of the app, which is the first of:
+//   - the value of the --profile flag
+//   - the value of the <APP>_PROFILE environment variable, where <APP> is the
+//     upper-case name of the root command
+//   - the profile selected with 'profile use' - see WithProfileCommand
+//
+// The returned profile is empty if profiles are not enabled or no profile is
+// active.
+func (a *App) Profile() string {
+	if !a.profiles {
+		return ""
+	}
+	if a.root != nil {
+		if f := a.root.PersistentFlags().Lookup(profileFlag); f != nil && f.Changed {
+			return f.Value.String()
+		}
+	}
+	if profile := os.Getenv(envPrefix(a.spec.CmdRoot.Name()) + "PROFILE"); profile != "" {
+		return profile
+	}
+	if !a.profileCmd {
+		return ""
+	}
+	bb, err := os.ReadFile(filepath.Join(a.StateDir(), profileFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bb))
+}
+
+// Profile returns the active profile of the app or an empty string - see
+// App.Profile.
+func (c *CmdCtx) Profile() string {
+	if v, ok := c.Get(CtxProfile); ok {
+		return v.(string)
+	}
+	return ""
+}
+
+// setProfile sets the active profile to the context.
+func (a *App) setProfile(ctx *CmdCtx) {
+	ctx.Set(CtxProfile, a.Profile())
+}
+
+// ProfileConfigFile returns the path of the config file of the given profile:
+// the config file of the app with the profile inserted before its extension,
+// e.g. config.staging.json.
+func (a *App) ProfileConfigFile(profile string) string {
+	file := a.ConfigFile()
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + profile + ext
+}
+
+// activeConfigFile returns the config file of the active profile or the config
+// file of the app if no profile is active.
+func (a *App) activeConfigFile() string {
+	if profile := a.Profile(); profile != "" {
+		return a.ProfileConfigFile(profile)
+	}
+	return a.ConfigFile()
+}
+
+// applyProfile sets the flags of the command that were not set on the command
+// line to their value in the active profile. The profile must be declared in
+// the spec or have a config file.
+func (a *App) applyProfile(cmd *cobra.Command) error {
+	profile := a.Profile()
+	if profile == "" {
+		return nil
+	}
+	c, err := a.profileConfig(profile)
+	if err != nil {
+		return err
+	}
+	e := errors.Template("applyProfile", errors.K.Invalid, ErrInvalidConfig, "profile", profile)
+	return setConfigValues(cmd, c, profileFlagKey, e)
+}
+
+// profileConfig returns the values of the given profile: the values of the
+// spec overridden by the values of the config file of the profile. The profile
+// must be declared in the spec or have a config file.
+func (a *App) profileConfig(profile string) (config, error) {
+	values, declared := a.spec.Profiles[profile]
+	c := config{}
+	for k, v := range values {
+		c[k] = v
+	}
+	if a.configCmd {
+		file := a.ProfileConfigFile(profile)
+		if _, err := os.Stat(file); err == nil {
+			declared = true
+		}
+		pc, err := a.loadConfigFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range pc {
+			c[k] = v
+		}
+	}
+	if !declared {
+		return nil, errors.E("profileConfig", errors.K.NotExist, ErrInvalidConfig,
+			"reason", "unknown profile",
+			"profile", profile)
+	}
+	return c, nil
+}
+
+// profileNames returns the sorted names of the profiles declared in the spec or
+// having a config file.
+func (a *App) profileNames() []string {
+	names := make(map[string]bool)
+	for name := range a.spec.Profiles {
+		names[name] = true
+	}
+	if a.configCmd {
+		ext := filepath.Ext(a.ConfigFile())
+		base := strings.TrimSuffix(a.ConfigFile(), ext) + "."
+		files, _ := filepath.Glob(a.ProfileConfigFile("*"))
+		for _, file := range files {
+			name := strings.TrimSuffix(strings.TrimPrefix(file, base), ext)
+			if name != "" {
+				names[name] = true
+			}
+		}
+	}
+	return sortedNames(names)
+}
+
+// addProfileCmd adds the 'profile' command group to the root command if
+// enabled and the root has no command with that name.
+func (a *App) addProfileCmd() {
+	if !a.profileCmd {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == profileCmdName {
+			return
+		}
+	}
+	completeProfiles := func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return a.profileNames(), cobra.ShellCompDirectiveNoFileComp
+	}
+	stateFile := func() string {
+		return filepath.Join(a.StateDir(), profileFile)
+	}
+	group := &cobra.Command{
+		Use:   profileCmdName,
+		Short: "Manage the active profile",
+		Long: `Manage the active profile.
+
+A profile overrides the default values of flags. The profile selected with
+'profile use' is active until unset, unless another profile is selected with
+the --profile flag or the environment.`,
+	}
+	group.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List the profiles, the active profile marked with '*'",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				active := a.Profile()
+				for _, name := range a.profileNames() {
+					mark := " "
+					if name == active {
+						mark = "*"
+					}
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", mark, name)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:               "use <profile>",
+			Short:             "Make the given profile the active profile",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeProfiles,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if _, err := a.profileConfig(args[0]); err != nil {
+					return err
+				}
+				file := stateFile()
+				e := errors.Template("profile use", errors.K.IO, "file", file)
+				if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+					return e(err)
+				}
+				if err := writeFileAtomic(file, []byte(args[0]+"\n")); err != nil {
+					return e(err)
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:               "show [profile]",
+			Short:             "Print the name and the values of the active or given profile",
+			Args:              cobra.MaximumNArgs(1),
+			ValidArgsFunction: completeProfiles,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				profile := a.Profile()
+				if len(args) > 0 {
+					profile = args[0]
+				}
+				if profile == "" {
+					return errors.E("profile show", errors.K.NotExist, ErrInvalidConfig, "reason", "no active profile")
+				}
+				c, err := a.profileConfig(profile)
+				if err != nil {
+					return err
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "profile: %s\n", profile)
+				for _, key := range c.sortedKeys() {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s=%s\n", key, configString(c[key]))
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "unset",
+			Short: "Unset the active profile selected with 'profile use'",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				err := os.Remove(stateFile())
+				if err != nil && !os.IsNotExist(err) {
+					return errors.E("profile unset", errors.K.IO, err, "file", stateFile())
+				}
+				return nil
+			},
+		},
+	)
+	a.root.AddCommand(group)
+}
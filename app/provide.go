@@ -0,0 +1,114 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// Provider constructs a dependency of commands - a client, a DB handle, an SDK
+// object etc. - from the context of the command.
+type Provider func(ctx *CmdCtx) (interface{}, error)
+
+// Provide registers the constructor of the dependency with the given name,
+// replacing any constructor registered before with that name. Dependencies
+// are constructed lazily - when first resolved with Resolve or
+// CmdCtx.Resolve - and at most once per invocation of a command: run
+// functions and constructors resolving the same dependency share it.
+//
+// Constructors may resolve other dependencies but must not depend on
+// themselves, directly or not.
+func (a *App) Provide(name string, ctor func(ctx *CmdCtx) (interface{}, error)) *App {
+	if a.providers == nil {
+		a.providers = make(map[string]Provider)
+	}
+	a.providers[name] = ctor
+	return a
+}
+
+// setProviders sets a registry of the dependencies provided by the app to the
+// context. The registry is new for each invocation such that dependencies are
+// not shared across invocations.
+func (a *App) setProviders(ctx *CmdCtx) {
+	if len(a.providers) == 0 {
+		return
+	}
+	ctx.Set(CtxProviders, &registry{
+		providers: a.providers,
+		values:    make(map[string]*provided),
+	})
+}
+
+// registry memoizes the dependencies constructed during an invocation.
+type registry struct {
+	providers map[string]Provider
+	mu        sync.Mutex
+	values    map[string]*provided
+}
+
+// provided is a dependency, constructed once.
+type provided struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func (r *registry) resolve(ctx *CmdCtx, name string) (interface{}, error) {
+	ctor, ok := r.providers[name]
+	if !ok {
+		return nil, errors.E("Resolve", errors.K.NotExist, ErrDependencyNotFound, "name", name)
+	}
+	r.mu.Lock()
+	p, ok := r.values[name]
+	if !ok {
+		p = &provided{}
+		r.values[name] = p
+	}
+	r.mu.Unlock()
+
+	p.once.Do(func() {
+		p.value, p.err = ctor(ctx)
+		if p.err != nil {
+			p.err = errors.E("Resolve", p.err, "name", name)
+		}
+	})
+	return p.value, p.err
+}
+
+// Resolve returns the dependency with the given name registered with
+// App.Provide, constructing it on first use in the current invocation. The
+// error wraps ErrDependencyNotFound if no such dependency was registered and
+// the error of the constructor if it failed.
+func (c *CmdCtx) Resolve(name string) (interface{}, error) {
+	v, ok := c.Get(CtxProviders)
+	if !ok {
+		return nil, errors.E("Resolve", errors.K.NotExist, ErrDependencyNotFound, "name", name)
+	}
+	return v.(*registry).resolve(c, name)
+}
+
+// Resolve returns the dependency with the given name registered with
+// App.Provide as a T:
+//
+//	db, err := app.Resolve[*sql.DB](ctx, "db")
+//
+// The error wraps ErrDependencyNotFound if no such dependency was registered,
+// the error of the constructor if it failed or is of kind Invalid if the
+// dependency is not a T.
+func Resolve[T any](ctx *CmdCtx, name string) (T, error) {
+	var ret T
+	v, err := ctx.Resolve(name)
+	if err != nil {
+		return ret, err
+	}
+	ret, ok := v.(T)
+	if !ok {
+		return ret, errors.E("Resolve", errors.K.Invalid,
+			"reason", "unexpected type",
+			"name", name,
+			"type", fmt.Sprintf("%T", v),
+			"expected", fmt.Sprintf("%T", &ret)[1:])
+	}
+	return ret, nil
+}
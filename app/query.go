@@ -0,0 +1,271 @@
+package app
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+)
+
+const queryFlag = "query"
+
+type queryStepKind int
+
+const (
+	stepField     queryStepKind = iota // .name or ['name']
+	stepIndex                          // [n]
+	stepSlice                          // [start:end]
+	stepWildcard                       // .* or [*] or []
+	stepRecursive                      // ..
+)
+
+type queryStep struct {
+	kind       queryStepKind
+	name       string
+	index      int
+	start, end *int
+}
+
+// query is a parsed JSONPath expression.
+type query struct {
+	expr  string
+	steps []queryStep
+}
+
+// parseQuery parses a JSONPath expression. The supported subset is:
+//
+//	$               the root - optional
+//	.name ['name']  a field of an object
+//	[n]             an element of an array - negative indexes count from the end
+//	[start:end]     a slice of an array - start and end are optional
+//	.* [*]          all fields of an object or elements of an array
+//	..name          the field in the value and all its descendants
+//
+// jq-style paths like '.items[].name' are accepted as well.
+func parseQuery(expr string) (*query, error) {
+	e := errors.Template("parseQuery", errors.K.Invalid, ErrInvalidQuery, "query", expr)
+	q := &query{expr: expr}
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		// relative path like 'items[0]'
+		s = "." + s
+	}
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			q.steps = append(q.steps, queryStep{kind: stepRecursive})
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				continue
+			}
+			name, rest := queryName(s)
+			if name == "" {
+				return nil, e("reason", "missing name after '..'")
+			}
+			q.steps = append(q.steps, nameStep(name))
+			s = rest
+		case s[0] == '.':
+			if s == "." {
+				// jq identity
+				s = ""
+				continue
+			}
+			name, rest := queryName(s[1:])
+			if name == "" {
+				if strings.HasPrefix(rest, "[") {
+					// jq '.[]' or '.[0]'
+					s = rest
+					continue
+				}
+				return nil, e("reason", "missing name after '.'")
+			}
+			q.steps = append(q.steps, nameStep(name))
+			s = rest
+		case s[0] == '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, e("reason", "missing ']'")
+			}
+			step, err := bracketStep(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, e(err)
+			}
+			q.steps = append(q.steps, step)
+			s = s[end+1:]
+		default:
+			return nil, e("reason", "unexpected character", "at", s)
+		}
+	}
+	return q, nil
+}
+
+// queryName returns the name at the start of s and the rest of s.
+func queryName(s string) (string, string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+func nameStep(name string) queryStep {
+	if name == "*" {
+		return queryStep{kind: stepWildcard}
+	}
+	return queryStep{kind: stepField, name: name}
+}
+
+// bracketStep returns the step of the content of brackets.
+func bracketStep(s string) (queryStep, error) {
+	e := errors.Template("bracketStep", errors.K.Invalid, ErrInvalidQuery, "selector", s)
+	switch {
+	case s == "" || s == "*":
+		return queryStep{kind: stepWildcard}, nil
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		return queryStep{kind: stepField, name: s[1 : len(s)-1]}, nil
+	case strings.Contains(s, ":"):
+		bounds := strings.SplitN(s, ":", 2)
+		step := queryStep{kind: stepSlice}
+		for i, b := range bounds {
+			b = strings.TrimSpace(b)
+			if b == "" {
+				continue
+			}
+			n, err := strconv.Atoi(b)
+			if err != nil {
+				return step, e("reason", "invalid slice bound")
+			}
+			if i == 0 {
+				step.start = &n
+			} else {
+				step.end = &n
+			}
+		}
+		return step, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return queryStep{}, e("reason", "invalid index")
+	}
+	return queryStep{kind: stepIndex, index: n}, nil
+}
+
+// multi returns true if the query may select several values.
+func (q *query) multi() bool {
+	for _, s := range q.steps {
+		switch s.kind {
+		case stepSlice, stepWildcard, stepRecursive:
+			return true
+		}
+	}
+	return false
+}
+
+// eval evaluates the query against the JSON representation of v. It returns
+// the list of the selected values if the query may select several values and
+// the selected value otherwise.
+func (q *query) eval(v interface{}) (interface{}, error) {
+	e := errors.Template("query", errors.K.Invalid, ErrInvalidQuery, "query", q.expr)
+	doc, err := toJSONValue(v)
+	if err != nil {
+		return nil, e(err)
+	}
+	values := []interface{}{doc}
+	for _, step := range q.steps {
+		var next []interface{}
+		for _, v := range values {
+			next = step.apply(v, next)
+		}
+		values = next
+	}
+	if q.multi() {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, e(errors.K.NotExist, "reason", "no value found")
+	}
+	return values[0], nil
+}
+
+// apply appends the values selected by the step in v to ret.
+func (s queryStep) apply(v interface{}, ret []interface{}) []interface{} {
+	switch s.kind {
+	case stepField:
+		if m, ok := v.(map[string]interface{}); ok {
+			if val, ok := m[s.name]; ok {
+				ret = append(ret, val)
+			}
+		}
+	case stepIndex:
+		if a, ok := v.([]interface{}); ok {
+			i := s.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				ret = append(ret, a[i])
+			}
+		}
+	case stepSlice:
+		if a, ok := v.([]interface{}); ok {
+			start, end := 0, len(a)
+			if s.start != nil {
+				start = sliceBound(*s.start, len(a))
+			}
+			if s.end != nil {
+				end = sliceBound(*s.end, len(a))
+			}
+			if start < end {
+				ret = append(ret, a[start:end]...)
+			}
+		}
+	case stepWildcard:
+		ret = append(ret, children(v)...)
+	case stepRecursive:
+		ret = append(ret, v)
+		for _, c := range children(v) {
+			ret = s.apply(c, ret)
+		}
+	}
+	return ret
+}
+
+func sliceBound(n, length int) int {
+	if n < 0 {
+		n += length
+	}
+	if n < 0 {
+		return 0
+	}
+	if n > length {
+		return length
+	}
+	return n
+}
+
+// children returns the fields of an object - ordered by name - or the elements
+// of an array.
+func children(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		return t
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ret := make([]interface{}, len(keys))
+		for i, k := range keys {
+			ret[i] = t[k]
+		}
+		return ret
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	rateLimitKey = "app_rate_limit" // key for commands annotation
+)
+
+// RateLimit limits the count of invocations of a command in a time window. The
+// invocations are recorded in the state dir of the app (see App.StateDir), such
+// that the limit applies across processes - e.g. to a command called in a loop
+// by a script:
+//
+//	{"use": "publish", "rate_limit": {"count": 10, "window": "1m"}}
+//
+// When the limit is exceeded, the command fails with an error wrapping
+// ErrRateLimited, or a warning is printed and the command runs if Warn is set.
+type RateLimit struct {
+	Count  int    `json:"count"`          // max count of invocations in the window
+	Window string `json:"window"`         // duration of the window, e.g. "1m" or "1h"
+	Warn   bool   `json:"warn,omitempty"` // warn instead of failing when the limit is exceeded
+}
+
+// window returns the duration of the window or an error if the rate limit is
+// invalid.
+func (r *RateLimit) window() (time.Duration, error) {
+	e := errors.Template("rate limit", errors.K.Invalid, ErrInvalidSpec)
+	if r.Count <= 0 {
+		return 0, e("reason", "count must be positive", "count", r.Count)
+	}
+	d, err := time.ParseDuration(r.Window)
+	if err != nil || d <= 0 {
+		return 0, e("reason", "invalid window", "window", r.Window)
+	}
+	return d, nil
+}
+
+func setRateLimit(cmd *cobra.Command, r *RateLimit) error {
+	if r == nil {
+		return nil
+	}
+	if _, err := r.window(); err != nil {
+		return errors.E("setRateLimit", err, "command", cmd.Name())
+	}
+	bb, err := json.Marshal(r)
+	if err != nil {
+		return errors.E("setRateLimit", errors.K.Invalid, err)
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[rateLimitKey] = string(bb)
+	return nil
+}
+
+// checkRateLimit records the invocation of the given command and returns an
+// error if its rate limit is exceeded.
+func (a *App) checkRateLimit(cmd *cobra.Command) error {
+	s := cmd.Annotations[rateLimitKey]
+	if s == "" {
+		return nil
+	}
+	e := errors.Template("rate limit", errors.K.Unavailable, "command", cmd.CommandPath())
+	r := &RateLimit{}
+	if err := json.Unmarshal([]byte(s), r); err != nil {
+		return e(errors.K.Invalid, err)
+	}
+	window, err := r.window()
+	if err != nil {
+		return e(err)
+	}
+
+	file, err := a.stateFile("ratelimit", cmd, ".json")
+	if err != nil {
+		return e(errors.K.IO, err)
+	}
+	unlock, err := lockFile(file)
+	if err != nil {
+		return e(errors.K.IO, err)
+	}
+	defer unlock()
+
+	var stamps []time.Time
+	if bb, err := os.ReadFile(file); err == nil {
+		_ = json.Unmarshal(bb, &stamps)
+	}
+	now := time.Now()
+	recent := stamps[:0]
+	for _, t := range stamps {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.Count {
+		retry := recent[len(recent)-r.Count].Add(window).Sub(now).Round(time.Second)
+		if !r.Warn {
+			return e(ErrRateLimited,
+				"count", r.Count,
+				"window", r.Window,
+				"retry_after", retry.String())
+		}
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s ran more than %d times in %s\n",
+			cmd.CommandPath(), r.Count, r.Window)
+	}
+	recent = append(recent, now)
+	if len(recent) > r.Count {
+		recent = recent[len(recent)-r.Count:]
+	}
+	bb, err := json.Marshal(recent)
+	if err == nil {
+		err = writeFileAtomic(file, bb)
+	}
+	if err != nil {
+		return e(errors.K.IO, err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// ErrorRenderer formats errors returned by commands for humans. Errors of the
+// errors-go package are printed with their fields as aligned key/values and
+// nested causes indented:
+//
+//	Error: command failed
+//	  kind   invalid
+//	  cmd    get
+//	  cause
+//	    op      fetch
+//	    kind    item does not exist
+//	    id      abc
+//
+//	Hint: check the id with 'cli list'
+//	See:  https://docs.example.com/errors#not-exist
+//
+// Hints and DocURLs are looked up by error kind, starting with the innermost
+// error of the chain, such that the most specific kind wins.
+type ErrorRenderer struct {
+	Stacktrace bool                   // print the stacktrace of errors (stripped by default)
+	Hints      map[errors.Kind]string // remediation hints keyed by error kind
+	DocURLs    map[errors.Kind]string // documentation URLs keyed by error kind
+}
+
+// NewErrorRenderer returns a new ErrorRenderer stripping stacktraces.
+func NewErrorRenderer() *ErrorRenderer {
+	return &ErrorRenderer{
+		Hints:   make(map[errors.Kind]string),
+		DocURLs: make(map[errors.Kind]string),
+	}
+}
+
+// WithStacktrace sets whether stacktraces are printed.
+func (r *ErrorRenderer) WithStacktrace(b bool) *ErrorRenderer {
+	r.Stacktrace = b
+	return r
+}
+
+// WithHint sets the remediation hint printed for errors of the given kind.
+func (r *ErrorRenderer) WithHint(kind errors.Kind, hint string) *ErrorRenderer {
+	if r.Hints == nil {
+		r.Hints = make(map[errors.Kind]string)
+	}
+	r.Hints[kind] = hint
+	return r
+}
+
+// WithDocURL sets the documentation URL printed for errors of the given kind.
+func (r *ErrorRenderer) WithDocURL(kind errors.Kind, url string) *ErrorRenderer {
+	if r.DocURLs == nil {
+		r.DocURLs = make(map[errors.Kind]string)
+	}
+	r.DocURLs[kind] = url
+	return r
+}
+
+// Render writes the given error to w. Nothing is written if err is nil.
+func (r *ErrorRenderer) Render(w io.Writer, err error) {
+	if err == nil {
+		return
+	}
+	b := &bytes.Buffer{}
+	if list, ok := err.(*errors.ErrorList); ok {
+		for i, le := range list.Errors {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			r.writeError(b, le)
+		}
+	} else {
+		r.writeError(b, err)
+	}
+
+	kinds := errorKinds(err)
+	hint := lookupKind(r.Hints, kinds)
+	url := lookupKind(r.DocURLs, kinds)
+	if hint != "" || url != "" {
+		b.WriteString("\n")
+	}
+	if hint != "" {
+		b.WriteString("Hint: " + hint + "\n")
+	}
+	if url != "" {
+		b.WriteString("See:  " + url + "\n")
+	}
+	_, _ = w.Write(b.Bytes())
+}
+
+// String returns the error rendered as a string.
+func (r *ErrorRenderer) String(err error) string {
+	sb := &strings.Builder{}
+	r.Render(sb, err)
+	return sb.String()
+}
+
+func (r *ErrorRenderer) writeError(b *bytes.Buffer, err error) {
+	e, ok := err.(*errors.Error)
+	if !ok {
+		b.WriteString("Error: " + err.Error() + "\n")
+		return
+	}
+	title := e.Op()
+	if title == "" {
+		title = string(e.Kind())
+	}
+	b.WriteString("Error: " + title + "\n")
+	writeFields(b, e, "  ", true)
+	if r.Stacktrace {
+		if s := stacktraceOf(e); s != "" {
+			b.WriteString("\n" + s + "\n")
+		}
+	}
+}
+
+// writeFields writes the fields of the given error as aligned key/values. The
+// op is omitted for the top error since it is used as title.
+func writeFields(b *bytes.Buffer, e *errors.Error, indent string, top bool) {
+	var fields []errorField
+	width := len("cause")
+	for _, f := range errorFields(e.ClearStacktrace()) {
+		if f.key == "cause" || (f.key == "op" && top) {
+			continue
+		}
+		fields = append(fields, f)
+		if len(f.key) > width {
+			width = len(f.key)
+		}
+	}
+	for _, f := range fields {
+		b.WriteString(fmt.Sprintf("%s%-*s  %s\n", indent, width, f.key, f.val))
+	}
+	cause := e.Cause()
+	if cause == nil {
+		return
+	}
+	if ce, ok := cause.(*errors.Error); ok {
+		b.WriteString(indent + "cause\n")
+		writeFields(b, ce, indent+"  ", false)
+		return
+	}
+	b.WriteString(fmt.Sprintf("%s%-*s  %s\n", indent, width, "cause", cause.Error()))
+}
+
+type errorField struct {
+	key string
+	val string
+}
+
+// errorFields returns the fields of the given error in the order they are
+// printed by errors-go. The fields are retrieved from the JSON representation
+// of the error since errors-go does not expose them otherwise.
+func errorFields(e *errors.Error) []errorField {
+	bb, err := json.Marshal(e)
+	if err != nil {
+		return []errorField{{key: "error", val: e.ErrorNoTrace()}}
+	}
+	dec := json.NewDecoder(bytes.NewReader(bb))
+	if _, err = dec.Token(); err != nil { // '{'
+		return nil
+	}
+	var ret []errorField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		key, _ := tok.(string)
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			break
+		}
+		if key == "stacktrace" {
+			continue
+		}
+		val := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			val = s
+		}
+		ret = append(ret, errorField{key: key, val: val})
+	}
+	return ret
+}
+
+// stacktraceOf returns the stacktrace of the given error or an empty string.
+func stacktraceOf(e *errors.Error) string {
+	full := e.Error()
+	notrace := e.ErrorNoTrace()
+	return strings.TrimSpace(strings.TrimPrefix(full, notrace))
+}
+
+// errorKinds returns the kinds of the errors in the chain of err, innermost
+// first. Kinds of all errors of an error list are returned.
+func errorKinds(err error) []errors.Kind {
+	if list, ok := err.(*errors.ErrorList); ok {
+		var ret []errors.Kind
+		for _, le := range list.Errors {
+			ret = append(ret, errorKinds(le)...)
+		}
+		return ret
+	}
+	var ret []errors.Kind
+	for err != nil {
+		e, ok := err.(*errors.Error)
+		if !ok {
+			break
+		}
+		ret = append([]errors.Kind{e.Kind()}, ret...)
+		err = e.Cause()
+	}
+	return ret
+}
+
+func lookupKind(m map[errors.Kind]string, kinds []errors.Kind) string {
+	for _, k := range kinds {
+		if s, ok := m[k]; ok {
+			return s
+		}
+	}
+	return ""
+}
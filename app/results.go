@@ -0,0 +1,153 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/eluv-io/log-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+// ResultSink receives the results monitored with SetMonitorResults as they are
+// added - see WithResultSink.
+type ResultSink func(r *CmdResult) error
+
+// ResultJSONLSink returns a ResultSink writing results to w as JSON lines.
+func ResultJSONLSink(w io.Writer) ResultSink {
+	mu := &sync.Mutex{}
+	return func(r *CmdResult) error {
+		bb, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(bb, '\n'))
+		return err
+	}
+}
+
+// ResultFileSink returns a ResultSink appending results as JSON lines to the
+// file at the given path, created with mode 0600 if it does not exist. Each
+// result is written when it is added, such that results survive the process
+// being killed. With fsync, the file is also synced to disk after each result
+// such that results survive a crash of the system.
+func ResultFileSink(path string, fsync bool) ResultSink {
+	mu := &sync.Mutex{}
+	return func(r *CmdResult) error {
+		bb, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(bb, '\n'))
+		if err == nil && fsync {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// WithResultSink sets the sink receiving the monitored results as they are
+// added with the AddResultFn of the command context, rather than only printed
+// on exit - see SetMonitorResults. Errors of the sink are logged.
+func (a *App) WithResultSink(sink ResultSink) *App {
+	a.resultSink = sink
+	return a
+}
+
+// addResultFn returns the AddResultFn of the given command: results with an
+// error record the path and the redacted command line of the command.
+func (a *App) addResultFn(cmd *cobra.Command) AddResultFn {
+	return func(key string, out interface{}, err error) {
+		r := newCommandResult(key, out, err)
+		if err != nil {
+			r.Command = cmd.CommandPath()
+			r.Invocation = bflags.CmdLine(cmd)
+		}
+		a.appendResult(r)
+	}
+}
+
+// appendResult adds a monitored result and flushes it to the result sink, if
+// set.
+func (a *App) appendResult(r *CmdResult) {
+	a.resultsMu.Lock()
+	a.results = append(a.results, r)
+	sink := a.resultSink
+	a.resultsMu.Unlock()
+	if sink == nil {
+		return
+	}
+	if err := sink(r); err != nil {
+		log.Warn("failed to flush result", "key", r.Key, "error", err)
+	}
+}
+
+// printResults prints the monitored results with the PrintResultFn of the app
+// if set, or to the results writer of the app - see WithResultsWriter - in the
+// output format selected with the --format flag if output is enabled and a
+// format is selected. Results are printed as plain text otherwise.
+func (a *App) printResults(reason string) {
+	results := a.getResults()
+	if a.printResultFn != nil {
+		a.printResultFn(results)
+		return
+	}
+	if len(results) == 0 {
+		return
+	}
+	w := a.resultsWriter
+	if w == nil {
+		w = os.Stdout
+	}
+	format := ""
+	if a.output && a.root != nil {
+		format = outputFlag(a.root, formatFlag)
+	}
+	if format != "" && format != plainFormatName {
+		f, err := a.outputFormat(format)
+		if err == nil {
+			err = f(w, a.root, results)
+		}
+		if err == nil {
+			return
+		}
+		log.Warn("failed to print results", "format", format, "error", err)
+	}
+	sb := &strings.Builder{}
+	sb.WriteString("\n" + reason + " - intermediary results\n") // avoid ^Cxx stick in front of result
+	_ = formatPlain(sb, a.root, results)
+	sb.WriteString("\n")
+	_, _ = io.WriteString(w, sb.String())
+}
+
+// WithPrintResults sets the function printing the monitored results on exit
+// signals - see SetMonitorResults. By default, results are printed to the
+// results writer of the app - see WithResultsWriter.
+func (a *App) WithPrintResults(fn PrintResultFn) *App {
+	a.printResultFn = fn
+	return a
+}
+
+// WithResultsWriter sets the writer of the monitored results printed on exit
+// signals - os.Stdout by default. Results are printed in the output format
+// selected with --format, if output is enabled - see WithOutput - such that
+// they integrate with machine-readable pipelines, and as plain text otherwise.
+func (a *App) WithResultsWriter(w io.Writer) *App {
+	a.resultsWriter = w
+	return a
+}
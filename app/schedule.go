@@ -0,0 +1,169 @@
+package app
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/eluv-io/log-go"
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const scheduleCmdName = "schedule"
+
+// ScheduleOptions configures the scheduled runs of commands. See
+// App.RunScheduled.
+type ScheduleOptions struct {
+	Jitter time.Duration   // max random delay added to each run - none if 0
+	Done   <-chan struct{} // stops scheduling when closed - scheduling stops on interrupt (Ctrl-C) otherwise
+}
+
+// WithScheduleOptions sets the options of the scheduled runs of commands.
+func (a *App) WithScheduleOptions(o ScheduleOptions) *App {
+	a.scheduleOpts = o
+	return a
+}
+
+// WithScheduleCommand adds the built-in 'schedule' command to the app if b is
+// true. The command runs the given command line on a cron expression until the
+// process is interrupted:
+//
+//	myapp schedule "*/5 * * * *" content list --library ilib123
+func (a *App) WithScheduleCommand(b bool) *App {
+	a.scheduleCmd = b
+	return a
+}
+
+// RunScheduled invokes the command at the given path - starting with the name
+// of the root command - with the given input each time the given cron
+// expression fires, until scheduling is stopped. See parseCron for the syntax
+// of the expression.
+//
+// Each run is invoked as with Invoke on a copy of the input - see
+// bflags.CopyInput - such that changes made by a run, like fields filled by
+// Complete, don't leak into the next runs. Runs are logged with their duration
+// and error, if any, and their output is printed. Lifecycle events are sent
+// for each run by Invoke and the CommandEnd function of the app is called
+// after each run.
+// Errors of the runs do not stop scheduling.
+//
+// Scheduling stops when the Done channel of the schedule options is closed, or
+// on interrupt through the signal handling of the app if no channel was set: a
+// run in progress completes before the process exits.
+func (a *App) RunScheduled(cronExpr string, path []string, input interface{}) error {
+	e := errors.Template("RunScheduled", errors.K.Invalid, "path", strings.Join(path, " "))
+	sched, err := parseCron(cronExpr)
+	if err != nil {
+		return e(err)
+	}
+	cmd, err := a.cobraCommand(path)
+	if err != nil {
+		return e(err)
+	}
+
+	opts := a.scheduleOpts
+	running := sync.Mutex{} // held while a run is in progress
+	done := opts.Done
+	if done == nil {
+		stopped := make(chan struct{})
+		unregister := registerSignalHandler(func() {
+			close(stopped)
+			running.Lock()
+			defer running.Unlock()
+		}, false)
+		defer unregister()
+		done = stopped
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	command := cmd.CommandPath()
+
+	for run := 1; ; run++ {
+		now := time.Now()
+		at := sched.next(now)
+		if at.IsZero() {
+			return e("reason", "cron expression never fires", "cron", cronExpr)
+		}
+		if opts.Jitter > 0 {
+			at = at.Add(time.Duration(random.Int63n(int64(opts.Jitter))))
+		}
+		select {
+		case <-done:
+			log.Info("scheduling stopped", "command", command, "runs", run-1)
+			return nil
+		case <-time.After(at.Sub(now)):
+		}
+
+		running.Lock()
+		start := time.Now()
+		ctx := NewCmdCtx()
+		in := input
+		if input != nil {
+			if in, err = bflags.CopyInput(nil, input); err != nil {
+				running.Unlock()
+				return e(err)
+			}
+		}
+		out, err := a.Invoke(ctx, path, in)
+		if err == nil {
+			err = a.printOutput(cmd, out)
+		}
+		if err != nil {
+			log.Warn("scheduled run failed", "command", command, "run", run,
+				"scheduled", at, "duration", time.Since(start), "error", err)
+		} else {
+			log.Info("scheduled run", "command", command, "run", run,
+				"scheduled", at, "duration", time.Since(start))
+		}
+		if a.cmdEnd != nil {
+			a.cmdEnd(cmd, out, err)
+		}
+		running.Unlock()
+	}
+}
+
+// addScheduleCmd adds the 'schedule' command to the root command if enabled and
+// the root has no command with that name.
+func (a *App) addScheduleCmd() {
+	if !a.scheduleCmd {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == scheduleCmdName {
+			return
+		}
+	}
+	a.root.AddCommand(&cobra.Command{
+		Use:   scheduleCmdName + " <cron> <command...>",
+		Short: "Run a command on a cron expression",
+		Long: `Run a command on a cron expression until interrupted.
+
+The cron expression has five fields - minute, hour, day of month, month and
+day of week - or is one of @yearly, @monthly, @weekly, @daily, @hourly or
+'@every <duration>'.`,
+		Example:            `  schedule "*/5 * * * *" content list`,
+		Args:               cobra.MinimumNArgs(2),
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			e := errors.Template("schedule", errors.K.Invalid)
+			c, rest, err := cmd.Root().Find(args[1:])
+			if err != nil || c == cmd.Root() || c == cmd {
+				return errorCommandNotFound("schedule", args[1:])
+			}
+			if err = c.ParseFlags(rest); err != nil {
+				return e(err)
+			}
+			in, err := bflags.SetArgs(c, c.Flags().Args())
+			if err != nil {
+				return e(err)
+			}
+			if _, ok := bflags.GetCmdInput(c); !ok {
+				in = nil
+			}
+			return a.RunScheduled(args[0], strings.Fields(c.CommandPath()), in)
+		},
+	})
+}
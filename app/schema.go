@@ -0,0 +1,310 @@
+package app
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const (
+	schemaVersion = "https://json-schema.org/draft/2020-12/schema"
+	schemaCmdName = "schema"
+)
+
+// JSONSchema is the JSON Schema of the input of a command or of one of its
+// flags or args. Args are marked with their position in 'x-position'.
+type JSONSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Format      string                 `json:"format,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	AnyOf       []*JSONSchema          `json:"anyOf,omitempty"`
+	Properties  map[string]*JSONSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	Items       *JSONSchema            `json:"items,omitempty"`
+	MinItems    *int                   `json:"minItems,omitempty"`
+	MaxItems    *int                   `json:"maxItems,omitempty"`
+	Enum        []string               `json:"enum,omitempty"`
+	Default     interface{}            `json:"default,omitempty"`
+	Position    *int                   `json:"x-position,omitempty"`
+}
+
+// String returns the schema as indented JSON.
+func (s *JSONSchema) String() string {
+	bb, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(bb)
+}
+
+// Schemas returns the JSON Schemas of the inputs of the runnable commands of
+// the app, keyed by command path (e.g. "myapp content get"). The schema of a
+// command describes its bound flags and args: their type, usage, choices,
+// defaults and whether they are required. Hidden flags are omitted.
+//
+// Defaults are the values of the bound fields when Schemas is called, hence
+// Schemas is expected to be called before executing a command.
+func (a *App) Schemas() (map[string]*JSONSchema, error) {
+	root, err := a.Cobra()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]*JSONSchema)
+	var walk func(c *cobra.Command)
+	walk = func(c *cobra.Command) {
+		if c.Runnable() && c.Name() != schemaCmdName {
+			ret[c.CommandPath()] = CmdSchema(c)
+		}
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+	return ret, nil
+}
+
+// CmdSchema returns the JSON Schema of the input bound to the given command.
+func CmdSchema(c *cobra.Command) *JSONSchema {
+	ret := &JSONSchema{
+		Schema:      schemaVersion,
+		Title:       c.CommandPath(),
+		Description: c.Short,
+		Type:        "object",
+		Properties:  make(map[string]*JSONSchema),
+	}
+	flags, _ := bflags.GetCmdFlagSet(c)
+	for _, fb := range flags {
+		if fb.Hidden {
+			continue
+		}
+		name := string(fb.Name)
+		ret.Properties[name] = flagSchema(c.Flags().Lookup(name), fb)
+		if fb.Required {
+			ret.Required = append(ret.Required, name)
+		}
+	}
+	args, _ := bflags.GetCmdArgSet(c)
+	if args != nil {
+		for i, fb := range args.Flags {
+			name := string(fb.Name)
+			s := flagSchema(c.Flags().Lookup(name), fb)
+			pos := i
+			s.Position = &pos
+			ret.Properties[name] = s
+			if !fb.Optional && s.Default == nil {
+				ret.Required = append(ret.Required, name)
+			}
+		}
+	}
+	sort.Strings(ret.Required)
+	return ret
+}
+
+// flagSchema returns the schema of the given flag or arg.
+func flagSchema(f *pflag.Flag, fb *bflags.FlagBond) *JSONSchema {
+	s := &JSONSchema{Description: fb.Usage}
+	v := reflect.ValueOf(fb.Value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Ptr {
+		typeSchema(s, v.Type().Elem())
+	} else if v.IsValid() {
+		typeSchema(s, v.Type())
+		if !v.IsZero() {
+			s.Default = defaultValue(f, v)
+		}
+	} else {
+		s.Type = "string"
+	}
+	if len(fb.Choices) > 0 {
+		s.Enum = fb.Choices
+	}
+	return s
+}
+
+// durationPattern matches the durations parsed by time.ParseDuration.
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	ipType              = reflect.TypeOf(net.IP{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	pflagValueType      = reflect.TypeOf((*pflag.Value)(nil)).Elem()
+)
+
+// typeSchema sets the type of the schema s for the given type. Types that are
+// not natively mapped to JSON - custom flag values or text unmarshalers - are
+// strings.
+func typeSchema(s *JSONSchema, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if opt, ok := optionalType(t); ok {
+		t = opt
+	}
+	switch {
+	case t == durationType:
+		// Go durations, e.g. '1m30s', not the ISO 8601 durations of the
+		// 'duration' format
+		s.Type, s.Pattern = "string", durationPattern
+		return
+	case t == ipType:
+		s.Type = "string"
+		s.AnyOf = []*JSONSchema{{Format: "ipv4"}, {Format: "ipv6"}}
+		return
+	case reflect.PtrTo(t).Implements(pflagValueType),
+		reflect.PtrTo(t).Implements(textUnmarshalerType):
+		s.Type = "string"
+		return
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// arrays of bytes are hex-encoded
+			s.Type, s.Format = "string", "hex"
+			return
+		}
+		n := t.Len()
+		s.Type, s.MinItems, s.MaxItems = "array", &n, &n
+		s.Items = &JSONSchema{}
+		typeSchema(s.Items, t.Elem())
+	case reflect.Slice:
+		s.Type = "array"
+		s.Items = &JSONSchema{}
+		typeSchema(s.Items, t.Elem())
+	default:
+		s.Type = "string"
+	}
+}
+
+// optionalType returns the type of the value of a bflags.Optional.
+func optionalType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || !strings.HasPrefix(t.Name(), "Optional[") {
+		return nil, false
+	}
+	get, ok := t.MethodByName("Get")
+	if !ok || get.Type.NumOut() != 1 {
+		return nil, false
+	}
+	return get.Type.Out(0), true
+}
+
+// defaultValue returns the default value of a flag as a JSON value: native
+// values as is and other values as their string representation in the flag.
+func defaultValue(f *pflag.Flag, v reflect.Value) interface{} {
+	if v.Type() == durationType || v.Type() == ipType {
+		if f != nil {
+			return f.DefValue
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Convert(nativeType(v.Kind())).Interface()
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return v.Interface()
+		}
+	}
+	if f != nil {
+		return f.DefValue
+	}
+	return nil
+}
+
+// nativeType returns the unnamed type of the given basic kind, such that
+// defaults of named types (e.g. 'type level int') marshal as their native value.
+func nativeType(k reflect.Kind) reflect.Type {
+	switch k {
+	case reflect.Bool:
+		return reflect.TypeOf(false)
+	case reflect.String:
+		return reflect.TypeOf("")
+	case reflect.Float32, reflect.Float64:
+		return reflect.TypeOf(float64(0))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.TypeOf(uint64(0))
+	default:
+		return reflect.TypeOf(int64(0))
+	}
+}
+
+// WithSchemaCommand adds the built-in 'schema' command to the app if b is true.
+// The command prints the JSON Schema of the input of the given command - or of
+// all commands if none is given - see Schemas:
+//
+//	myapp schema content get
+func (a *App) WithSchemaCommand(b bool) *App {
+	a.schemaCmd = b
+	return a
+}
+
+// addSchemaCmd adds the 'schema' command to the root command if enabled and the
+// root has sub-commands but no command with that name.
+func (a *App) addSchemaCmd() {
+	if !a.schemaCmd || !a.root.HasSubCommands() {
+		return
+	}
+	for _, c := range a.root.Commands() {
+		if c.Name() == schemaCmdName {
+			return
+		}
+	}
+	a.root.AddCommand(a.newSchemaCmd())
+}
+
+// newSchemaCmd returns the 'schema' command printing the JSON Schema of the
+// input of the given command - or of all commands if none is given.
+func (a *App) newSchemaCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   schemaCmdName + " [command...]",
+		Short: "Print the JSON Schema of the input of a command",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var v interface{}
+			if len(args) == 0 {
+				schemas, err := a.Schemas()
+				if err != nil {
+					return err
+				}
+				v = schemas
+			} else {
+				c, rest, err := cmd.Root().Find(args)
+				if err != nil || len(rest) > 0 || c == cmd.Root() {
+					return errorCommandNotFound("schema", args)
+				}
+				v = CmdSchema(c)
+			}
+			bb, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				return errors.E("schema", errors.K.Invalid, err)
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), string(bb))
+			return err
+		},
+	}
+}
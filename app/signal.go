@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
+	"sync"
 	"syscall"
 
 	"github.com/eluv-io/log-go"
@@ -20,30 +22,74 @@ func init() {
 	stacktrace = make([]byte, 1024*1024)
 }
 
+// signalHooks are the functions called on exit signals - see
+// registerSignalHandler.
+var signalHooks = struct {
+	once  sync.Once
+	mu    sync.Mutex
+	next  int
+	hooks map[int]signalHook
+}{
+	hooks: make(map[int]signalHook),
+}
+
+type signalHook struct {
+	onExit    func()
+	dumpStack bool
+}
+
+// registerSignalHandler registers onExitFn to be called on exit signals, with
+// all goroutine stacktraces logged before if dumpStackOnExit is true. Signals
+// are trapped and the SIGQUIT stacktrace handler is registered once for the
+// process. The returned function unregisters onExitFn.
 func registerSignalHandler(onExitFn func(), dumpStackOnExit bool) func() {
-	ctx := context.Background()
-	// begin trapping signals
-	goodbye.Notify(ctx,
-		syscall.SIGKILL, 1,
-		syscall.SIGHUP, 0,
-		syscall.SIGINT, 0,
-		// syscall.SIGQUIT: 0, ==> separate handler below to print stacktrace
-		// syscall.SIGTERM, 0, ==> normal exit: don't interfere
-	)
-	// Register shutdown handler
-	goodbye.Register(func(ctx context.Context, sig os.Signal) {
-		log.Warn("unexpected shutdown", "signal", sig.String(), "signal#", fmt.Sprintf("%d", sig))
-		if dumpStackOnExit {
-			dumpAllStacktraces()
-		}
-		onExitFn()
-		log.Debug("shutdown hook completed")
-	})
+	signalHooks.once.Do(func() {
+		// begin trapping signals
+		goodbye.Notify(context.Background(),
+			syscall.SIGKILL, 1,
+			syscall.SIGHUP, 0,
+			syscall.SIGINT, 0,
+			// syscall.SIGQUIT: 0, ==> separate handler below to print stacktrace
+			// syscall.SIGTERM, 0, ==> normal exit: don't interfere
+		)
+		// Register shutdown handler
+		goodbye.Register(func(ctx context.Context, sig os.Signal) {
+			log.Warn("unexpected shutdown", "signal", sig.String(), "signal#", fmt.Sprintf("%d", sig))
+			signalHooks.mu.Lock()
+			ids := make([]int, 0, len(signalHooks.hooks))
+			for id := range signalHooks.hooks {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			hooks := make([]signalHook, 0, len(ids))
+			for _, id := range ids {
+				hooks = append(hooks, signalHooks.hooks[id])
+			}
+			signalHooks.mu.Unlock()
+			for _, h := range hooks {
+				if h.dumpStack {
+					dumpAllStacktraces()
+					break
+				}
+			}
+			for _, h := range hooks {
+				h.onExit()
+			}
+			log.Debug("shutdown hook completed")
+		})
 
-	registerStacktraceHandler()
+		registerStacktraceHandler()
+	})
 
+	signalHooks.mu.Lock()
+	defer signalHooks.mu.Unlock()
+	id := signalHooks.next
+	signalHooks.next++
+	signalHooks.hooks[id] = signalHook{onExit: onExitFn, dumpStack: dumpStackOnExit}
 	return func() {
-		goodbye.Exit(ctx, -1)
+		signalHooks.mu.Lock()
+		defer signalHooks.mu.Unlock()
+		delete(signalHooks.hooks, id)
 	}
 }
 
@@ -53,7 +99,7 @@ func registerStacktraceHandler() {
 	// Unfortunately, goodbye does not provide the possibility to continue
 	// execution after the handler has executed, hence we register it directly
 	// with the go runtime.
-	sigc := make(chan os.Signal)
+	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGQUIT)
 	go func() {
 		for sig := range sigc {
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"sort"
+)
+
+// UnmarshalJSON unmarshals the command from its canonical form, JCmd.
+func (c *Cmd) UnmarshalJSON(bb []byte) error {
+	j := &JCmd{}
+	err := json.Unmarshal(bb, j)
+	if err != nil {
+		return err
+	}
+	*c = *j.toCmd()
+	return nil
+}
+
+// UnmarshalJSON unmarshals the command. Numbers in inputs are kept as
+// json.Number in order to preserve their representation.
+func (j *JCmd) UnmarshalJSON(bb []byte) error {
+	type jcmd JCmd
+	dec := json.NewDecoder(bytes.NewReader(bb))
+	dec.UseNumber()
+	return dec.Decode((*jcmd)(j))
+}
+
+func (j *JCmd) toCmd() *Cmd {
+	return &Cmd{
+		Use:                        j.Use,
+		Extends:                    j.Extends,
+		Aliases:                    j.Aliases,
+		HiddenAliases:              j.HiddenAliases,
+		SuggestFor:                 j.SuggestFor,
+		Short:                      j.Short,
+		Long:                       j.Long,
+		Category:                   j.Category,
+		GroupID:                    j.GroupID,
+		Topic:                      j.Topic,
+		Example:                    j.Example,
+		SeeAlso:                    j.SeeAlso,
+		Roles:                      j.Roles,
+		RateLimit:                  j.RateLimit,
+		Templates:                  j.Templates,
+		ShellAlias:                 j.ShellAlias,
+		FanOut:                     j.FanOut,
+		Watch:                      j.Watch,
+		CopyInput:                  j.CopyInput,
+		ValidArgs:                  j.ValidArgs,
+		ValidArgsFunction:          CompletionFnWithName(j.ValidArgsFunction),
+		Args:                       j.Args,
+		ArgsValidatorName:          j.ArgsValidatorName,
+		ArgAliases:                 j.ArgAliases,
+		BashCompletionFunction:     j.BashCompletionFunction,
+		Deprecated:                 j.Deprecated,
+		Deprecation:                j.Deprecation,
+		Hidden:                     j.Hidden,
+		Annotations:                j.Annotations,
+		Version:                    j.Version,
+		PersistentPreRunE:          CobraFnWithName(j.PersistentPreRunE),
+		PreRunE:                    CobraFnWithName(j.PreRunE),
+		RunE:                       RunFnWithName(j.RunE),
+		PostRunE:                   CobraFnWithName(j.PostRunE),
+		PersistentPostRunE:         CobraFnWithName(j.PersistentPostRunE),
+		SilenceErrors:              j.SilenceErrors,
+		SilenceUsage:               j.SilenceUsage,
+		DisableFlagParsing:         j.DisableFlagParsing,
+		DisableAutoGenTag:          j.DisableAutoGenTag,
+		DisableFlagsInUseLine:      j.DisableFlagsInUseLine,
+		DisableSuggestions:         j.DisableSuggestions,
+		SuggestionsMinimumDistance: j.SuggestionsMinimumDistance,
+		TraverseChildren:           j.TraverseChildren,
+		CompletionOptions:          j.CompletionOptions,
+		FlagCompletions:            j.FlagCompletions,
+		ArgCompletions:             j.ArgCompletions,
+		InputCtor:                  j.InputCtor,
+		Input:                      j.Input,
+		SubCommands:                j.SubCommands,
+	}
+}
+
+// setApp sets the app to the command and its sub-commands.
+func (c *Cmd) setApp(a *App) {
+	c.app = a
+	for _, sub := range c.SubCommands {
+		sub.setApp(a)
+	}
+}
+
+// jsonInput returns the input constructor and the input of the command in
+// their canonical form:
+//   - an inline input object without input constructor is marshaled as
+//     default values of the constructor registered for its type
+//   - default values of an input constructor are marshaled as the input
+//     object they are decoded to
+//
+// Other functions are replaced by their Go name.
+func (c *Cmd) jsonInput() (string, interface{}) {
+	ctor, input := c.InputCtor, c.Input
+	ti := reflect.TypeOf(input)
+	if ti == nil {
+		return ctor, input
+	}
+	if ti.Kind() == reflect.Func {
+		return ctor, runtime.FuncForPC(reflect.ValueOf(input).Pointer()).Name()
+	}
+	if _, ok := input.(map[string]interface{}); ok && ctor != "" && c.app != nil {
+		if in, err := c.decodeInput(); err == nil {
+			return ctor, in
+		}
+	}
+	if ctor == "" && c.app != nil {
+		for _, name := range sortedNames(c.app.rt.inputs) {
+			if reflect.TypeOf(c.app.rt.inputs[name]()) == ti {
+				return name, input
+			}
+		}
+	}
+	return ctor, input
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// copyAnnotations returns a copy of the given annotations such that
+// annotations added to cobra commands are not reflected in the spec.
+func copyAnnotations(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
@@ -1,12 +1,20 @@
 package app_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/eluv-io/ecobra-go/app"
+	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/ecobra-go/params"
+	"github.com/eluv-io/errors-go"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
@@ -139,7 +147,7 @@ func TestCommandSerial(t *testing.T) {
 	fmt.Println(string(bb))
 }
 
-func ExampleLegacy() {
+func Example_legacy() {
 	root, err := initCmd()
 	if err != nil {
 		fmt.Println("error", err)
@@ -160,12 +168,12 @@ func ExampleLegacy() {
 
 }
 
-// ExampleCommandFromJson shows an app example built from a json definition: RT
+// Example_commandFromJson shows an app example built from a json definition: RT
 // functions are defined by their name in the json spec.
-// - see ExampleCommandWithStrings for example wit spec defined inline & RT
+// - see Example_commandWithStrings for example wit spec defined inline & RT
 //   function still defined by name
 // - see ExampleCommand for example with all RT function defined inline
-func ExampleCommandFromJson() {
+func Example_commandFromJson() {
 	rt, err := app.RtFunctions(cobraFns, inputs, runFns)
 	if err != nil {
 		fmt.Println("error", err)
@@ -195,10 +203,10 @@ func ExampleCommandFromJson() {
 
 }
 
-// same as ExampleCommandFromJson but the spec is defined inline in code
+// same as Example_commandFromJson but the spec is defined inline in code
 // RT functions are still defined by name
 // see ExampleCommand for example with all RT function defined inline
-func ExampleCommandWithStrings() {
+func Example_commandWithStrings() {
 	rt, err := app.RtFunctions(cobraFns, inputs, runFns)
 	if err != nil {
 		fmt.Println("error", err)
@@ -254,7 +262,7 @@ func ExampleCommandWithStrings() {
 	// cleanup
 }
 
-// same as ExampleCommandWithStrings but no RT functions are used: they're all
+// same as Example_commandWithStrings but no RT functions are used: they're all
 // defined inline in code.
 func ExampleCommand() {
 	spec := app.NewSpec(
@@ -439,3 +447,464 @@ func TestMarshallSpec(t *testing.T) {
 	require.NoError(t, err)
 	fmt.Println(string(s))
 }
+
+type completeInput struct {
+	Name     string `cmd:"arg" json:"name"`
+	Greeting string
+	calls    []string
+}
+
+func (c *completeInput) Normalize() error {
+	c.calls = append(c.calls, "normalize")
+	c.Name = strings.TrimSpace(c.Name)
+	return nil
+}
+
+func (c *completeInput) Complete(ctx *app.CmdCtx) error {
+	c.calls = append(c.calls, "complete")
+	prefix, _ := ctx.Get("prefix")
+	c.Greeting = fmt.Sprintf("%v %s", prefix, c.Name)
+	return nil
+}
+
+func (c *completeInput) Validate() error {
+	c.calls = append(c.calls, "validate")
+	if c.Name == "" {
+		return fmt.Errorf("empty name")
+	}
+	return nil
+}
+
+func TestInputLifecycle(t *testing.T) {
+	in := &completeInput{}
+	var greeting string
+	spec := app.NewSpec(
+		nil,
+		&app.Cmd{
+			Use:           "cli",
+			SilenceErrors: true,
+			SilenceUsage:  true,
+			SubCommands: []*app.Cmd{
+				{
+					Use: "greet",
+					RunE: app.RunFn(func(ctx *app.CmdCtx, in *completeInput) error {
+						in.calls = append(in.calls, "run")
+						greeting = in.Greeting
+						return nil
+					}),
+					Input: in,
+				},
+			},
+		})
+	a, err := app.NewApp(spec, nil)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	ctx := app.NewCmdCtx()
+	ctx.Set("prefix", "hello")
+	bflags.SetCmdCtx(root, ctx)
+
+	root.SetArgs([]string{"greet", " bob "})
+	err = root.Execute()
+	require.NoError(t, err)
+	require.Equal(t, "hello bob", greeting)
+	require.Equal(t, []string{"normalize", "complete", "validate", "run"}, in.calls)
+
+	root, err = a.NewCobra()
+	require.NoError(t, err)
+	root.SetArgs([]string{"greet", " "})
+	err = root.Execute()
+	require.Error(t, err)
+}
+
+type InputCompletion struct {
+	Qfab string   `cmd:"flag,qfab,the fabric url"`
+	Id   string   `cmd:"arg,id,content id,0"`
+	Keys []string `cmd:"arg,keys,keys,1"`
+}
+
+func TestCompletions(t *testing.T) {
+	jspec := `{
+	"cmd_root": {
+		"use": "cli ",
+		"sub_commands": [{
+			"use": "get <id> <keys>",
+			"run_e": "get",
+			"input_ctor": "completion",
+			"flag_completions": {"qfab": "urls"},
+			"arg_completions": {"id": "ids", "keys": "keys"}
+		}]
+	}
+}`
+	complete := func(values ...string) app.CompletionFn {
+		return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return values, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	rt, err := app.RtFunctions(
+		nil,
+		map[string]app.Ctor{"completion": func() interface{} { return &InputCompletion{} }},
+		map[string]app.Runfn{"get": func(ctx *app.CmdCtx, in *InputCompletion) error { return nil }})
+	require.NoError(t, err)
+	rt.WithCompletions(map[string]app.CompletionFn{
+		"urls": complete("http://a", "http://b"),
+		"ids":  complete("iq__1", "iq__2"),
+		"keys": complete("k1"),
+	})
+
+	a, err := app.NewAppFromSpec(jspec, rt)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+
+	run := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Contains(t, run("get", "--qfab", ""), "http://a\nhttp://b\n")
+	require.Contains(t, run("get", ""), "iq__1\niq__2\n")
+	require.Contains(t, run("get", "iq__1", ""), "k1\n")
+	require.Contains(t, run("get", "iq__1", "k1", ""), "k1\n")
+
+	bb, err := json.Marshal(a.Spec())
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"arg_completions":{"id":"ids","keys":"keys"}`)
+
+	// unknown completion function
+	rt, err = app.RtFunctions(nil,
+		map[string]app.Ctor{"completion": func() interface{} { return &InputCompletion{} }},
+		nil)
+	require.NoError(t, err)
+	a, err = app.NewAppFromSpec(jspec, rt)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, app.ErrFunctionNotFound), err)
+}
+
+func TestValidArgsFunction(t *testing.T) {
+	jspec := `{
+	"cmd_root": {
+		"use": "cli ",
+		"sub_commands": [{
+			"use": "get <id> <keys>",
+			"run_e": "get",
+			"input_ctor": "completion",
+			"valid_args_function": "ids",
+			"arg_completions": {"keys": "keys"}
+		}]
+	}
+}`
+	complete := func(values ...string) app.CompletionFn {
+		return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return values, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	rt, err := app.RtFunctions(
+		nil,
+		map[string]app.Ctor{"completion": func() interface{} { return &InputCompletion{} }},
+		map[string]app.Runfn{"get": func(ctx *app.CmdCtx, in *InputCompletion) error { return nil }})
+	require.NoError(t, err)
+	rt.WithCompletions(map[string]app.CompletionFn{
+		"ids":  complete("iq__1", "iq__2"),
+		"keys": complete("k1"),
+	})
+
+	run := func(root *cobra.Command, args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+
+	a, err := app.NewAppFromSpec(jspec, rt)
+	require.NoError(t, err)
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	require.Contains(t, run(root, "get", ""), "iq__1\niq__2\n") // valid args function
+	require.Contains(t, run(root, "get", "iq__1", ""), "k1\n")  // arg completion
+	require.Equal(t, "ids", a.Spec().CmdRoot.SubCommands[0].ValidArgsFunction.String())
+
+	// inline function
+	a, err = app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use: "cli",
+		SubCommands: []*app.Cmd{{
+			Use:               "get",
+			RunE:              app.RunFn(func(ctx *app.CmdCtx, in *InputCompletion) error { return nil }),
+			Input:             &InputCompletion{},
+			ValidArgsFunction: app.CompletionFnOf(complete("inline")),
+		}},
+	}), nil)
+	require.NoError(t, err)
+	root, err = a.Cobra()
+	require.NoError(t, err)
+	require.Contains(t, run(root, "get", ""), "inline\n")
+}
+
+func TestSpecRoundTrip(t *testing.T) {
+	rt, err := app.RtFunctions(cobraFns, inputs, runFns)
+	require.NoError(t, err)
+
+	roundTrip := func(a *app.App) string {
+		_, err := a.Cobra()
+		require.NoError(t, err)
+		s := a.Spec().String()
+		a2, err := app.NewAppFromSpec(s, rt)
+		require.NoError(t, err)
+		_, err = a2.Cobra()
+		require.NoError(t, err)
+		require.Equal(t, s, a2.Spec().String())
+		return s
+	}
+
+	a, err := app.NewAppFromSpec(appSample, rt)
+	require.NoError(t, err)
+	s := roundTrip(a)
+	require.Contains(t, s, `"input": {
+          "my_value": "xyz"
+        }`)
+
+	// functions referenced by name and inline inputs registered in the runtime
+	// are marshaled by name
+	a, err = app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use:               "cli",
+		PersistentPreRunE: app.CobraFnWithName("initializeSample"),
+		SubCommands: []*app.Cmd{{
+			Use:         "sample",
+			Category:    "tools",
+			Annotations: map[string]string{"key": "value"},
+			RunE:        app.RunFnWithName("execSample"),
+			Input:       &InputSample{MyValue: "xyz"},
+		}},
+	}), rt)
+	require.NoError(t, err)
+	s = roundTrip(a)
+	require.Contains(t, s, `"persistent_pre_run_e": "initializeSample"`)
+	require.Contains(t, s, `"run_e": "execSample"`)
+	require.Contains(t, s, `"input_ctor": "sample"`)
+	// annotations of cobra commands are not reflected in the spec
+	require.Contains(t, s, `"annotations": {
+          "key": "value"
+        },`)
+
+	// functions given as values are marshaled with their Go name, even if
+	// registered: closures of the same function literal can't be told apart
+	greet := func(greeting string) func(ctx *app.CmdCtx) error {
+		return func(ctx *app.CmdCtx) error { return errors.Str(greeting) }
+	}
+	hello, bye := greet("hello"), greet("bye")
+	rt, err = app.RtFunctions(nil, nil, map[string]app.Runfn{"hello": hello, "bye": bye})
+	require.NoError(t, err)
+	a, err = app.NewApp(app.NewSpec(nil, &app.Cmd{
+		Use: "cli",
+		SubCommands: []*app.Cmd{
+			{Use: "hello", RunE: app.RunFn(hello)},
+			{Use: "bye", RunE: app.RunFnWithName("bye")},
+		},
+	}), rt)
+	require.NoError(t, err)
+	_, err = a.Cobra()
+	require.NoError(t, err)
+	s = a.Spec().String()
+	require.Contains(t, s, `"run_e": "github.com/eluv-io/ecobra-go/app_test.TestSpecRoundTrip.func`)
+	require.Contains(t, s, `"run_e": "bye"`)
+	require.NotContains(t, s, `"run_e": "hello"`)
+}
+
+func TestRegisterInput(t *testing.T) {
+	rt, err := app.RtFunctions(cobraFns, nil, runFns)
+	require.NoError(t, err)
+	app.RegisterInput[InputSample](rt, "sample")
+
+	a, err := app.NewAppFromSpec(appSample, rt)
+	require.NoError(t, err)
+	cmd, err := a.Command("cli", "sample")
+	require.NoError(t, err)
+	cmd.Input = `{"my_value": "from json"}`
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	sample, _, err := root.Find([]string{"sample"})
+	require.NoError(t, err)
+	in, ok := bflags.GetCmdInput(sample)
+	require.True(t, ok)
+	require.Equal(t, &InputSample{MyValue: "from json"}, in)
+
+	_, err = app.NewAppFromSpec(strings.Replace(appSample, `"input_ctor": "sample"`, `"input_ctor": "unknown"`, 1), rt)
+	require.True(t, errors.Is(err, app.ErrFunctionNotFound), err)
+	require.Equal(t, "cli sample", errors.Field(err, "commands"))
+}
+
+type richInput struct {
+	Addr    net.IP          `cmd:"flag" json:"addr"`
+	Timeout time.Duration   `cmd:"flag" json:"timeout"`
+	Meta    params.Json     `cmd:"flag" json:"meta"`
+	Config  params.FilePath `json:"config"`
+	Count   int8            `cmd:"flag" json:"count"`
+	Custom  string          `cmd:"flag" json:"custom"`
+}
+
+func TestDecodeHooks(t *testing.T) {
+	rt, err := app.RtFunctions(nil, nil, nil)
+	require.NoError(t, err)
+	app.RegisterInput[richInput](rt, "rich")
+	rt.WithDecodeHooks(func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if s, ok := data.(string); ok && to.Kind() == reflect.String {
+			return strings.ReplaceAll(s, "$HOST", "localhost"), nil
+		}
+		return data, nil
+	})
+
+	newInput := func(input string) (*richInput, error) {
+		a, err := app.NewAppFromSpec(`{"cmd_root": {"use": "cli", "input_ctor": "rich", "input": `+input+`}}`, rt)
+		require.NoError(t, err)
+		root, err := a.Cobra()
+		if err != nil {
+			return nil, err
+		}
+		in, _ := bflags.GetCmdInput(root)
+		return in.(*richInput), nil
+	}
+
+	in, err := newInput(`{
+		"addr": "10.0.0.1",
+		"timeout": "1m30s",
+		"meta": {"a": [1, 2]},
+		"config": "~/cfg.json",
+		"count": 12,
+		"custom": "http://$HOST:8008"
+	}`)
+	require.NoError(t, err)
+	require.Equal(t, &richInput{
+		Addr:    net.ParseIP("10.0.0.1"),
+		Timeout: 90 * time.Second,
+		Meta:    `{"a":[1,2]}`,
+		Config:  "~/cfg.json",
+		Count:   12,
+		Custom:  "http://localhost:8008",
+	}, in)
+
+	_, err = newInput(`{"count": 1.5}`)
+	require.ErrorContains(t, err, "not a valid integer")
+	_, err = newInput(`{"count": 300}`)
+	require.ErrorContains(t, err, "not a valid integer")
+}
+
+func TestUnknownInputKeys(t *testing.T) {
+	rt, err := app.RtFunctions(cobraFns, inputs, runFns)
+	require.NoError(t, err)
+
+	_, err = app.NewAppFromSpec(strings.Replace(appSample, `"my_value": "xyz"`, `"my_valu": "xyz", "other": 1`, 1), rt)
+	require.True(t, errors.Is(err, app.ErrInvalidSpec), err)
+	require.Equal(t, "cli sample", errors.Field(err, "command"))
+	require.Equal(t, "my_valu, other", errors.Field(err, "keys"))
+
+	a, err := app.NewAppFromSpec(appSample, rt)
+	require.NoError(t, err)
+	cmd, err := a.Command("cli", "sample")
+	require.NoError(t, err)
+	cmd.Input = map[string]interface{}{"my_value": "abc", "unknown": true}
+	_, err = a.Cobra()
+	require.True(t, errors.Is(err, app.ErrInvalidSpec), err)
+	require.Equal(t, "unknown", errors.Field(err, "keys"))
+}
+
+type schemaInput struct {
+	Format  string        `cmd:"flag,format,output format,f" choices:"json,text"`
+	Limit   int           `cmd:"flag,limit,max count"`
+	Timeout time.Duration `cmd:"flag,timeout,request timeout"`
+	Tags    []string      `cmd:"flag,tags,some tags"`
+	Secret  bool          `cmd:"flag,secret,hidden flag,,false,false,true"`
+	ID      string        `cmd:"arg,id,content id,0"`
+	Path    string        `cmd:"arg,path,a path,1,true"`
+}
+
+func TestSchemas(t *testing.T) {
+	rt, err := app.RtFunctions(nil,
+		map[string]app.Ctor{"schema": func() interface{} { return &schemaInput{Format: "json", Limit: 10} }},
+		map[string]app.Runfn{"get": func(*app.CmdCtx, *schemaInput) error { return nil }})
+	require.NoError(t, err)
+	a, err := app.NewAppFromSpec(`{
+	"cmd_root": {
+		"use": "cli",
+		"sub_commands": [
+			{"use": "get", "short": "get content", "input_ctor": "schema", "run_e": "get"}
+		]
+	}
+}`, rt)
+	require.NoError(t, err)
+
+	schemas, err := a.Schemas()
+	require.NoError(t, err)
+	require.Len(t, schemas, 1)
+	require.Equal(t, `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "cli get",
+  "description": "get content",
+  "type": "object",
+  "properties": {
+    "format": {
+      "description": "output format",
+      "type": "string",
+      "enum": [
+        "json",
+        "text"
+      ],
+      "default": "json"
+    },
+    "id": {
+      "description": "content id",
+      "type": "string",
+      "x-position": 0
+    },
+    "limit": {
+      "description": "max count",
+      "type": "integer",
+      "default": 10
+    },
+    "path": {
+      "description": "a path",
+      "type": "string",
+      "x-position": 1
+    },
+    "tags": {
+      "description": "some tags",
+      "type": "array",
+      "items": {
+        "type": "string"
+      }
+    },
+    "timeout": {
+      "description": "request timeout",
+      "type": "string",
+      "pattern": "^[-+]?(0|(([0-9]+(\\.[0-9]*)?|\\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$"
+    }
+  },
+  "required": [
+    "id"
+  ]
+}`, schemas["cli get"].String())
+
+	// the schema command is opt-in
+	root, err := a.Cobra()
+	require.NoError(t, err)
+	_, _, err = root.Find([]string{"schema"})
+	require.Error(t, err)
+
+	root, err = a.WithSchemaCommand(true).NewCobra()
+	require.NoError(t, err)
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	root.SetOut(out)
+	root.SetErr(errOut)
+	root.SetArgs([]string{"schema", "get"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, schemas["cli get"].String()+"\n", out.String())
+	require.Empty(t, errOut.String())
+
+	root.SetArgs([]string{"schema", "unknown"})
+	require.True(t, errors.Is(root.Execute(), app.ErrCommandNotFound))
+}
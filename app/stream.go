@@ -0,0 +1,160 @@
+package app
+
+import (
+	"reflect"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// EmitFn receives the items emitted by run functions with CmdCtx.Emit.
+type EmitFn func(item interface{}) error
+
+// StreamOutput is the output passed to the CommandEnd and lifecycle functions
+// for commands streaming their output - see CmdCtx.Emit: streamed items are
+// not retained.
+type StreamOutput struct {
+	Items int // number of items streamed
+}
+
+// Emit prints the given item of the output of the command incrementally,
+// through the output format selected with --format if output is enabled - see
+// App.WithOutput. List-style commands over large datasets emit their items
+// instead of returning them all at once. Alternatively, run functions may
+// return a receive-only channel of items.
+//
+// Items are printed one at a time: JSON items as separate documents and table
+// items as rows of a single table whose columns are set by the first item. The
+// --query flag applies to each item. With --diff-against, items are collected
+// and compared to the saved result as a list.
+func (c *CmdCtx) Emit(item interface{}) error {
+	if v, ok := c.Get(CtxEmitFn); ok {
+		if fn, ok := v.(EmitFn); ok {
+			return fn(item)
+		}
+	}
+	return errors.E("Emit", errors.K.NotImplemented, "reason", "emit function not set")
+}
+
+// streamPrinter prints the items streamed by a command as they arrive.
+type streamPrinter struct {
+	a      *App
+	cmd    *cobra.Command
+	setup  bool
+	format OutputFormat
+	table  *tableStream
+	q      *query
+	diff   bool
+	items  []interface{} // items collected with --diff-against
+	count  int           // number of items streamed
+}
+
+func (a *App) newStreamPrinter(cmd *cobra.Command) *streamPrinter {
+	return &streamPrinter{a: a, cmd: cmd}
+}
+
+// init sets up the printer from the output flags of the command.
+func (p *streamPrinter) init() error {
+	if p.setup {
+		return nil
+	}
+	p.setup = true
+	format := outputFlag(p.cmd, formatFlag)
+	switch format {
+	case tableFormatName, wideFormatName:
+		if _, custom := p.a.outputFormats[format]; !custom {
+			p.table = &tableStream{wide: format == wideFormatName}
+		}
+	}
+	if p.table == nil {
+		f, err := p.a.outputFormat(format)
+		if err != nil {
+			return err
+		}
+		p.format = f
+	}
+	if expr := outputFlag(p.cmd, queryFlag); expr != "" {
+		q, err := parseQuery(expr)
+		if err != nil {
+			return err
+		}
+		p.q = q
+	}
+	p.diff = outputFlag(p.cmd, diffAgainstFlag) != ""
+	return nil
+}
+
+// print prints the given item.
+func (p *streamPrinter) print(item interface{}) error {
+	p.count++
+	if !p.a.output {
+		return nil
+	}
+	if err := p.init(); err != nil {
+		return err
+	}
+	if p.diff {
+		p.items = append(p.items, item)
+		return nil
+	}
+	if p.q != nil {
+		v, err := p.q.eval(item)
+		if errors.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		item = v
+	}
+	w := p.cmd.OutOrStdout()
+	if p.table != nil {
+		return p.table.write(w, p.cmd, item)
+	}
+	return p.format(w, p.cmd, item)
+}
+
+// output returns the output of the command once its items were streamed: the
+// output returned by the run function if any, the collected items with
+// --diff-against or a StreamOutput.
+func (p *streamPrinter) output(out interface{}) interface{} {
+	switch {
+	case out != nil:
+		return out
+	case p.diff:
+		if p.items == nil {
+			return []interface{}{}
+		}
+		return p.items
+	case p.count > 0:
+		return &StreamOutput{Items: p.count}
+	}
+	return nil
+}
+
+// streamChannel prints the items received from the given output if it is a
+// channel until it is closed, and returns the output of the command - see
+// streamPrinter.output. Other outputs are returned as is.
+func (p *streamPrinter) streamChannel(out interface{}) (interface{}, error) {
+	ch := reflect.ValueOf(out)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return p.output(out), nil
+	}
+	if ch.IsNil() {
+		return p.output(nil), nil
+	}
+	for {
+		item, ok := ch.Recv()
+		if !ok {
+			break
+		}
+		if err := p.print(item.Interface()); err != nil {
+			// don't block the producer
+			go func() {
+				for _, ok := ch.Recv(); ok; _, ok = ch.Recv() {
+				}
+			}()
+			return nil, err
+		}
+	}
+	return p.output(nil), nil
+}
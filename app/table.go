@@ -0,0 +1,393 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	tableFormatName = "table"
+	wideFormatName  = "wide"
+	noHeadersFlag   = "no-headers"
+	columnsFlag     = "columns"
+	columnSeparator = "   "
+)
+
+// tableColumn is a column of a table.
+type tableColumn struct {
+	header string
+	names  []string // names selecting the column with --columns
+	index  []int    // index of the field in structs
+	key    string   // key in maps
+	width  int      // max width of cells - not truncated if 0
+	right  bool     // right aligned
+}
+
+// formatTable returns the output format rendering outputs - slices of structs
+// or of maps, or a single struct - as tables with one row per element. Cells are
+// truncated to the width of their column unless wide is true.
+//
+// The columns of structs are defined by their `table:"header,width,align"`
+// field tags, e.g.
+//
+//	Name string `table:"NAME,20"`
+//	Size int64  `table:"SIZE,,right"`
+//
+// where the width and align ('left' or 'right') are optional. Fields tagged with
+// `table:"-"` are skipped. Structs without table tags show all their exported
+// fields - except those tagged with `json:"-"` - with the upper-case JSON name of
+// the field as header.
+func formatTable(wide bool) OutputFormat {
+	return func(w io.Writer, cmd *cobra.Command, out interface{}) error {
+		rows := tableRows(out)
+		cols, err := commandColumns(cmd, rows)
+		if err != nil {
+			return err
+		}
+		lines := tableLines(cols, rows, wide)
+		headers := outputFlag(cmd, noHeadersFlag) != "true"
+		if headers {
+			lines = append([][]string{headerLine(cols)}, lines...)
+		}
+		return writeTable(w, cols, lines, headers && useColor(cmd, cmd.OutOrStdout()))
+	}
+}
+
+// tableRows returns the rows of the given output: the output itself if it is a
+// slice or an array, a slice with the output as single element otherwise.
+func tableRows(out interface{}) reflect.Value {
+	rows := reflect.ValueOf(out)
+	for rows.Kind() == reflect.Ptr || rows.Kind() == reflect.Interface {
+		if rows.IsNil() {
+			// no rows: the table has the columns of the type only
+			return reflect.MakeSlice(reflect.SliceOf(rows.Type()), 0, 0)
+		}
+		rows = rows.Elem()
+	}
+	if rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array {
+		one := reflect.MakeSlice(reflect.SliceOf(rows.Type()), 1, 1)
+		one.Index(0).Set(rows)
+		rows = one
+	}
+	return rows
+}
+
+// commandColumns returns the columns of the table of the given rows, as
+// selected with the --columns flag of the command.
+func commandColumns(cmd *cobra.Command, rows reflect.Value) ([]*tableColumn, error) {
+	cols, err := tableColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	return selectColumns(cols, outputFlag(cmd, columnsFlag))
+}
+
+func headerLine(cols []*tableColumn) []string {
+	line := make([]string, len(cols))
+	for i, c := range cols {
+		line[i] = c.header
+	}
+	return line
+}
+
+// tableLines returns the cells of the given rows.
+func tableLines(cols []*tableColumn, rows reflect.Value, wide bool) [][]string {
+	lines := make([][]string, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		line := make([]string, len(cols))
+		for j, c := range cols {
+			line[j] = c.cell(rows.Index(i), wide)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// tableStream writes the items streamed by a command as the rows of a table.
+// The columns and their widths are those of the first item: cells of later
+// items that are wider than their column are not aligned.
+type tableStream struct {
+	wide   bool
+	cols   []*tableColumn
+	widths []int
+}
+
+// write writes the row of the given item, preceded by the headers for the
+// first item.
+func (t *tableStream) write(w io.Writer, cmd *cobra.Command, item interface{}) error {
+	rows := tableRows(item)
+	if t.cols != nil {
+		return writeLines(w, t.cols, t.widths, tableLines(t.cols, rows, t.wide), false)
+	}
+	cols, err := commandColumns(cmd, rows)
+	if err != nil {
+		return err
+	}
+	lines := tableLines(cols, rows, t.wide)
+	headers := outputFlag(cmd, noHeadersFlag) != "true"
+	if headers {
+		lines = append([][]string{headerLine(cols)}, lines...)
+	}
+	t.cols = cols
+	t.widths = lineWidths(cols, lines)
+	if !t.wide {
+		// reserve the width of truncated columns
+		for i, c := range cols {
+			if c.width > t.widths[i] {
+				t.widths[i] = c.width
+			}
+		}
+	}
+	return writeLines(w, cols, t.widths, lines, headers && useColor(cmd, cmd.OutOrStdout()))
+}
+
+// tableColumns returns the columns of the table of the given rows.
+func tableColumns(rows reflect.Value) ([]*tableColumn, error) {
+	elem := rows.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Struct:
+		cols, tagged := structColumns(elem, nil)
+		if tagged {
+			ret := cols[:0]
+			for _, c := range cols {
+				if c.width >= 0 {
+					ret = append(ret, c)
+				}
+			}
+			cols = ret
+		}
+		for _, c := range cols {
+			if c.width < 0 {
+				c.width = 0
+			}
+		}
+		return cols, nil
+	case reflect.Map, reflect.Interface:
+		return mapColumns(rows)
+	}
+	return nil, errors.E("tableColumns", errors.K.Invalid, ErrInvalidFormat, "reason", "output is not a list of structs or maps", "type", elem.String())
+}
+
+// structColumns returns the columns of the exported fields of the given struct
+// type and whether any field has a table tag. Untagged fields have a negative
+// width.
+func structColumns(typ reflect.Type, index []int) ([]*tableColumn, bool) {
+	var ret []*tableColumn
+	tagged := false
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		idx := append(append([]int{}, index...), i)
+		tag, hasTag := f.Tag.Lookup("table")
+		if tag == "-" || !f.IsExported() || (!hasTag && f.Tag.Get("json") == "-") {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && !hasTag {
+			cols, t := structColumns(f.Type, idx)
+			ret = append(ret, cols...)
+			tagged = tagged || t
+			continue
+		}
+		name := f.Name
+		if j, ok := f.Tag.Lookup("json"); ok {
+			if j = strings.Split(j, ",")[0]; j != "" && j != "-" {
+				name = j
+			}
+		}
+		c := &tableColumn{
+			header: strings.ToUpper(name),
+			names:  []string{name, f.Name},
+			index:  idx,
+			width:  -1,
+		}
+		if hasTag {
+			tagged = true
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				c.header = parts[0]
+			}
+			c.width = 0
+			if len(parts) > 1 && parts[1] != "" {
+				c.width, _ = strconv.Atoi(parts[1])
+			}
+			c.right = len(parts) > 2 && parts[2] == "right"
+		}
+		ret = append(ret, c)
+	}
+	return ret, tagged
+}
+
+// mapColumns returns the columns of the keys of the maps of the given rows,
+// ordered by key.
+func mapColumns(rows reflect.Value) ([]*tableColumn, error) {
+	keys := make(map[string]bool)
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+			row = row.Elem()
+		}
+		if !row.IsValid() {
+			continue
+		}
+		if row.Kind() != reflect.Map || row.Type().Key().Kind() != reflect.String {
+			return nil, errors.E("tableColumns", errors.K.Invalid, ErrInvalidFormat, "reason", "output is not a list of structs or maps")
+		}
+		for _, k := range row.MapKeys() {
+			keys[k.String()] = true
+		}
+	}
+	ret := make([]*tableColumn, 0, len(keys))
+	for k := range keys {
+		ret = append(ret, &tableColumn{header: strings.ToUpper(k), names: []string{k}, key: k})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].key < ret[j].key })
+	return ret, nil
+}
+
+// selectColumns returns the columns with the given comma-separated names - the
+// header, the JSON name or the field name, case insensitive - in the given
+// order, or all columns if names is empty.
+func selectColumns(cols []*tableColumn, names string) ([]*tableColumn, error) {
+	if names == "" {
+		return cols, nil
+	}
+	var ret []*tableColumn
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range cols {
+			if c.matches(name) {
+				ret = append(ret, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.E("selectColumns", errors.K.Invalid, ErrInvalidFormat, "reason", "unknown column", "column", name)
+		}
+	}
+	return ret, nil
+}
+
+func (c *tableColumn) matches(name string) bool {
+	if strings.EqualFold(c.header, name) {
+		return true
+	}
+	for _, n := range c.names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cell returns the content of the cell of the column in the given row.
+func (c *tableColumn) cell(row reflect.Value, wide bool) string {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		if row.IsNil() {
+			return ""
+		}
+		row = row.Elem()
+	}
+	var v reflect.Value
+	if c.key != "" {
+		v = row.MapIndex(reflect.ValueOf(c.key))
+	} else {
+		fv, err := row.FieldByIndexErr(c.index)
+		if err != nil {
+			return ""
+		}
+		v = fv
+	}
+	s := cellString(v)
+	if !wide && c.width > 0 && utf8.RuneCountInString(s) > c.width {
+		runes := []rune(s)
+		s = string(runes[:c.width-1]) + "…"
+	}
+	return s
+}
+
+// cellString returns the string representation of the given value: composite
+// values are represented as compact JSON.
+func cellString(v reflect.Value) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		bb, err := json.Marshal(v.Interface())
+		if err == nil {
+			return string(bb)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// writeTable writes the given lines with cells aligned in columns. The first
+// line is in bold if boldFirst is true.
+func writeTable(w io.Writer, cols []*tableColumn, lines [][]string, boldFirst bool) error {
+	return writeLines(w, cols, lineWidths(cols, lines), lines, boldFirst)
+}
+
+// lineWidths returns the widths of the columns of the given lines.
+func lineWidths(cols []*tableColumn, lines [][]string) []int {
+	widths := make([]int, len(cols))
+	for _, line := range lines {
+		for i, s := range line {
+			if n := utf8.RuneCountInString(s); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	return widths
+}
+
+// writeLines writes the given lines with cells padded to the given widths.
+func writeLines(w io.Writer, cols []*tableColumn, widths []int, lines [][]string, boldFirst bool) error {
+	sb := &strings.Builder{}
+	for n, line := range lines {
+		row := &strings.Builder{}
+		for i, s := range line {
+			if i > 0 {
+				row.WriteString(columnSeparator)
+			}
+			pad := ""
+			if n := widths[i] - utf8.RuneCountInString(s); n > 0 {
+				pad = strings.Repeat(" ", n)
+			}
+			if cols[i].right {
+				row.WriteString(pad + s)
+			} else {
+				row.WriteString(s + pad)
+			}
+		}
+		text := strings.TrimRight(row.String(), " ")
+		if n == 0 && boldFirst {
+			text = colorize(text, ansiBold)
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
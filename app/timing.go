@@ -0,0 +1,34 @@
+package app
+
+import (
+	"time"
+)
+
+// Phase is a phase of the execution of a command.
+type Phase string
+
+const (
+	PhaseBind  Phase = "bind"  // creation of the cobra commands and binding of their inputs
+	PhaseParse Phase = "parse" // parsing of the command line and setup of the input, up to the run function
+	PhaseRun   Phase = "run"   // the run function of the command
+)
+
+// PhaseTimer receives the duration of the phases of the execution of commands.
+type PhaseTimer func(phase Phase, d time.Duration)
+
+// WithPhaseTimer sets a timer notified of the duration of each phase of the
+// execution of commands:
+//   - PhaseBind when the cobra commands are created (see Cobra and NewCobra)
+//   - PhaseParse and PhaseRun for each command run with Execute. The parse
+//     phase is not timed for commands run by executing the cobra command
+//     directly.
+func (a *App) WithPhaseTimer(t PhaseTimer) *App {
+	a.phaseTimer = t
+	return a
+}
+
+func (a *App) timePhase(phase Phase, start time.Time) {
+	if a.phaseTimer != nil && !start.IsZero() {
+		a.phaseTimer(phase, time.Since(start))
+	}
+}
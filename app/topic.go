@@ -0,0 +1,106 @@
+package app
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	topicKey = "app_topic" // key for commands annotation
+)
+
+// isTopic returns true if the given command is a help topic.
+func isTopic(c *cobra.Command) bool {
+	return c.Annotations[topicKey] == "true" || c.IsAdditionalHelpTopicCommand()
+}
+
+// configureTopic configures the given command as a help topic: its Long
+// description is rendered through the pager by the help command, e.g.
+//
+//	myapp help auth-model
+func configureTopic(c *cobra.Command) {
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	c.Annotations[topicKey] = "true"
+	c.SetHelpFunc(func(cmd *cobra.Command, _ []string) {
+		text := cmd.Long
+		if text == "" {
+			text = cmd.Short
+		}
+		page(cmd.OutOrStdout(), renderTopic(text, useColor(cmd, cmd.OutOrStdout())), false)
+	})
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[*+-]\s+(.*)$`)
+	mdInline  = strings.NewReplacer("**", "", "__", "", "`", "")
+)
+
+// renderTopic renders the markdown-ish text of a help topic for the terminal:
+// headings are underlined - and in bold if color is true - bullets are
+// normalized and emphasis and code markers are removed.
+func renderTopic(text string, color bool) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			title := mdInline.Replace(m[2])
+			underline := "-"
+			if len(m[1]) == 1 {
+				title = strings.ToUpper(title)
+				underline = "="
+			}
+			rule := strings.Repeat(underline, len(title))
+			if color {
+				title = colorize(title, ansiBold)
+			}
+			out = append(out, title, rule)
+			continue
+		}
+		if m := mdBullet.FindStringSubmatch(line); m != nil {
+			out = append(out, m[1]+"  • "+mdInline.Replace(m[2]))
+			continue
+		}
+		out = append(out, mdInline.Replace(line))
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// page writes text to w through the pager defined by the PAGER environment
+// variable - 'less -R' by default - if w is a terminal. The text is written
+// directly to w otherwise or if the pager cannot be started. With
+// quitIfOneScreen, less exits right away when the text fits on the screen -
+// unless the LESS environment variable is set.
+func page(w io.Writer, text string, quitIfOneScreen bool) {
+	if f, ok := w.(*os.File); ok && isTerminal(f) {
+		pager, set := os.LookupEnv("PAGER")
+		if !set {
+			pager = "less -R"
+		}
+		if args := strings.Fields(pager); len(args) > 0 && args[0] != "cat" {
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdin = strings.NewReader(text)
+			cmd.Stdout = f
+			cmd.Stderr = os.Stderr
+			if _, set := os.LookupEnv("LESS"); quitIfOneScreen && !set {
+				cmd.Env = append(os.Environ(), "LESS=FRX")
+			}
+			if err := cmd.Run(); err == nil {
+				return
+			}
+		}
+	}
+	_, _ = io.WriteString(w, text)
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -186,11 +186,11 @@ func commandLine(f bflags.Flagger, cmdPath []string, in *InputSample) ([]string,
 		if v.Hidden || v.Value == nil {
 			continue
 		}
-		result = append(result, v.CmdString()...)
+		result = append(result, v.RawCmdString()...)
 	}
 	if argset != nil {
 		for _, fl := range argset.Flags {
-			result = append(result, fl.CmdString()...)
+			result = append(result, fl.RawCmdString()...)
 		}
 	}
 	return result, nil
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+	"github.com/eluv-io/ecobra-go/params"
+)
+
+const (
+	watchKey  = "app_watch" // key for commands annotation
+	watchFlag = "watch"
+)
+
+// WatchOptions configures the watch mode of commands.
+type WatchOptions struct {
+	Interval time.Duration   // interval between checks of the watched files - 500ms if 0
+	Debounce time.Duration   // time without further change before re-running after a change - 200ms if 0
+	Done     <-chan struct{} // stops watching when closed - watching stops on interrupt (Ctrl-C) otherwise
+}
+
+// WithWatchOptions sets the options of the watch mode of commands. See
+// Cmd.Watch.
+func (a *App) WithWatchOptions(o WatchOptions) *App {
+	a.watchOpts = o
+	return a
+}
+
+func setWatch(cmd *cobra.Command, watch bool) {
+	if !watch {
+		return
+	}
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[watchKey] = "true"
+}
+
+// configureWatch adds the --watch flag to commands with watch mode enabled.
+// It returns an error if the command has no file path flag or arg to watch.
+func configureWatch(cmd *cobra.Command) error {
+	if cmd.Annotations[watchKey] == "" {
+		return nil
+	}
+	e := errors.Template("configureWatch", errors.K.Invalid, ErrInvalidSpec, "command", cmd.Name())
+	if len(watchableFlags(cmd)) == 0 {
+		return e("reason", "watch requires a file path flag or arg")
+	}
+	if cmd.Flags().Lookup(watchFlag) != nil {
+		return e(bflags.ErrDuplicateFlag, "flag", watchFlag)
+	}
+	cmd.Flags().Bool(watchFlag, false, "re-run the command when its input files change")
+	return nil
+}
+
+// isWatching returns true if the command runs in watch mode.
+func isWatching(cmd *cobra.Command) bool {
+	if cmd.Annotations[watchKey] == "" {
+		return false
+	}
+	watch, _ := cmd.Flags().GetBool(watchFlag)
+	return watch
+}
+
+// watchableFlags returns the bound flags and args of the command holding a
+// params.FilePath or a params.PathOrReader.
+func watchableFlags(cmd *cobra.Command) []*pflag.Flag {
+	var ret []*pflag.Flag
+	add := func(fb *bflags.FlagBond) {
+		f := cmd.Flags().Lookup(string(fb.Name))
+		if f == nil {
+			return
+		}
+		switch f.Value.(type) {
+		case *params.FilePath, *params.PathOrReader:
+			ret = append(ret, f)
+		}
+	}
+	if flags, err := bflags.GetCmdFlagSet(cmd); err == nil {
+		for _, fb := range flags {
+			add(fb)
+		}
+	}
+	if args, err := bflags.GetCmdArgSet(cmd); err == nil && args != nil {
+		for _, fb := range args.Flags {
+			add(fb)
+		}
+	}
+	return ret
+}
+
+// watchedFiles returns the paths of the files set to the watchable flags and
+// args of the command. Stdin ('-') is not watched.
+func watchedFiles(cmd *cobra.Command) []string {
+	var ret []string
+	for _, f := range watchableFlags(cmd) {
+		if path := f.Value.String(); path != "" && path != "-" {
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// resetReaders closes the readers opened by the PathOrReader flags and args of
+// the command, such that files are opened again by the next run.
+func resetReaders(cmd *cobra.Command) {
+	for _, f := range watchableFlags(cmd) {
+		if p, ok := f.Value.(*params.PathOrReader); ok && p.Read != nil && p.Path != "" && p.Path != "-" {
+			_ = p.Read.Close()
+			p.Read = nil
+		}
+	}
+}
+
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func fileStates(files []string) map[string]fileState {
+	ret := make(map[string]fileState, len(files))
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			ret[file] = fileState{}
+			continue
+		}
+		ret[file] = fileState{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+	}
+	return ret
+}
+
+func sameStates(a, b map[string]fileState) bool {
+	for file, s := range a {
+		if b[file] != s {
+			return false
+		}
+	}
+	return true
+}
+
+// watch re-runs the command each time its input files change, until watching
+// is stopped. rerun runs the command, prints its output and calls the end hook:
+// it returns the error of the run and a non-nil invalid error if the command
+// cannot run, which stops watching. Errors of the runs - starting with err, the
+// error of the first run - are printed to the error output of the command and
+// watching goes on.
+func (a *App) watch(cmd *cobra.Command, err error, rerun func() (err error, invalid error)) error {
+	opts := a.watchOpts
+	if opts.Interval <= 0 {
+		opts.Interval = 500 * time.Millisecond
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 200 * time.Millisecond
+	}
+	running := sync.Mutex{} // held while a run is in progress
+	done := opts.Done
+	if done == nil {
+		// the exit handler waits for the run in progress
+		interrupted := make(chan struct{})
+		unregister := registerSignalHandler(func() {
+			close(interrupted)
+			running.Lock()
+			defer running.Unlock()
+		}, false)
+		defer unregister()
+		done = interrupted
+	}
+	stderr := cmd.ErrOrStderr()
+	report := func(err error) {
+		if err == nil {
+			return
+		}
+		if a.errRenderer != nil {
+			a.errRenderer.Render(stderr, err)
+		} else {
+			_, _ = fmt.Fprintln(stderr, "Error:", err)
+		}
+	}
+	wait := func(d time.Duration) bool {
+		select {
+		case <-done:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+
+	files := watchedFiles(cmd)
+	report(err)
+	_, _ = fmt.Fprintf(stderr, "watching %s\n", strings.Join(files, ", "))
+	states := fileStates(files)
+	for iteration := 2; ; iteration++ {
+		// wait for a change, then for the files to be stable
+		current := states
+		for sameStates(current, states) {
+			if !wait(opts.Interval) {
+				return nil
+			}
+			current = fileStates(files)
+		}
+		for {
+			if !wait(opts.Debounce) {
+				return nil
+			}
+			next := fileStates(files)
+			if sameStates(next, current) {
+				break
+			}
+			current = next
+		}
+		states = current
+
+		running.Lock()
+		_, _ = fmt.Fprintf(stderr, "\n--- %s: run %d at %s ---\n",
+			cmd.CommandPath(), iteration, time.Now().Format("15:04:05"))
+		resetReaders(cmd)
+		err, invalid := rerun()
+		running.Unlock()
+		if invalid != nil {
+			return invalid
+		}
+		report(err)
+	}
+}
@@ -0,0 +1,57 @@
+package bflags
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const hiddenAliasesKey = "bflags_hidden_aliases" // key for commands annotation
+
+// SetHiddenAliases adds the given aliases to the aliases of the command without
+// showing them in the help of the command. Hidden aliases are typically used to
+// keep accepting former names of renamed commands.
+func SetHiddenAliases(c *cobra.Command, aliases ...string) {
+	if c == nil || len(aliases) == 0 {
+		return
+	}
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	hidden := append(HiddenAliases(c), aliases...)
+	c.Annotations[hiddenAliasesKey] = strings.Join(hidden, "\n")
+	for _, alias := range aliases {
+		if !c.HasAlias(alias) {
+			c.Aliases = append(c.Aliases, alias)
+		}
+	}
+}
+
+// HiddenAliases returns the hidden aliases of the given command.
+func HiddenAliases(c *cobra.Command) []string {
+	if c == nil || c.Annotations[hiddenAliasesKey] == "" {
+		return nil
+	}
+	return strings.Split(c.Annotations[hiddenAliasesKey], "\n")
+}
+
+// nameAndAliases returns the name and the aliases of the given command as
+// rendered in the help, or an empty string if the command has no visible
+// alias.
+func nameAndAliases(c *cobra.Command) string {
+	hidden := HiddenAliases(c)
+	names := []string{c.Name()}
+outer:
+	for _, alias := range c.Aliases {
+		for _, h := range hidden {
+			if h == alias {
+				continue outer
+			}
+		}
+		names = append(names, alias)
+	}
+	if len(names) == 1 {
+		return ""
+	}
+	return strings.Join(names, ", ")
+}
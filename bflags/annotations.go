@@ -0,0 +1,143 @@
+package bflags
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Annotation is a key/value pair found in the 'meta' tag of a field.
+// Annotations of the form 'key=value' have both Key and Value set, bare
+// annotations (without '=') only have the Key set.
+type Annotation struct {
+	Key   string
+	Value string
+	bare  bool // true if the annotation was declared without '='
+}
+
+// String returns the annotation as declared in the 'meta' tag.
+func (a Annotation) String() string {
+	if a.bare {
+		return a.Key
+	}
+	return a.Key + "=" + a.Value
+}
+
+// IsBare returns true if the annotation was declared without a value.
+func (a Annotation) IsBare() bool {
+	return a.bare
+}
+
+// parseAnnotation parses a single 'key=value' or bare annotation.
+func parseAnnotation(s string) Annotation {
+	ndx := strings.Index(s, "=")
+	if ndx <= 0 {
+		return Annotation{Key: s, bare: true}
+	}
+	return Annotation{
+		Key:   strings.TrimSpace(s[:ndx]),
+		Value: strings.TrimSpace(s[ndx+1:]),
+	}
+}
+
+// Annotations is the ordered list of annotations of a FlagBond.
+type Annotations []Annotation
+
+// NewAnnotations parses the given strings as annotations: each string is either
+// of the form 'key=value' or a bare value.
+func NewAnnotations(ss ...string) Annotations {
+	if len(ss) == 0 {
+		return nil
+	}
+	ret := make(Annotations, 0, len(ss))
+	for _, s := range ss {
+		ret = append(ret, parseAnnotation(s))
+	}
+	return ret
+}
+
+// Strings returns the annotations as declared in the 'meta' tag.
+func (a Annotations) Strings() []string {
+	if a == nil {
+		return nil
+	}
+	ret := make([]string, 0, len(a))
+	for _, an := range a {
+		ret = append(ret, an.String())
+	}
+	return ret
+}
+
+// Has returns true if an annotation with the given key exists. For backward
+// compatibility, s may also be the full 'key=value' string.
+func (a Annotations) Has(s string) bool {
+	for _, an := range a {
+		if an.Key == s || an.String() == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the value of the first annotation with the given key and true
+// if the annotation exists.
+func (a Annotations) Get(key string) (string, bool) {
+	for _, an := range a {
+		if an.Key == key {
+			return an.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the values of all annotations with the given key.
+func (a Annotations) Values(key string) []string {
+	var ret []string
+	for _, an := range a {
+		if an.Key == key {
+			ret = append(ret, an.Value)
+		}
+	}
+	return ret
+}
+
+// GetString returns the value of the first annotation with the given key or
+// the empty string if none exists.
+func (a Annotations) GetString(key string) string {
+	ret, _ := a.Get(key)
+	return ret
+}
+
+// GetBool returns true if an annotation with the given key exists and is
+// either bare (e.g. 'sensitive') or has a value parsing to true
+// (e.g. 'sensitive=true').
+func (a Annotations) GetBool(key string) bool {
+	for _, an := range a {
+		if an.Key != key {
+			continue
+		}
+		if an.bare {
+			return true
+		}
+		b, err := strconv.ParseBool(an.Value)
+		return err == nil && b
+	}
+	return false
+}
+
+// MarshalJSON marshals the annotations as an array of strings, as declared in
+// the 'meta' tag.
+func (a Annotations) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.Strings())
+}
+
+// UnmarshalJSON unmarshals an array of strings.
+func (a *Annotations) UnmarshalJSON(bb []byte) error {
+	var ss []string
+	err := json.Unmarshal(bb, &ss)
+	if err != nil {
+		return err
+	}
+	*a = NewAnnotations(ss...)
+	return nil
+}
@@ -0,0 +1,120 @@
+package bflags
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// AuditRecord is the record written by the AuditLog middleware for each
+// invocation of a command.
+type AuditRecord struct {
+	Time     time.Time         `json:"time"`            // start time of the command
+	User     string            `json:"user"`            // name of the user running the command
+	Host     string            `json:"host"`            // host name
+	Command  string            `json:"command"`         // command path, e.g. 'cli content get'
+	Flags    map[string]string `json:"flags,omitempty"` // flags and args set on the command line - secrets redacted
+	Status   string            `json:"status"`          // "ok" or "error"
+	Error    string            `json:"error,omitempty"` // the error returned by the command, without stacktrace
+	Duration string            `json:"duration"`        // duration of the command
+}
+
+// AuditSink receives the records of the AuditLog middleware.
+type AuditSink func(rec *AuditRecord) error
+
+// JSONLSink returns an AuditSink writing records to w as JSON lines.
+func JSONLSink(w io.Writer) AuditSink {
+	mu := &sync.Mutex{}
+	return func(rec *AuditRecord) error {
+		bb, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(bb, '\n'))
+		return err
+	}
+}
+
+// FileSink returns an AuditSink appending records as JSON lines to the file at
+// the given path. The file is created with mode 0600 if it does not exist and
+// is only opened in append mode.
+func FileSink(path string) AuditSink {
+	return func(rec *AuditRecord) error {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		err = JSONLSink(f)(rec)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// AuditLog returns a Middleware writing an AuditRecord to the given sink after
+// each invocation of a command: user, host, command path, flags and args set on
+// the command line, result status and duration. Values of secret flags are
+// redacted (see FlagBond.IsSecret).
+//
+// The error returned by the command takes precedence over an error writing the
+// record, which is returned otherwise: commands do not succeed silently without
+// an audit trail.
+func AuditLog(sink AuditSink) Middleware {
+	return func(next RunFn) RunFn {
+		return func(cmd *cobra.Command, in interface{}) error {
+			start := time.Now()
+			err := next(cmd, in)
+
+			rec := &AuditRecord{
+				Time:     start.UTC(),
+				User:     auditUser(),
+				Command:  cmd.CommandPath(),
+				Status:   "ok",
+				Duration: time.Since(start).String(),
+			}
+			rec.Host, _ = os.Hostname()
+			if fas := GetFlagArgs(cmd).Set(); len(fas) > 0 {
+				rec.Flags = make(map[string]string, len(fas))
+				for name, fa := range fas {
+					rec.Flags[name] = fa.String()
+				}
+			}
+			if err != nil {
+				rec.Status = "error"
+				rec.Error = errorNoTrace(err)
+			}
+			serr := sink(rec)
+			if err != nil {
+				return err
+			}
+			if serr != nil {
+				return errors.E("AuditLog", errors.K.IO, serr, "command", rec.Command)
+			}
+			return nil
+		}
+	}
+}
+
+func auditUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func errorNoTrace(err error) string {
+	if e, ok := err.(*errors.Error); ok {
+		return e.ErrorNoTrace()
+	}
+	return err.Error()
+}
@@ -0,0 +1,34 @@
+package bflags
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+type benchInput struct {
+	Name     string   `cmd:"flag,name,the name,n"`
+	Count    int      `cmd:"flag,count,the count,c"`
+	Verbose  bool     `cmd:"flag,verbose,verbose output,v"`
+	Tags     []string `cmd:"flag,tags,some tags"`
+	Id       string   `cmd:"arg,id,content id,0"`
+	Paths    []string `cmd:"arg,paths,some paths,1"`
+	Password string   `cmd:"flag,password,the password" meta:"sensitive"`
+}
+
+// BenchmarkBind binds the same input type to 500 commands
+func BenchmarkBind(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		root := &cobra.Command{Use: "root"}
+		for j := 0; j < 500; j++ {
+			c := &cobra.Command{Use: "cmd"}
+			root.AddCommand(c)
+			err := Bind(c, &benchInput{})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		ClearCmdState(root)
+	}
+}
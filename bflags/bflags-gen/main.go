@@ -0,0 +1,396 @@
+/*
+bflags-gen generates static binders for structs bound with bflags.
+
+For each of the given struct types, it reads the 'cmd', 'meta' and 'post'
+tags of the fields and generates a StaticBonds method implementing
+bflags.StaticBinder. bflags.Bind then retrieves flags and args of the struct
+without reflection.
+
+Usage:
+
+	bflags-gen -type input1,input2 [-output file] [directory]
+
+or as a go:generate directive in the package declaring the structs:
+
+	//go:generate bflags-gen -type input1,input2
+
+The following rules apply:
+  - the directory defaults to the current directory and the output file to
+    <first type>_bflags.go (lower case) in that directory
+  - embedded structs declared in the same package are walked
+  - types having fields that cannot be bound statically are skipped with a
+    warning and are bound with reflection: fields with pointer types, fields
+    with struct, map, interface, chan or func types, embedded structs of other
+    packages, tagged embedded structs and duplicate names.
+  - types declared in other packages are assumed to be supported by bflags
+    (e.g. time.Duration or implementations of pflag.Value)
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/bflags"
+)
+
+const header = "// Code generated by bflags-gen; DO NOT EDIT.\n"
+
+// bondField is a bound field found in a struct
+type bondField struct {
+	path  string // path to the field from the receiver, e.g. 'in.Name'
+	fb    *bflags.FlagBond
+	isArg bool
+}
+
+// pkgStructs holds the structs declared in a package
+type pkgStructs struct {
+	name    string
+	structs map[string]*ast.StructType
+}
+
+// parsePackage parses the non-test go files of the given directory.
+func parsePackage(dir string) (*pkgStructs, error) {
+	e := errors.Template("parsePackage", "dir", dir)
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, e(err)
+	}
+	fset := token.NewFileSet()
+	ret := &pkgStructs{structs: make(map[string]*ast.StructType)}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, e(err)
+		}
+		if isGenerated(f) {
+			continue
+		}
+		ret.addFile(f)
+	}
+	if ret.name == "" {
+		return nil, e(errors.K.NotExist, "reason", "no go files")
+	}
+	return ret, nil
+}
+
+// parseSource parses the given source as a single file package.
+func parseSource(src string) (*pkgStructs, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "src.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, errors.E("parseSource", err)
+	}
+	ret := &pkgStructs{structs: make(map[string]*ast.StructType)}
+	ret.addFile(f)
+	return ret, nil
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if c.Text+"\n" == header {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *pkgStructs) addFile(f *ast.File) {
+	p.name = f.Name.Name
+	ast.Inspect(f, func(n ast.Node) bool {
+		ts, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		if st, ok := ts.Type.(*ast.StructType); ok {
+			p.structs[ts.Name.Name] = st
+		}
+		return false
+	})
+}
+
+var basicTypes = map[string]bool{
+	"bool": true, "string": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// fields returns the bound fields of the given struct or an error if the
+// struct cannot be bound statically.
+func (p *pkgStructs) fields(st *ast.StructType, path string) ([]*bondField, error) {
+	var ret []*bondField
+	for _, f := range st.Fields.List {
+		tag := reflect.StructTag("")
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, errors.E("fields", errors.K.Invalid, err, "tag", f.Tag.Value)
+			}
+			tag = reflect.StructTag(s)
+		}
+
+		if len(f.Names) == 0 {
+			// embedded field
+			id, ok := f.Type.(*ast.Ident)
+			if !ok || p.structs[id.Name] == nil {
+				if !ok || !ast.IsExported(id.Name) {
+					continue
+				}
+				return nil, errors.E("fields", errors.K.NotImplemented,
+					"reason", "embedded type not declared in package",
+					"type", id.Name)
+			}
+			if tag.Get("cmd") != "" {
+				return nil, errors.E("fields", errors.K.NotImplemented,
+					"reason", "tagged embedded struct",
+					"type", id.Name)
+			}
+			inner, err := p.fields(p.structs[id.Name], path+"."+id.Name)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, inner...)
+			continue
+		}
+
+		for _, name := range f.Names {
+			if !ast.IsExported(name.Name) {
+				continue
+			}
+			fb, isArg := bflags.FlagBondFromTag(name.Name, tag)
+			if fb == nil {
+				if star, ok := f.Type.(*ast.StarExpr); ok {
+					if id, ok := star.X.(*ast.Ident); !ok || !basicTypes[id.Name] {
+						// untagged pointers to structs are walked by bflags
+						return nil, errors.E("fields", errors.K.NotImplemented,
+							"reason", "untagged pointer field",
+							"field", name.Name)
+					}
+				}
+				continue
+			}
+			if !p.isSupported(f.Type) {
+				return nil, errors.E("fields", errors.K.NotImplemented,
+					"reason", "unsupported field type",
+					"field", name.Name)
+			}
+			ret = append(ret, &bondField{
+				path:  path + "." + name.Name,
+				fb:    fb,
+				isArg: isArg,
+			})
+		}
+	}
+	return ret, nil
+}
+
+// isSupported returns true if a field of the given type can be bound statically.
+func (p *pkgStructs) isSupported(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return p.structs[t.Name] == nil
+	case *ast.SelectorExpr:
+		return true
+	case *ast.ArrayType:
+		return t.Len == nil && p.isSupported(t.Elt)
+	case *ast.IndexExpr:
+		// bflags.Optional[T]
+		sel, ok := t.X.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "Optional"
+	default:
+		return false
+	}
+}
+
+// generate generates the StaticBonds methods for the given types. Types that
+// cannot be bound statically are reported in skipped.
+func generate(p *pkgStructs, types []string) (code []byte, skipped map[string]error, err error) {
+	e := errors.Template("generate", errors.K.Invalid)
+	skipped = make(map[string]error)
+
+	sb := &strings.Builder{}
+	sb.WriteString(header)
+	sb.WriteString("\npackage " + p.name + "\n\n")
+	sb.WriteString("import \"github.com/eluv-io/ecobra-go/bflags\"\n")
+
+	count := 0
+	for _, typ := range types {
+		st, ok := p.structs[typ]
+		if !ok {
+			return nil, nil, e(errors.K.NotExist, "reason", "struct not found", "type", typ)
+		}
+		fields, err := p.fields(st, "in")
+		if err == nil {
+			err = checkNames(fields)
+		}
+		if err != nil {
+			skipped[typ] = err
+			continue
+		}
+		writeStaticBonds(typ, fields, sb)
+		count++
+	}
+	if count == 0 {
+		return nil, skipped, e("reason", "no type to generate", "types", types)
+	}
+
+	code, err = format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, nil, e(err)
+	}
+	return code, skipped, nil
+}
+
+// checkNames returns an error if several fields are bound with the same name.
+func checkNames(fields []*bondField) error {
+	names := make(map[string]bool)
+	for _, f := range fields {
+		name := string(f.fb.Name)
+		if names[name] {
+			return errors.E("checkNames", errors.K.NotImplemented,
+				"reason", "duplicate name",
+				"name", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+func writeStaticBonds(typ string, fields []*bondField, sb *strings.Builder) {
+	sb.WriteString("\n// StaticBonds implements bflags.StaticBinder.\n")
+	sb.WriteString("func (in *" + typ + ") StaticBonds() (flags []*bflags.FlagBond, args []*bflags.FlagBond) {\n")
+	for _, f := range fields {
+		if !f.isArg {
+			sb.WriteString("flags = append(flags, " + flagBondLiteral(f) + ")\n")
+		}
+	}
+	for _, f := range fields {
+		if f.isArg {
+			sb.WriteString("args = append(args, " + flagBondLiteral(f) + ")\n")
+		}
+	}
+	sb.WriteString("return flags, args\n")
+	sb.WriteString("}\n")
+}
+
+func flagBondLiteral(f *bondField) string {
+	fb := f.fb
+	sb := &strings.Builder{}
+	sb.WriteString("&bflags.FlagBond{\n")
+	sb.WriteString("Name: " + strconv.Quote(string(fb.Name)) + ",\n")
+	if fb.Shorthand != "" {
+		sb.WriteString("Shorthand: " + strconv.Quote(fb.Shorthand) + ",\n")
+	}
+	sb.WriteString("Value: &" + f.path + ",\n")
+	sb.WriteString("Usage: " + strconv.Quote(fb.Usage) + ",\n")
+	writeBool := func(name string, v bool) {
+		if v {
+			sb.WriteString(name + ": true,\n")
+		}
+	}
+	writeBool("Required", fb.Required)
+	writeBool("Persistent", fb.Persistent)
+	writeBool("Hidden", fb.Hidden)
+	writeBool("Count", fb.Count)
+	sb.WriteString("ArgOrder: " + strconv.Itoa(fb.ArgOrder) + ",\n")
+	writeBool("Optional", fb.Optional)
+	if len(fb.Annotations) > 0 {
+		sb.WriteString("Annotations: bflags.NewAnnotations(" + quoteAll(fb.Annotations.Strings()) + "),\n")
+	}
+	if len(fb.PostProcessors) > 0 {
+		sb.WriteString("PostProcessors: []string{" + quoteAll(fb.PostProcessors) + "},\n")
+	}
+	writeBool("Repeat", fb.Repeat)
+	if fb.Separator != "" {
+		sb.WriteString("Separator: " + strconv.Quote(fb.Separator) + ",\n")
+	}
+	if len(fb.Choices) > 0 {
+		sb.WriteString("Choices: []string{" + quoteAll(fb.Choices) + "},\n")
+	}
+	if fb.Complete != "" {
+		sb.WriteString("Complete: " + strconv.Quote(fb.Complete) + ",\n")
+	}
+	if fb.Layout != "" {
+		sb.WriteString("Layout: " + strconv.Quote(fb.Layout) + ",\n")
+	}
+	if fb.Validate != "" {
+		sb.WriteString("Validate: " + strconv.Quote(fb.Validate) + ",\n")
+	}
+	writeBool("Splat", fb.Splat)
+	if len(fb.Groups) > 0 {
+		sb.WriteString("Groups: []string{" + quoteAll(fb.Groups) + "},\n")
+	}
+	if fb.Env != "" {
+		sb.WriteString("Env: " + strconv.Quote(fb.Env) + ",\n")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+func quoteAll(ss []string) string {
+	qs := make([]string, len(ss))
+	for i, s := range ss {
+		qs[i] = strconv.Quote(s)
+	}
+	return strings.Join(qs, ", ")
+}
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; must be set")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_bflags.go")
+	flag.Parse()
+	if *typeNames == "" {
+		fmt.Println("bflags-gen -type T1,T2 [-output file] [directory]")
+		os.Exit(1)
+	}
+	types := strings.Split(*typeNames, ",")
+	for i, t := range types {
+		types[i] = strings.TrimSpace(t)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	p, err := parsePackage(dir)
+	if err != nil {
+		fmt.Println("Error parsing package", dir, err)
+		os.Exit(1)
+	}
+
+	code, skipped, err := generate(p, types)
+	for typ, serr := range skipped {
+		fmt.Fprintln(os.Stderr, "bflags-gen: skipping", typ, "- will be bound with reflection:", serr)
+	}
+	if err != nil {
+		fmt.Println("Error generating binders", err)
+		os.Exit(1)
+	}
+
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, strings.ToLower(types[0])+"_bflags.go")
+	}
+	err = ioutil.WriteFile(out, code, 0644)
+	if err != nil {
+		fmt.Println("Error writing", out, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const src = `package cmd
+
+import "time"
+
+type common struct {
+	Verbose bool ` + "`cmd:\"flag,verbose,verbose output,v\"`" + `
+}
+
+type input struct {
+	common
+	Timeout time.Duration ` + "`cmd:\"flag,timeout,the timeout\" meta:\"k=v\"`" + `
+	Id      string        ` + "`cmd:\"arg,id,content id,0\" post:\"trim\"`" + `
+	Paths   []string      ` + "`cmd:\"arg,paths,some paths,1,true\"`" + `
+	ignored string
+	Other   int
+}
+
+type inner struct {
+	Name string ` + "`cmd:\"flag,name,the name\"`" + `
+}
+
+type nested struct {
+	Inner *inner
+}
+`
+
+const expected = `// Code generated by bflags-gen; DO NOT EDIT.
+
+package cmd
+
+import "github.com/eluv-io/ecobra-go/bflags"
+
+// StaticBonds implements bflags.StaticBinder.
+func (in *input) StaticBonds() (flags []*bflags.FlagBond, args []*bflags.FlagBond) {
+	flags = append(flags, &bflags.FlagBond{
+		Name:      "verbose",
+		Shorthand: "v",
+		Value:     &in.common.Verbose,
+		Usage:     "verbose output",
+		ArgOrder:  -1,
+	})
+	flags = append(flags, &bflags.FlagBond{
+		Name:        "timeout",
+		Value:       &in.Timeout,
+		Usage:       "the timeout",
+		ArgOrder:    -1,
+		Annotations: bflags.NewAnnotations("k=v"),
+	})
+	args = append(args, &bflags.FlagBond{
+		Name:           "id",
+		Value:          &in.Id,
+		Usage:          "content id",
+		ArgOrder:       0,
+		PostProcessors: []string{"trim"},
+	})
+	args = append(args, &bflags.FlagBond{
+		Name:     "paths",
+		Value:    &in.Paths,
+		Usage:    "some paths",
+		ArgOrder: 1,
+		Optional: true,
+	})
+	return flags, args
+}
+`
+
+func TestGenerate(t *testing.T) {
+	p, err := parseSource(src)
+	require.NoError(t, err)
+
+	code, skipped, err := generate(p, []string{"input", "nested"})
+	require.NoError(t, err)
+	require.Equal(t, expected, string(code))
+	require.Len(t, skipped, 1)
+	require.Error(t, skipped["nested"])
+
+	_, _, err = generate(p, []string{"nested"})
+	require.Error(t, err)
+	_, _, err = generate(p, []string{"unknown"})
+	require.Error(t, err)
+}
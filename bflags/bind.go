@@ -1,7 +1,6 @@
 package bflags
 
 import (
-	"encoding/json"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -27,7 +26,12 @@ import (
 // are read as:
 //
 //	flag: name, usage, shorthand, persistent, required, hidden
-//	arg: name, usage, order
+//	arg: name, usage, order, optional
+//
+// Unless the command already has Args set, Args is set to validate the count
+// of positional args against the bound args (see positionalArgs).
+// If the Use field of the command contains only the name of the command, the
+// usage of bound args is appended, e.g. "cmd <id> [path] [files...]".
 //
 // Attributes with default value on the right side of the expression can be omitted:
 //
@@ -36,6 +40,9 @@ import (
 // A 'meta' tag can be added to convey annotations with the bound tag:
 //
 //	`cmd:"flag,config,file name,c" meta:"file,non-empty"`
+//
+// If v implements StaticBinder - usually through code generated by bflags-gen -
+// the flags and args are retrieved from v without reflection.
 func Bind(c *cobra.Command, v interface{}) error {
 	return BindCustom(c, nil, v)
 }
@@ -48,7 +55,15 @@ func BindCustom(c *cobra.Command, f Flagger, v interface{}) error {
 	}
 	e := newFlagsBinder(c, f)
 
-	err := e.bind(v, bindOpts{})
+	var err error
+	if sb, ok := v.(StaticBinder); ok && f == nil {
+		err = e.bindStatic(v, sb)
+	} else {
+		err = e.bind(v, bindOpts{})
+	}
+	if err == nil {
+		err = markFlagGroups(c)
+	}
 	if err != nil {
 		path := append([]string{}, c.Name())
 		r := c.Parent()
@@ -65,17 +80,92 @@ func BindCustom(c *cobra.Command, f Flagger, v interface{}) error {
 
 	e.Reset(nil, nil)
 	bindStatePool.Put(e)
+	setCmdPristine(c, f, v)
 
+	if c.Args == nil {
+		c.Args = positionalArgs(c)
+	}
+	if use := strings.TrimSpace(c.Use); use != "" && !strings.Contains(use, " ") {
+		if args := argsUsage(c); args != "" {
+			c.Use = use + " " + args
+		}
+	}
 	return nil
 }
 
+// argsUsage returns the usage of the args bound to the command as expected in
+// the Use field of the command, e.g. "<id> [path] [files...]": required args
+// are enclosed in angle brackets and optional args in square brackets.
+func argsUsage(c *cobra.Command) string {
+	argset, err := GetCmdArgSet(c)
+	if err != nil || len(argset.Flags) == 0 {
+		return ""
+	}
+	ret := make([]string, 0, len(argset.Flags))
+	for i, fb := range argset.Flags {
+		name := string(fb.Name)
+		if i == len(argset.Flags)-1 && isSliceValue(c.Flags().Lookup(name)) {
+			name += "..."
+		}
+		if fb.isOptional() {
+			ret = append(ret, "["+name+"]")
+		} else {
+			ret = append(ret, "<"+name+">")
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+// positionalArgs returns a cobra.PositionalArgs function validating the count
+// of positional args against the args bound to the command:
+//   - args marked 'optional' or with a non-zero default value may be omitted,
+//     but args preceding a required arg must be provided
+//   - a trailing slice arg accepts any number of args
+//   - commands accepting extra args accept any number of args
+//
+// Errors wrap ErrMissingArg or ErrUnexpectedArgs.
+// Nil is returned if no arg is bound to the command.
+func positionalArgs(c *cobra.Command) cobra.PositionalArgs {
+	argset, err := GetCmdArgSet(c)
+	if err != nil || len(argset.Flags) == 0 {
+		return nil
+	}
+	minCount := 0
+	for i, fb := range argset.Flags {
+		if !fb.isOptional() {
+			minCount = i + 1
+		}
+	}
+	maxCount := len(argset.Flags)
+	last := argset.Flags[maxCount-1]
+	variadic := isSliceValue(c.Flags().Lookup(string(last.Name)))
+
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < minCount {
+			missing := make([]string, 0, minCount-len(args))
+			for _, fb := range argset.Flags[len(args):minCount] {
+				missing = append(missing, string(fb.Name))
+			}
+			return errors.NoTrace("positionalArgs", errors.K.Invalid, ErrMissingArg,
+				"expected_min", minCount,
+				"count", len(args),
+				"missing", missing)
+		}
+		if variadic || acceptsExtraArgs(cmd) || len(args) <= maxCount {
+			return nil
+		}
+		return noStackTrace(checkExtraArgs(cmd, argset, args))
+	}
+}
+
 // isSliceValue returns true if the Value of the flag has a type (string) ending
-// with 'Slice' which is a convention respected over the pflag package.
+// with 'Slice' or 'Array' which is a convention respected over the pflag package.
 func isSliceValue(f *flag.Flag) bool {
 	if f == nil {
 		return false
 	}
-	return strings.HasSuffix(f.Value.Type(), "Slice")
+	typ := unwrapValue(f.Value).Type()
+	return strings.HasSuffix(typ, "Slice") || strings.HasSuffix(typ, "Array")
 }
 
 // SetArgs sets the args to the 'arg' fields of the value previously bound as the
@@ -88,35 +178,15 @@ func isSliceValue(f *flag.Flag) bool {
 // The input is returned if no error occurred.
 func SetArgs(c *cobra.Command, args []string) (interface{}, error) {
 	ex := errors.Template("setArgs")
-	if log.IsDebug() {
-		// report found flags and args in debug mode
-		cmdflags, err := GetCmdFlagSet(c)
-		s := "null"
-		if err == nil {
-			bb, err2 := json.Marshal(cmdflags)
-			if err2 != nil {
-				log.Warn("error marshalling cmdFlags", err2)
-			}
-			s = string(bb)
-		}
-		log.Debug("set args - bound flags", "flags", s)
-		argflags, err := GetCmdArgSet(c)
-		s = "null"
-		if err == nil {
-			bb, err2 := json.Marshal(argflags)
-			if err2 != nil {
-				log.Warn("error marshalling argFlags", err2)
-			}
-			s = string(bb)
-		}
-		log.Debug("set args - bound args", "args", s)
-	}
-
 	if len(args) > 0 {
 		argset, err := GetCmdArgSet(c)
 		if err != nil {
 			return nil, err
 		}
+		err = checkExtraArgs(c, argset, args)
+		if err != nil {
+			return nil, ex(err)
+		}
 		for i, arg := range args {
 			if i < len(argset.Flags) {
 				f := c.Flags().Lookup(string(argset.Flags[i].Name))
@@ -128,49 +198,152 @@ func SetArgs(c *cobra.Command, args []string) (interface{}, error) {
 				}
 				// support for variadic args with slices arg
 				if i == len(argset.Flags)-1 && len(args) > len(argset.Flags) && isSliceValue(f) {
-					arg = strings.Join(args[i:], ",")
+					if argset.Flags[i].Repeat {
+						for _, a := range args[i:] {
+							if err = f.Value.Set(a); err != nil {
+								return nil, ex(err)
+							}
+						}
+						f.Changed = true
+						break
+					}
+					arg = strings.Join(args[i:], argset.Flags[i].separator())
 				}
 				err = f.Value.Set(arg)
 				if err != nil {
 					return nil, ex(err)
 				}
+				f.Changed = true
 			}
 		}
 	}
 
+	err := splat(c)
+	if err != nil {
+		return nil, ex(err)
+	}
+	err = applyEnv(c)
+	if err != nil {
+		return nil, ex(err)
+	}
+	err = postProcess(c)
+	if err != nil {
+		return nil, ex(err)
+	}
+	err = checkChoices(c)
+	if err != nil {
+		return nil, ex(err)
+	}
+	err = validateValues(c)
+	if err != nil {
+		return nil, ex(err)
+	}
+
 	if log.IsDebug() {
-		// reconstruct command line from all
-		cmds := make([]string, 0, 16)
-		cc := c
-		for cc != nil {
-			cmds = append(cmds, "")
-			copy(cmds[1:], cmds[0:])
-			cmds[0] = cc.Name()
-			cc = cc.Parent()
-		}
+		log.Debug("set args", "command_line", CmdLine(c))
+	}
+
+	v, _ := GetCmdInput(c)
+	return v, nil
+}
+
+const extraArgsKey = "bflags_extra_args" // key for commands annotation
 
-		cmdflags, err := GetCmdFlagSet(c)
-		if err == nil {
-			for _, f := range cmdflags {
-				cmds = append(cmds, f.CmdString()...)
+// AllowExtraArgs configures the given command to accept more positional
+// arguments than bound arg fields. This is an alternative to implementing
+// ExtraArgsAcceptor in the input bound to the command.
+func AllowExtraArgs(c *cobra.Command) {
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	c.Annotations[extraArgsKey] = "true"
+}
+
+func acceptsExtraArgs(c *cobra.Command) bool {
+	if c.Annotations[extraArgsKey] == "true" {
+		return true
+	}
+	in, _ := GetCmdInput(c)
+	if x, ok := in.(ExtraArgsAcceptor); ok && x.AcceptExtraArgs() {
+		return true
+	}
+	return false
+}
+
+// checkExtraArgs returns an error if more args than bound arg fields are
+// provided, unless the last arg field is a slice or the command accepts extra
+// args.
+func checkExtraArgs(c *cobra.Command, argset *ArgSet, args []string) error {
+	count := len(argset.Flags)
+	if len(args) <= count || acceptsExtraArgs(c) {
+		return nil
+	}
+	if count > 0 && isSliceValue(c.Flags().Lookup(string(argset.Flags[count-1].Name))) {
+		return nil
+	}
+	unexpected := make([]string, 0, len(args)-count)
+	for i := count; i < len(args); i++ {
+		unexpected = append(unexpected, fmt.Sprintf("%d:%s", i, args[i]))
+	}
+	return errors.E("checkExtraArgs", errors.K.Invalid, ErrUnexpectedArgs,
+		"reason", "unexpected arguments",
+		"expected_count", count,
+		"unexpected", unexpected)
+}
+
+// postProcess applies post processors of bound flags and args.
+func postProcess(c *cobra.Command) error {
+	if cmdflags, err := GetCmdFlagSet(c); err == nil {
+		for _, fl := range cmdflags {
+			if err = fl.postProcess(); err != nil {
+				return err
 			}
 		}
-		argflags, err := GetCmdArgSet(c)
-		if err == nil {
-			for _, f := range argflags.Flags {
-				cmds = append(cmds, f.CmdString()...)
+	}
+	if argflags, err := GetCmdArgSet(c); err == nil {
+		for _, fl := range argflags.Flags {
+			if err = fl.postProcess(); err != nil {
+				return err
 			}
 		}
-		log.Debug(strings.Join(cmds, " "))
 	}
+	return nil
+}
 
-	v, _ := GetCmdInput(c)
-	return v, nil
+// Normalizer may be implemented by an input bound to a command in order to
+// mutate or canonicalize its fields once the command line was parsed.
+type Normalizer interface {
+	Normalize() error
+}
+
+// Validator may be implemented by an input bound to a command in order to
+// validate its fields once the command line was parsed.
+type Validator interface {
+	Validate() error
+}
+
+// Normalize calls the Normalize function of the given input if it implements
+// Normalizer.
+func Normalize(in interface{}) error {
+	if n, ok := in.(Normalizer); ok {
+		return n.Normalize()
+	}
+	return nil
+}
+
+// Validate calls the Validate function of the given input if it implements
+// Validator.
+func Validate(in interface{}) error {
+	if v, ok := in.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
 }
 
 // SetupCmdArgs configures and returns the input struct bound to the provided
 // command with the given arguments.
 // * If the typ parameter is not nil the type of the input is verified
+// * if the input has a function 'Normalize() error', the function is called
 // * if the input has a function 'Validate() error', the function is called
 // The input must have previously been bound to the command like so:
 //
@@ -186,16 +359,15 @@ func SetupCmdArgs(cmd *cobra.Command, args []string, typ reflect.Type) (interfac
 		return nil, e(err)
 	}
 	if typ != nil && typ != reflect.TypeOf(m) {
-		return nil, e("reason", "wrong input", "input", m)
+		return nil, e(ErrInvalidInput, "reason", "wrong input", "input", m)
 	}
-	type validatable interface {
-		Validate() error
+	err = Normalize(m)
+	if err != nil {
+		return nil, e(err)
 	}
-	if val, ok := m.(validatable); ok {
-		err = val.Validate()
-		if err != nil {
-			return nil, e(err)
-		}
+	err = Validate(m)
+	if err != nil {
+		return nil, e(err)
 	}
 	// no usage from now on
 	cmd.SilenceUsage = true
@@ -206,39 +378,112 @@ func SetupCmdArgs(cmd *cobra.Command, args []string, typ reflect.Type) (interfac
 
 // GetFlagArgSet returns a map[string]string of flags and args that were set for
 // the given command. This function has to be called after SetArgs.
+// The value of secret flags and args is redacted (see FlagBond.IsSecret).
 func GetFlagArgSet(c *cobra.Command) map[string]string {
 	ret := make(map[string]string)
 
 	if cmdflags, err := GetCmdFlagSet(c); err == nil {
 		for name, fl := range cmdflags {
-			// for flags: cmdString returns ["--flag", "value"] except for bool
-			ss := fl.cmdString(true)
-			switch len(ss) {
-			case 0:
-				continue
-			case 1:
-				// should not happen since we ask for full flag
-				ndx := strings.Index(ss[0], "=")
-				if ndx > 0 {
-					ret[string(name)] = ss[0][ndx+1:]
-				}
-			default:
-				ret[string(name)] = ss[1]
+			if value := fl.valueString(); value != "" {
+				ret[string(name)] = value
 			}
 		}
 	}
 	if argflags, err := GetCmdArgSet(c); err == nil {
 		for _, fl := range argflags.Flags {
-			ss := fl.CmdString()
-			if len(ss) == 0 {
-				continue
+			if value := fl.valueString(); value != "" {
+				ret[string(fl.Name)] = value
 			}
-			ret[string(fl.Name)] = ss[0]
 		}
 	}
 	return ret
 }
 
+// FlagArg is a flag or arg bound to a command, as returned by GetFlagArgs.
+type FlagArg struct {
+	Name   string      // name of the flag or arg
+	Value  interface{} // value of the bound field, pointers followed - nil for nil pointers
+	IsSet  bool        // true if the flag or arg was explicitly set on the command line
+	IsArg  bool        // true for positional args
+	Secret bool        // true if the value must not be logged (see FlagBond.IsSecret)
+}
+
+// String returns the value of the flag or arg as a string, with the value of
+// secret flags redacted.
+func (f *FlagArg) String() string {
+	if f.Secret {
+		return RedactedValue
+	}
+	v := fieldValue(f.Value)
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// FlagArgs are the flags and args bound to a command, keyed by name.
+type FlagArgs map[string]*FlagArg
+
+// Set returns the flags and args explicitly set on the command line.
+func (f FlagArgs) Set() FlagArgs {
+	ret := make(FlagArgs)
+	for name, fa := range f {
+		if fa.IsSet {
+			ret[name] = fa
+		}
+	}
+	return ret
+}
+
+// GetFlagArgs returns the flags and args bound to the given command with their
+// typed value and whether they were explicitly set on the command line. This
+// function has to be called after SetArgs.
+// Unlike GetFlagArgSet, values of secret flags are not redacted: use
+// FlagArg.String for logging.
+func GetFlagArgs(c *cobra.Command) FlagArgs {
+	ret := make(FlagArgs)
+	add := func(fb *FlagBond) {
+		fl := c.Flags().Lookup(string(fb.Name))
+		if fl == nil {
+			fl = c.PersistentFlags().Lookup(string(fb.Name))
+		}
+		ret[string(fb.Name)] = &FlagArg{
+			Name:   string(fb.Name),
+			Value:  fieldValue(fb.Value),
+			IsSet:  fl != nil && fl.Changed,
+			IsArg:  fb.isArg,
+			Secret: fb.IsSecret(),
+		}
+	}
+	if cmdflags, err := GetCmdFlagSet(c); err == nil {
+		for _, fb := range cmdflags {
+			add(fb)
+		}
+	}
+	if argflags, err := GetCmdArgSet(c); err == nil {
+		for _, fb := range argflags.Flags {
+			add(fb)
+		}
+	}
+	return ret
+}
+
+// fieldValue returns the value pointed to by ptr, following pointers, or nil if
+// a pointer is nil. ptr itself is returned if it's not a pointer.
+func fieldValue(ptr interface{}) interface{} {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr {
+		return ptr
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
 // BindRunE binds the input parameter to the given command and sets the runE
 // parameter function as the function invoked by the RunE function of the cobra
 // command.
@@ -288,7 +533,7 @@ func BindRunE[T any](input *T, cmd *cobra.Command, runE func(*T) error, f Flagge
 		reflect.ValueOf(input).Kind() != reflect.Ptr ||
 		reflect.ValueOf(input).Elem().Kind() != reflect.Struct {
 
-		return nil, e(
+		return nil, e(ErrUnsupportedType,
 			"reason", "only structs are supported",
 			"input_value_kind", reflect.ValueOf(input).Kind(),
 			"input_value_elem_kind", reflect.ValueOf(input).Elem().Kind())
@@ -310,7 +555,10 @@ func BindRunE[T any](input *T, cmd *cobra.Command, runE func(*T) error, f Flagge
 				"input", fmt.Sprintf("%p", input))
 		}
 
-		err = runE(input)
+		run := withMiddlewares(cmd, func(*cobra.Command, interface{}) error {
+			return runE(input)
+		})
+		err = run(cmd, in)
 		if err != nil {
 			if x, ok := in.(ErrorSilencer); ok && x.SilenceErrors() {
 				cmd.SilenceErrors = true
@@ -369,6 +617,34 @@ func BindRunE[T any](input *T, cmd *cobra.Command, runE func(*T) error, f Flagge
 type Binder struct {
 	Error   error
 	Command *cobra.Command
+
+	name     string           // name of the command, even if binding failed
+	failures []*binderFailure // failures of this binder and its children
+}
+
+// binderFailure is the error of a binder with the path of its command in the
+// tree of binders.
+type binderFailure struct {
+	path []string
+	err  error
+}
+
+// newBinder returns a Binder for the given command and binding error.
+func newBinder(c *cobra.Command, cmd *cobra.Command, err error) *Binder {
+	ret := &Binder{
+		Command: cmd,
+	}
+	if c != nil {
+		ret.name = c.Name()
+	}
+	if err != nil {
+		ret.failures = []*binderFailure{{
+			path: []string{ret.name},
+			err:  errors.ClearStacktrace(err),
+		}}
+		ret.Error = ret.failuresError()
+	}
+	return ret
 }
 
 // NewBinderC constructs a new Binder with just a Command. This is useful for
@@ -380,22 +656,176 @@ func NewBinderC(c *cobra.Command) *Binder {
 // NewBinder returns a Binder initialized by running BindRunE with the given parameters
 func NewBinder[T any](in *T, c *cobra.Command, runE func(*T) error, f Flagger) *Binder {
 	cmd, err := BindRunE(in, c, runE, f)
-	return &Binder{
-		Error:   errors.ClearStacktrace(err),
-		Command: cmd,
-	}
+	return newBinder(c, cmd, err)
 }
 
 // AddCommand adds the commands of the given Binder instances to the command of
 // this Binder or append their error to the Error of this Binder if they have
-// errors.
+// errors. Each error reports the full path of the failing command.
 func (b *Binder) AddCommand(bound ...*Binder) *Binder {
 	for _, bn := range bound {
 		if bn.Error != nil {
-			b.Error = errors.Append(b.Error, bn.Error)
+			failures := bn.failures
+			if len(failures) == 0 {
+				// Error set outside of the constructors
+				failures = []*binderFailure{{path: []string{bn.cmdName()}, err: bn.Error}}
+			}
+			for _, f := range failures {
+				b.failures = append(b.failures, &binderFailure{
+					path: append([]string{b.cmdName()}, f.path...),
+					err:  f.err,
+				})
+			}
+			b.Error = b.failuresError()
 		} else if b.Command != nil {
 			b.Command.AddCommand(bn.Command)
 		}
 	}
 	return b
 }
+
+func (b *Binder) cmdName() string {
+	if b.name == "" && b.Command != nil {
+		return b.Command.Name()
+	}
+	return b.name
+}
+
+func (b *Binder) failuresError() error {
+	var ret error
+	for _, f := range b.failures {
+		ret = errors.Append(ret, errors.NoTrace("Binder", f.err, "path", strings.Join(f.path, " ")))
+	}
+	return ret
+}
+
+// Build returns the command of this Binder after validating the tree of
+// commands or the errors of the Binder if it has errors. Validation reports
+// sibling commands with the same name or alias and flags whose shorthand
+// collides with another flag of the command or with a persistent flag of a
+// parent command.
+func (b *Binder) Build() (*cobra.Command, error) {
+	if b.Error != nil {
+		return nil, b.Error
+	}
+	if b.Command == nil {
+		return nil, errors.E("Binder.Build", errors.K.Invalid, "reason", "nil command")
+	}
+	err := validateCommandTree(b.Command, nil)
+	if err != nil {
+		return nil, err
+	}
+	return b.Command, nil
+}
+
+// MustBuild is like Build but panics in case of error.
+func (b *Binder) MustBuild() *cobra.Command {
+	cmd, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// validateCommandTree validates the given command and its sub-commands.
+// inherited maps the shorthands of persistent flags of parents to their names.
+func validateCommandTree(c *cobra.Command, inherited map[string]string) error {
+	var ret error
+	e := errors.TemplateNoTrace("validate", errors.K.Invalid, "path", c.CommandPath())
+
+	shorthands := make(map[string]string, len(inherited))
+	for k, v := range inherited {
+		shorthands[k] = v
+	}
+	persistent := make(map[string]string, len(inherited))
+	for k, v := range inherited {
+		persistent[k] = v
+	}
+	check := func(isPersistent bool) func(fl *flag.Flag) {
+		return func(fl *flag.Flag) {
+			if fl.Shorthand == "" {
+				return
+			}
+			if name, ok := shorthands[fl.Shorthand]; ok && name != fl.Name {
+				ret = errors.Append(ret, e(ErrDuplicateFlag,
+					"reason", "shorthand collision",
+					"shorthand", fl.Shorthand,
+					"flag", fl.Name,
+					"other_flag", name))
+				return
+			}
+			shorthands[fl.Shorthand] = fl.Name
+			if isPersistent {
+				persistent[fl.Shorthand] = fl.Name
+			}
+		}
+	}
+	c.PersistentFlags().VisitAll(check(true))
+	c.Flags().VisitAll(check(false))
+
+	names := make(map[string]bool)
+	for _, sub := range c.Commands() {
+		for _, name := range append([]string{sub.Name()}, sub.Aliases...) {
+			if names[name] {
+				ret = errors.Append(ret, e(ErrDuplicateCommand,
+					"reason", "duplicate command name or alias",
+					"name", name))
+			}
+			names[name] = true
+		}
+		ret = errors.Append(ret, validateCommandTree(sub, persistent))
+	}
+	return ret
+}
+
+// NewParentBinder returns a Binder with the given command bound to the given
+// input but without run function. This is useful for parent commands declaring
+// persistent flags used by their children created with NewChildBinder.
+func NewParentBinder[T any](in *T, c *cobra.Command, f Flagger) *Binder {
+	e := errors.Template("NewParentBinder", errors.K.Invalid)
+	if c == nil || in == nil {
+		return newBinder(c, nil, e("reason", "nil command or input not allowed"))
+	}
+	var err error
+	if reflect.ValueOf(in).Elem().Kind() != reflect.Struct {
+		err = e(ErrUnsupportedType, "reason", "only structs are supported")
+	} else {
+		err = BindCustom(c, f, in)
+	}
+	return newBinder(c, c, err)
+}
+
+// NewChildBinder is like NewBinder but the run function also receives the input
+// of the closest ancestor command bound to an input of type *P, typically with
+// NewParentBinder. Running the command fails if no such ancestor exists.
+func NewChildBinder[P any, T any](in *T, c *cobra.Command, runE func(parent *P, in *T) error, f Flagger) *Binder {
+	var run func(*T) error
+	if runE != nil {
+		run = func(in *T) error {
+			parent, err := ParentInput[P](c)
+			if err != nil {
+				return err
+			}
+			return runE(parent, in)
+		}
+	}
+	return NewBinder(in, c, run, f)
+}
+
+// ParentInput returns the input of the closest ancestor of the given command
+// that is bound to an input of type *P.
+func ParentInput[P any](c *cobra.Command) (*P, error) {
+	for p := c.Parent(); p != nil; p = p.Parent() {
+		in, ok := GetCmdInput(p)
+		if !ok {
+			continue
+		}
+		if ret, ok := in.(*P); ok {
+			return ret, nil
+		}
+	}
+	return nil, errors.E("ParentInput", errors.K.NotExist, ErrInvalidInput,
+		"reason", "no parent bound to input",
+		"command", c.Name(),
+		"type", reflect.TypeOf((*P)(nil)).String())
+}
@@ -2,16 +2,21 @@ package bflags
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 
 	"github.com/eluv-io/errors-go"
+
+	"github.com/eluv-io/ecobra-go/params"
 )
 
 type testOpts struct {
@@ -218,5 +223,1493 @@ func TestBinderError(t *testing.T) {
 						},
 						nil)))
 	require.Error(t, root.Error)
+	require.Contains(t, root.Error.Error(), "path [test sub a]")
+	require.Contains(t, root.Error.Error(), "path [test sub b]")
 	fmt.Println(root.Error)
+
+	_, err := root.Build()
+	require.Equal(t, root.Error, err)
+	require.Panics(t, func() { root.MustBuild() })
+}
+
+func TestBinderBuild(t *testing.T) {
+	type rootIn struct {
+		Verbose bool `cmd:"flag,verbose,verbose output,v,true"`
+	}
+	type childIn struct {
+		Value string `cmd:"flag,value,a value,v"`
+	}
+	newChild := func(use string, aliases ...string) *Binder {
+		return NewBinder(
+			&childIn{},
+			&cobra.Command{Use: use, Aliases: aliases},
+			func(in *childIn) error { return nil },
+			nil)
+	}
+
+	root := NewParentBinder(&rootIn{}, &cobra.Command{Use: "test"}, nil).
+		AddCommand(
+			NewBinderC(&cobra.Command{Use: "sub"}).
+				AddCommand(newChild("a", "x")),
+			newChild("b"),
+			NewBinder(
+				&testOpts{},
+				&cobra.Command{Use: "c", Aliases: []string{"b"}},
+				func(in *testOpts) error { return nil },
+				nil))
+	require.NoError(t, root.Error)
+
+	_, err := root.Build()
+	require.Error(t, err)
+	list, ok := err.(*errors.ErrorList)
+	require.True(t, ok)
+	require.Equal(t, 3, len(list.Errors))
+	// sub-commands are sorted by name: b, c, sub
+	require.True(t, errors.Is(list.Errors[0], ErrDuplicateFlag))
+	require.True(t, errors.Is(list.Errors[1], ErrDuplicateCommand))
+	require.True(t, errors.Is(list.Errors[2], ErrDuplicateFlag))
+	require.Contains(t, err.Error(), "path [test sub a]")
+	require.Contains(t, err.Error(), "path [test b]")
+
+	root = NewBinderC(&cobra.Command{Use: "test"}).
+		AddCommand(newChild("a"), newChild("b"))
+	cmd := root.MustBuild()
+	require.Equal(t, root.Command, cmd)
+}
+
+func TestChildBinder(t *testing.T) {
+	type rootIn struct {
+		Config string `cmd:"flag,config,config file,c,true"`
+	}
+	type childIn struct {
+		Name string `cmd:"arg,name,the name,0"`
+	}
+	var gotParent *rootIn
+	var gotChild *childIn
+	root := NewParentBinder(
+		&rootIn{Config: "default.json"},
+		&cobra.Command{
+			Use:   "test",
+			Short: "root command",
+		},
+		nil).
+		AddCommand(
+			NewBinderC(
+				&cobra.Command{
+					Use:   "sub",
+					Short: "sub commands",
+				}).
+				AddCommand(
+					NewChildBinder(
+						&childIn{},
+						&cobra.Command{
+							Use:   "a <name>",
+							Short: "child a",
+						},
+						func(parent *rootIn, in *childIn) error {
+							gotParent, gotChild = parent, in
+							return nil
+						},
+						nil)))
+	require.NoError(t, root.Error)
+
+	root.Command.SetArgs([]string{"sub", "a", "--config", "my.json", "joe"})
+	require.NoError(t, root.Command.Execute())
+	require.Equal(t, "my.json", gotParent.Config)
+	require.Equal(t, "joe", gotChild.Name)
+
+	// no parent with the expected input type
+	orphan := NewChildBinder(
+		&childIn{},
+		&cobra.Command{
+			Use:           "b <name>",
+			SilenceErrors: true,
+			SilenceUsage:  true,
+		},
+		func(parent *testOpts, in *childIn) error {
+			return nil
+		},
+		nil)
+	require.NoError(t, orphan.Error)
+	orphan.Command.SetArgs([]string{"joe"})
+	err := orphan.Command.Execute()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestBinderMiddleware(t *testing.T) {
+	type childIn struct {
+		Name string `cmd:"arg,name,the name,0"`
+	}
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RunFn) RunFn {
+			return func(cmd *cobra.Command, in interface{}) error {
+				calls = append(calls, name+" start "+in.(*childIn).Name)
+				err := next(cmd, in)
+				calls = append(calls, name+" end")
+				return err
+			}
+		}
+	}
+	errAuth := errors.Str("not authorized")
+	child := NewBinder(
+		&childIn{},
+		&cobra.Command{
+			Use:           "a <name>",
+			SilenceErrors: true,
+			SilenceUsage:  true,
+		},
+		func(in *childIn) error {
+			calls = append(calls, "run "+in.Name)
+			return nil
+		},
+		nil).
+		Use(trace("child")).
+		Before(func(cmd *cobra.Command, in interface{}) error {
+			if in.(*childIn).Name == "eve" {
+				return errAuth
+			}
+			return nil
+		})
+	root := NewBinderC(&cobra.Command{Use: "test"}).
+		Use(trace("root")).
+		After(func(cmd *cobra.Command, in interface{}, err error) error {
+			calls = append(calls, "after "+cmd.Name())
+			return err
+		}).
+		AddCommand(child)
+	require.NoError(t, root.Error)
+
+	root.Command.SetArgs([]string{"a", "joe"})
+	require.NoError(t, root.Command.Execute())
+	require.Equal(t, []string{
+		"root start joe",
+		"child start joe",
+		"run joe",
+		"child end",
+		"after a",
+		"root end",
+	}, calls)
+
+	calls = nil
+	root.Command.SetArgs([]string{"a", "eve"})
+	err := root.Command.Execute()
+	require.True(t, errors.Is(err, errAuth))
+	require.Equal(t, []string{
+		"root start eve",
+		"child start eve",
+		"child end",
+		"after a",
+		"root end",
+	}, calls)
+}
+
+func TestAddFlag(t *testing.T) {
+	in := &testOpts{}
+	cmd, err := BindRunE(
+		in,
+		&cobra.Command{
+			Use:   "test <domains>",
+			Short: "explanation short",
+		},
+		func(opts *testOpts) error {
+			return opts.run()
+		},
+		nil)
+	require.NoError(t, err)
+
+	flags, err := GetCmdFlagSet(cmd)
+	require.NoError(t, err)
+
+	verbose := false
+	err = flags.Add(cmd, NewFlagBond("verbose", "v", &verbose, "verbose output"))
+	require.NoError(t, err)
+
+	// duplicates are rejected
+	err = flags.Add(cmd, NewFlagBond("verbose", "", &verbose, "verbose output"))
+	require.Error(t, err)
+	err = flags.Add(cmd, NewFlagBond("password", "", new(string), "password"))
+	require.Error(t, err)
+
+	stored, err := GetCmdFlagSet(cmd)
+	require.NoError(t, err)
+	_, ok := stored.Get("verbose")
+	require.True(t, ok)
+
+	cmd.SetArgs([]string{"-v", "x"})
+	err = cmd.Execute()
+	require.NoError(t, err)
+	require.True(t, verbose)
+	require.True(t, in.done)
+	require.Equal(t, "true", GetFlagArgSet(cmd)["verbose"])
+
+	// adding to a command without bound input stores the flags
+	c := &cobra.Command{Use: "plain"}
+	count := 0
+	err = CmdFlags{}.Add(c, NewFlagBond("count", "c", &count, "count"))
+	require.NoError(t, err)
+	stored, err = GetCmdFlagSet(c)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(stored))
+}
+
+type postOpts struct {
+	Config string   `cmd:"flag,config,config file" post:"trim,expandHome"`
+	Region string   `cmd:"flag,region,region name" post:"upper"`
+	Names  []string `cmd:"arg,names,names,0" post:"lower"`
+}
+
+func TestPostProcessors(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	in := &postOpts{Region: "us"}
+	cmd, err := BindRunE(
+		in,
+		&cobra.Command{Use: "test"},
+		func(opts *postOpts) error { return nil },
+		nil)
+	require.NoError(t, err)
+
+	cmd.SetArgs([]string{"--config", " ~/conf.json ", "Bob", "ALICE"})
+	err = cmd.Execute()
+	require.NoError(t, err)
+	require.Equal(t, home+"/conf.json", in.Config)
+	require.Equal(t, "US", in.Region)
+	require.Equal(t, []string{"bob", "alice"}, in.Names)
+
+	RegisterPostProcessor("fail", func(ptr interface{}) error {
+		return errors.E("fail", errors.K.Invalid)
+	})
+	type failOpts struct {
+		Name string `cmd:"flag" post:"fail"`
+	}
+	cmd, err = BindRunE(
+		&failOpts{},
+		&cobra.Command{Use: "test"},
+		func(opts *failOpts) error { return nil },
+		nil)
+	require.NoError(t, err)
+	cmd.SetArgs([]string{})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	err = cmd.Execute()
+	require.Error(t, err)
+
+	type unknownOpts struct {
+		Name string `cmd:"flag" post:"unknown"`
+	}
+	err = Bind(&cobra.Command{Use: "test"}, &unknownOpts{})
+	require.Error(t, err)
+}
+
+type lifecycleOpts struct {
+	Name  string `cmd:"flag,name,the name"`
+	calls []string
+}
+
+func (o *lifecycleOpts) Normalize() error {
+	o.calls = append(o.calls, "normalize")
+	o.Name = strings.ToLower(o.Name)
+	return nil
+}
+
+func (o *lifecycleOpts) Validate() error {
+	o.calls = append(o.calls, "validate")
+	if o.Name != "bob" {
+		return errors.E("validate", errors.K.Invalid, "name", o.Name)
+	}
+	return nil
+}
+
+func TestNormalizeValidate(t *testing.T) {
+	in := &lifecycleOpts{}
+	cmd, err := BindRunE(
+		in,
+		&cobra.Command{Use: "test"},
+		func(opts *lifecycleOpts) error {
+			opts.calls = append(opts.calls, "run")
+			return nil
+		},
+		nil)
+	require.NoError(t, err)
+
+	cmd.SetArgs([]string{"--name", "BOB"})
+	err = cmd.Execute()
+	require.NoError(t, err)
+	require.Equal(t, "bob", in.Name)
+	require.Equal(t, []string{"normalize", "validate", "run"}, in.calls)
+}
+
+type extraOpts struct {
+	Name  string `cmd:"arg,name,the name,0"`
+	extra bool
+}
+
+func (o *extraOpts) AcceptExtraArgs() bool {
+	return o.extra
+}
+
+func TestSetArgsExtraArgs(t *testing.T) {
+	in := &extraOpts{}
+	c := &cobra.Command{Use: "test"}
+	err := Bind(c, in)
+	require.NoError(t, err)
+
+	_, err = SetArgs(c, []string{"bob"})
+	require.NoError(t, err)
+
+	_, err = SetArgs(c, []string{"bob", "alice", "carl"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unexpected arguments")
+	require.Contains(t, err.Error(), "1:alice")
+	require.Contains(t, err.Error(), "2:carl")
+
+	in.extra = true
+	_, err = SetArgs(c, []string{"bob", "alice"})
+	require.NoError(t, err)
+
+	in.extra = false
+	AllowExtraArgs(c)
+	_, err = SetArgs(c, []string{"bob", "alice"})
+	require.NoError(t, err)
+
+	// variadic slices consume extra args
+	vin := &testOpts{}
+	c = &cobra.Command{Use: "test"}
+	err = Bind(c, vin)
+	require.NoError(t, err)
+	_, err = SetArgs(c, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, vin.Domains)
+}
+
+func TestPositionalArgs(t *testing.T) {
+	type exactOpts struct {
+		Id   string `cmd:"arg,id,content id,0"`
+		Path string `cmd:"arg,path,path,1"`
+	}
+	type optionalOpts struct {
+		Id   string `cmd:"arg,id,content id,0"`
+		Path string `cmd:"arg,path,path,1,true"`
+	}
+	type defaultOpts struct {
+		Id   string `cmd:"arg,id,content id,0"`
+		Path string `cmd:"arg,path,path,1"`
+	}
+	type variadicOpts struct {
+		Id    string   `cmd:"arg,id,content id,0"`
+		Files []string `cmd:"arg,files,files,1"`
+	}
+	type noArgOpts struct {
+		Name string `cmd:"flag"`
+	}
+
+	tests := []struct {
+		name  string
+		in    interface{}
+		valid [][]string
+		fail  [][]string
+	}{
+		{"exact", &exactOpts{}, [][]string{{"a", "b"}}, [][]string{{}, {"a"}, {"a", "b", "c"}}},
+		{"optional", &optionalOpts{}, [][]string{{"a"}, {"a", "b"}}, [][]string{{}, {"a", "b", "c"}}},
+		{"default", &defaultOpts{Path: "/tmp"}, [][]string{{"a"}, {"a", "b"}}, [][]string{{}, {"a", "b", "c"}}},
+		{"variadic", &variadicOpts{}, [][]string{{"a", "b"}, {"a", "b", "c"}}, [][]string{{}, {"a"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &cobra.Command{Use: "test"}
+			err := Bind(c, tc.in)
+			require.NoError(t, err)
+			require.NotNil(t, c.Args)
+			for _, args := range tc.valid {
+				require.NoError(t, c.Args(c, args), args)
+			}
+			for _, args := range tc.fail {
+				require.Error(t, c.Args(c, args), args)
+			}
+		})
+	}
+
+	// no args bound
+	c := &cobra.Command{Use: "test"}
+	err := Bind(c, &noArgOpts{})
+	require.NoError(t, err)
+	require.Nil(t, c.Args)
+
+	// Args already set on the command are kept
+	c = &cobra.Command{Use: "test", Args: cobra.ArbitraryArgs}
+	err = Bind(c, &exactOpts{})
+	require.NoError(t, err)
+	require.NoError(t, c.Args(c, []string{"a", "b", "c"}))
+
+	// commands accepting extra args
+	c = &cobra.Command{Use: "test"}
+	err = Bind(c, &exactOpts{})
+	require.NoError(t, err)
+	AllowExtraArgs(c)
+	require.NoError(t, c.Args(c, []string{"a", "b", "c"}))
+	require.Error(t, c.Args(c, []string{"a"}))
+}
+
+func TestUseLine(t *testing.T) {
+	type useOpts struct {
+		Id    string   `cmd:"arg,id,content id,0"`
+		Path  string   `cmd:"arg,path,path,1"`
+		Files []string `cmd:"arg,files,files,2,true"`
+		Name  string   `cmd:"flag"`
+	}
+
+	c := &cobra.Command{Use: "cmd"}
+	err := Bind(c, &useOpts{Path: "/tmp"})
+	require.NoError(t, err)
+	require.Equal(t, "cmd <id> [path] [files...]", c.Use)
+	require.Equal(t, "cmd", c.Name())
+
+	// explicit use line is kept
+	c = &cobra.Command{Use: "cmd <content-id> ..."}
+	err = Bind(c, &useOpts{})
+	require.NoError(t, err)
+	require.Equal(t, "cmd <content-id> ...", c.Use)
+
+	// no args
+	c = &cobra.Command{Use: "cmd"}
+	err = Bind(c, &struct {
+		Name string `cmd:"flag"`
+	}{})
+	require.NoError(t, err)
+	require.Equal(t, "cmd", c.Use)
+}
+
+type staticInput struct {
+	Name    string   `cmd:"flag,name,the name,n"`
+	Verbose bool     `cmd:"flag,verbose,verbose output,v,false,false,true"`
+	Id      string   `cmd:"arg,id,content id,0" meta:"non-empty"`
+	Paths   []string `cmd:"arg,paths,some paths,1" post:"trim"`
+}
+
+// StaticBonds is what bflags-gen generates for staticInput
+func (in *staticInput) StaticBonds() (flags []*FlagBond, args []*FlagBond) {
+	flags = append(flags, &FlagBond{
+		Name:      "name",
+		Shorthand: "n",
+		Value:     &in.Name,
+		Usage:     "the name",
+		ArgOrder:  -1,
+	})
+	flags = append(flags, &FlagBond{
+		Name:      "verbose",
+		Shorthand: "v",
+		Value:     &in.Verbose,
+		Usage:     "verbose output",
+		Hidden:    true,
+		ArgOrder:  -1,
+	})
+	args = append(args, &FlagBond{
+		Name:        "id",
+		Value:       &in.Id,
+		Usage:       "content id",
+		ArgOrder:    0,
+		Annotations: NewAnnotations("non-empty"),
+	})
+	args = append(args, &FlagBond{
+		Name:           "paths",
+		Value:          &in.Paths,
+		Usage:          "some paths",
+		ArgOrder:       1,
+		PostProcessors: []string{"trim"},
+	})
+	return flags, args
+}
+
+func TestStaticBinder(t *testing.T) {
+	type reflectInput staticInput
+
+	bindCmd := func(in interface{}) (*cobra.Command, CmdFlags, *ArgSet) {
+		c := &cobra.Command{Use: "cmd"}
+		require.NoError(t, Bind(c, in))
+		flags, err := GetCmdFlagSet(c)
+		require.NoError(t, err)
+		args, err := GetCmdArgSet(c)
+		require.NoError(t, err)
+		return c, flags, args
+	}
+
+	_, rflags, rargs := bindCmd(&reflectInput{})
+	c, sflags, sargs := bindCmd(&staticInput{})
+	require.Equal(t, rflags.String(), sflags.String())
+	require.Equal(t, rargs.String(), sargs.String())
+	require.Equal(t, "cmd <id> <paths...>", c.Use)
+	for name, fb := range rflags {
+		require.Equal(t, fb.Shorthand, sflags[name].Shorthand)
+		require.Equal(t, fb.Hidden, sflags[name].Hidden)
+	}
+	for i, fb := range rargs.Flags {
+		require.True(t, sargs.Flags[i].isArg)
+		require.Equal(t, fb.Annotations, sargs.Flags[i].Annotations)
+		require.Equal(t, fb.PostProcessors, sargs.Flags[i].PostProcessors)
+	}
+
+	require.NoError(t, c.ParseFlags([]string{"-n", "joe"}))
+	in, err := SetArgs(c, []string{"iq__1", " a "})
+	require.NoError(t, err)
+	require.Equal(t, &staticInput{Name: "joe", Id: "iq__1", Paths: []string{"a"}}, in)
+
+	fb, isArg := FlagBondFromTag("Verbose", `cmd:"flag,,verbose output,v,false,false,true" meta:"k=v"`)
+	require.False(t, isArg)
+	require.Equal(t, cmdFlag("Verbose"), fb.Name)
+	require.True(t, fb.Hidden)
+	require.Equal(t, "v", fb.Annotations.GetString("k"))
+	fb, _ = FlagBondFromTag("Name", `json:"name"`)
+	require.Nil(t, fb)
+}
+
+func TestSentinelErrors(t *testing.T) {
+	type dupInner struct {
+		Name string `cmd:"flag,name,the name"`
+	}
+	type dupOpts struct {
+		Name  string   `cmd:"flag,name,the name"`
+		Inner dupInner `cmd:"flag,inner,inner"`
+	}
+	type badOrderOpts struct {
+		Id   string `cmd:"arg,id,content id,0"`
+		Path string `cmd:"arg,path,path"`
+	}
+	type badPostOpts struct {
+		Name string `cmd:"flag,name,the name" post:"unknown"`
+	}
+	type unsupportedOpts struct {
+		Ch chan int `cmd:"flag,ch,a channel"`
+	}
+	type argOpts struct {
+		Id   string `cmd:"arg,id,content id,0"`
+		Path string `cmd:"arg,path,path,1"`
+	}
+
+	tests := []struct {
+		in       interface{}
+		sentinel error
+	}{
+		{&dupOpts{}, ErrDuplicateFlag},
+		{&badOrderOpts{}, ErrBadTag},
+		{&badPostOpts{}, ErrBadTag},
+		{&unsupportedOpts{}, ErrUnsupportedType},
+	}
+	for _, tc := range tests {
+		err := Bind(&cobra.Command{Use: "test"}, tc.in)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, tc.sentinel), "%v: %v", tc.sentinel, err)
+	}
+
+	c := &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, &argOpts{}))
+	err := c.Args(c, []string{"a"})
+	require.True(t, errors.Is(err, ErrMissingArg), err)
+	require.Equal(t, []string{"path"}, errors.Field(err, "missing"))
+	err = c.Args(c, []string{"a", "b", "c"})
+	require.True(t, errors.Is(err, ErrUnexpectedArgs), err)
+	_, err = SetArgs(c, []string{"a", "b", "c"})
+	require.True(t, errors.Is(err, ErrUnexpectedArgs), err)
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	var s string
+	err = flags.Add(c, NewFlagBond("path", "", &s, "dup of arg"))
+	require.True(t, errors.Is(err, ErrDuplicateFlag), err)
+}
+
+// secretString is a SecretValue
+type secretString string
+
+func (s secretString) IsSecret() bool        { return true }
+func (s *secretString) String() string       { return string(*s) }
+func (s *secretString) Set(val string) error { *s = secretString(val); return nil }
+func (s *secretString) Type() string         { return "string" }
+
+func TestRedaction(t *testing.T) {
+	type secretOpts struct {
+		User     string       `cmd:"flag,user,the user"`
+		Password string       `cmd:"flag,password,the password"`
+		ApiKey   string       `cmd:"flag,api-key,the api key" meta:"secret"`
+		Auth     secretString `cmd:"flag,auth,the authorization"`
+		Code     string       `cmd:"arg,code,a code,0" meta:"secret=true"`
+	}
+	in := &secretOpts{}
+	c := &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, in))
+	require.NoError(t, c.ParseFlags([]string{"--user", "joe", "--password", "pwd", "--api-key", "key", "--auth", "bearer"}))
+	_, err := SetArgs(c, []string{"1234"})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"user":     "joe",
+		"password": RedactedValue,
+		"api-key":  RedactedValue,
+		"auth":     RedactedValue,
+		"code":     RedactedValue,
+	}, GetFlagArgSet(c))
+	require.Equal(t, secretString("bearer"), in.Auth)
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	fb, _ := flags.Get("password")
+	require.Equal(t, []string{"--password", RedactedValue}, fb.CmdString())
+	require.Equal(t, []string{"--password", "pwd"}, fb.RawCmdString())
+	require.NotContains(t, flags.String(), "pwd")
+	bb, err := json.Marshal(flags)
+	require.NoError(t, err)
+	require.NotContains(t, string(bb), "pwd")
+	require.NotContains(t, string(bb), "\"key\"")
+
+	user, _ := flags.Get("user")
+	user.Secret = true
+	require.Equal(t, RedactedValue, GetFlagArgSet(c)["user"])
+	user.Secret = false
+
+	SetRedactPatterns("*user*")
+	defer SetRedactPatterns("*password*", "*passwd*", "*secret*", "*token*", "*credential*")
+	ret := GetFlagArgSet(c)
+	require.Equal(t, RedactedValue, ret["user"])
+	require.Equal(t, "pwd", ret["password"])
+	require.Equal(t, RedactedValue, ret["api-key"])
+}
+
+func TestCmdLine(t *testing.T) {
+	type opts struct {
+		Count    int      `cmd:"flag,count,a count"`
+		Verbose  bool     `cmd:"flag,verbose,verbose output"`
+		Password string   `cmd:"flag,password,the password"`
+		Query    string   `cmd:"flag,query,a query"`
+		Id       string   `cmd:"arg,id,content id,0"`
+		Paths    []string `cmd:"arg,paths,some paths,1,true"`
+	}
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{Use: "get"}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, &opts{Count: 3}))
+	require.Equal(t, "cli get", CmdLine(c))
+
+	require.NoError(t, c.ParseFlags([]string{"--password", "pwd", "--verbose", "--query", "a b"}))
+	_, err := SetArgs(c, []string{"iq__1", "p1", "p 2"})
+	require.NoError(t, err)
+	require.Equal(t, "cli get --password "+RedactedValue+" --query 'a b' --verbose iq__1 'p1,p 2'", CmdLine(c))
+	require.Equal(t, "", CmdLine(nil))
+}
+
+func TestSnapshot(t *testing.T) {
+	type opts struct {
+		Count    int           `cmd:"flag,count,a count"`
+		Verbose  *bool         `cmd:"flag,verbose,verbose output"`
+		Timeout  time.Duration `cmd:"flag,timeout,a timeout"`
+		Tags     []string      `cmd:"flag,tags,some tags"`
+		Password string        `cmd:"flag,password,the password"`
+		Id       string        `cmd:"arg,id,content id,0"`
+		Paths    []string      `cmd:"arg,paths,some paths,1,true"`
+	}
+	newCmd := func(in *opts) *cobra.Command {
+		root := &cobra.Command{Use: "cli"}
+		c := &cobra.Command{Use: "get"}
+		root.AddCommand(c)
+		require.NoError(t, Bind(c, in))
+		return c
+	}
+	in := &opts{Count: 3}
+	c := newCmd(in)
+	require.NoError(t, c.ParseFlags([]string{"--count", "5", "--verbose", "--timeout", "2s", "--tags", "a,b", "--password", "pwd"}))
+	_, err := SetArgs(c, []string{"iq__1", "p1", "p2"})
+	require.NoError(t, err)
+
+	snap, err := TakeSnapshot(c)
+	require.NoError(t, err)
+	require.Equal(t, "cli get", snap.Command)
+	require.Equal(t, []string{"count", "id", "password", "paths", "tags", "timeout", "verbose"}, snap.Changed)
+	bb, err := json.Marshal(snap)
+	require.NoError(t, err)
+	require.NotContains(t, string(bb), "pwd")
+
+	restored := &Snapshot{}
+	require.NoError(t, json.Unmarshal(bb, restored))
+	in2 := &opts{Count: 3}
+	c2 := newCmd(in2)
+	require.NoError(t, Restore(c2, restored))
+	require.Equal(t, 5, in2.Count)
+	require.True(t, *in2.Verbose)
+	require.Equal(t, 2*time.Second, in2.Timeout)
+	require.Equal(t, []string{"a", "b"}, in2.Tags)
+	require.Equal(t, "", in2.Password) // redacted
+	require.Equal(t, "iq__1", in2.Id)
+	require.Equal(t, []string{"p1", "p2"}, in2.Paths)
+	require.True(t, c2.Flags().Lookup("count").Changed)
+	require.False(t, c2.Flags().Lookup("password").Changed)
+	require.Equal(t, "cli get --count 5 --tags a,b --timeout 2s --verbose iq__1 p1,p2", CmdLine(c2))
+
+	// flags and args set directly
+	flags, err := GetCmdFlagSet(c2)
+	require.NoError(t, err)
+	require.NoError(t, flags.Set(`{"count":{"value":7}}`))
+	require.Equal(t, 7, in2.Count)
+	err = flags.Set(`{"unknown":{"value":7}}`)
+	require.Error(t, err)
+	require.True(t, errors.IsKind(errors.K.NotExist, err))
+	require.Error(t, flags.Set(`{"count":{"value":"x"}}`))
+	require.NoError(t, json.Unmarshal([]byte(`{"count":{"value":8}}`), &flags))
+	require.Equal(t, 8, in2.Count)
+	var unbound CmdFlags
+	require.Error(t, json.Unmarshal([]byte(`{"count":{"value":8}}`), &unbound))
+
+	args, err := GetCmdArgSet(c2)
+	require.NoError(t, err)
+	require.NoError(t, args.Set(`{"Flags":[{"name":"id","value":"iq__2"}]}`))
+	require.Equal(t, "iq__2", in2.Id)
+	require.Equal(t, []string{"p1", "p2"}, in2.Paths)
+}
+
+func TestResetCommand(t *testing.T) {
+	type inner struct {
+		Level int `cmd:"flag,level,a level"`
+	}
+	type opts struct {
+		Count   int      `cmd:"flag,count,a count"`
+		Verbose *bool    `cmd:"flag,verbose,verbose output"`
+		Tags    []string `cmd:"flag,tags,some tags"`
+		Labels  []string `cmd:"flag,label,some labels" meta:"repeat"`
+		Mode    string   `cmd:"flag,mode,the mode" choices:"a,b"`
+		Inner   *inner
+		Id      string   `cmd:"arg,id,content id,0"`
+		Paths   []string `cmd:"arg,paths,some paths,1,true"`
+	}
+	in := &opts{Count: 3, Tags: []string{"x"}, Inner: &inner{Level: 1}}
+	root := &cobra.Command{Use: "cli"}
+	var extra string
+	root.PersistentFlags().StringVar(&extra, "extra", "none", "an unbound flag")
+	var got opts
+	c := &cobra.Command{
+		Use: "get",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := SetArgs(cmd, args)
+			got = *in
+			return err
+		},
+	}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, in))
+
+	root.SetArgs([]string{"get", "--count", "5", "--verbose", "--tags", "a", "--tags", "b",
+		"--label", "l1", "--level", "2", "--extra", "some", "iq__1", "p1"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, 5, got.Count)
+	require.Equal(t, []string{"a", "b"}, got.Tags)
+	require.Equal(t, []string{"l1"}, got.Labels)
+	require.Equal(t, 2, in.Inner.Level)
+	require.Equal(t, "some", extra)
+
+	require.NoError(t, ResetCommand(root))
+	require.Equal(t, 3, in.Count)
+	require.Nil(t, in.Verbose)
+	require.Equal(t, []string{"x"}, in.Tags)
+	require.Equal(t, 1, in.Inner.Level)
+	require.Equal(t, "", in.Id)
+	require.Equal(t, "none", extra)
+	require.False(t, c.Flags().Lookup("count").Changed)
+	require.False(t, root.PersistentFlags().Lookup("extra").Changed)
+	// values are re-created without re-configuring the flags
+	require.Equal(t, "the mode (one of: a|b)", c.Flags().Lookup("mode").Usage)
+	require.NoError(t, c.RegisterFlagCompletionFunc("mode", nil))
+
+	root.SetArgs([]string{"get", "--tags", "c", "--label", "l2", "iq__2"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, 3, got.Count)
+	require.Nil(t, got.Verbose)
+	require.Equal(t, []string{"c"}, got.Tags)
+	require.Equal(t, []string{"l2"}, got.Labels)
+	require.Equal(t, 1, in.Inner.Level)
+	require.Equal(t, "iq__2", got.Id)
+	require.Empty(t, got.Paths)
+	require.NoError(t, ResetCommand(nil))
+}
+
+func TestCheckShadowing(t *testing.T) {
+	type rootOpts struct {
+		Verbose bool   `cmd:"flag,verbose,verbose output,v,true"`
+		Output  string `cmd:"flag,output,output format,o,true"`
+	}
+	type shadowing struct {
+		Output string `cmd:"flag,output,output file"`
+	}
+	type overriding struct {
+		Output string `cmd:"flag,output,output file" meta:"override"`
+	}
+	type colliding struct {
+		Version bool `cmd:"flag,version,print version,v"`
+	}
+	type shadowingArg struct {
+		Verbose string `cmd:"arg,verbose,an arg,0"`
+	}
+	newTree := func(in interface{}) (*cobra.Command, *cobra.Command) {
+		root := &cobra.Command{Use: "cli"}
+		require.NoError(t, Bind(root, &rootOpts{}))
+		group := &cobra.Command{Use: "group"}
+		root.AddCommand(group)
+		c := &cobra.Command{Use: "get", RunE: func(*cobra.Command, []string) error { return nil }}
+		group.AddCommand(c)
+		require.NoError(t, Bind(c, in))
+		return root, c
+	}
+
+	for _, in := range []interface{}{&shadowing{}, &shadowingArg{}} {
+		root, _ := newTree(in)
+		err := CheckShadowing(root)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrDuplicateFlag))
+		require.Equal(t, "cli group get", err.(*errors.Error).Field("command"))
+		require.Equal(t, "cli", err.(*errors.Error).Field("parent"))
+	}
+
+	root, _ := newTree(&colliding{})
+	err := CheckShadowing(root)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrDuplicateFlag))
+	require.Equal(t, "verbose", err.(*errors.Error).Field("parent_flag"))
+
+	in := &overriding{}
+	root, c := newTree(in)
+	require.NoError(t, CheckShadowing(root))
+	root.SetArgs([]string{"group", "get", "--output", "out.txt", "-v"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, "out.txt", in.Output)
+	require.NoError(t, CheckShadowing(root)) // inherited flags are merged after execution
+	require.True(t, c.Flags().Lookup("verbose").Changed)
+}
+
+func TestEnv(t *testing.T) {
+	type envInput struct {
+		Port   int      `cmd:"flag,port,listen port" env:"BFLAGS_TEST_PORT"`
+		Host   string   `cmd:"flag,host,listen host,,,true"`
+		DryRun bool     `cmd:"flag,dry-run,dry run"`
+		Tags   []string `cmd:"flag,tags,tags"`
+		ID     string   `cmd:"arg,id,an id,0"`
+	}
+	t.Setenv("BFLAGS_TEST_PORT", "8080")
+	t.Setenv("APP_HOST", "localhost")
+	t.Setenv("APP_DRY_RUN", "true")
+	t.Setenv("APP_TAGS", "a,b")
+	t.Setenv("APP_ID", "ignored")
+
+	in := &envInput{}
+	c := &cobra.Command{Use: "serve", Args: cobra.ArbitraryArgs, RunE: func(*cobra.Command, []string) error { return nil }}
+	require.NoError(t, BindEnv(c, in, "APP_"))
+	require.Contains(t, c.Flags().Lookup("port").Usage, "(env BFLAGS_TEST_PORT)")
+	require.Contains(t, c.Flags().Lookup("dry-run").Usage, "(env APP_DRY_RUN)")
+
+	require.NoError(t, c.ParseFlags([]string{"--port", "9000"}))
+	_, err := SetArgs(c, []string{"x"})
+	require.NoError(t, err)
+	require.Equal(t, &envInput{Port: 9000, Host: "localhost", DryRun: true, Tags: []string{"a", "b"}, ID: "x"}, in)
+	require.Nil(t, c.Flags().Lookup("port").Annotations[EnvAnnotation])
+	require.Equal(t, []string{"APP_HOST"}, c.Flags().Lookup("host").Annotations[EnvAnnotation])
+
+	// a required flag bound to an unset variable is missing
+	require.NoError(t, os.Unsetenv("APP_HOST"))
+	c = &cobra.Command{Use: "serve", RunE: func(*cobra.Command, []string) error { return nil }}
+	require.NoError(t, BindEnv(c, &envInput{}, "APP_"))
+	_, err = SetArgs(c, []string{"x"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrMissingFlag), err)
+
+	// invalid values are reported with the variable
+	t.Setenv("BFLAGS_TEST_PORT", "abc")
+	c = &cobra.Command{Use: "serve"}
+	in = &envInput{}
+	require.NoError(t, Bind(c, in))
+	_, err = SetArgs(c, []string{"x"})
+	require.Error(t, err)
+	require.Equal(t, "BFLAGS_TEST_PORT", err.(*errors.Error).Field("env"))
+}
+
+func TestFlagGroups(t *testing.T) {
+	type authInput struct {
+		Token    string `cmd:"flag,token,auth token" group:"auth"`
+		User     string `cmd:"flag,user,user name" group:"auth:xor,basic:and"`
+		Password string `cmd:"flag,password,user password" group:"basic:and"`
+	}
+	run := func(args ...string) error {
+		c := &cobra.Command{Use: "login", RunE: func(*cobra.Command, []string) error { return nil }}
+		require.NoError(t, Bind(c, &authInput{}))
+		c.SetArgs(append([]string{}, args...))
+		c.SetOut(io.Discard)
+		c.SetErr(io.Discard)
+		return c.Execute()
+	}
+	require.NoError(t, run())
+	require.NoError(t, run("--token", "t"))
+	require.NoError(t, run("--user", "u", "--password", "p"))
+
+	err := run("--token", "t", "--user", "u", "--password", "p")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "none of the others can be")
+	err = run("--user", "u")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must all be set")
+
+	type single struct {
+		Token string `cmd:"flag,token,auth token" group:"auth"`
+	}
+	type conflicting struct {
+		Token string `cmd:"flag,token,auth token" group:"auth:xor"`
+		User  string `cmd:"flag,user,user name" group:"auth:and"`
+	}
+	type invalid struct {
+		Token string `cmd:"flag,token,auth token" group:"auth:or"`
+	}
+	type arg struct {
+		ID string `cmd:"arg,id,an id,0" group:"ids"`
+	}
+	for _, in := range []interface{}{&single{}, &conflicting{}, &invalid{}, &arg{}} {
+		err = Bind(&cobra.Command{Use: "login"}, in)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrBadTag), err)
+	}
+}
+
+func TestCompleteTag(t *testing.T) {
+	RegisterCompletion("test-colors", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return []string{"red", "green"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	type completeIn struct {
+		Config string   `cmd:"flag,config,config file" complete:"file:json|yaml"`
+		Out    string   `cmd:"flag,out,output directory" complete:"dirs"`
+		Color  string   `cmd:"flag,color,a color" choices:"blue,yellow" complete:"test-colors"`
+		Names  []string `cmd:"arg,names,some names,0" complete:"none"`
+	}
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{Use: "test", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, &completeIn{}))
+	RegisterCompletions(root)
+	complete := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd, "test"}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Equal(t, "json\nyaml\n:8\n", complete("--config", ""))
+	require.Equal(t, ":16\n", complete("--out", ""))
+	require.Equal(t, "red\ngreen\n:4\n", complete("--color", ""))
+	require.Equal(t, ":4\n", complete("a", ""))
+
+	type unknown struct {
+		Config string `cmd:"flag,config,config file" complete:"unknown"`
+	}
+	err := Bind(&cobra.Command{Use: "test"}, &unknown{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrBadTag), err)
+}
+
+func TestTimeFlags(t *testing.T) {
+	type timeInput struct {
+		Since time.Time  `cmd:"flag,since,start date" layout:"2006-01-02"`
+		Until *time.Time `cmd:"flag,until,end time"`
+		At    time.Time  `cmd:"arg,at,time of the event,0"`
+	}
+	in := &timeInput{}
+	c := &cobra.Command{Use: "events"}
+	require.NoError(t, Bind(c, in))
+	require.Equal(t, "time", c.Flags().Lookup("since").Value.Type())
+	require.Equal(t, "", c.Flags().Lookup("since").DefValue)
+
+	require.NoError(t, c.ParseFlags([]string{"--since", "2024-03-01", "--until", "2024-03-31T18:00:00Z"}))
+	_, err := SetArgs(c, []string{"2024-03-15T09:30:00+01:00"})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), in.Since)
+	require.NotNil(t, in.Until)
+	require.Equal(t, time.Date(2024, 3, 31, 18, 0, 0, 0, time.UTC), *in.Until)
+	require.True(t, time.Date(2024, 3, 15, 8, 30, 0, 0, time.UTC).Equal(in.At))
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	fb, _ := flags.Get("since")
+	require.Equal(t, []string{"--since", "2024-03-01"}, fb.CmdString())
+
+	// values not matching the layout are rejected
+	c = &cobra.Command{Use: "events"}
+	require.NoError(t, Bind(c, &timeInput{}))
+	require.Error(t, c.ParseFlags([]string{"--since", "2024-03-01T00:00:00Z"}))
+
+	// the layout tag is only valid for time values
+	type badLayout struct {
+		Name string `cmd:"flag,name,a name" layout:"2006"`
+	}
+	err = Bind(&cobra.Command{Use: "bad"}, &badLayout{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrBadTag), err)
+}
+
+func TestValidateTag(t *testing.T) {
+	type validInput struct {
+		Port    int           `cmd:"flag,port,listen port" validate:"min=1,max=65535"`
+		Name    string        `cmd:"flag,name,user name" validate:"nonempty,max=8,regexp=^[a-z]{1,8}$"`
+		Mode    string        `cmd:"flag,mode,mode" validate:"oneof=fast|slow"`
+		Tags    []string      `cmd:"flag,tags,tags" validate:"max=2,oneof=a|b|c"`
+		Timeout time.Duration `cmd:"flag,timeout,timeout" validate:"min=1s"`
+		Key     string        `cmd:"flag,key,api key" meta:"secret" validate:"regexp=^k-"`
+		Id      string        `cmd:"arg,id,an id,0" validate:"nonempty"`
+	}
+	set := func(args ...string) (*validInput, error) {
+		in := &validInput{}
+		c := &cobra.Command{Use: "test"}
+		require.NoError(t, Bind(c, in))
+		flags, args := args[:len(args)-1], args[len(args)-1:]
+		require.NoError(t, c.ParseFlags(flags))
+		_, err := SetArgs(c, args)
+		return in, err
+	}
+
+	in, err := set("--port", "80", "--name", "joe", "--mode", "fast", "--tags", "a,c", "--timeout", "2s", "--key", "k-1", "x")
+	require.NoError(t, err)
+	require.Equal(t, &validInput{Port: 80, Name: "joe", Mode: "fast", Tags: []string{"a", "c"}, Timeout: 2 * time.Second, Key: "k-1", Id: "x"}, in)
+
+	// zero values not set are only checked by nonempty
+	_, err = set("--name", "joe", "x")
+	require.NoError(t, err)
+
+	_, err = set("--port", "0", "--name", "joe", "x")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrInvalidValue), err)
+	require.Equal(t, cmdFlag("port"), errors.Field(err, "flag"))
+
+	// all failing flags are reported
+	_, err = set("--port", "70000", "--name", "Joe", "--mode", "medium", "--tags", "a,b,c", "--timeout", "1ms", "--key", "secret", "")
+	require.Error(t, err)
+	list, ok := err.(*errors.Error).Cause().(*errors.ErrorList)
+	require.True(t, ok, err)
+	var failed []string
+	for _, le := range list.Errors {
+		require.True(t, errors.Is(le, ErrInvalidValue), le)
+		failed = append(failed, string(errors.Field(le, "flag").(cmdFlag)))
+		if errors.Field(le, "flag") == cmdFlag("key") {
+			require.Equal(t, RedactedValue, errors.Field(le, "value"))
+		}
+	}
+	require.Equal(t, []string{"port", "name", "mode", "tags", "timeout", "key", "id"}, failed)
+
+	// invalid rules are reported when binding
+	type badRule struct {
+		Name string `cmd:"flag,name,a name" validate:"min=a"`
+	}
+	type unknownRule struct {
+		Name string `cmd:"flag,name,a name" validate:"email"`
+	}
+	type badType struct {
+		On bool `cmd:"flag,on,on" validate:"max=1"`
+	}
+	for _, in := range []interface{}{&badRule{}, &unknownRule{}, &badType{}} {
+		err = Bind(&cobra.Command{Use: "bad"}, in)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrBadTag), err)
+	}
+}
+
+func TestCountFlags(t *testing.T) {
+	type countInput struct {
+		Verbose int `cmd:"flag,verbose,verbosity,v,,,,count"`
+		Level   int `cmd:"flag,level,level,l,,,,count"`
+	}
+	parse := func(args ...string) (*countInput, *cobra.Command) {
+		in := &countInput{Level: 1}
+		c := &cobra.Command{Use: "test"}
+		require.NoError(t, Bind(c, in))
+		require.NoError(t, c.ParseFlags(args))
+		_, err := SetArgs(c, nil)
+		require.NoError(t, err)
+		return in, c
+	}
+	in, c := parse()
+	require.Equal(t, &countInput{Verbose: 0, Level: 1}, in)
+	require.Equal(t, "count", c.Flags().Lookup("verbose").Value.Type())
+	require.Equal(t, "1", c.Flags().Lookup("level").DefValue)
+
+	in, _ = parse("-vvv", "-l")
+	require.Equal(t, &countInput{Verbose: 3, Level: 2}, in)
+
+	in, c = parse("--verbose", "-v", "--level=5")
+	require.Equal(t, &countInput{Verbose: 2, Level: 5}, in)
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	fb, _ := flags.Get("verbose")
+	require.True(t, fb.Count)
+	require.Equal(t, []string{"--verbose=2"}, fb.CmdString())
+
+	fb, isArg := FlagBondFromTag("Verbose", `cmd:"flag,verbose,verbosity,v,,,,count"`)
+	require.False(t, isArg)
+	require.True(t, fb.Count)
+
+	// count flags must be bound to an int
+	type badCount struct {
+		Verbose bool `cmd:"flag,verbose,verbosity,v,,,,count"`
+	}
+	err = Bind(&cobra.Command{Use: "bad"}, &badCount{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrBadTag), err)
+}
+
+func TestGetFlagArgs(t *testing.T) {
+	type typedOpts struct {
+		Count    int      `cmd:"flag,count,a count"`
+		Verbose  *bool    `cmd:"flag,verbose,verbose output"`
+		Password string   `cmd:"flag,password,the password"`
+		Id       string   `cmd:"arg,id,content id,0"`
+		Paths    []string `cmd:"arg,paths,some paths,1,true"`
+	}
+	in := &typedOpts{Count: 3}
+	c := &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, in))
+	require.NoError(t, c.ParseFlags([]string{"--password", "pwd", "--verbose"}))
+	_, err := SetArgs(c, []string{"iq__1"})
+	require.NoError(t, err)
+
+	fas := GetFlagArgs(c)
+	require.Len(t, fas, 5)
+	require.Equal(t, &FlagArg{Name: "count", Value: 3}, fas["count"])
+	require.Equal(t, &FlagArg{Name: "verbose", Value: true, IsSet: true}, fas["verbose"])
+	require.Equal(t, "true", fas["verbose"].String())
+	require.Equal(t, &FlagArg{Name: "password", Value: "pwd", IsSet: true, Secret: true}, fas["password"])
+	require.Equal(t, RedactedValue, fas["password"].String())
+	require.Equal(t, &FlagArg{Name: "id", Value: "iq__1", IsSet: true, IsArg: true}, fas["id"])
+	require.Equal(t, "iq__1", fas["id"].String())
+	require.False(t, fas["paths"].IsSet)
+	require.True(t, fas["paths"].IsArg)
+
+	// nil pointers have no value
+	in.Verbose = nil
+	fas = GetFlagArgs(c)
+	require.Nil(t, fas["verbose"].Value)
+	require.Equal(t, "", fas["verbose"].String())
+
+	set := fas.Set()
+	require.Len(t, set, 3)
+	require.Contains(t, set, "verbose")
+	require.NotContains(t, set, "count")
+}
+
+func TestSplat(t *testing.T) {
+	type splatOpts struct {
+		Config  params.Json `cmd:"flag,config,config file" splat:"true" json:"-"`
+		Name    string      `cmd:"flag,name,the name" json:"name"`
+		Count   int         `cmd:"flag,count,a count" json:"count"`
+		Tags    []string    `cmd:"flag,tags,some tags" json:"tags"`
+		Timeout string      `cmd:"flag,timeout,the timeout" json:"timeout"`
+		Id      string      `cmd:"arg,id,content id,0" json:"id"`
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	err := os.WriteFile(file, []byte(`{"name":"file","count":5,"tags":["f1","f2"],"id":"file-id"}`), 0644)
+	require.NoError(t, err)
+
+	in := &splatOpts{Name: "default", Timeout: "1s", Tags: []string{"d"}}
+	c := &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, in))
+	require.NoError(t, c.ParseFlags([]string{"--config", "@" + file, "--count", "3", "--tags", "x"}))
+	_, err = SetArgs(c, []string{"arg-id"})
+	require.NoError(t, err)
+
+	require.Equal(t, "file", in.Name)        // file overrides default
+	require.Equal(t, 3, in.Count)            // explicit flag overrides file
+	require.Equal(t, []string{"x"}, in.Tags) // explicit flag overrides file
+	require.Equal(t, "1s", in.Timeout)       // default not in file
+	require.Equal(t, "arg-id", in.Id)        // explicit arg overrides file
+	require.Equal(t, params.Json("@"+file), in.Config)
+
+	// no splat without value
+	in = &splatOpts{Name: "default"}
+	c = &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, in))
+	_, err = SetArgs(c, []string{"arg-id"})
+	require.NoError(t, err)
+	require.Equal(t, "default", in.Name)
+
+	// invalid json
+	c = &cobra.Command{Use: "test"}
+	require.NoError(t, Bind(c, &splatOpts{}))
+	require.NoError(t, c.ParseFlags([]string{"--config", "{bad"}))
+	_, err = SetArgs(c, []string{"arg-id"})
+	require.Error(t, err)
+
+	// named string types must implement flag.Value
+	type name string
+	err = Bind(&cobra.Command{Use: "test"}, &struct {
+		Name name `cmd:"flag,name,the name"`
+	}{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrUnsupportedType), err)
+}
+
+func TestGenerateExample(t *testing.T) {
+	type exampleIn struct {
+		Qfab     string   `cmd:"flag,qfab,fabric url"`
+		Qid      string   `cmd:"flag,qid,content id,,,true"`
+		Verbose  bool     `cmd:"flag,verbose,verbose output"`
+		Password string   `cmd:"flag,password,the password"`
+		Tags     []string `cmd:"flag,tags,tags"`
+		Debug    bool     `cmd:"flag,debug,debug,,,,true"`
+		Name     string   `cmd:"arg,name,the name,0"`
+		Files    []string `cmd:"arg,files,the files,1,true"`
+	}
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{Use: "get", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(c)
+	in := &exampleIn{
+		Qfab:     "http://host:8008",
+		Verbose:  true,
+		Password: "s3cret",
+		Tags:     []string{"a b", "c"},
+		Debug:    true,
+	}
+	require.NoError(t, Bind(c, in))
+
+	require.Equal(t,
+		"cli get --password '***' --qfab http://host:8008 --qid <qid> --tags 'a b,c' --verbose <name>",
+		GenerateExample(c))
+
+	SetDefaultExample(root)
+	require.Equal(t, "", root.Example) // not runnable
+	require.Equal(t, GenerateExample(c), c.Example)
+
+	c.Example = "cli get x"
+	SetDefaultExample(root)
+	require.Equal(t, "cli get x", c.Example)
+}
+
+func TestChoices(t *testing.T) {
+	type choicesIn struct {
+		Format string   `cmd:"flag,format,output format" choices:"json, yaml,text" post:"lower"`
+		Fields []string `cmd:"flag,fields,fields to show" choices:"id,name"`
+		Level  int      `cmd:"flag,level,level" choices:"1,2"`
+		Kind   string   `cmd:"arg,kind,the kind,0" choices:"a,b"`
+	}
+	newCmd := func() (*cobra.Command, *choicesIn) {
+		in := &choicesIn{Format: "json", Level: 1}
+		c := &cobra.Command{Use: "test"}
+		require.NoError(t, Bind(c, in))
+		return c, in
+	}
+
+	c, in := newCmd()
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"json", "yaml", "text"}, flags["format"].Choices)
+	require.Contains(t, c.Flags().Lookup("format").Usage, "output format (one of: json|yaml|text)")
+	argset, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+	require.Equal(t, "  kind : the kind (one of: a|b)", argset.ArgUsages())
+	bb, err := json.Marshal(argset)
+	require.NoError(t, err)
+	require.Contains(t, string(bb), `"choices":["a","b"]`)
+
+	require.NoError(t, c.ParseFlags([]string{"--format", "YAML", "--fields", "id,name", "--level", "2"}))
+	_, err = SetArgs(c, []string{"b"})
+	require.NoError(t, err)
+	require.Equal(t, &choicesIn{Format: "yaml", Fields: []string{"id", "name"}, Level: 2, Kind: "b"}, in)
+
+	for _, args := range [][]string{
+		{"--format", "xml", "a"},
+		{"--fields", "id,other", "a"},
+		{"--level", "3", "a"},
+		{"c"},
+	} {
+		c, _ = newCmd()
+		require.NoError(t, c.ParseFlags(args[:len(args)-1]))
+		_, err = SetArgs(c, args[len(args)-1:])
+		require.True(t, errors.Is(err, ErrInvalidChoice), "%v %v", args, err)
+	}
+
+	// completion of flags and args
+	root := &cobra.Command{Use: "cli"}
+	c = &cobra.Command{Use: "test", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, &choicesIn{}))
+	RegisterCompletions(root)
+	complete := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd, "test"}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Equal(t, "yaml\n:4\n", complete("--format", "y"))
+	require.Equal(t, "a\nb\n:4\n", complete(""))
+
+	// completions are registered with RegisterCompletions, not when binding,
+	// such that commands bound temporarily are not kept alive by cobra
+	c, _ = newCmd()
+	require.NoError(t, c.RegisterFlagCompletionFunc("format", choicesCompletion(nil)))
+}
+
+func TestFlagBuilder(t *testing.T) {
+	type reflectInput staticInput
+
+	in := &reflectInput{}
+	bonds := Bonds{
+		NewFlag("name").Short("n").Usage("the name").Bind(&in.Name),
+		NewFlag("verbose").Short("v").Usage("verbose output").Hidden().Bind(&in.Verbose),
+		NewArg("id").Usage("content id").Order(0).Meta("non-empty").Bind(&in.Id),
+		NewArg("paths").Usage("some paths").Order(1).Post("trim").Bind(&in.Paths),
+	}
+	c := &cobra.Command{Use: "cmd"}
+	require.NoError(t, Bind(c, bonds))
+	sflags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	sargs, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+
+	r := &cobra.Command{Use: "cmd"}
+	require.NoError(t, Bind(r, &reflectInput{}))
+	rflags, err := GetCmdFlagSet(r)
+	require.NoError(t, err)
+	rargs, err := GetCmdArgSet(r)
+	require.NoError(t, err)
+	require.Equal(t, rflags.String(), sflags.String())
+	require.Equal(t, rargs.String(), sargs.String())
+	require.Equal(t, r.Use, c.Use)
+	require.Equal(t, r.UsageString(), c.UsageString())
+
+	require.NoError(t, c.ParseFlags([]string{"-n", "joe"}))
+	v, err := SetArgs(c, []string{"iq__1", " a "})
+	require.NoError(t, err)
+	require.Equal(t, bonds, v)
+	require.Equal(t, &reflectInput{Name: "joe", Id: "iq__1", Paths: []string{"a"}}, in)
+
+	// a builder is reusable
+	b := NewFlag("format").Usage("output format").Choices("json", "text")
+	var f1, f2 string
+	fb1, fb2 := b.Bind(&f1), b.Bind(&f2)
+	require.Equal(t, []string{"json", "text"}, fb2.Choices)
+	require.True(t, fb1.Value != fb2.Value)
+
+	c = &cobra.Command{Use: "cmd"}
+	require.NoError(t, Bind(c, Bonds{fb1}))
+	require.NoError(t, c.ParseFlags([]string{"--format", "yaml"}))
+	_, err = SetArgs(c, nil)
+	require.True(t, errors.Is(err, ErrInvalidChoice))
+}
+
+func TestAuditLog(t *testing.T) {
+	type auditIn struct {
+		Name     string `cmd:"arg,name,the name,0"`
+		Password string `cmd:"flag,password,the password"`
+		Verbose  bool   `cmd:"flag,verbose,verbose output"`
+		Limit    *int   `cmd:"flag,limit,max results"`
+	}
+	errFail := errors.Str("failed")
+	b := NewBinder(
+		&auditIn{},
+		&cobra.Command{
+			Use:           "get <name>",
+			SilenceErrors: true,
+			SilenceUsage:  true,
+		},
+		func(in *auditIn) error {
+			if in.Name == "eve" {
+				return errors.E("get", errors.K.Permission, errFail)
+			}
+			return nil
+		},
+		nil)
+	buf := &bytes.Buffer{}
+	root := NewBinderC(&cobra.Command{Use: "cli"}).
+		Use(AuditLog(JSONLSink(buf))).
+		AddCommand(b)
+	require.NoError(t, root.Error)
+
+	root.Command.SetArgs([]string{"get", "joe", "--password", "pwd", "--limit", "5"})
+	require.NoError(t, root.Command.Execute())
+	root.Command.SetArgs([]string{"get", "eve"})
+	require.Error(t, root.Command.Execute())
+
+	require.NotContains(t, buf.String(), "pwd")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	recs := make([]*AuditRecord, len(lines))
+	for i, line := range lines {
+		recs[i] = &AuditRecord{}
+		require.NoError(t, json.Unmarshal([]byte(line), recs[i]))
+		require.Equal(t, "cli get", recs[i].Command)
+		require.NotEmpty(t, recs[i].Duration)
+		require.False(t, recs[i].Time.IsZero())
+	}
+	require.Equal(t, "ok", recs[0].Status)
+	// values of pointer fields are logged, not their address
+	require.Equal(t, map[string]string{"name": "joe", "password": RedactedValue, "limit": "5"}, recs[0].Flags)
+	require.Equal(t, "error", recs[1].Status)
+	require.Equal(t, "op [get] kind [permission denied] cause [failed]", recs[1].Error)
+
+	// errors writing the record fail the command
+	file := filepath.Join(t.TempDir(), "missing", "audit.jsonl")
+	UseMiddleware(root.Command, AuditLog(FileSink(file)))
+	root.Command.SetArgs([]string{"get", "joe"})
+	err := root.Command.Execute()
+	require.True(t, errors.IsKind(errors.K.IO, err), err)
+}
+
+type parseInput struct {
+	Qid   string        `cmd:"flag,qid,content id,q"`
+	Count int           `cmd:"flag,count,the count"`
+	Mode  string        `cmd:"flag,mode,the mode" choices:"fast,slow"`
+	Wait  time.Duration `cmd:"flag,wait,wait time"`
+	Path  string        `cmd:"arg,path,the path,0"`
+	Files []string      `cmd:"arg,files,some files,1,true"`
+}
+
+func TestParseInto(t *testing.T) {
+	in := &parseInput{Count: 1}
+	err := ParseInto(in, []string{"-q", "iq__x", "--wait", "2s", "/a", "f1", "f2"})
+	require.NoError(t, err)
+	require.Equal(t, &parseInput{
+		Qid:   "iq__x",
+		Count: 1,
+		Wait:  2 * time.Second,
+		Path:  "/a",
+		Files: []string{"f1", "f2"},
+	}, in)
+
+	type required struct {
+		Qid string `cmd:"flag,qid,content id,q,false,true"`
+	}
+	for _, test := range []struct {
+		v     interface{}
+		argv  []string
+		cause error
+	}{
+		{v: &parseInput{}, argv: []string{}, cause: ErrMissingArg},
+		{v: &parseInput{}, argv: []string{"--mode", "medium", "/a"}, cause: ErrInvalidChoice},
+		{v: &required{}, argv: []string{}, cause: ErrMissingFlag},
+		{v: &parseInput{}, argv: []string{"--count", "x", "/a"}},
+		{v: &parseInput{}, argv: []string{"--unknown", "/a"}},
+		{v: parseInput{}, argv: []string{"/a"}},
+	} {
+		err = ParseInto(test.v, test.argv)
+		require.Error(t, err, test.argv)
+		require.True(t, errors.IsKind(errors.K.Invalid, err), err)
+		if test.cause != nil {
+			require.True(t, errors.Is(err, test.cause), err)
+		}
+	}
+
+	// nothing of the throwaway command is kept: neither its state nor the
+	// completion of its flags, which cobra never releases
+	cmd := &cobra.Command{Use: "parse"}
+	require.NoError(t, parseInto(cmd, &parseInput{}, []string{"/a"}))
+	require.Nil(t, getState(cmd))
+	require.NoError(t, cmd.RegisterFlagCompletionFunc("mode", choicesCompletion(nil)))
+}
+
+func FuzzParseInto(f *testing.F) {
+	f.Add("-q iq__x --count 3 /a f1 f2")
+	f.Add("--mode fast --wait 1m /a")
+	f.Add("--count=-1 -- --qid")
+	f.Fuzz(func(t *testing.T, cmdline string) {
+		_ = ParseInto(&parseInput{}, strings.Fields(cmdline))
+	})
 }
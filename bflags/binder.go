@@ -29,17 +29,21 @@ type bindOpts struct {
 
 // An flagsBinder binds flags and args into a *cobra.Command.
 type flagsBinder struct {
-	cmd      *cobra.Command
-	custom   Flagger
-	cmdFlags CmdFlags
-	argFlags []*FlagBond
+	cmd        *cobra.Command
+	custom     Flagger
+	cmdFlags   CmdFlags
+	argFlags   []*FlagBond
+	fieldCount int // count of fields of the top level struct, used as capacity hint
 }
 
+// Reset prepares the binder for binding to c. The flags and args are not
+// reused across bindings since they are stored with the command: they are
+// allocated lazily by setFlagBound.
 func (e *flagsBinder) Reset(c *cobra.Command, custom Flagger) {
 	e.cmd = c
 	e.custom = custom
-	e.cmdFlags = make(CmdFlags)
-	e.argFlags = make([]*FlagBond, 0)
+	e.cmdFlags = nil
+	e.argFlags = nil
 }
 
 type bindError struct{ error }
@@ -67,13 +71,54 @@ func (e *flagsBinder) bind(v interface{}, opts bindOpts) (err error) {
 			}
 		}
 	}()
-	ex := errors.Template("bind", "v", fmt.Sprintf("%#v", v))
+	ex := func(args ...interface{}) error {
+		return errors.E(append([]interface{}{"bind", "v", fmt.Sprintf("%#v", v)}, args...)...)
+	}
 	val := reflect.ValueOf(v)
 	if val.Kind() != reflect.Interface && val.Kind() != reflect.Ptr {
-		return ex("reason", "cannot call value.Elem",
+		return ex(ErrUnsupportedType, "reason", "cannot call value.Elem",
 			"kind", val.Kind().String())
 	}
+	if elem := val.Elem(); elem.Kind() == reflect.Struct {
+		e.fieldCount = len(cachedTypeFields(elem.Type()))
+	}
 	e.reflectValue(val.Elem(), opts)
+	return e.configure(v, ex)
+}
+
+// bindStatic binds the flags and args returned by the StaticBinder sb without
+// using reflection.
+func (e *flagsBinder) bindStatic(v interface{}, sb StaticBinder) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if je, ok := r.(bindError); ok {
+				err = je.error
+			} else {
+				panic(r)
+			}
+		}
+	}()
+	ex := func(args ...interface{}) error {
+		return errors.E(append([]interface{}{"bindStatic", "type", errors.TypeOf(v)}, args...)...)
+	}
+	flags, args := sb.StaticBonds()
+	e.fieldCount = len(flags) + len(args)
+	for _, fb := range flags {
+		fb.isArg = false
+		e.addFlagBond(fb, &flagSpec{name: string(fb.Name)})
+	}
+	for _, fb := range args {
+		fb.isArg = true
+		e.addFlagBond(fb, &argSpec{name: string(fb.Name)})
+	}
+	return e.configure(v, ex)
+}
+
+// configure registers the bound flags and args with the command.
+func (e *flagsBinder) configure(v interface{}, ex func(args ...interface{}) error) (err error) {
+	if e.cmdFlags == nil {
+		e.cmdFlags = make(CmdFlags)
+	}
 	err = e.cmdFlags.ConfigureCmd(e.cmd, e.custom)
 	if err != nil {
 		return err
@@ -84,7 +129,7 @@ func (e *flagsBinder) bind(v interface{}, opts bindOpts) (err error) {
 		hasOrder := e.argFlags[0].ArgOrder >= 0
 		for i := 1; i < len(e.argFlags); i++ {
 			if (e.argFlags[i].ArgOrder >= 0) != hasOrder {
-				return ex("reason", "args order must be either fully specified or not at all",
+				return ex(ErrBadTag, "reason", "args order must be either fully specified or not at all",
 					"arg_flag", e.argFlags[i].Name,
 					"order", e.argFlags[i].ArgOrder)
 			}
@@ -98,10 +143,10 @@ func (e *flagsBinder) bind(v interface{}, opts bindOpts) (err error) {
 		}
 		if fb.ArgOrder >= 0 {
 			if fb.ArgOrder >= len(e.argFlags) {
-				return ex("reason", "invalid order specified", "found order", fb.ArgOrder)
+				return ex(ErrBadTag, "reason", "invalid order specified", "found order", fb.ArgOrder)
 			}
 			if argf[fb.ArgOrder] != nil {
-				return ex("reason", "duplicate order specified", "found order", fb.ArgOrder)
+				return ex(ErrBadTag, "reason", "duplicate order specified", "found order", fb.ArgOrder)
 			}
 			argf[fb.ArgOrder] = fb
 		} else {
@@ -109,11 +154,20 @@ func (e *flagsBinder) bind(v interface{}, opts bindOpts) (err error) {
 		}
 	}
 	setCmdArgSet(e.cmd, argf)
+	setArgsCompletion(e.cmd, argf)
 	setCmdInput(e.cmd, v)
 
 	return nil
 }
 
+// specError returns a function creating errors for the given op and spec.
+// Unlike errors.Template, nothing is allocated until an error is reported.
+func specError(op string, spec cmdSpec) func(args ...interface{}) *errors.Error {
+	return func(args ...interface{}) *errors.Error {
+		return errors.E(append([]interface{}{op, "tag_type", spec.kind(), "name", spec.getName()}, args...)...)
+	}
+}
+
 // error aborts the binding by panicking with err wrapped in bindError.
 func (e *flagsBinder) error(err *errors.Error) {
 	panic(bindError{error: err})
@@ -124,46 +178,93 @@ func (e *flagsBinder) reflectValue(v reflect.Value, opts bindOpts) {
 }
 
 func (e *flagsBinder) setFlagBound(ptr interface{}, spec cmdSpec) {
-	ex := errors.Template("setFlagBound",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
-
 	short := ""
 	required := false
 	persistent := false
 	hidden := false
+	count := false
 	order := -1
 	isArg := false
+	optional := false
 	if spec.kind() == flagTag {
 		short = spec.(*flagSpec).shorthand
 		persistent = spec.(*flagSpec).persistent
 		required = spec.(*flagSpec).required
 		hidden = spec.(*flagSpec).hidden
+		count = spec.(*flagSpec).count
 	} else {
 		isArg = true
 		order = spec.(*argSpec).order
+		optional = spec.(*argSpec).optional
 	}
 
 	name := cmdFlag(spec.getName())
 	fb := &FlagBond{
-		isArg:       isArg,
-		Name:        name,
-		Shorthand:   short,
-		Value:       ptr,
-		Usage:       spec.getDescription(),
-		Required:    required,
-		Persistent:  persistent,
-		Hidden:      hidden,
-		ArgOrder:    order,
-		Annotations: spec.getAnnotations(),
+		isArg:          isArg,
+		Name:           name,
+		Shorthand:      short,
+		Value:          ptr,
+		Usage:          spec.getDescription(),
+		Required:       required,
+		Persistent:     persistent,
+		Hidden:         hidden,
+		Count:          count,
+		ArgOrder:       order,
+		Optional:       optional,
+		Annotations:    spec.getAnnotations(),
+		PostProcessors: spec.getPostProcessors(),
+		Separator:      spec.getSeparator(),
+		Repeat:         spec.getRepeat(),
+		Choices:        spec.getChoices(),
+		Env:            spec.getEnv(),
+		Groups:         spec.getGroups(),
+		Complete:       spec.getComplete(),
+		Layout:         spec.getLayout(),
+		Validate:       spec.getValidate(),
+		Splat:          spec.getSplat(),
+	}
+	e.addFlagBond(fb, spec)
+}
+
+// addFlagBond adds fb to the flags or args of the binder depending on the kind
+// of spec.
+func (e *flagsBinder) addFlagBond(fb *FlagBond, spec cmdSpec) {
+	ex := specError("setFlagBound", spec)
+	name := fb.Name
+	for _, pp := range fb.PostProcessors {
+		if _, ok := getPostProcessor(pp); !ok {
+			e.error(ex(ErrBadTag, "reason", "unknown post processor", "post_processor", pp))
+		}
+	}
+	if err := checkGroups(fb); err != nil {
+		e.error(ex(err))
+	}
+	if _, err := tagCompletion(fb.Complete); err != nil {
+		e.error(ex(err))
+	}
+	if err := checkLayout(fb); err != nil {
+		e.error(ex(err))
+	}
+	if _, err := fb.validationRules(); err != nil {
+		e.error(ex(err))
+	}
+	if err := checkCount(fb); err != nil {
+		e.error(ex(err))
 	}
 
 	if spec.kind() == flagTag {
 		if _, ok := e.cmdFlags[name]; ok {
-			e.error(ex("reason", "duplicate flag", "name", name))
+			e.error(ex(ErrDuplicateFlag, "reason", "duplicate flag", "name", name))
+		}
+		if e.cmdFlags == nil {
+			e.cmdFlags = make(CmdFlags, e.fieldCount)
 		}
+		fb.declOrder = len(e.cmdFlags)
 		e.cmdFlags[name] = fb
 	} else {
+		if e.argFlags == nil {
+			e.argFlags = make([]*FlagBond, 0, e.fieldCount)
+		}
 		e.argFlags = append(e.argFlags, fb)
 	}
 }
@@ -180,16 +281,16 @@ func (e *flagsBinder) valueBinder(v reflect.Value) binderFunc {
 type binderFunc func(e *flagsBinder, v reflect.Value, spec cmdSpec, opts bindOpts)
 
 func invalidValueBinder(e *flagsBinder, v reflect.Value, _ cmdSpec, _ bindOpts) {
-	e.error(errors.E("invalid value", "value", v))
+	e.error(errors.E("invalid value", ErrUnsupportedType, "value", v))
 }
 
 func unsupportedTypeBinder(e *flagsBinder, v reflect.Value, _ cmdSpec, _ bindOpts) {
-	e.error(errors.E("unsupported type", "type", v.Type()))
+	e.error(errors.E("unsupported type", ErrUnsupportedType, "type", v.Type()))
 }
 
 func interfaceBinder(e *flagsBinder, v reflect.Value, _ cmdSpec, opts bindOpts) {
 	if v.IsNil() {
-		e.error(errors.E("unsupported type", "type", v.Type(), "reason", "nil interface"))
+		e.error(errors.E("unsupported type", ErrUnsupportedType, "type", v.Type(), "reason", "nil interface"))
 		return
 	}
 	e.reflectValue(v.Elem(), opts)
@@ -218,14 +319,12 @@ type arrayBinder struct {
 }
 
 func (ae *arrayBinder) bind(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("arrayBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("arrayBinder", spec)
 
 	iface := v.Addr().Interface()
 	ok := v.Kind() == reflect.Slice || v.Kind() == reflect.Array
 	if !ok {
-		e.error(ex("wrong type, expected slice or array, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected slice or array, got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(iface, spec)
 }
@@ -241,18 +340,16 @@ type ptrBinder struct {
 }
 
 func (pe ptrBinder) bind(e *flagsBinder, v reflect.Value, spec cmdSpec, opts bindOpts) {
-	ex := errors.Template("ptrBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("ptrBinder", spec)
 	if v.IsNil() {
 		iface := v.Addr().Interface()
 		switch ptr := iface.(type) {
-		case **bool, **string, **int, **int64:
+		case **bool, **string, **int, **int64, **uint, **float64, **time.Duration, **time.Time, **net.IP:
 			// allow binding to nil of these
 			e.setFlagBound(ptr, spec)
 		default:
 			// others are not supported
-			e.error(ex("reason", "can't bind to nil pointer"))
+			e.error(ex(ErrUnsupportedType, "reason", "can't bind to nil pointer"))
 		}
 		return
 	}
@@ -265,35 +362,34 @@ func newPtrBinder(e *flagsBinder, t reflect.Type) binderFunc {
 }
 
 func boolBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("boolBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("boolBinder", spec)
 
 	iface := v.Addr().Interface()
 	ptr, ok := iface.(*bool)
 	if !ok {
-		e.error(ex("wrong type, expected *bool, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *bool, got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(ptr, spec)
 }
 
 func stringBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("stringBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("stringBinder", spec)
 
 	iface := v.Addr().Interface()
-	ptr, ok := iface.(*string)
+	if ptr, ok := iface.(*string); ok {
+		e.setFlagBound(ptr, spec)
+		return
+	}
+	// named string types like params.Json are bound if they implement flag.Value
+	fv, ok := iface.(flag.Value)
 	if !ok {
-		e.error(ex("wrong type, expected *string, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *string or flag.Value, got", reflect.TypeOf(iface)))
 	}
-	e.setFlagBound(ptr, spec)
+	e.setFlagBound(fv, spec)
 }
 
 func uintBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("uintBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("uintBinder", spec)
 
 	iface := v.Addr().Interface()
 
@@ -315,15 +411,13 @@ func uintBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
 	}
 
 	if !ok {
-		e.error(ex("wrong type, expected *uint[x], got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *uint[x], got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(iface, spec)
 }
 
 func intBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("intBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("intBinder", spec)
 
 	iface := v.Addr().Interface()
 
@@ -343,7 +437,7 @@ func intBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
 	}
 
 	if !ok {
-		e.error(ex("wrong type, expected *int[x], got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *int[x], got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(iface, spec)
 }
@@ -353,9 +447,7 @@ type floatBinder int // number of bits
 func (bits floatBinder) bind(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
 	f := v.Float()
 	_ = f
-	ex := errors.Template("floatBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("floatBinder", spec)
 
 	iface := v.Addr().Interface()
 
@@ -369,7 +461,7 @@ func (bits floatBinder) bind(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bi
 	}
 
 	if !ok {
-		e.error(ex("wrong type, expected *float[x], got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *float[x], got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(iface, spec)
 }
@@ -380,27 +472,23 @@ var (
 )
 
 func ipBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("ipBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("ipBinder", spec)
 
 	iface := v.Addr().Interface()
 	ptr, ok := iface.(*net.IP)
 	if !ok {
-		e.error(ex("wrong type, expected *net.IP, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *net.IP, got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(ptr, spec)
 }
 
 func durationBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("durationBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("durationBinder", spec)
 
 	iface := v.Addr().Interface()
 	ptr, ok := iface.(*time.Duration)
 	if !ok {
-		e.error(ex("wrong type, expected *time.Duration, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *time.Duration, got", reflect.TypeOf(iface)))
 	}
 	e.setFlagBound(ptr, spec)
 }
@@ -411,14 +499,12 @@ func customBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
 }
 
 func flagValueBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
-	ex := errors.Template("flagValueBinder",
-		"tag_type", spec.kind(),
-		"name", spec.getName())
+	ex := specError("flagValueBinder", spec)
 
 	iface := v.Addr().Interface()
 	_, ok := reflect.ValueOf(iface).Elem().Interface().(flag.Value)
 	if !ok {
-		e.error(ex("wrong type, expected flag.Value, got", reflect.TypeOf(iface)))
+		e.error(ex(ErrUnsupportedType, "wrong type, expected flag.Value, got", reflect.TypeOf(iface)))
 	}
 	if v.Kind() == reflect.Struct {
 		//ignored for now: need to use a pointer on it
@@ -439,7 +525,7 @@ func (se *structBinder) bind(e *flagsBinder, v reflect.Value, _ cmdSpec, opts bi
 			// NOTE: this where binding fields of inner structs WON'T work if
 			//       the inner struct is not initialized (binding won't happen)
 			//continue: raise an error rather than ignore
-			e.error(errors.E("bind", errors.K.Invalid,
+			e.error(errors.E("bind", errors.K.Invalid, ErrInvalidInput,
 				"reason", "invalid value for binding",
 				"possible cause", "inner struct not initialized",
 				"name", f.name,
@@ -450,7 +536,7 @@ func (se *structBinder) bind(e *flagsBinder, v reflect.Value, _ cmdSpec, opts bi
 }
 
 func newStructBinder(e *flagsBinder, t reflect.Type) binderFunc {
-	fields := typeFields(t)
+	fields := cachedTypeFields(t)
 	se := &structBinder{
 		fields:    fields,
 		fieldEncs: make([]binderFunc, len(fields)),
@@ -466,12 +552,18 @@ func typeBinder(e *flagsBinder, t reflect.Type) binderFunc {
 	if e.custom != nil && e.custom.Bind(t) {
 		return customBinder
 	}
+	// .. or Optional
+	if reflect.PointerTo(t).Implements(optionalFlagType) {
+		return customBinder
+	}
 	// .. or known types
 	switch t {
 	case reflect.TypeOf(net.IP{}):
 		return ipBinder
 	case reflect.TypeOf(time.Duration(0)):
 		return durationBinder
+	case reflect.TypeOf(time.Time{}):
+		return timeBinder
 	}
 	//if t.Implements(reflect.TypeOf((*flag.Value)(nil)).Elem()) {
 	//	return flagValueBinder
@@ -545,10 +637,20 @@ cmd:"flag,id,content id, i,true,true,true"
 meta:"val1,val2"
 */
 const (
-	cmdTag  = "cmd"
-	argTag  = "arg"
-	flagTag = "flag"
-	metaTag = "meta"
+	cmdTag      = "cmd"
+	argTag      = "arg"
+	flagTag     = "flag"
+	metaTag     = "meta"
+	postTag     = "post"
+	sepTag      = "sep"
+	repeatTag   = "repeat"
+	choicesTag  = "choices"
+	envTag      = "env"
+	groupTag    = "group"
+	completeTag = "complete"
+	layoutTag   = "layout"
+	validateTag = "validate"
+	splatTag    = "splat"
 )
 
 type cmdSpec interface {
@@ -556,15 +658,34 @@ type cmdSpec interface {
 	getName() string
 	setName(s string)
 	getDescription() string
-	getAnnotations() []string
+	getAnnotations() Annotations
+	getPostProcessors() []string
+	getSeparator() string
+	getRepeat() bool
+	getChoices() []string
+	getEnv() string
+	getGroups() []string
+	getComplete() string
+	getLayout() string
+	getValidate() string
+	getSplat() bool
 }
 
-// cmd:"arg,[name, description, [order]]"
+// cmd:"arg,[name, description, [order, [optional]]]"
 type argSpec struct {
-	name        string   // name of the flag or arg parameter
-	description string   // description
-	order       int      // optional order on command line
-	annotations []string // annotations
+	name        string      // name of the flag or arg parameter
+	description string      // description
+	order       int         // optional order on command line
+	optional    bool        // true if the arg may be omitted on the command line
+	annotations Annotations // annotations
+	post        []string    // post processors
+	sep         string      // separator of slice values
+	repeat      bool        // true for repeatable slices
+	choices     []string    // allowed values
+	groups      []string    // flag groups
+	complete    string      // completion of the value
+	layout      string      // layout of time values
+	validate    string      // validation rules
 }
 
 func (a *argSpec) kind() string {
@@ -580,19 +701,60 @@ func (a *argSpec) setName(s string) {
 func (a *argSpec) getDescription() string {
 	return a.description
 }
-func (a *argSpec) getAnnotations() []string {
+func (a *argSpec) getAnnotations() Annotations {
 	return a.annotations
 }
+func (a *argSpec) getPostProcessors() []string {
+	return a.post
+}
+func (a *argSpec) getSeparator() string {
+	return a.sep
+}
+func (a *argSpec) getRepeat() bool {
+	return a.repeat
+}
+func (a *argSpec) getChoices() []string {
+	return a.choices
+}
+func (a *argSpec) getEnv() string {
+	return ""
+}
+func (a *argSpec) getGroups() []string {
+	return a.groups
+}
+func (a *argSpec) getComplete() string {
+	return a.complete
+}
+func (a *argSpec) getLayout() string {
+	return a.layout
+}
+func (a *argSpec) getValidate() string {
+	return a.validate
+}
+func (a *argSpec) getSplat() bool {
+	return false
+}
 
-// cmd:"flag,name[, description, short hand, persistent=false, required=false, hidden=false]" meta:"val1,val2,val3"
+// cmd:"flag,name[, description, short hand, persistent=false, required=false, hidden=false, count]" meta:"val1,val2,val3"
 type flagSpec struct {
-	name        string   // name of the flag or arg parameter
-	description string   // description: used for usage
-	shorthand   string   // one letter shorthand or the empty string for none
-	persistent  bool     // true: the flag is available to the command as well as every command under the command
-	required    bool     // true if the flag is required
-	hidden      bool     // true if the flag is hidden
-	annotations []string // annotations
+	name        string      // name of the flag or arg parameter
+	description string      // description: used for usage
+	shorthand   string      // one letter shorthand or the empty string for none
+	persistent  bool        // true: the flag is available to the command as well as every command under the command
+	required    bool        // true if the flag is required
+	hidden      bool        // true if the flag is hidden
+	count       bool        // true for count flags
+	annotations Annotations // annotations
+	post        []string    // post processors
+	sep         string      // separator of slice values
+	repeat      bool        // true for repeatable slices
+	choices     []string    // allowed values
+	env         string      // environment variable providing the value
+	groups      []string    // flag groups as 'name:mode'
+	complete    string      // completion of the value
+	layout      string      // layout of time values
+	validate    string      // validation rules
+	splat       bool        // true if the value is unmarshaled into the input
 }
 
 func (a *flagSpec) kind() string {
@@ -608,9 +770,39 @@ func (a *flagSpec) setName(s string) {
 func (a *flagSpec) getDescription() string {
 	return a.description
 }
-func (a *flagSpec) getAnnotations() []string {
+func (a *flagSpec) getAnnotations() Annotations {
 	return a.annotations
 }
+func (a *flagSpec) getPostProcessors() []string {
+	return a.post
+}
+func (a *flagSpec) getSeparator() string {
+	return a.sep
+}
+func (a *flagSpec) getRepeat() bool {
+	return a.repeat
+}
+func (a *flagSpec) getChoices() []string {
+	return a.choices
+}
+func (a *flagSpec) getEnv() string {
+	return a.env
+}
+func (a *flagSpec) getGroups() []string {
+	return a.groups
+}
+func (a *flagSpec) getComplete() string {
+	return a.complete
+}
+func (a *flagSpec) getLayout() string {
+	return a.layout
+}
+func (a *flagSpec) getValidate() string {
+	return a.validate
+}
+func (a *flagSpec) getSplat() bool {
+	return a.splat
+}
 
 // A field represents a single field found in a struct.
 type field struct {
@@ -639,6 +831,18 @@ func (x byIndex) Less(i, j int) bool {
 	return len(x[i].index) < len(x[j].index)
 }
 
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// cachedTypeFields is like typeFields but uses a cache to avoid repeated work.
+// The returned fields and their specs must not be modified.
+func cachedTypeFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
 // typeFields returns a list of fields that should be recognized for the given type.
 // The algorithm is breadth-first search over the set of structs to include - the top struct
 // and then any reachable anonymous structs.
@@ -828,11 +1032,25 @@ func parseFieldTag(sf reflect.StructField) cmdSpec {
 		name = sf.Name
 	}
 
-	var annotations []string
+	var annotations Annotations
 	annot := strings.Trim(sf.Tag.Get(metaTag), " ")
 	if annot != "" {
-		annotations = splitString(annot)
+		annotations = NewAnnotations(splitString(annot)...)
+	}
+	var post []string
+	if p := strings.Trim(sf.Tag.Get(postTag), " "); p != "" {
+		post = splitString(p)
+	}
+	sep := sf.Tag.Get(sepTag)
+	repeat, _ := strconv.ParseBool(sf.Tag.Get(repeatTag))
+	var choices []string
+	if c := strings.Trim(sf.Tag.Get(choicesTag), " "); c != "" {
+		choices = splitString(c)
 	}
+	groups := parseGroups(sf.Tag.Get(groupTag))
+	complete := strings.TrimSpace(sf.Tag.Get(completeTag))
+	layout := sf.Tag.Get(layoutTag)
+	validate := strings.TrimSpace(sf.Tag.Get(validateTag))
 
 	switch kind {
 	case "":
@@ -842,16 +1060,28 @@ func parseFieldTag(sf reflect.StructField) cmdSpec {
 		if err != nil {
 			order = -1
 		}
+		optional, _ := strconv.ParseBool(opts.At(3))
 		return &argSpec{
 			name:        name,
 			description: description,
 			order:       order,
+			optional:    optional,
 			annotations: annotations,
+			post:        post,
+			sep:         sep,
+			repeat:      repeat,
+			choices:     choices,
+			groups:      groups,
+			complete:    complete,
+			layout:      layout,
+			validate:    validate,
 		}
 	case flagTag:
 		persistent, _ := strconv.ParseBool(opts.At(3))
 		required, _ := strconv.ParseBool(opts.At(4))
 		hidden, _ := strconv.ParseBool(opts.At(5))
+		count := strings.TrimSpace(opts.At(6)) == countOpt
+		splat, _ := strconv.ParseBool(sf.Tag.Get(splatTag))
 		return &flagSpec{
 			name:        name,
 			description: description,
@@ -859,7 +1089,18 @@ func parseFieldTag(sf reflect.StructField) cmdSpec {
 			persistent:  persistent,
 			required:    required,
 			hidden:      hidden,
+			count:       count,
 			annotations: annotations,
+			post:        post,
+			sep:         sep,
+			repeat:      repeat,
+			choices:     choices,
+			env:         strings.TrimSpace(sf.Tag.Get(envTag)),
+			groups:      groups,
+			complete:    complete,
+			layout:      layout,
+			validate:    validate,
+			splat:       splat,
 		}
 	default:
 		return nil
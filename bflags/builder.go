@@ -0,0 +1,144 @@
+package bflags
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// FlagBuilder builds FlagBonds programmatically. It is an alternative to struct
+// tags for commands assembled dynamically - from plugins or generated code -
+// rather than from static structs:
+//
+//	in := &struct{ ID string; Path string }{}
+//	bonds := bflags.Bonds{
+//		bflags.NewFlag("id").Short("i").Usage("content id").Required().Bind(&in.ID),
+//		bflags.NewArg("path").Usage("the path").Optional().Bind(&in.Path),
+//	}
+//	err := bflags.Bind(cmd, bonds)
+//
+// The builder methods mirror the attributes of the 'cmd', 'meta', 'post',
+// 'sep', 'repeat' and 'choices' tags.
+type FlagBuilder struct {
+	fb FlagBond
+}
+
+// NewFlag returns a builder for a flag with the given name.
+func NewFlag(name string) *FlagBuilder {
+	return &FlagBuilder{fb: FlagBond{Name: cmdFlag(name), ArgOrder: -1}}
+}
+
+// NewArg returns a builder for a positional arg with the given name. Unless
+// Order is called, args are ordered as they are bound.
+func NewArg(name string) *FlagBuilder {
+	return &FlagBuilder{fb: FlagBond{Name: cmdFlag(name), ArgOrder: -1, isArg: true}}
+}
+
+// Short sets the one letter shorthand of a flag.
+func (b *FlagBuilder) Short(s string) *FlagBuilder {
+	b.fb.Shorthand = s
+	return b
+}
+
+// Usage sets the usage string.
+func (b *FlagBuilder) Usage(s string) *FlagBuilder {
+	b.fb.Usage = s
+	return b
+}
+
+// Required marks a flag as required.
+func (b *FlagBuilder) Required() *FlagBuilder {
+	b.fb.Required = true
+	return b
+}
+
+// Persistent makes a flag available to the sub-commands of the command.
+func (b *FlagBuilder) Persistent() *FlagBuilder {
+	b.fb.Persistent = true
+	return b
+}
+
+// Hidden hides a flag from the help.
+func (b *FlagBuilder) Hidden() *FlagBuilder {
+	b.fb.Hidden = true
+	return b
+}
+
+// Optional marks an arg as optional.
+func (b *FlagBuilder) Optional() *FlagBuilder {
+	b.fb.Optional = true
+	return b
+}
+
+// Order sets the position of an arg. Order must be set on either all or none
+// of the args of a command.
+func (b *FlagBuilder) Order(i int) *FlagBuilder {
+	b.fb.ArgOrder = i
+	return b
+}
+
+// Separator sets the separator of slice values.
+func (b *FlagBuilder) Separator(sep string) *FlagBuilder {
+	b.fb.Separator = sep
+	return b
+}
+
+// Repeat makes a slice flag repeatable.
+func (b *FlagBuilder) Repeat() *FlagBuilder {
+	b.fb.Repeat = true
+	return b
+}
+
+// Choices sets the allowed values.
+func (b *FlagBuilder) Choices(choices ...string) *FlagBuilder {
+	b.fb.Choices = choices
+	return b
+}
+
+// Meta adds annotations, as found in a 'meta' tag.
+func (b *FlagBuilder) Meta(annotations ...string) *FlagBuilder {
+	b.fb.Annotations = append(b.fb.Annotations, NewAnnotations(annotations...)...)
+	return b
+}
+
+// Post adds the names of registered post processors.
+func (b *FlagBuilder) Post(names ...string) *FlagBuilder {
+	b.fb.PostProcessors = append(b.fb.PostProcessors, names...)
+	return b
+}
+
+// Completion sets the shell completion function of a flag.
+func (b *FlagBuilder) Completion(fn func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)) *FlagBuilder {
+	b.fb.completion = fn
+	return b
+}
+
+// Bind returns a new FlagBond bound to the given value, which must be a pointer
+// to a variable of a type supported by Bind. The builder may be reused to
+// create other bonds.
+func (b *FlagBuilder) Bind(ptr interface{}) *FlagBond {
+	fb := b.fb
+	fb.Value = ptr
+	fb.Annotations = append(Annotations(nil), b.fb.Annotations...)
+	fb.PostProcessors = append([]string(nil), b.fb.PostProcessors...)
+	fb.Choices = append([]string(nil), b.fb.Choices...)
+	return &fb
+}
+
+// Bonds is a list of FlagBonds created with a FlagBuilder. It implements
+// StaticBinder and can be bound to a command with Bind:
+//
+//	err := bflags.Bind(cmd, bflags.Bonds{ ... })
+//
+// The Bonds are then the input of the command.
+type Bonds []*FlagBond
+
+// StaticBonds implements StaticBinder.
+func (b Bonds) StaticBonds() (flags []*FlagBond, args []*FlagBond) {
+	for _, fb := range b {
+		if fb.isArg {
+			args = append(args, fb)
+		} else {
+			flags = append(flags, fb)
+		}
+	}
+	return flags, args
+}
@@ -0,0 +1,100 @@
+package bflags
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// usage returns the usage of the flag, followed by its choices if any, e.g.
+// 'output format (one of: json|yaml|text)'.
+func (f *FlagBond) usage() string {
+	if len(f.Choices) == 0 {
+		return f.Usage
+	}
+	return strings.TrimSpace(f.Usage + " (one of: " + strings.Join(f.Choices, "|") + ")")
+}
+
+// choicesCompletion returns a completion function proposing the given choices.
+func choicesCompletion(choices []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ret := make([]string, 0, len(choices))
+		for _, c := range choices {
+			if strings.HasPrefix(c, toComplete) {
+				ret = append(ret, c)
+			}
+		}
+		return ret, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// checkChoice returns an error if the value of the flag - or any value of a
+// slice - is not one of its choices.
+func (f *FlagBond) checkChoice() error {
+	if len(f.Choices) == 0 {
+		return nil
+	}
+	for _, val := range choiceValues(f.Value) {
+		ok := false
+		for _, c := range f.Choices {
+			if val == c {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.E("checkChoice", errors.K.Invalid, ErrInvalidChoice,
+				"flag", f.Name,
+				"value", val,
+				"choices", strings.Join(f.Choices, "|"))
+		}
+	}
+	return nil
+}
+
+// choiceValues returns the string representation of the given value, or of
+// each element if the value is a slice.
+func choiceValues(v interface{}) []string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Slice {
+		ret := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ret = append(ret, fmt.Sprint(rv.Index(i).Interface()))
+		}
+		return ret
+	}
+	return []string{fmt.Sprint(rv.Interface())}
+}
+
+// checkChoices checks the values of the flags and args set on the command line
+// against their choices.
+func checkChoices(c *cobra.Command) error {
+	var bonds []*FlagBond
+	if cmdflags, err := GetCmdFlagSet(c); err == nil {
+		for _, fl := range cmdflags {
+			bonds = append(bonds, fl)
+		}
+	}
+	if argflags, err := GetCmdArgSet(c); err == nil {
+		bonds = append(bonds, argflags.Flags...)
+	}
+	for _, fb := range bonds {
+		f := c.Flags().Lookup(string(fb.Name))
+		if f == nil || !f.Changed {
+			continue
+		}
+		if err := fb.checkChoice(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package bflags
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// CmdLine returns the command line equivalent to the current invocation of the
+// given command: the path of the command followed by the flags bound to it
+// that were set or differ from their default, and by its args. Values of
+// secret flags are redacted (see IsSecret) and values with spaces or special
+// characters of the shell are quoted, such that the command line can be
+// logged or pasted in bug reports.
+func CmdLine(c *cobra.Command) string {
+	if c == nil {
+		return ""
+	}
+	ret := []string{c.CommandPath()}
+	if flags, err := GetCmdFlagSet(c); err == nil {
+		names := make([]string, 0, len(flags))
+		for name := range flags {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f := c.Flags().Lookup(name)
+			if f == nil || (!f.Changed && ValueString(f.Value) == f.DefValue) {
+				continue
+			}
+			ret = append(ret, quoteCmdLine(flags[cmdFlag(name)].CmdString())...)
+		}
+	}
+	if args, err := GetCmdArgSet(c); err == nil {
+		for _, f := range args.Flags {
+			ret = append(ret, quoteCmdLine(f.CmdString())...)
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+// quoteCmdLine quotes the given values like quoteAll, except redacted values.
+func quoteCmdLine(ss []string) []string {
+	for i, s := range ss {
+		if s != RedactedValue {
+			ss[i] = quoteAll(ss[i : i+1])[0]
+		}
+	}
+	return ss
+}
@@ -0,0 +1,185 @@
+package bflags
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// CompletionFunc is a function completing the value of a flag or arg, like
+// cobra's ValidArgsFunction.
+//
+// Completions are declared on fields with the 'complete' tag, followed by the
+// name of a registered completion:
+//
+//	`cmd:"flag,config,config file" complete:"file:json|yaml"`
+//	`cmd:"arg,dir,output directory,0" complete:"dirs"`
+type CompletionFunc func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+var completions = struct {
+	mu  sync.RWMutex
+	fns map[string]CompletionFunc
+}{
+	fns: map[string]CompletionFunc{
+		"file": directiveCompletion(cobra.ShellCompDirectiveDefault),
+		"dirs": directiveCompletion(cobra.ShellCompDirectiveFilterDirs),
+		"none": directiveCompletion(cobra.ShellCompDirectiveNoFileComp),
+	},
+}
+
+// RegisterCompletion registers the given completion with the given name. An
+// already registered completion with the same name is replaced. Built-in
+// completions are:
+//   - file: file names, or file names with the given extensions if followed by
+//     extensions separated by '|', e.g. 'file:json|yaml'
+//   - dirs: directory names
+//   - none: no completion, not even file names
+func RegisterCompletion(name string, fn CompletionFunc) {
+	completions.mu.Lock()
+	defer completions.mu.Unlock()
+	completions.fns[name] = fn
+}
+
+// tagCompletion returns the completion declared with the given 'complete' tag,
+// or nil if the tag is empty.
+func tagCompletion(tag string) (CompletionFunc, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	if exts := strings.TrimPrefix(tag, "file:"); exts != tag {
+		extensions := strings.Split(exts, "|")
+		return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+			return extensions, cobra.ShellCompDirectiveFilterFileExt
+		}, nil
+	}
+	completions.mu.RLock()
+	defer completions.mu.RUnlock()
+	fn, ok := completions.fns[tag]
+	if !ok {
+		return nil, errors.E("tagCompletion", errors.K.NotExist, ErrBadTag,
+			"reason", "unknown completion",
+			"completion", tag)
+	}
+	return fn, nil
+}
+
+// directiveCompletion returns a completion returning no values and the given
+// directive.
+func directiveCompletion(d cobra.ShellCompDirective) CompletionFunc {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return nil, d
+	}
+}
+
+// placeholderValue is a flag.Value whose type is a placeholder shown in the
+// usage of the flag, e.g. '--qid content-id'.
+type placeholderValue struct {
+	flag.Value
+	placeholder string
+}
+
+func (p *placeholderValue) Type() string {
+	return p.placeholder
+}
+
+// value returns the flag.Value of the Flagged, wrapped in a placeholderValue
+// if it has a placeholder.
+func (f *Flagged) value() flag.Value {
+	if f.Placeholder == "" {
+		return f.Flag
+	}
+	return &placeholderValue{Value: f.Flag, placeholder: f.Placeholder}
+}
+
+// unwrapValue returns the flag.Value wrapped by a placeholderValue or the given
+// value.
+func unwrapValue(v flag.Value) flag.Value {
+	if pv, ok := v.(*placeholderValue); ok {
+		return pv.Value
+	}
+	return v
+}
+
+// setArgsCompletion sets a ValidArgsFunction to the command calling the
+// completion functions of the given args, unless the command already has one.
+// Positions after the last arg use the completion of the last arg if it is a
+// slice.
+func setArgsCompletion(cmd *cobra.Command, args []*FlagBond) {
+	if cmd.ValidArgsFunction != nil {
+		return
+	}
+	hasCompletion := false
+	for _, fb := range args {
+		if fb.completion != nil {
+			hasCompletion = true
+			break
+		}
+	}
+	if !hasCompletion {
+		return
+	}
+	cmd.ValidArgsFunction = func(cmd *cobra.Command, params []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		pos := len(params)
+		if pos >= len(args) && isSliceValue(cmd.Flags().Lookup(string(args[len(args)-1].Name))) {
+			pos = len(args) - 1
+		}
+		if pos < len(args) && args[pos].completion != nil {
+			return args[pos].completion(cmd, params, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+}
+
+// SetFlagCompletion sets the completion function of the bound flag with the
+// given name, replacing the completion declared with its tag or provided by a
+// custom Flagger. Persistent flags of parent commands are found as well. The
+// completion is registered with RegisterCompletions.
+func SetFlagCompletion(cmd *cobra.Command, name string, fn CompletionFunc) error {
+	for c := cmd; c != nil; c = c.Parent() {
+		cmdFlags, err := GetCmdFlagSet(c)
+		if err != nil {
+			continue
+		}
+		if fb, ok := cmdFlags.get(cmdFlag(name)); ok && (c == cmd || fb.Persistent) {
+			fb.completion = fn
+			return nil
+		}
+	}
+	return errors.E("SetFlagCompletion", errors.K.NotExist,
+		"reason", "flag not bound",
+		"command", cmd.CommandPath(),
+		"flag", name)
+}
+
+// RegisterCompletions registers the completion functions of the flags bound to
+// the given command and its sub-commands with cobra, where they are kept for
+// the lifetime of the program: cobra provides no way to unregister them.
+// Completions are therefore not registered when binding, such that commands
+// bound only temporarily - like the throwaway command of ParseInto or command
+// trees that are rebuilt - are not kept alive. Call RegisterCompletions with
+// the root command before executing it:
+//
+//	root := bflags.NewBinder(in, cmd, run, nil).MustBuild()
+//	bflags.RegisterCompletions(root)
+//	err := root.Execute()
+//
+// Flags that already have a registered completion are skipped. Commands of the
+// app package register their completions lazily, when a completion is
+// requested.
+func RegisterCompletions(cmd *cobra.Command) {
+	if cmdFlags, err := GetCmdFlagSet(cmd); err == nil {
+		for _, fb := range cmdFlags.declared() {
+			if fb.completion != nil && !fb.isArg {
+				// cobra returns an error for flags that are already registered:
+				// completions registered directly with cobra take precedence
+				_ = cmd.RegisterFlagCompletionFunc(string(fb.Name), fb.completion)
+			}
+		}
+	}
+	for _, c := range cmd.Commands() {
+		RegisterCompletions(c)
+	}
+}
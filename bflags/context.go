@@ -0,0 +1,30 @@
+package bflags
+
+import (
+	"context"
+)
+
+// cmdCtxKey is the key of the command context in a context.Context.
+type cmdCtxKey struct{}
+
+// ContextWithCmdCtx returns a copy of parent carrying the given command
+// context - see SetCmdCtx. A background context is used if parent is nil.
+// Use it with cmd.SetContext such that libraries receiving only the
+// context.Context of a command can reach the command state with
+// CmdCtxFromContext.
+func ContextWithCmdCtx(parent context.Context, v interface{}) context.Context {
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithValue(parent, cmdCtxKey{}, v)
+}
+
+// CmdCtxFromContext returns the command context carried by ctx and true if ctx
+// carries one - see ContextWithCmdCtx.
+func CmdCtxFromContext(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	v := ctx.Value(cmdCtxKey{})
+	return v, v != nil
+}
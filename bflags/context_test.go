@@ -0,0 +1,32 @@
+package bflags
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCmdCtxFromContext(t *testing.T) {
+	_, ok := CmdCtxFromContext(nil)
+	require.False(t, ok)
+	_, ok = CmdCtxFromContext(context.Background())
+	require.False(t, ok)
+
+	type key string
+	parent := context.WithValue(context.Background(), key("k"), "v")
+	cmd := &cobra.Command{Use: "test"}
+	SetCmdCtx(cmd, "state")
+	v, _ := GetCmdCtx(cmd)
+	cmd.SetContext(ContextWithCmdCtx(parent, v))
+
+	v, ok = CmdCtxFromContext(cmd.Context())
+	require.True(t, ok)
+	require.Equal(t, "state", v)
+	require.Equal(t, "v", cmd.Context().Value(key("k")))
+
+	v, ok = CmdCtxFromContext(ContextWithCmdCtx(nil, 1))
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+}
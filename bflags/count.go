@@ -0,0 +1,39 @@
+package bflags
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/eluv-io/errors-go"
+	flag "github.com/spf13/pflag"
+)
+
+// countOpt is the option of the 'cmd' tag of count flags, following the hidden
+// option: `cmd:"flag,verbose,verbosity,v,,,,count"`.
+const countOpt = "count"
+
+// checkCount returns an error if the flag is a count flag but is not bound to
+// an int.
+func checkCount(fb *FlagBond) error {
+	if !fb.Count {
+		return nil
+	}
+	if _, ok := fb.Value.(*int); ok && !fb.isArg {
+		return nil
+	}
+	return errors.E("checkCount", errors.K.Invalid, ErrBadTag,
+		"reason", "count flags must be bound to an int",
+		"flag", fb.Name,
+		"type", reflect.TypeOf(fb.Value))
+}
+
+// makeCountFlag adds the count flag bound to val to the flag set. Each
+// occurrence of the flag on the command line increments the value - '-vvv'
+// sets it to 3 - and '--verbose=2' sets it. The default value is the value of
+// the field.
+func makeCountFlag(pflags *flag.FlagSet, v *FlagBond, val *int) {
+	def := *val
+	pflags.CountVarP(val, string(v.Name), v.Shorthand, v.Usage)
+	*val = def
+	pflags.Lookup(string(v.Name)).DefValue = strconv.Itoa(def)
+}
@@ -3,13 +3,19 @@ package bflags
 import (
 	"reflect"
 
+	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 )
 
 type Flagged struct {
-	Ptr      interface{} // a pointer to the original value (or the original value itself)
-	Flag     flag.Value  // a flag.Value representing the value
-	CsvSlice bool        // true if the value is a slice whose string representation is comma separated
+	Ptr         interface{} // a pointer to the original value (or the original value itself)
+	Flag        flag.Value  // a flag.Value representing the value
+	CsvSlice    bool        // true if the value is a slice whose string representation is comma separated
+	Secret      bool        // true if the value must be redacted in logs and reconstructed command lines
+	Placeholder string      // optional name of the value shown in the usage of flags, e.g. 'content-id'
+	Choices     []string    // optional allowed values, unless declared with the 'choices' tag
+	// optional completion function registered for flags and args of the type
+	Completion func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
 }
 
 type Flagger interface {
@@ -0,0 +1,28 @@
+package bflags
+
+import (
+	"github.com/spf13/cobra"
+)
+
+const deprecationKey = "bflags_deprecation" // key for commands annotation
+
+// SetDeprecation sets the deprecation notice of the given command, rendered at
+// the top of the help of the command. Unlike cobra's Deprecated field, the
+// notice neither hides the command nor prints a message when it runs.
+func SetDeprecation(c *cobra.Command, notice string) {
+	if c == nil || notice == "" {
+		return
+	}
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	c.Annotations[deprecationKey] = notice
+}
+
+// Deprecation returns the deprecation notice of the given command.
+func Deprecation(c *cobra.Command) string {
+	if c == nil {
+		return ""
+	}
+	return c.Annotations[deprecationKey]
+}
@@ -6,8 +6,8 @@
 		Syntax
 
 		Tag are specified using 'cmd' followed by either 'flag' or 'arg':
-			flag, name, usage, shorthand, persistent, required, hidden
-			arg,  name, usage, order
+			flag, name, usage, shorthand, persistent, required, hidden, count
+			arg,  name, usage, order, optional
 
 		sample:
 			flag  `cmd:"flag,id,content id,i,true,true,false"`
@@ -27,16 +27,109 @@
 		For `arg` tags, the order (starting at 0) must be specified for all or none
 		of the fields in the struct.
 
+		Unless the command already has its Args set, Bind sets cmd.Args from the
+		bound args: an arg may be omitted on the command line if marked optional or
+		if the field has a non-zero default value; a trailing slice arg accepts any
+		number of values.
+		Likewise, if the Use field of the command contains only the name of the
+		command, the usage of the args is appended: `cmd <id> [path] [files...]`
+
 		The library also supports specifying a 'meta' tag, followed by a comma separated
-		list of values that are attached as a slice of strings to the 'Annotations' field
+		list of values that are attached as Annotations to the 'Annotations' field
 		of the resulting FlagBond:
 			`meta:"value1,value2"`
+		Each value is either bare ('sensitive') or a key/value pair ('unit=bytes').
+		Annotations are kept in order and offer typed accessors:
+			fb.Annotations.GetString("unit") // "bytes"
+			fb.Annotations.GetBool("sensitive") // true
+		Annotations of the form 'key=value' are also set on the Annotations of the
+		underlying pflag.Flag (multiple values for the same key are accumulated),
+		which makes them visible to cobra completion and other tools:
+			`meta:"cobra_annotation_bash_completion_filename_extensions=json"`
+
+		A 'sep' tag sets the separator used to split and join values of slice flags
+		and args, instead of the comma. Values are then not parsed as CSV and may
+		contain commas:
+			`cmd:"flag,exprs,filter expressions" sep:";"`
+
+		A 'repeat' tag makes a slice flag repeatable, like pflag.StringArray: each
+		occurrence of the flag adds a value and values are never split. CmdString
+		repeats the flag for each value:
+			`cmd:"flag,tag,tags" repeat:"true"` // --tag a,b --tag c => ["a,b", "c"]
+
+		A flag with a 'splat' tag - typically a params.Json - is unmarshaled into the
+		input after SetArgs. Values of the file override defaults, explicitly set
+		flags and args override the file:
+			`cmd:"flag,config,config file" splat:"true" json:"-"`
+
+		Values of secret flags and args are redacted in debug logs, CmdString and
+		GetFlagArgSet. A flag is secret if annotated with 'secret', if its name
+		matches a pattern set with SetRedactPatterns (by default *password*,
+		*passwd*, *secret*, *token*, *credential*), if its type implements
+		SecretValue - like params.Secret - or if a custom Flagger returns a
+		Flagged with Secret set:
+			`cmd:"flag,api-key,the api key" meta:"secret"`
+
+		A flag or arg of a sub-command may not have the name of a persistent flag of
+		a parent command, which cobra would silently shadow, unless annotated with
+		'override' (see CheckShadowing):
+			`cmd:"flag,output,output file" meta:"override"`
+
+		A 'post' tag declares post processors - registered with RegisterPostProcessor -
+		that are applied in order to the value of the field after SetArgs:
+			`cmd:"flag,config,config file" post:"trim,expandHome"`
+		Built-in post processors are 'expandHome', 'lower', 'upper' and 'trim'.
+
+		An 'env' tag binds a flag to an environment variable, which provides the
+		value of the flag when it is not set on the command line. BindEnv binds all
+		flags to variables named after a prefix and the flag name:
+			`cmd:"flag,port,listen port" env:"MY_APP_PORT"`
+			_ = BindEnv(c, &MyStruct{}, "MY_APP_") // --dry-run => MY_APP_DRY_RUN
+
+		A 'group' tag puts a flag in flag groups declared as 'name:mode': flags of an
+		'xor' group - the default mode - are mutually exclusive and flags of an 'and'
+		group must be set together. Bind marks the groups with cobra:
+			`cmd:"flag,token,auth token" group:"auth"`
+			`cmd:"flag,user,user name" group:"auth:xor,basic:and"`
+			`cmd:"flag,password,password" group:"basic:and"`
+
+		A 'complete' tag declares the shell completion of a flag or arg with the name
+		of a completion registered with RegisterCompletion. Built-in completions are
+		'file' - optionally restricted to extensions - 'dirs' and 'none':
+			`cmd:"flag,config,config file" complete:"file:json|yaml"`
+		Completions of flags - declared with the tag, provided by a custom Flagger or
+		derived from choices - are registered with cobra by RegisterCompletions,
+		which is called with the root command before executing it.
+
+		Flags and args of type time.Time or *time.Time are parsed with the layout of
+		their 'layout' tag, or time.RFC3339 without tag:
+			`cmd:"flag,since,start date" layout:"2006-01-02"`
+
+		A 'validate' tag declares rules checked by SetArgs: 'min' and 'max' bound
+		numbers, durations or the length of strings and slices, 'oneof' lists allowed
+		values, 'regexp' - the last rule - is matched by values and 'nonempty'
+		requires a value. All failing flags and args are reported:
+			`cmd:"flag,port,listen port" validate:"min=1,max=65535"`
+			`cmd:"flag,name,user name" validate:"nonempty,regexp=^[a-z]{1,8}$"`
+
+		The 'count' option makes a flag bound to an int a count flag, incremented
+		each time it is set on the command line: -vvv sets the flag below to 3.
+			`cmd:"flag,verbose,verbosity,v,,,,count"`
+
+		Static binding: the bflags-gen tool generates a StaticBonds method for the
+		given struct types, implementing StaticBinder. Bind then uses the generated
+		code instead of reflecting on the struct (unless a custom Flagger is used):
+			//go:generate bflags-gen -type myInput
 
 		Even though not a frequent usage, the bound flags can be retrieved after binding:
 			var c *cobra.Command
 			_ = Bind(c, &MyStruct{})
 			flags, _ := GetCmdFlagSet(c)
 			args, _ := GetCmdArgSet(c)
+		After SetArgs, GetFlagArgs returns the typed value of each flag and arg and
+		whether it was explicitly set on the command line:
+			fas := GetFlagArgs(c)
+			fas["id"].IsSet
 
 
 		Example
@@ -166,6 +259,9 @@
 			Binding to specific types is supported through the Flagger interface.
 			With an instance fl of Flagger, call bflags.BindCustom(cmd, fl, v)
 			See `TestCustomFlag` for a sample implementation.
+			The Flagged returned by the Flagger may provide a Placeholder shown in
+			the usage of flags and a Completion function registered for all flags
+			and args of the type.
 
 		Struct implementing flag.Value
 
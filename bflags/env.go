@@ -0,0 +1,114 @@
+package bflags
+
+import (
+	"os"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// EnvAnnotation is the pflag annotation of flags whose value was set from an
+// environment variable by SetArgs. The annotation holds the name of the
+// variable.
+const EnvAnnotation = "bflags_env"
+
+// BindEnv is like Bind and additionally binds all flags of the input to
+// environment variables: flags without an 'env' tag take their value from the
+// variable named after the prefix and the flag name in upper case, with '-'
+// replaced by '_'. With prefix "MY_APP_", the flag 'dry-run' is bound to
+// MY_APP_DRY_RUN.
+//
+// Args are never bound to environment variables.
+func BindEnv(c *cobra.Command, v interface{}, prefix string) error {
+	updateState(c, func(st *cmdState) {
+		st.envPrefix = prefix
+	})
+	return Bind(c, v)
+}
+
+// EnvVar returns the name of the environment variable bound to the flag with
+// the given name of the command - with an 'env' tag or BindEnv - or an empty
+// string.
+func EnvVar(cmd *cobra.Command, name string) string {
+	cmdflags, err := GetCmdFlagSet(cmd)
+	if err != nil {
+		return ""
+	}
+	fb, ok := cmdflags[cmdFlag(name)]
+	if !ok {
+		return ""
+	}
+	return envVar(cmd, fb)
+}
+
+// envVar returns the name of the environment variable bound to the given flag
+// of the command or an empty string.
+func envVar(cmd *cobra.Command, fb *FlagBond) string {
+	if fb.isArg {
+		return ""
+	}
+	if fb.Env != "" {
+		return fb.Env
+	}
+	st := getState(cmd)
+	if st == nil || st.envPrefix == "" {
+		return ""
+	}
+	return st.envPrefix + strings.ToUpper(strings.ReplaceAll(string(fb.Name), "-", "_"))
+}
+
+// applyEnv sets the flags of the command that were not set on the command line
+// from their environment variables and checks that required flags bound to
+// environment variables have a value.
+func applyEnv(c *cobra.Command) error {
+	cmdflags, err := GetCmdFlagSet(c)
+	if err != nil {
+		return nil
+	}
+	for _, fb := range cmdflags.declared() {
+		env := envVar(c, fb)
+		if env == "" {
+			continue
+		}
+		f := c.Flags().Lookup(string(fb.Name))
+		if f == nil || f.Changed {
+			continue
+		}
+		delete(f.Annotations, EnvAnnotation)
+		val, ok := os.LookupEnv(env)
+		if !ok {
+			if fb.Required {
+				return errors.NoTrace("applyEnv", errors.K.Invalid, ErrMissingFlag,
+					"missing", fb.Name,
+					"env", env)
+			}
+			continue
+		}
+		if err = setEnvValue(f.Value, fb, val); err != nil {
+			return errors.E("applyEnv", errors.K.Invalid, err,
+				"flag", fb.Name,
+				"env", env)
+		}
+		if f.Annotations == nil {
+			f.Annotations = make(map[string][]string)
+		}
+		f.Annotations[EnvAnnotation] = []string{env}
+	}
+	return nil
+}
+
+// setEnvValue sets the value of the flag to the given value of its environment
+// variable. Slices are replaced rather than appended to, such that the variable
+// overrides values of the config file.
+func setEnvValue(v flag.Value, fb *FlagBond, val string) error {
+	sv, ok := v.(flag.SliceValue)
+	if !ok {
+		return v.Set(val)
+	}
+	if fb.Repeat {
+		return sv.Replace([]string{val})
+	}
+	return sv.Replace(parseSliceDefault(val))
+}
@@ -1,5 +1,9 @@
 package bflags
 
+import (
+	"github.com/eluv-io/errors-go"
+)
+
 // ErrorSilencer may be implemented by an input type bound to a command in
 // BindRunE for requesting to silence errors.
 type ErrorSilencer interface {
@@ -16,3 +20,49 @@ type ErrorTraceRemover interface {
 	// the setup of the command.
 	NoTrace() bool
 }
+
+// ExtraArgsAcceptor may be implemented by an input type bound to a command for
+// accepting more positional arguments than bound arg fields. By default, SetArgs
+// returns an error reporting unexpected arguments, unless the last arg field is
+// a slice.
+type ExtraArgsAcceptor interface {
+	// AcceptExtraArgs returns true to have extra args ignored by SetArgs
+	AcceptExtraArgs() bool
+}
+
+// Sentinel errors wrapped as the cause of errors returned by bflags. Callers
+// can test for them with errors.Is:
+//
+//	if errors.Is(err, bflags.ErrMissingArg) { ... }
+var (
+	// ErrDuplicateFlag is the cause of errors reporting a flag bound twice to
+	// the same command or colliding flag shorthands.
+	ErrDuplicateFlag = errors.Str("duplicate flag")
+	// ErrDuplicateCommand is the cause of errors reporting sibling commands
+	// with the same name or alias.
+	ErrDuplicateCommand = errors.Str("duplicate command")
+	// ErrBadTag is the cause of errors reporting an invalid 'cmd', 'meta' or
+	// 'post' tag, like inconsistent arg orders or unknown post processors.
+	ErrBadTag = errors.Str("bad tag")
+	// ErrUnsupportedType is the cause of errors reporting a field or value
+	// whose type cannot be bound.
+	ErrUnsupportedType = errors.Str("unsupported type")
+	// ErrInvalidInput is the cause of errors reporting an input that cannot
+	// be bound or retrieved, like nil inner structs.
+	ErrInvalidInput = errors.Str("invalid input")
+	// ErrMissingArg is the cause of errors reporting missing positional args
+	// on the command line.
+	ErrMissingArg = errors.Str("missing argument")
+	// ErrMissingFlag is the cause of errors reporting required flags missing
+	// on the command line in ParseInto.
+	ErrMissingFlag = errors.Str("missing flag")
+	// ErrUnexpectedArgs is the cause of errors reporting more positional args
+	// than expected on the command line.
+	ErrUnexpectedArgs = errors.Str("unexpected arguments")
+	// ErrInvalidChoice is the cause of errors reporting a value of a flag or
+	// an arg that is not one of its choices.
+	ErrInvalidChoice = errors.Str("invalid choice")
+	// ErrInvalidValue is the cause of errors reporting a value of a flag or an
+	// arg breaking a rule of its 'validate' tag.
+	ErrInvalidValue = errors.Str("invalid value")
+)
@@ -0,0 +1,215 @@
+package bflags
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// GenerateExample returns an invocation of the given command built from the
+// flags and args bound to the command and their current - usually default -
+// values:
+//   - flags with a non-zero value are rendered with CmdString, i.e. with the
+//     value of secret flags redacted
+//   - required flags without value are rendered with a placeholder, e.g.
+//     '--qid <qid>'
+//   - args are rendered with their value or a placeholder, e.g. '<name>'
+//
+// Hidden flags are ignored.
+func GenerateExample(c *cobra.Command) string {
+	if c == nil {
+		return ""
+	}
+	parts := []string{c.CommandPath()}
+	if cmdflags, err := GetCmdFlagSet(c); err == nil {
+		for _, fb := range cmdflags.sorted() {
+			if fb.Hidden {
+				continue
+			}
+			ss := quoteAll(fb.CmdString())
+			if len(ss) == 0 && fb.Required {
+				ss = []string{"--" + string(fb.Name), "<" + string(fb.Name) + ">"}
+			}
+			parts = append(parts, ss...)
+		}
+	}
+	if argset, err := GetCmdArgSet(c); err == nil {
+		for _, fb := range argset.Flags {
+			ss := quoteAll(fb.CmdString())
+			if len(ss) == 0 {
+				if fb.isOptional() {
+					continue
+				}
+				ss = []string{"<" + string(fb.Name) + ">"}
+			}
+			parts = append(parts, ss...)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetDefaultExample sets the Example of the given command and its sub-commands
+// to the invocation returned by GenerateExample if the Example is empty and the
+// command is runnable.
+func SetDefaultExample(c *cobra.Command) {
+	if c == nil {
+		return
+	}
+	if c.Example == "" && c.Runnable() {
+		c.Example = GenerateExample(c)
+	}
+	for _, sub := range c.Commands() {
+		SetDefaultExample(sub)
+	}
+}
+
+// quoteAll quotes the given strings with single quotes if they contain
+// characters interpreted by the shell.
+func quoteAll(ss []string) []string {
+	for i, s := range ss {
+		if strings.ContainsAny(s, " \t\n'\"\\$`&|;<>()*?[]{}!#~") {
+			ss[i] = "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}
+	}
+	return ss
+}
+
+// SetExampleVars sets variables available to templates in the examples of the
+// given command and its sub-commands. Variables of sub-commands override those
+// of their parents.
+func SetExampleVars(cmd *cobra.Command, vars map[string]interface{}) {
+	if cmd == nil {
+		return
+	}
+	updateState(cmd, func(s *cmdState) {
+		if s.exampleVars == nil {
+			s.exampleVars = make(map[string]interface{}, len(vars))
+		}
+		for k, v := range vars {
+			s.exampleVars[k] = v
+		}
+	})
+}
+
+// ExampleData returns the data used to render the example of the given command
+// as a template:
+//   - AppName: the name of the root command
+//   - CmdPath: the full path of the command
+//   - Flags: the placeholders of the flags of the command by name, e.g.
+//     '<content-id>' for a flag with a custom type providing a placeholder or
+//     '<qid>' otherwise
+//   - the variables set with SetExampleVars on the command and its parents
+func ExampleData(c *cobra.Command) map[string]interface{} {
+	flags := make(map[string]string)
+	addFlag := func(fl *flag.Flag) {
+		name := fl.Name
+		if pv, ok := fl.Value.(*placeholderValue); ok {
+			name = pv.placeholder
+		}
+		flags[fl.Name] = "<" + name + ">"
+	}
+	c.InheritedFlags().VisitAll(addFlag)
+	c.LocalFlags().VisitAll(addFlag)
+
+	ret := map[string]interface{}{
+		"AppName": c.Root().Name(),
+		"CmdPath": c.CommandPath(),
+		"Flags":   flags,
+	}
+	var cmds []*cobra.Command
+	for p := c; p != nil; p = p.Parent() {
+		cmds = append(cmds, p)
+	}
+	for i := len(cmds) - 1; i >= 0; i-- {
+		st := getState(cmds[i])
+		if st == nil {
+			continue
+		}
+		for k, v := range st.exampleVars {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// RenderExample returns the example of the given command rendered as a
+// template with the data returned by ExampleData, e.g.
+//
+//	{{.AppName}} get --qid {{.Flags.qid}} --config {{.ConfigDir}}/config.json
+//
+// Missing variables are rendered empty and the example is returned unchanged
+// if it is not a valid template. This is the function used to show examples in
+// the help of commands.
+func RenderExample(c *cobra.Command) string {
+	if c == nil {
+		return ""
+	}
+	if !strings.Contains(c.Example, "{{") {
+		return c.Example
+	}
+	t, err := template.New("example").Option("missingkey=zero").Parse(c.Example)
+	if err != nil {
+		return c.Example
+	}
+	// missing variables are rendered empty: missingkey=zero renders the zero
+	// value of interface{} as '<no value>', hence add them as empty strings
+	data := ExampleData(c)
+	fields := make(map[string]bool)
+	templateFields(t.Tree.Root, fields)
+	for name := range fields {
+		if _, ok := data[name]; !ok {
+			data[name] = ""
+		}
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, data)
+	if err != nil {
+		return c.Example
+	}
+	return buf.String()
+}
+
+// templateFields adds the names of the fields referenced by the given node of
+// a template and its children to ret, e.g. 'AppName' for {{.AppName}}.
+func templateFields(node parse.Node, ret map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFields(child, ret)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, ret)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFields(cmd, ret)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFields(arg, ret)
+		}
+	case *parse.FieldNode:
+		ret[n.Ident[0]] = true
+	case *parse.IfNode:
+		templateBranchFields(&n.BranchNode, ret)
+	case *parse.RangeNode:
+		templateBranchFields(&n.BranchNode, ret)
+	case *parse.WithNode:
+		templateBranchFields(&n.BranchNode, ret)
+	}
+}
+
+func templateBranchFields(n *parse.BranchNode, ret map[string]bool) {
+	templateFields(n.Pipe, ret)
+	templateFields(n.List, ret)
+	templateFields(n.ElseList, ret)
+}
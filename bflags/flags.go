@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,10 +19,8 @@ import (
 type cmdFlag string
 
 const (
-	flagset = "$flagset" // key used to set CmdFlags in cmd flags
-	argset  = "$argset"  // key used to set argset in cmd flags
-	input   = "$input"   // key used to set input in cmd flags
-	cmdctx  = "$ctx"     // key used to set context in cmd flags
+	flagset = "$flagset" // type of CmdFlags as a flag.Value
+	argset  = "$argset"  // type of ArgSet as a flag.Value
 )
 
 type FlagBond struct {
@@ -33,9 +32,27 @@ type FlagBond struct {
 	Required    bool        // true if the flag is required
 	Persistent  bool        // true: the flag is available to the command as well as every command under the command
 	Hidden      bool        // true to set the flag as hidden
+	Count       bool        // true for count flags incremented each time they are set, e.g. -vvv
 	ArgOrder    int         // for flags used to bind args
+	Optional    bool        // for args: true if the arg may be omitted on the command line
 	CsvSlice    bool        // true for flags with comma separated string representation
-	Annotations []string    // annotations found as 'meta' tag
+	Separator   string      // separator of slice values, found as 'sep' tag (comma if empty)
+	Repeat      bool        // true for repeatable slice flags: values are never split, found as 'repeat' tag
+	Secret      bool        // true if the value must be redacted (see IsSecret)
+	Annotations Annotations // annotations found as 'meta' tag
+	Choices     []string    // allowed values, found as 'choices' tag or provided by a custom Flagger
+	Env         string      // environment variable providing the value if the flag is not set, found as 'env' tag
+	Groups      []string    // flag groups of the flag as 'name:mode', found as 'group' tag
+	Complete    string      // completion of the value, found as 'complete' tag - see RegisterCompletion
+	Layout      string      // layout of time.Time values, found as 'layout' tag (time.RFC3339 if empty)
+	Validate    string      // validation rules checked by SetArgs, found as 'validate' tag
+	Splat       bool        // true if the value is unmarshaled into the input by SetArgs, found as 'splat' tag
+	// names of post processors applied after SetArgs, found as 'post' tag
+	PostProcessors []string
+	// completion function provided by a custom Flagger
+	completion func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+	// order of declaration of the flag in the bound input
+	declOrder int
 }
 
 var nillableKinds = []reflect.Kind{
@@ -71,15 +88,24 @@ func isCsvSlice(object interface{}) bool {
 	return false
 }
 
+// CmdString returns the equivalent command line of the flag. The value of
+// secret flags is redacted (see IsSecret).
 func (f *FlagBond) CmdString() []string {
-	return f.cmdString(false)
+	return f.cmdString(false, true)
+}
+
+// RawCmdString is like CmdString but does not redact the value of secret flags.
+// The returned command line must not be logged.
+func (f *FlagBond) RawCmdString() []string {
+	return f.cmdString(false, false)
 }
 
 // cmdString return the equivalent command line.
 // When f refers to a bool flag: if fullBoolFlag is false the returned value looks
 // like the command line (e.g. --xyz for a true value), otherwise fullBoolFlag is
 // true and the returned slice holds the flag name and value.
-func (f *FlagBond) cmdString(fullBoolFlag bool) []string {
+// If redact is true, the value of secret flags is replaced with RedactedValue.
+func (f *FlagBond) cmdString(fullBoolFlag, redact bool) []string {
 	v := f.Value
 	if isNil(v) {
 		return nil
@@ -94,21 +120,42 @@ func (f *FlagBond) cmdString(fullBoolFlag bool) []string {
 	if isNil(v) {
 		return nil
 	}
+	if _, ok := v.(flag.Value); !ok && reflect.ValueOf(v).Kind() == reflect.Ptr {
+		// pointer to pointer bindings (e.g. **int)
+		v = reflect.ValueOf(v).Elem().Interface()
+	}
+	if f.Repeat && reflect.ValueOf(v).Kind() == reflect.Slice {
+		return f.repeatCmdString(reflect.ValueOf(v), redact)
+	}
 
 	value := fmt.Sprintf("%v", v)
-	if f.CsvSlice || isCsvSlice(v) {
+	if t, ok := v.(time.Time); ok {
+		value = formatTime(t, f.layout())
+	} else if rv := reflect.ValueOf(v); rv.Kind() == reflect.Array {
+		value = arrayString(rv, f.separator())
+	} else if f.CsvSlice || isCsvSlice(v) {
 		vov := reflect.ValueOf(v)
 		ss := make([]string, 0, vov.Len())
 		for i := 0; i < vov.Len(); i++ {
 			ss = append(ss, fmt.Sprintf("%v", vov.Index(i)))
 		}
-		value = strings.Join(ss, ",")
+		value = strings.Join(ss, f.separator())
 	}
 	if value == "" {
 		return []string{}
 	}
+	if redact && f.IsSecret() {
+		value = RedactedValue
+	}
 
 	if !f.isArg {
+		if f.Count {
+			// count flags take their value with '=' only
+			if value == "0" {
+				return []string{}
+			}
+			return []string{"--" + string(f.Name) + "=" + value}
+		}
 		if isBool && !fullBoolFlag {
 			// pflag.flag always set the NoOptDefVal of boolean flags to 'true'
 			if value == "false" {
@@ -121,6 +168,37 @@ func (f *FlagBond) cmdString(fullBoolFlag bool) []string {
 	return []string{value}
 }
 
+// repeatCmdString returns the command line of a repeatable flag: the flag is
+// repeated for each value (e.g. --tag a --tag b) and args have one entry per
+// value.
+func (f *FlagBond) repeatCmdString(vals reflect.Value, redact bool) []string {
+	ret := make([]string, 0, 2*vals.Len())
+	for i := 0; i < vals.Len(); i++ {
+		value := fmt.Sprintf("%v", vals.Index(i))
+		if redact && f.IsSecret() {
+			value = RedactedValue
+		}
+		if !f.isArg {
+			ret = append(ret, "--"+string(f.Name))
+		}
+		ret = append(ret, value)
+	}
+	return ret
+}
+
+// NewFlagBond returns a new FlagBond for a flag with the given name, shorthand
+// and usage. value is expected to be a pointer to the variable receiving the
+// value of the flag.
+func NewFlagBond(name, shorthand string, value interface{}, usage string) *FlagBond {
+	return &FlagBond{
+		Name:      cmdFlag(name),
+		Shorthand: shorthand,
+		Value:     value,
+		Usage:     usage,
+		ArgOrder:  -1,
+	}
+}
+
 func (f *FlagBond) Copy() *FlagBond {
 	return &(*f)
 }
@@ -135,16 +213,48 @@ func (f *FlagBond) SetRequired(v bool) *FlagBond {
 	return f
 }
 
+// HasAnnotation returns true if the flag has an annotation with the given key
+// or - for backward compatibility - with the given 'key=value' string.
 func (f *FlagBond) HasAnnotation(s string) bool {
 	if f == nil {
 		return false
 	}
+	return f.Annotations.Has(s)
+}
+
+// isOptional returns true if the arg may be omitted on the command line: the arg
+// is either marked as optional or has a non-zero default value.
+func (f *FlagBond) isOptional() bool {
+	if f.Optional {
+		return true
+	}
+	if _, ok := f.Value.(optionalFlag); ok {
+		return true
+	}
+	v := reflect.ValueOf(f.Value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return false
+	}
+	return !v.IsZero()
+}
+
+// pflagAnnotations returns the annotations of the form 'key=value' as a map
+// suitable for pflag.Flag.Annotations. Bare annotations are ignored.
+func (f *FlagBond) pflagAnnotations() map[string][]string {
+	var ret map[string][]string
 	for _, a := range f.Annotations {
-		if a == s {
-			return true
+		if a.IsBare() {
+			continue
 		}
+		if ret == nil {
+			ret = make(map[string][]string)
+		}
+		ret[a.Key] = append(ret[a.Key], a.Value)
 	}
-	return false
+	return ret
 }
 
 func (f *FlagBond) MarshalJSON() ([]byte, error) {
@@ -156,24 +266,33 @@ func (f *FlagBond) MarshalJSON() ([]byte, error) {
 		Required    bool        `json:"required,omitempty"`
 		Persistent  bool        `json:"persistent,omitempty"`
 		Hidden      bool        `json:"hidden,omitempty"`
-		Annotations []string    `json:"annotations"`
+		Annotations Annotations `json:"annotations"`
+		Choices     []string    `json:"choices,omitempty"`
 	}
 	type argBond struct {
 		Name        cmdFlag     `json:"name"`
 		Value       interface{} `json:"value,omitempty"`
 		Usage       string      `json:"usage"`
 		ArgOrder    int         `json:"arg_order"`
-		Annotations []string    `json:"annotations"`
+		Optional    bool        `json:"optional,omitempty"`
+		Annotations Annotations `json:"annotations"`
+		Choices     []string    `json:"choices,omitempty"`
 	}
 	var jsn []byte
 	var err error
+	value := f.Value
+	if f.IsSecret() && !isNil(value) {
+		value = RedactedValue
+	}
 	if f.isArg {
 		a := &argBond{
 			Name:        f.Name,
-			Value:       f.Value,
+			Value:       value,
 			Usage:       f.Usage,
 			ArgOrder:    f.ArgOrder,
+			Optional:    f.Optional,
 			Annotations: f.Annotations,
+			Choices:     f.Choices,
 		}
 		jsn, err = json.Marshal(a)
 		if err != nil {
@@ -183,12 +302,13 @@ func (f *FlagBond) MarshalJSON() ([]byte, error) {
 		a := &flagBond{
 			Name:        f.Name,
 			Shorthand:   f.Shorthand,
-			Value:       f.Value,
+			Value:       value,
 			Usage:       f.Usage,
 			Required:    f.Required,
 			Persistent:  f.Persistent,
 			Hidden:      f.Hidden,
 			Annotations: f.Annotations,
+			Choices:     f.Choices,
 		}
 		jsn, err = json.Marshal(a)
 		if err != nil {
@@ -200,17 +320,74 @@ func (f *FlagBond) MarshalJSON() ([]byte, error) {
 
 type CmdFlags map[cmdFlag]*FlagBond
 
-// CmdFlags implements flag.Value in order to be stored in a hidden flag
+// CmdFlags implements flag.Value
 var _ flag.Value = (CmdFlags)(nil)
 
+// String returns the flags and their values as they would appear on the
+// command line, sorted by name. Use json.Marshal for a full representation.
 func (s CmdFlags) String() string {
-	bb, _ := json.Marshal(s)
-	return string(bb)
+	return flagBondsString(s.sorted())
 }
 
-// Set is not intended to be called (but required by Value interface)
-func (s CmdFlags) Set(string) error {
-	return errors.E("flagset.Set", errors.K.Invalid)
+// sorted returns the flags sorted by name.
+func (s CmdFlags) sorted() []*FlagBond {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	fbs := make([]*FlagBond, 0, len(s))
+	for _, name := range names {
+		fbs = append(fbs, s[cmdFlag(name)])
+	}
+	return fbs
+}
+
+// declared returns the flags in declaration order.
+func (s CmdFlags) declared() []*FlagBond {
+	fbs := s.sorted()
+	sort.SliceStable(fbs, func(i, j int) bool {
+		return fbs[i].declOrder < fbs[j].declOrder
+	})
+	return fbs
+}
+
+// flagBondsString renders the given flags as 'name=value' pairs without
+// marshaling to json.
+func flagBondsString(fbs []*FlagBond) string {
+	sb := strings.Builder{}
+	sb.WriteString("[")
+	for i, fb := range fbs {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(string(fb.Name))
+		sb.WriteString("=")
+		sb.WriteString(fb.valueString())
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// Set sets the values of the flags to the values found in the given json
+// representation of flags, as returned by json.Marshal: flags absent from the
+// json keep their value, unknown flags are an error. Redacted values of secret
+// flags are ignored.
+func (s CmdFlags) Set(v string) error {
+	values := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(v), &values); err != nil {
+		return errors.E("flagset.Set", errors.K.Invalid, err)
+	}
+	return setBondValues("flagset.Set", s, values)
+}
+
+// UnmarshalJSON sets the values of the flags like Set. The flags must have
+// been bound, since their values are unmarshaled into the bound variables.
+func (s *CmdFlags) UnmarshalJSON(bb []byte) error {
+	if *s == nil {
+		return errors.E("flagset.UnmarshalJSON", errors.K.Invalid, "reason", "flags are not bound")
+	}
+	return s.Set(string(bb))
 }
 
 func (s CmdFlags) Type() string {
@@ -264,6 +441,9 @@ func (s CmdFlags) ConfigureCmd(cmd *cobra.Command, custom Flagger) error {
 	}
 	for k, v := range s {
 		v.Name = k
+	}
+	// register flags in declaration order for commands listing flags unsorted
+	for _, v := range s.declared() {
 		_, err := s.configureFlag(cmd, custom, v)
 		if err != nil {
 			return err
@@ -273,6 +453,53 @@ func (s CmdFlags) ConfigureCmd(cmd *cobra.Command, custom Flagger) error {
 	return nil
 }
 
+// Add adds the given FlagBond to the flags bound to the given command: the
+// flag is registered with the command and the CmdFlags stored with the command
+// is updated such as GetCmdFlagSet reports the new flag.
+// This allows plugins or middleware to contribute flags to a command after the
+// command input was bound with Bind. The Value of the FlagBond is expected to
+// be a pointer to the variable receiving the flag value.
+func (s CmdFlags) Add(cmd *cobra.Command, fb *FlagBond) error {
+	return s.AddCustom(cmd, nil, fb)
+}
+
+// AddCustom is like Add and allows a custom Flagger
+func (s CmdFlags) AddCustom(cmd *cobra.Command, custom Flagger, fb *FlagBond) error {
+	e := errors.Template("CmdFlags.Add", errors.K.Invalid)
+	if cmd == nil {
+		return e("reason", "cmd is nil")
+	}
+	if fb == nil || fb.Name == "" {
+		return e("reason", "flag is nil or has no name")
+	}
+	if s == nil {
+		return e("reason", "flags are nil")
+	}
+	e = e.Add("name", fb.Name)
+	if _, ok := s[fb.Name]; ok {
+		return e(ErrDuplicateFlag, "reason", "duplicate flag")
+	}
+	if cmd.Flags().Lookup(string(fb.Name)) != nil ||
+		cmd.PersistentFlags().Lookup(string(fb.Name)) != nil {
+		return e(ErrDuplicateFlag, "reason", "flag already defined in command")
+	}
+	fb.isArg = false
+	fb.declOrder = len(s)
+	_, err := s.configureFlag(cmd, custom, fb)
+	if err != nil {
+		return e(err)
+	}
+	s[fb.Name] = fb
+
+	stored, err := GetCmdFlagSet(cmd)
+	if err != nil {
+		s.setFor(cmd)
+	} else if reflect.ValueOf(stored).Pointer() != reflect.ValueOf(s).Pointer() {
+		stored[fb.Name] = fb
+	}
+	return nil
+}
+
 // PENDING: not used so far - remove ?
 func (s CmdFlags) configure(cmd *cobra.Command, name cmdFlag) (interface{}, error) {
 	if cmd == nil {
@@ -303,11 +530,26 @@ func (s CmdFlags) configureFlag(cmd *cobra.Command, custom Flagger, v *FlagBond)
 		flagged = custom.Flag(v.Value)
 		if flagged != nil {
 			r = flagged.Ptr
-			pflags.VarPF(flagged.Flag, flagName, v.Shorthand, v.Usage)
+			pflags.VarPF(flagged.value(), flagName, v.Shorthand, v.Usage)
 			if flagged.CsvSlice {
 				v.CsvSlice = true
 			}
+			if flagged.Secret {
+				v.Secret = true
+			}
+			if len(v.Choices) == 0 {
+				v.Choices = flagged.Choices
+			}
+			v.completion = flagged.Completion
+		}
+	}
+	if v.Complete != "" {
+		// the completion declared with the tag takes precedence
+		completion, err := tagCompletion(v.Complete)
+		if err != nil {
+			return nil, err
 		}
+		v.completion = completion
 	}
 	if flagged == nil {
 		var err error
@@ -317,7 +559,8 @@ func (s CmdFlags) configureFlag(cmd *cobra.Command, custom Flagger, v *FlagBond)
 		}
 	}
 
-	if v.Required {
+	if v.Required && envVar(cmd, v) == "" {
+		// required flags bound to an environment variable are checked by SetArgs
 		var err error
 		if v.Persistent {
 			err = cmd.MarkPersistentFlagRequired(flagName)
@@ -331,6 +574,24 @@ func (s CmdFlags) configureFlag(cmd *cobra.Command, custom Flagger, v *FlagBond)
 	if v.Hidden {
 		pflags.Lookup(flagName).Hidden = true
 	}
+	if env := envVar(cmd, v); env != "" {
+		pflags.Lookup(flagName).Usage += " (env " + env + ")"
+	}
+	if len(v.Choices) > 0 {
+		pflags.Lookup(flagName).Usage = v.usage()
+		if v.completion == nil {
+			v.completion = choicesCompletion(v.Choices)
+		}
+	}
+	if annotations := v.pflagAnnotations(); len(annotations) > 0 {
+		fl := pflags.Lookup(flagName)
+		if fl.Annotations == nil {
+			fl.Annotations = make(map[string][]string)
+		}
+		for key, vals := range annotations {
+			fl.Annotations[key] = append(fl.Annotations[key], vals...)
+		}
+	}
 
 	return r, nil
 }
@@ -339,7 +600,36 @@ func (s CmdFlags) makeFlag(pflags *flag.FlagSet, v *FlagBond) (interface{}, erro
 	flagName := string(v.Name)
 	var r interface{}
 
+	if val, ok := v.Value.(*int); ok && v.Count {
+		makeCountFlag(pflags, v, val)
+		return val, nil
+	}
+	if _, isValue := v.Value.(flag.Value); !isValue {
+		if av, ok := newArrayValue(v.Value, v.separator()); ok {
+			pflags.VarP(av, flagName, v.Shorthand, v.Usage)
+			return v.Value, nil
+		}
+	}
+	if v.Repeat {
+		if sv, ok := newSepSliceValue(v.Value, ""); ok {
+			pflags.VarP(sv, flagName, v.Shorthand, v.Usage)
+			return v.Value, nil
+		}
+	}
+	if v.Separator != "" && v.Separator != "," {
+		if sv, ok := newSepSliceValue(v.Value, v.Separator); ok {
+			pflags.VarP(sv, flagName, v.Shorthand, v.Usage)
+			return v.Value, nil
+		}
+	}
+
 	switch val := v.Value.(type) {
+	case optionalFlag:
+		err := s.makeOptionalFlag(pflags, v, val)
+		if err != nil {
+			return nil, err
+		}
+		r = val
 
 	case string:
 		r = pflags.StringP(flagName, v.Shorthand, val, v.Usage)
@@ -445,6 +735,29 @@ func (s CmdFlags) makeFlag(pflags *flag.FlagSet, v *FlagBond) (interface{}, erro
 		pflags.VarPF(newPtrInt64Value(val), flagName, v.Shorthand, v.Usage)
 		r = val
 
+	case **uint:
+		pflags.VarPF(newPtrUintValue(val), flagName, v.Shorthand, v.Usage)
+		r = val
+
+	case **float64:
+		pflags.VarPF(newPtrFloat64Value(val), flagName, v.Shorthand, v.Usage)
+		r = val
+
+	case **time.Duration:
+		pflags.VarPF(newPtrDurationValue(val), flagName, v.Shorthand, v.Usage)
+		r = val
+
+	case *time.Time:
+		pflags.VarP(newTimeValue(val, v.layout()), flagName, v.Shorthand, v.Usage)
+		r = val
+	case **time.Time:
+		pflags.VarPF(newPtrTimeValue(val, v.layout()), flagName, v.Shorthand, v.Usage)
+		r = val
+
+	case **net.IP:
+		pflags.VarPF(newPtrIPValue(val), flagName, v.Shorthand, v.Usage)
+		r = val
+
 	case float32:
 		r = pflags.Float32P(flagName, v.Shorthand, val, v.Usage)
 	case *float32:
@@ -478,6 +791,12 @@ func (s CmdFlags) makeFlag(pflags *flag.FlagSet, v *FlagBond) (interface{}, erro
 		pflags.DurationSliceVarP(val, flagName, v.Shorthand, *val, v.Usage)
 		r = val
 	default:
+		if fv, ok := v.Value.(flag.Value); ok && isStringPtr(v.Value) {
+			// named string type implementing flag.Value
+			pflags.VarP(fv, flagName, v.Shorthand, v.Usage)
+			r = fv
+			break
+		}
 		fv, ok := reflect.ValueOf(v.Value).Elem().Interface().(flag.Value)
 		if ok {
 			if reflect.ValueOf(fv).Kind() == reflect.Ptr {
@@ -493,7 +812,7 @@ func (s CmdFlags) makeFlag(pflags *flag.FlagSet, v *FlagBond) (interface{}, erro
 			//}
 		}
 		return nil, errors.E("configure flags - unsupported value type",
-			errors.K.NotImplemented,
+			errors.K.NotImplemented, ErrUnsupportedType,
 			"ok", ok,
 			"name", v.Name,
 			"value", v.Value,
@@ -503,6 +822,12 @@ func (s CmdFlags) makeFlag(pflags *flag.FlagSet, v *FlagBond) (interface{}, erro
 	return r, nil
 }
 
+// isStringPtr returns true if v is a pointer to a value of kind string.
+func isStringPtr(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.String
+}
+
 func (s CmdFlags) flagset(cmd *cobra.Command, name cmdFlag) (*flag.FlagSet, error) {
 	if cmd == nil {
 		return nil, errors.E("configure flags", errors.K.Invalid,
@@ -615,19 +940,17 @@ func noStackTrace(err error) error {
 
 // ------- FlagSet helpers
 func setCmdFlagSet(cmd *cobra.Command, s CmdFlags) {
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   flagset,
-		Hidden: true,
-		Value:  s,
+	updateState(cmd, func(st *cmdState) {
+		st.flags = s
 	})
 }
 
 func GetCmdFlagSet(cmd *cobra.Command) (CmdFlags, error) {
-	f := cmd.Flags().Lookup(flagset)
-	if f == nil {
+	st := getState(cmd)
+	if st == nil || st.flags == nil {
 		return nil, errors.E("getCmdFlagSet", errors.K.NotExist)
 	}
-	return f.Value.(CmdFlags), nil
+	return st.flags, nil
 }
 
 type ArgSet struct {
@@ -636,17 +959,27 @@ type ArgSet struct {
 
 var _ flag.Value = (*ArgSet)(nil)
 
+// String returns the args and their values in order. Use json.Marshal for a
+// full representation.
 func (f *ArgSet) String() string {
-	jsn, err := json.Marshal(f.Flags)
-	if err != nil {
-		panic(err)
-	}
-	return string(jsn)
+	return flagBondsString(f.Flags)
 }
 
 // ArgUsages returns a string containing the usage information for all flags in
 // the ArgSet
 func (f *ArgSet) ArgUsages() string {
+	return f.ArgUsagesWrapped(0)
+}
+
+// ArgUsagesWrapped is like ArgUsages but wraps usages such that lines do not
+// exceed cols. No wrapping is done if cols is zero.
+func (f *ArgSet) ArgUsagesWrapped(cols int) string {
+	return f.ArgUsagesOrdered(cols, OrderDefault)
+}
+
+// ArgUsagesOrdered is like ArgUsagesWrapped with args listed in the given
+// order.
+func (f *ArgSet) ArgUsagesOrdered(cols int, order FlagOrder) string {
 	if len(f.Flags) == 0 {
 		return ""
 	}
@@ -659,19 +992,48 @@ func (f *ArgSet) ArgUsages() string {
 	}
 	flm := fmt.Sprintf("%d", lm)
 	// arg flags are expected to be correctly ordered
-	for i, arg := range f.Flags {
+	args := orderArgs(f.Flags, order)
+	for i, arg := range args {
 		name := fmt.Sprintf("  %-"+flm+"s", string(arg.Name))
-		sb.WriteString(name + " : " + arg.Usage)
-		if i < len(f.Flags)-1 {
+		sb.WriteString(name + " : " + wrapText(arg.usage(), len(name)+3, cols))
+		if i < len(args)-1 {
 			sb.WriteString("\n")
 		}
 	}
 	return sb.String()
 }
 
-// Set is not intended to be called (but required by Value interface)
-func (f *ArgSet) Set(string) error {
-	return errors.E("argset.Set", errors.K.Invalid)
+// Set sets the values of the args to the values found in the given json
+// representation of args, as returned by json.Marshal. Args are matched by
+// name: args absent from the json keep their value, unknown args are an error.
+func (f *ArgSet) Set(v string) error {
+	var jargs struct {
+		Flags []json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(v), &jargs); err != nil {
+		return errors.E("argset.Set", errors.K.Invalid, err)
+	}
+	values := make(map[string]json.RawMessage, len(jargs.Flags))
+	for _, raw := range jargs.Flags {
+		var arg struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &arg); err != nil {
+			return errors.E("argset.Set", errors.K.Invalid, err)
+		}
+		values[arg.Name] = raw
+	}
+	args := make(map[cmdFlag]*FlagBond, len(f.Flags))
+	for _, fb := range f.Flags {
+		args[fb.Name] = fb
+	}
+	return setBondValues("argset.Set", args, values)
+}
+
+// UnmarshalJSON sets the values of the args like Set. The args must have been
+// bound, since their values are unmarshaled into the bound variables.
+func (f *ArgSet) UnmarshalJSON(bb []byte) error {
+	return f.Set(string(bb))
 }
 
 func (f *ArgSet) Type() string {
@@ -682,19 +1044,17 @@ func setCmdArgSet(cmd *cobra.Command, s []*FlagBond) {
 	if s == nil {
 		s = []*FlagBond{}
 	}
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   argset,
-		Hidden: true,
-		Value:  &ArgSet{Flags: s},
+	updateState(cmd, func(st *cmdState) {
+		st.args = &ArgSet{Flags: s}
 	})
 }
 
 func GetCmdArgSet(cmd *cobra.Command) (*ArgSet, error) {
-	f := cmd.Flags().Lookup(argset)
-	if f == nil {
+	st := getState(cmd)
+	if st == nil || st.args == nil {
 		return nil, errors.E("getCmdArgSet", errors.K.NotExist)
 	}
-	return f.Value.(*ArgSet), nil
+	return st.args, nil
 }
 
 // -- ptr bool value
@@ -818,114 +1178,188 @@ func (b *ptrStringValue) String() string {
 	return *ret
 }
 
-// inputValue implements Value in order to store any input in the flagset
-type inputValue struct {
-	input interface{}
+// -- ptr uint value
+type ptrUintValue struct {
+	p **uint
 }
 
-var _ flag.Value = (*inputValue)(nil)
+func newPtrUintValue(p **uint) *ptrUintValue {
+	return &ptrUintValue{p}
+}
 
-func (f *inputValue) String() string {
-	jsn, err := json.Marshal(f)
-	if err != nil {
-		panic(err)
+func (b *ptrUintValue) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 0)
+	if err == nil {
+		uv := uint(v)
+		*b.p = &uv
 	}
-	return string(jsn)
+	return err
 }
 
-// Set is not intended to be called (but required by Value interface)
-func (f *inputValue) Set(string) error {
-	return errors.E("flagset.Set", errors.K.Invalid)
+func (b *ptrUintValue) Type() string {
+	return "uint"
 }
 
-func (f *inputValue) Type() string {
-	return input
+func (b *ptrUintValue) String() string {
+	ret := *b.p
+	if ret == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*ret), 10)
 }
 
-func setCmdInput(cmd *cobra.Command, v interface{}) {
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   input,
-		Hidden: true,
-		Value:  &inputValue{input: v},
-	})
+// -- ptr float64 value
+type ptrFloat64Value struct {
+	p **float64
 }
 
-func GetCmdInput(cmd *cobra.Command) (interface{}, bool) {
-	f := cmd.Flags().Lookup(input)
-	if f == nil {
-		return nil, false
+func newPtrFloat64Value(p **float64) *ptrFloat64Value {
+	return &ptrFloat64Value{p}
+}
+
+func (b *ptrFloat64Value) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err == nil {
+		*b.p = &v
 	}
-	return f.Value.(*inputValue).input, true
+	return err
 }
 
-// ctxValue implements Value in order to store any context in the flagset
-type ctxValue struct {
-	typ string
-	ctx interface{}
+func (b *ptrFloat64Value) Type() string {
+	return "float64"
 }
 
-var _ flag.Value = (*ctxValue)(nil)
+func (b *ptrFloat64Value) String() string {
+	ret := *b.p
+	if ret == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*ret, 'g', -1, 64)
+}
 
-func (f *ctxValue) String() string {
-	jsn, err := json.Marshal(f.ctx)
-	if err != nil {
-		panic(err)
+// -- ptr time.Duration value
+type ptrDurationValue struct {
+	p **time.Duration
+}
+
+func newPtrDurationValue(p **time.Duration) *ptrDurationValue {
+	return &ptrDurationValue{p}
+}
+
+func (b *ptrDurationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err == nil {
+		*b.p = &v
+	}
+	return err
+}
+
+func (b *ptrDurationValue) Type() string {
+	return "duration"
+}
+
+func (b *ptrDurationValue) String() string {
+	ret := *b.p
+	if ret == nil {
+		return ""
+	}
+	return ret.String()
+}
+
+// -- ptr net.IP value
+type ptrIPValue struct {
+	p **net.IP
+}
+
+func newPtrIPValue(p **net.IP) *ptrIPValue {
+	return &ptrIPValue{p}
+}
+
+func (b *ptrIPValue) Set(s string) error {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return fmt.Errorf("failed to parse IP: %q", s)
 	}
-	return string(jsn)
+	*b.p = &ip
+	return nil
 }
 
-// Set is not intended to be called (but required by Value interface)
-func (f *ctxValue) Set(string) error {
-	return errors.E("flags.Set", errors.K.Invalid)
+func (b *ptrIPValue) Type() string {
+	return "ip"
+}
+
+func (b *ptrIPValue) String() string {
+	ret := *b.p
+	if ret == nil {
+		return ""
+	}
+	return ret.String()
 }
 
-func (f *ctxValue) Type() string {
-	return f.typ
+func setCmdInput(cmd *cobra.Command, v interface{}) {
+	updateState(cmd, func(st *cmdState) {
+		st.input = v
+		st.hasInput = true
+	})
 }
 
+func GetCmdInput(cmd *cobra.Command) (interface{}, bool) {
+	st := getState(cmd)
+	if st == nil || !st.hasInput {
+		return nil, false
+	}
+	return st.input, true
+}
+
+// SetCmdCtx sets the given context to the command. See ContextWithCmdCtx to
+// make it reachable from the context.Context of the command.
 func SetCmdCtx(cmd *cobra.Command, v interface{}) {
-	f := cmd.Flags().Lookup(cmdctx)
-	if f != nil && f.Value.(*ctxValue).ctx == v {
-		return
-	}
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   cmdctx,
-		Hidden: true,
-		Value:  &ctxValue{typ: cmdctx, ctx: v},
+	updateState(cmd, func(st *cmdState) {
+		st.ctx = v
+		st.hasCtx = true
 	})
 }
 
+// GetCmdCtx returns the context of the command and true if a context was set.
 func GetCmdCtx(cmd *cobra.Command) (interface{}, bool) {
 	if cmd == nil {
 		return nil, false
 	}
-	f := cmd.Flags().Lookup(cmdctx)
-	if f == nil {
+	st := getState(cmd)
+	if st == nil || !st.hasCtx {
 		return nil, false
 	}
-	return f.Value.(*ctxValue).ctx, true
+	return st.ctx, true
 }
 
+// AddToCmdCtx attaches the given value with the given name to the command.
+// It returns false if a value with the same name was already added.
 func AddToCmdCtx(cmd *cobra.Command, name string, v interface{}) bool {
-	f := cmd.Flags().Lookup(name)
-	if f != nil {
-		return false
-	}
-	cmd.Flags().AddFlag(&flag.Flag{
-		Name:   name,
-		Hidden: true,
-		Value:  &ctxValue{typ: name, ctx: v},
+	added := false
+	updateState(cmd, func(st *cmdState) {
+		if _, ok := st.values[name]; ok {
+			return
+		}
+		if st.values == nil {
+			st.values = make(map[string]interface{})
+		}
+		st.values[name] = v
+		added = true
 	})
-	return true
+	return added
 }
 
+// GetFromCmdCtx returns the value attached with the given name to the command.
 func GetFromCmdCtx(cmd *cobra.Command, name string) (interface{}, bool) {
 	if cmd == nil {
 		return nil, false
 	}
-	f := cmd.Flags().Lookup(name)
-	if f == nil {
+	cmdStates.mu.RLock()
+	defer cmdStates.mu.RUnlock()
+	st := lookupState(cmd)
+	if st == nil {
 		return nil, false
 	}
-	return f.Value.(*ctxValue).ctx, true
+	v, ok := st.values[name]
+	return v, ok
 }
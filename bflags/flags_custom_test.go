@@ -86,3 +86,56 @@ func TestCustomFlag(t *testing.T) {
 	require.EqualValues(t, []string{"path", "to", "bla"}, sts.Path)
 
 }
+
+// completionFl is a Flagger providing a placeholder and completion for paths
+type completionFl struct {
+	fl
+}
+
+func (c *completionFl) Flag(val interface{}) *Flagged {
+	ret := c.fl.Flag(val)
+	if ret != nil {
+		ret.Placeholder = "a/path"
+		ret.Completion = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return []string{toComplete + "/x", toComplete + "/y"}, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+	return ret
+}
+
+func TestCustomFlagCompletion(t *testing.T) {
+	type argsInput struct {
+		Name  string `cmd:"arg,name,the name,0"`
+		Other path   `cmd:"arg,other,the other,1"`
+	}
+	c := &cobra.Command{
+		Use: "test",
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	err := BindCustom(c, &completionFl{}, &MyObject{})
+	require.NoError(t, err)
+	require.Contains(t, c.Flags().FlagUsages(), "--path a/path")
+
+	complete := func(c *cobra.Command, args ...string) string {
+		root := &cobra.Command{Use: "root"}
+		root.AddCommand(c)
+		RegisterCompletions(root)
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append([]string{cobra.ShellCompRequestCmd, c.Name()}, args...))
+		require.NoError(t, root.Execute())
+		return out.String()
+	}
+	require.Contains(t, complete(c, "--path", "a"), "a/x\na/y\n")
+
+	// args
+	c = &cobra.Command{
+		Use: "test",
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	err = BindCustom(c, &completionFl{}, &argsInput{})
+	require.NoError(t, err)
+	require.NotNil(t, c.ValidArgsFunction)
+	require.NotContains(t, complete(c, "b"), "b/x")
+	require.Contains(t, complete(c, "joe", "b"), "b/x\nb/y\n")
+}
@@ -2,8 +2,11 @@ package bflags
 
 import (
 	"encoding/json"
+	"fmt"
 	"net"
 	"reflect"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -126,13 +129,14 @@ func TestAnnotations(t *testing.T) {
 	f, ok := flags[cmdFlag("Is")]
 	require.True(t, ok)
 	require.Equal(t, 1, len(f.Annotations))
-	require.Equal(t, "ok", f.Annotations[0])
+	require.Equal(t, "ok", f.Annotations[0].Key)
+	require.True(t, f.HasAnnotation("ok"))
 
 	f, ok = flags[cmdFlag("Int")]
 	require.True(t, ok)
 	require.Equal(t, 2, len(f.Annotations))
-	require.Equal(t, "one", f.Annotations[0])
-	require.Equal(t, "two", f.Annotations[1])
+	require.Equal(t, "one", f.Annotations[0].Key)
+	require.Equal(t, "two", f.Annotations[1].Key)
 
 	args, err := GetCmdArgSet(c)
 	require.NoError(t, err)
@@ -140,7 +144,55 @@ func TestAnnotations(t *testing.T) {
 	f = args.Flags[0]
 	require.Equal(t, cmdFlag("Arg"), f.Name)
 	require.Equal(t, 1, len(f.Annotations))
-	require.Equal(t, "ok", f.Annotations[0])
+	require.Equal(t, "ok", f.Annotations[0].Key)
+}
+
+func TestStructuredAnnotations(t *testing.T) {
+	an := NewAnnotations("sensitive", "unit=bytes", "ext=json", "ext=yaml", "secret=false")
+	require.True(t, an.Has("sensitive"))
+	require.True(t, an.Has("unit"))
+	require.True(t, an.Has("unit=bytes"))
+	require.False(t, an.Has("bytes"))
+
+	require.True(t, an.GetBool("sensitive"))
+	require.False(t, an.GetBool("secret"))
+	require.False(t, an.GetBool("missing"))
+	require.Equal(t, "bytes", an.GetString("unit"))
+	require.Equal(t, "", an.GetString("missing"))
+	require.Equal(t, []string{"json", "yaml"}, an.Values("ext"))
+
+	bb, err := json.Marshal(an)
+	require.NoError(t, err)
+	require.Equal(t, `["sensitive","unit=bytes","ext=json","ext=yaml","secret=false"]`, string(bb))
+
+	var an2 Annotations
+	err = json.Unmarshal(bb, &an2)
+	require.NoError(t, err)
+	require.Equal(t, an, an2)
+}
+
+type TestPflagAnnotationsStruct struct {
+	Config string `cmd:"flag" meta:"non-empty,ext=json,ext=yaml"`
+	Plain  string `cmd:"flag" meta:"ok"`
+	Arg    string `cmd:"arg" meta:"kind=path"`
+}
+
+func TestPflagAnnotations(t *testing.T) {
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	err := Bind(c, &TestPflagAnnotationsStruct{})
+	require.NoError(t, err)
+
+	pf := assertFlag(t, c, "Config")
+	require.Equal(t, map[string][]string{"ext": {"json", "yaml"}}, pf.Annotations)
+
+	pf = assertFlag(t, c, "Plain")
+	require.Nil(t, pf.Annotations)
+
+	pf = c.Flag("Arg")
+	require.NotNil(t, pf)
+	require.Equal(t, []string{"path"}, pf.Annotations["kind"])
 }
 
 // TestBindPtrBoolIntString test that binding to pointer values
@@ -231,6 +283,75 @@ func TestBindPtrBoolIntString(t *testing.T) {
 	require.Equal(t, "hello", *sts.Str)
 }
 
+type TestPtrUintFloatDurationIP struct {
+	Uint     *uint          `cmd:"flag"`
+	Float    *float64       `cmd:"flag"`
+	Duration *time.Duration `cmd:"flag"`
+	Ip       *net.IP        `cmd:"flag"`
+}
+
+// TestBindPtrUintFloatDurationIP test binding to nil pointers of uint, float64,
+// time.Duration and net.IP: nil means the flag was not provided.
+func TestBindPtrUintFloatDurationIP(t *testing.T) {
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	sts := &TestPtrUintFloatDurationIP{}
+	err := Bind(c, sts)
+	require.NoError(t, err)
+	pfuint := assertFlag(t, c, "Uint")
+	pffloat := assertFlag(t, c, "Float")
+	pfduration := assertFlag(t, c, "Duration")
+	pfip := assertFlag(t, c, "Ip")
+	require.Equal(t, "", pfuint.Value.String())
+	require.Equal(t, "duration", pfduration.Value.Type())
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	fb, _ := flags.Get("Uint")
+	require.Nil(t, fb.CmdString())
+
+	require.Error(t, pfuint.Value.Set("-1"))
+	require.Nil(t, sts.Uint)
+	require.NoError(t, pfuint.Value.Set("3"))
+	require.Equal(t, uint(3), *sts.Uint)
+	require.Equal(t, "3", pfuint.Value.String())
+	require.Equal(t, []string{"--Uint", "3"}, fb.CmdString())
+
+	require.Error(t, pffloat.Value.Set("bla"))
+	require.Nil(t, sts.Float)
+	require.NoError(t, pffloat.Value.Set("1.5"))
+	require.Equal(t, 1.5, *sts.Float)
+	require.Equal(t, "1.5", pffloat.Value.String())
+
+	require.Error(t, pfduration.Value.Set("bla"))
+	require.Nil(t, sts.Duration)
+	require.NoError(t, pfduration.Value.Set("1m"))
+	require.Equal(t, time.Minute, *sts.Duration)
+	require.Equal(t, "1m0s", pfduration.Value.String())
+
+	require.Error(t, pfip.Value.Set("bla"))
+	require.Nil(t, sts.Ip)
+	require.NoError(t, pfip.Value.Set("127.0.0.1"))
+	require.Equal(t, "127.0.0.1", sts.Ip.String())
+	require.Equal(t, "127.0.0.1", pfip.Value.String())
+
+	// initialized pointers are bound to their value
+	c = &cobra.Command{
+		Use: "dontUse",
+	}
+	sts = &TestPtrUintFloatDurationIP{
+		Uint:     new(uint),
+		Float:    new(float64),
+		Duration: new(time.Duration),
+		Ip:       &net.IP{},
+	}
+	err = Bind(c, sts)
+	require.NoError(t, err)
+	require.NoError(t, assertFlag(t, c, "Duration").Value.Set("2s"))
+	require.Equal(t, 2*time.Second, *sts.Duration)
+}
+
 type TestPtrBoolStruct struct {
 	Is     *bool `cmd:"flag,is"`
 	Ignore string
@@ -1006,3 +1127,337 @@ func TestBindPtrStructWithInnerPtr(t *testing.T) {
 	}
 	require.Equal(t, exp, sts)
 }
+
+func TestCmdStateNotInFlags(t *testing.T) {
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	child := &cobra.Command{
+		Use: "child",
+	}
+	c.AddCommand(child)
+	err := Bind(c, &TestPtrBoolIntString{})
+	require.NoError(t, err)
+	err = Bind(child, &TestStringStruct{})
+	require.NoError(t, err)
+	SetCmdCtx(c, "ctx")
+	require.True(t, AddToCmdCtx(c, "key", 1))
+	require.False(t, AddToCmdCtx(c, "key", 2))
+
+	c.Flags().VisitAll(func(f *pflag.Flag) {
+		require.NotContains(t, f.Name, "$")
+	})
+
+	_, err = GetCmdFlagSet(c)
+	require.NoError(t, err)
+	_, err = GetCmdArgSet(c)
+	require.NoError(t, err)
+	in, ok := GetCmdInput(c)
+	require.True(t, ok)
+	require.NotNil(t, in)
+	ctx, ok := GetCmdCtx(c)
+	require.True(t, ok)
+	require.Equal(t, "ctx", ctx)
+	v, ok := GetFromCmdCtx(c, "key")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	// the context of previous executions is removed, other values are kept
+	require.NoError(t, ResetCommand(c))
+	_, ok = GetCmdCtx(c)
+	require.False(t, ok)
+	_, ok = GetFromCmdCtx(c, "key")
+	require.True(t, ok)
+
+	ClearCmdState(c)
+	_, err = GetCmdFlagSet(c)
+	require.True(t, errors.IsNotExist(err))
+	_, err = GetCmdFlagSet(child)
+	require.True(t, errors.IsNotExist(err))
+	_, ok = GetCmdInput(c)
+	require.False(t, ok)
+	_, ok = GetCmdCtx(c)
+	require.False(t, ok)
+	_, ok = GetFromCmdCtx(c, "key")
+	require.False(t, ok)
+}
+
+func TestCmdStateRelease(t *testing.T) {
+	type input struct {
+		Name string `cmd:"flag,name,a name"`
+	}
+	// states of the commands still in the registry
+	bound := func(keys map[uintptr]bool) int {
+		cmdStates.mu.RLock()
+		defer cmdStates.mu.RUnlock()
+		n := 0
+		for k := range cmdStates.m {
+			if keys[k] {
+				n++
+			}
+		}
+		return n
+	}
+
+	keys := make(map[uintptr]bool)
+	func() {
+		for i := 0; i < 10; i++ {
+			root := &cobra.Command{Use: "cli"}
+			c, err := BindRunE(&input{}, &cobra.Command{Use: "get"}, func(in *input) error { return nil }, nil)
+			require.NoError(t, err)
+			root.AddCommand(c)
+			require.NoError(t, Bind(root, &input{}))
+			keys[address(root)] = true
+			keys[address(c)] = true
+		}
+	}()
+	require.Equal(t, 20, bound(keys))
+
+	// commands that are not referenced anymore release their state
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		return bound(keys) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCmdStateConcurrency(t *testing.T) {
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{Use: "get"}
+	root.AddCommand(c)
+	defer ClearCmdState(root)
+	SetExampleVars(root, map[string]interface{}{"var": 0})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				AddToCmdCtx(root, fmt.Sprintf("key-%d-%d", i, j), j)
+				SetExampleVars(root, map[string]interface{}{fmt.Sprintf("var%d", i): j})
+				SetFlagOrder(root, OrderDeclared)
+				UseMiddleware(root, func(next RunFn) RunFn { return next })
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = GetFromCmdCtx(root, "key-0-0")
+				for range getState(root).exampleVars {
+				}
+				_ = GetFlagOrder(c)
+				_ = withMiddlewares(c, func(*cobra.Command, interface{}) error { return nil })
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, OrderDeclared, GetFlagOrder(c))
+}
+
+func TestFlagSetString(t *testing.T) {
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	type argsAndFlags struct {
+		Stringval string `cmd:"flag"`
+		Id        string `cmd:"arg,,,0"`
+		Path      string `cmd:"arg,,,1"`
+	}
+	err := Bind(c, &argsAndFlags{})
+	require.NoError(t, err)
+	err = c.ParseFlags([]string{"--Stringval", "x"})
+	require.NoError(t, err)
+	_, err = SetArgs(c, []string{"a", "b"})
+	require.NoError(t, err)
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	require.Equal(t, "[Stringval=x]", flags.String())
+
+	args, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+	require.Equal(t, "[Id=a Path=b]", args.String())
+}
+
+type TestOptionalStruct struct {
+	Count    Optional[int]           `cmd:"flag,count,a count"`
+	Verbose  Optional[bool]          `cmd:"flag,verbose,verbose output,v"`
+	Timeout  Optional[time.Duration] `cmd:"flag,timeout,the timeout"`
+	Tags     Optional[[]string]      `cmd:"flag,tags,some tags"`
+	Id       Optional[string]        `cmd:"arg,id,content id"`
+	Defaults Optional[int]           `cmd:"flag,defaults,with default"`
+}
+
+func TestBindOptional(t *testing.T) {
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	sts := &TestOptionalStruct{
+		Defaults: NewOptional(5),
+	}
+	err := Bind(c, sts)
+	require.NoError(t, err)
+	require.Equal(t, "dontUse [id]", c.Use)
+
+	err = c.ParseFlags([]string{"--count", "0", "-v", "--tags", "a,b"})
+	require.NoError(t, err)
+	_, err = SetArgs(c, nil)
+	require.NoError(t, err)
+
+	require.True(t, sts.Count.IsSet())
+	require.Equal(t, 0, sts.Count.Get())
+	require.True(t, sts.Verbose.IsSet())
+	require.True(t, sts.Verbose.Get())
+	require.False(t, sts.Timeout.IsSet())
+	require.Equal(t, time.Second, sts.Timeout.GetOr(time.Second))
+	require.Equal(t, []string{"a", "b"}, sts.Tags.Get())
+	require.False(t, sts.Id.IsSet())
+	require.True(t, sts.Defaults.IsSet())
+	require.Equal(t, 5, sts.Defaults.Get())
+	require.Equal(t, "5", assertFlag(t, c, "defaults").DefValue)
+
+	_, err = SetArgs(c, []string{"iq__1"})
+	require.NoError(t, err)
+	require.Equal(t, "iq__1", sts.Id.Get())
+	require.Equal(t, "iq__1", GetFlagArgSet(c)["id"])
+	require.NotContains(t, GetFlagArgSet(c), "timeout")
+
+	require.Error(t, assertFlag(t, c, "timeout").Value.Set("bla"))
+	require.False(t, sts.Timeout.IsSet())
+
+	bb, err := json.Marshal(sts)
+	require.NoError(t, err)
+	require.Equal(t, `{"Count":0,"Verbose":true,"Timeout":null,"Tags":["a","b"],"Id":"iq__1","Defaults":5}`, string(bb))
+
+	var o TestOptionalStruct
+	err = json.Unmarshal([]byte(`{"Count":2,"Timeout":null}`), &o)
+	require.NoError(t, err)
+	require.True(t, o.Count.IsSet())
+	require.Equal(t, 2, o.Count.Get())
+	require.False(t, o.Timeout.IsSet())
+	require.True(t, o.Timeout.IsZero())
+	o.Count.Unset()
+	require.False(t, o.Count.IsSet())
+}
+
+func TestSliceSeparator(t *testing.T) {
+	type sepOpts struct {
+		Exprs  []string        `cmd:"flag,exprs,expressions" sep:";"`
+		Ints   []int           `cmd:"flag,ints,integers" sep:":"`
+		Delays []time.Duration `cmd:"flag,delays,delays" sep:" "`
+		Paths  []string        `cmd:"arg,paths,paths,0" sep:"|"`
+	}
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	sts := &sepOpts{}
+	err := Bind(c, sts)
+	require.NoError(t, err)
+
+	err = c.ParseFlags([]string{"--exprs", "a,b;c", "--exprs", "d", "--ints", "1:2", "--delays", "1s 2m"})
+	require.NoError(t, err)
+	_, err = SetArgs(c, []string{"x,y", "z"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"a,b", "c", "d"}, sts.Exprs)
+	require.Equal(t, []int{1, 2}, sts.Ints)
+	require.Equal(t, []time.Duration{time.Second, 2 * time.Minute}, sts.Delays)
+	require.Equal(t, []string{"x,y", "z"}, sts.Paths)
+	require.Equal(t, "[a,b;c;d]", assertFlag(t, c, "exprs").Value.String())
+	require.Equal(t, "stringSlice", assertFlag(t, c, "exprs").Value.Type())
+	require.Error(t, assertFlag(t, c, "ints").Value.Set("1:x"))
+
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	fb, _ := flags.Get("exprs")
+	require.Equal(t, []string{"--exprs", "a,b;c;d"}, fb.CmdString())
+	args, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x,y|z"}, args.Flags[0].CmdString())
+}
+
+func TestRepeatableFlags(t *testing.T) {
+	type repeatOpts struct {
+		Tags  []string `cmd:"flag,tag,tags" repeat:"true"`
+		Ports []int    `cmd:"flag,port,ports" repeat:"true"`
+		Csv   []string `cmd:"flag,csv,comma separated"`
+		Exprs []string `cmd:"arg,exprs,expressions,0" repeat:"true"`
+	}
+	bindParse := func(cmdLine []string) (*repeatOpts, *cobra.Command) {
+		c := &cobra.Command{
+			Use: "dontUse",
+		}
+		sts := &repeatOpts{}
+		require.NoError(t, Bind(c, sts))
+		require.NoError(t, c.ParseFlags(cmdLine))
+		_, err := SetArgs(c, c.Flags().Args())
+		require.NoError(t, err)
+		return sts, c
+	}
+
+	cmdLine := []string{"--tag", "a,b", "--tag", "c", "--port", "80", "--port", "443", "--csv", "x,y", "e1,e2", "e3"}
+	sts, c := bindParse(cmdLine)
+	require.Equal(t, []string{"a,b", "c"}, sts.Tags)
+	require.Equal(t, []int{80, 443}, sts.Ports)
+	require.Equal(t, []string{"x", "y"}, sts.Csv)
+	require.Equal(t, []string{"e1,e2", "e3"}, sts.Exprs)
+	require.Equal(t, "stringArray", assertFlag(t, c, "tag").Value.Type())
+	require.Equal(t, "a,b,c", GetFlagArgSet(c)["tag"])
+
+	// command line reconstruction is loss-less
+	flags, err := GetCmdFlagSet(c)
+	require.NoError(t, err)
+	args, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+	var line []string
+	for _, name := range []string{"tag", "port", "csv"} {
+		fb, _ := flags.Get(name)
+		line = append(line, fb.CmdString()...)
+	}
+	line = append(line, args.Flags[0].CmdString()...)
+	require.Equal(t, cmdLine, line)
+
+	sts2, _ := bindParse(line)
+	require.Equal(t, sts, sts2)
+}
+
+func TestBindArrays(t *testing.T) {
+	type arrayOpts struct {
+		Pair  [2]string  `cmd:"flag,pair,a pair"`
+		Ints  [3]int     `cmd:"flag,ints,three ints" sep:";"`
+		Key   [4]byte    `cmd:"flag,key,hex key"`
+		Point [2]float64 `cmd:"arg,point,a point,0"`
+	}
+	c := &cobra.Command{
+		Use: "dontUse",
+	}
+	sts := &arrayOpts{Pair: [2]string{"a", "b"}}
+	require.NoError(t, Bind(c, sts))
+	require.Equal(t, "a,b", assertFlag(t, c, "pair").DefValue)
+	require.Equal(t, "hex", assertFlag(t, c, "key").Value.Type())
+
+	err := c.ParseFlags([]string{"--pair", "a,b,c"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "wrong count of values")
+	require.Equal(t, [2]string{"a", "b"}, sts.Pair)
+
+	require.Error(t, assertFlag(t, c, "ints").Value.Set("1;x;3"))
+	require.Equal(t, [3]int{}, sts.Ints)
+	require.Error(t, assertFlag(t, c, "key").Value.Set("0102"))
+	require.Error(t, assertFlag(t, c, "key").Value.Set("zz"))
+
+	err = c.ParseFlags([]string{"--pair", "c,d", "--ints", "1;2;3", "--key", "0a0b0c0d"})
+	require.NoError(t, err)
+	_, err = SetArgs(c, []string{"1.5,2"})
+	require.NoError(t, err)
+	require.Equal(t, [2]string{"c", "d"}, sts.Pair)
+	require.Equal(t, [3]int{1, 2, 3}, sts.Ints)
+	require.Equal(t, [4]byte{10, 11, 12, 13}, sts.Key)
+	require.Equal(t, [2]float64{1.5, 2}, sts.Point)
+
+	fas := GetFlagArgSet(c)
+	require.Equal(t, "c,d", fas["pair"])
+	require.Equal(t, "1;2;3", fas["ints"])
+	require.Equal(t, "0a0b0c0d", fas["key"])
+	require.Equal(t, "1.5,2", fas["point"])
+}
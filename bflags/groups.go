@@ -0,0 +1,92 @@
+package bflags
+
+import (
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// modes of flag groups, declared with the 'group' tag as 'name:mode'
+const (
+	groupXor = "xor" // at most one flag of the group may be set
+	groupAnd = "and" // the flags of the group must be set together or not at all
+)
+
+// parseGroups parses the value of a 'group' tag, e.g. "auth:xor,tls:and", into
+// groups as 'name:mode'. The mode of groups without mode is 'xor'.
+func parseGroups(tag string) []string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return nil
+	}
+	ret := splitString(tag)
+	for i, g := range ret {
+		if !strings.Contains(g, ":") {
+			ret[i] = g + ":" + groupXor
+		}
+	}
+	return ret
+}
+
+// checkGroups returns an error if the groups of the given flag are invalid.
+func checkGroups(fb *FlagBond) error {
+	if len(fb.Groups) == 0 {
+		return nil
+	}
+	e := errors.Template("checkGroups", errors.K.Invalid, ErrBadTag, "flag", fb.Name)
+	if fb.isArg {
+		return e("reason", "args cannot be in flag groups")
+	}
+	for _, g := range fb.Groups {
+		name, mode, _ := strings.Cut(g, ":")
+		if name == "" || (mode != groupXor && mode != groupAnd) {
+			return e("reason", "invalid flag group, expected 'name:xor' or 'name:and'", "group", g)
+		}
+	}
+	return nil
+}
+
+// markFlagGroups marks the flags bound to the given command that are in the
+// same group as mutually exclusive or required together, depending on the mode
+// of the group. cobra reports violations of the groups when the command is
+// executed.
+func markFlagGroups(c *cobra.Command) error {
+	flags, err := GetCmdFlagSet(c)
+	if err != nil {
+		return nil
+	}
+	e := errors.Template("markFlagGroups", errors.K.Invalid, ErrBadTag)
+	var names []string
+	modes := make(map[string]string)
+	members := make(map[string][]string)
+	for _, fb := range flags.declared() {
+		for _, g := range fb.Groups {
+			name, mode, _ := strings.Cut(g, ":")
+			if m, ok := modes[name]; !ok {
+				modes[name] = mode
+				names = append(names, name)
+			} else if m != mode {
+				return e("reason", "conflicting modes of flag group",
+					"group", name,
+					"flag", fb.Name)
+			}
+			members[name] = append(members[name], string(fb.Name))
+		}
+	}
+	for _, name := range names {
+		if len(members[name]) < 2 {
+			return e("reason", "flag group with a single flag",
+				"group", name,
+				"flag", members[name][0])
+		}
+	}
+	for _, name := range names {
+		if modes[name] == groupAnd {
+			c.MarkFlagsRequiredTogether(members[name]...)
+		} else {
+			c.MarkFlagsMutuallyExclusive(members[name]...)
+		}
+	}
+	return nil
+}
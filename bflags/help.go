@@ -6,7 +6,9 @@ import (
 	"text/template"
 	_ "unsafe"
 
+	"github.com/eluv-io/errors-go"
 	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
 )
 
 // templateFuncs exports cobra.templateFuncs
@@ -31,7 +33,7 @@ func ConfigureHelpFuncs() {
 			if err != nil {
 				return err.Error()
 			}
-			return argSet.ArgUsages()
+			return argSet.ArgUsagesOrdered(TerminalWidth(), GetFlagOrder(cmd))
 		})
 	AddTemplateFunc("hasArgs",
 		func(cmd *cobra.Command) bool {
@@ -42,16 +44,96 @@ func ConfigureHelpFuncs() {
 			return len(argSet.Flags) > 0
 		})
 	AddTemplateFunc("fullUsageString", fullUsageString)
+	AddTemplateFunc("example", RenderExample)
+	AddTemplateFunc("seeAlso", seeAlsoUsages)
+	AddTemplateFunc("deprecation", Deprecation)
+	AddTemplateFunc("aliases", nameAndAliases)
+	AddTemplateFunc("flagUsages", flagUsages)
 }
 
 func ConfigureCommandHelp(c *cobra.Command) {
 	c.SetUsageTemplate(cmdUsageTemplate)
+	c.SetUsageFunc(cmdUsage)
 	c.SetHelpFunc(cmdHelp)
 }
 
+// ConfigureRootHelp configures the help and usage functions of a root command
+// whose templates were set with cobra: like for commands configured with
+// ConfigureCommandHelp, templates set with SetCmdTemplates take precedence and
+// cobra's default templates are used if rendering fails.
+func ConfigureRootHelp(c *cobra.Command) {
+	c.SetUsageFunc(cmdUsage)
+	c.SetHelpFunc(func(c *cobra.Command, _ []string) {
+		renderHelp(c, c.HelpTemplate())
+	})
+}
+
+// Templates are help and usage templates overriding the default templates of
+// a command. Empty templates are ignored.
+type Templates struct {
+	Help  string `json:"help,omitempty"`  // template of the help of the command
+	Usage string `json:"usage,omitempty"` // template of the usage of the command - also shown in the help
+}
+
+// SetCmdTemplates sets the non-empty help and usage templates of t to the given
+// command, replacing the ones previously set. They apply to the command and its
+// sub-commands, unless overridden by templates of a sub-command: set on the root
+// command, they are app-wide templates. An error is returned if a template
+// cannot be parsed.
+//
+// Templates are rendered with the command as data and the template functions of
+// cobra and bflags. If rendering fails, cobra's default template is used.
+func SetCmdTemplates(c *cobra.Command, t Templates) error {
+	for _, text := range []string{t.Help, t.Usage} {
+		if text == "" {
+			continue
+		}
+		if _, err := parseTemplate(text); err != nil {
+			return errors.E("SetCmdTemplates", errors.K.Invalid, err, "command", c.Name())
+		}
+	}
+	updateState(c, func(s *cmdState) {
+		if t.Help != "" {
+			s.templates.Help = t.Help
+		}
+		if t.Usage != "" {
+			s.templates.Usage = t.Usage
+		}
+	})
+	return nil
+}
+
+// cmdTemplate returns the template of the given command or of its nearest
+// parent selected by get, or the empty string if none was set.
+func cmdTemplate(c *cobra.Command, get func(t Templates) string) string {
+	for ; c != nil; c = c.Parent() {
+		st := getState(c)
+		if st == nil {
+			continue
+		}
+		if text := get(st.templates); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+func helpTemplate(t Templates) string  { return t.Help }
+func usageTemplate(t Templates) string { return t.Usage }
+
+var (
+	// cobra's default templates, used if rendering other templates fails
+	cobraHelpTemplate  = (&cobra.Command{}).HelpTemplate()
+	cobraUsageTemplate = (&cobra.Command{}).UsageTemplate()
+)
+
 func fullUsageString(c *cobra.Command) (string, error) {
+	text := cmdTemplate(c, usageTemplate)
+	if text == "" {
+		text = fullCmdUsageTemplate
+	}
 	buf := bytes.NewBuffer([]byte{})
-	err := tmpl(buf, fullCmdUsageTemplate, c)
+	err := tmpl(buf, text, c)
 	if err != nil {
 		return "", err
 	}
@@ -60,31 +142,125 @@ func fullUsageString(c *cobra.Command) (string, error) {
 
 func cmdHelp(c *cobra.Command, args []string) {
 	_ = args
-	err := tmpl(c.OutOrStdout(), cmdHelpTemplate, c)
+	renderHelp(c, cmdHelpTemplate)
+}
+
+// renderHelp renders the help template of the command - or def if none was set
+// - falling back to cobra's default help template on failure.
+func renderHelp(c *cobra.Command, def string) {
+	text := cmdTemplate(c, helpTemplate)
+	if text == "" {
+		text = def
+	}
+	err := renderOrFallback(c.OutOrStdout(), text, cobraHelpTemplate, c)
 	if err != nil {
 		c.Println(err)
 	}
 }
 
+// cmdUsage renders the usage template of the command - or the template set
+// with cobra if none was set - falling back to cobra's default usage template on
+// failure.
+func cmdUsage(c *cobra.Command) error {
+	text := cmdTemplate(c, usageTemplate)
+	if text == "" {
+		text = c.UsageTemplate()
+	}
+	err := renderOrFallback(c.OutOrStderr(), text, cobraUsageTemplate, c)
+	if err != nil {
+		c.PrintErrln(err)
+	}
+	return err
+}
+
+// renderOrFallback renders text or the fallback template if rendering text
+// fails. Since templates are rendered to a buffer, no partial output is written
+// to w.
+func renderOrFallback(w io.Writer, text, fallback string, c *cobra.Command) error {
+	buf := &bytes.Buffer{}
+	err := tmpl(buf, text, c)
+	if err != nil && text != fallback {
+		log.Warn("rendering template failed - using default template", "command", c.CommandPath(), "error", err)
+		buf.Reset()
+		err = tmpl(buf, fallback, c)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// parseTemplate parses the given template text with the template functions.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("top").Funcs(templateFuncs).Parse(text)
+}
+
 // tmpl executes the given template text on data, writing the result to w.
-func tmpl(w io.Writer, text string, data interface{}) error {
-	t := template.New("top")
-	t.Funcs(templateFuncs)
-	template.Must(t.Parse(text))
+// Errors parsing the template and panics while executing it are returned as
+// errors.
+func tmpl(w io.Writer, text string, data interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.E("tmpl", errors.K.Invalid, "reason", "panic rendering template", "panic", r)
+		}
+	}()
+	t, err := parseTemplate(text)
+	if err != nil {
+		return errors.E("tmpl", errors.K.Invalid, err)
+	}
 	return t.Execute(w, data)
 }
 
+// ValueString returns the string representation of the value of a flag, or an
+// empty string if the String method of the value panics.
+func ValueString(v flag.Value) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Warn("flag value String panicked", "type", errors.TypeOf(v), "panic", r)
+			s = ""
+		}
+	}()
+	return v.String()
+}
+
+// safeValue is a flag value whose String method does not panic.
+type safeValue struct {
+	flag.Value
+}
+
+func (v *safeValue) String() string {
+	return ValueString(v.Value)
+}
+
+// safeFlag returns the given flag if the String method of its value does not
+// panic, or a copy of the flag with the value wrapped in a safeValue otherwise.
+func safeFlag(f *flag.Flag) *flag.Flag {
+	panicked := true
+	func() {
+		defer func() { _ = recover() }()
+		_ = f.Value.String()
+		panicked = false
+	}()
+	if !panicked {
+		return f
+	}
+	cp := *f
+	cp.Value = &safeValue{Value: f.Value}
+	return &cp
+}
+
 // fullCmdUsageTemplate adds reporting of arguments to the default cobra
 // template (returned by *Command.UsageTemplate)
 var fullCmdUsageTemplate = `Usage:{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
-  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+  {{.CommandPath}} [command]{{end}}{{if aliases .}}
 
 Aliases:
-  {{.NameAndAliases}}{{end}}{{if .HasExample}}
+  {{aliases .}}{{end}}{{if .HasExample}}
 
 Examples:
-{{.Example}}{{end}}{{if .HasAvailableSubCommands}}
+{{example .}}{{end}}{{if .HasAvailableSubCommands}}
 
 Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if hasArgs . }}
@@ -93,13 +269,16 @@ Arguments:
 {{arguments . }}{{end}}{{if .HasAvailableLocalFlags}}
 
 Flags:
-{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+{{flagUsages . .LocalFlags | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
 
 Global Flags:
-{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+{{flagUsages . .InheritedFlags | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
 
 Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
-  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{with seeAlso .}}
+
+See also:
+{{.}}{{end}}{{if .HasAvailableSubCommands}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
@@ -110,10 +289,10 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 // It is called by the command Usage / UsageString function.
 var cmdUsageTemplate = `Usage:{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
-  {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
+  {{.CommandPath}} [command]{{end}}{{if aliases .}}
 
 Aliases:
-  {{.NameAndAliases}}{{end}}{{if .HasAvailableSubCommands}}
+  {{aliases .}}{{end}}{{if .HasAvailableSubCommands}}
 
 Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
   {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if hasArgs . }}
@@ -122,12 +301,14 @@ Arguments:
 {{arguments . }}{{end}}{{if .HasAvailableLocalFlags}}
 
 Flags:
-{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}
+{{flagUsages . .LocalFlags | trimTrailingWhitespaces}}{{end}}
 `
 
 // cmdHelpTemplate is like the default help template returned by cobra commands
 // except it calls 'fullUsageString' for a command rather than the UsageString
 // function of the command.
-var cmdHelpTemplate = `{{with (or .Long .Short)}}{{. | trimTrailingWhitespaces}}
+var cmdHelpTemplate = `{{with deprecation .}}DEPRECATED: {{.}}
+
+{{end}}{{with (or .Long .Short)}}{{. | trimTrailingWhitespaces}}
 
 {{end}}{{if or .Runnable .HasSubCommands}}{{fullUsageString . }}{{end}}`
@@ -1,8 +1,11 @@
 package bflags
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,15 +22,237 @@ func TestExpectedTemplateFuncs(t *testing.T) {
 	} {
 		require.NotNil(t, templateFuncs[name])
 	}
-	// works if the test is run alone, but len is 10 if the singleton was already updated
-	//require.Equal(t, 7, len(templateFuncs))
 	ConfigureHelpFuncs()
-	require.Equal(t, 10, len(templateFuncs))
 	for _, name := range []string{
 		"arguments",
 		"hasArgs",
 		"fullUsageString",
+		"example",
+		"seeAlso",
+		"deprecation",
+		"aliases",
+		"flagUsages",
 	} {
-		require.NotNil(t, templateFuncs[name])
+		require.NotNil(t, templateFuncs[name], name)
+	}
+
+	// functions already registered are not replaced
+	AddTemplateFunc("example", func() string { return "" })
+	require.Equal(t, reflect.ValueOf(RenderExample).Pointer(), reflect.ValueOf(templateFuncs["example"]).Pointer())
+}
+
+func TestRenderExample(t *testing.T) {
+	type exampleIn struct {
+		Qid    string `cmd:"flag,qid,content id"`
+		Config string `cmd:"flag,config,config file,c,true"`
+	}
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{
+		Use:     "get",
+		Example: "{{.AppName}} get --qid {{.Flags.qid}} --config {{.ConfigDir}}/config.json {{.Missing}}",
+		Run:     func(*cobra.Command, []string) {},
+	}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, &exampleIn{}))
+
+	SetExampleVars(root, map[string]interface{}{"ConfigDir": "/etc/cli", "AppName": "mycli"})
+	require.Equal(t, "mycli get --qid <qid> --config /etc/cli/config.json ", RenderExample(c))
+
+	SetExampleVars(c, map[string]interface{}{"ConfigDir": "/tmp"})
+	require.Equal(t, "mycli get --qid <qid> --config /tmp/config.json ", RenderExample(c))
+
+	// rendered in help
+	ConfigureHelpFuncs()
+	ConfigureCommandHelp(c)
+	out := &strings.Builder{}
+	root.SetOut(out)
+	root.SetArgs([]string{"get", "--help"})
+	require.NoError(t, root.Execute())
+	require.Contains(t, out.String(), "mycli get --qid <qid> --config /tmp/config.json")
+
+	// missing flags and variables in branches are rendered empty, literal text
+	// is kept
+	c.Example = "{{.AppName}} get {{.Flags.missing}}{{if .Verbose}}-v{{end}} # <no value>"
+	require.Equal(t, "mycli get  # <no value>", RenderExample(c))
+
+	// invalid templates are returned unchanged
+	c.Example = "cli get {{.AppName"
+	require.Equal(t, c.Example, RenderExample(c))
+
+	require.Equal(t, "", RenderExample(nil))
+}
+
+func TestCmdTemplates(t *testing.T) {
+	ConfigureHelpFuncs()
+	root := &cobra.Command{Use: "cli"}
+	a := &cobra.Command{Use: "a", Short: "command a", Run: func(*cobra.Command, []string) {}}
+	b := &cobra.Command{Use: "b", Short: "command b", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(a, b)
+	ConfigureCommandHelp(a)
+	ConfigureCommandHelp(b)
+
+	help := func(args ...string) string {
+		out := &strings.Builder{}
+		root.SetOut(out)
+		root.SetArgs(append(args, "--help"))
+		require.NoError(t, root.Execute())
+		return out.String()
 	}
+	require.Contains(t, help("a"), "Usage:\n  cli a [flags]")
+
+	// invalid templates are rejected
+	err := SetCmdTemplates(root, Templates{Help: "{{.Short"})
+	require.Error(t, err)
+
+	// app-wide templates and overrides
+	require.NoError(t, SetCmdTemplates(root, Templates{Help: "app: {{.Short}}\n"}))
+	require.NoError(t, SetCmdTemplates(b, Templates{Help: "b: {{.Short}}\n"}))
+	require.Equal(t, "app: command a\n", help("a"))
+	require.Equal(t, "b: command b\n", help("b"))
+
+	// usage templates apply to the help and the usage
+	require.NoError(t, SetCmdTemplates(a, Templates{Help: cmdHelpTemplate, Usage: "usage of {{.Name}}\n"}))
+	require.Equal(t, "command a\n\nusage of a\n", help("a"))
+	require.Equal(t, "usage of a\n", a.UsageString())
+
+	// templates failing to render fall back to cobra's default
+	require.NoError(t, SetCmdTemplates(b, Templates{Help: "{{.Missing}}"}))
+	require.Contains(t, help("b"), "Usage:\n  cli b [flags]")
+}
+
+func TestRootHelpTemplate(t *testing.T) {
+	ConfigureHelpFuncs()
+	root := &cobra.Command{Use: "cli", Short: "the cli", Run: func(*cobra.Command, []string) {}}
+	root.SetHelpTemplate("root help: {{.Short}}\n")
+	ConfigureRootHelp(root)
+
+	out := &strings.Builder{}
+	root.SetOut(out)
+	root.SetArgs([]string{"--help"})
+	require.NoError(t, root.Execute())
+	require.Equal(t, "root help: the cli\n", out.String())
+}
+
+// panickyValue is a flag value whose String method panics once set.
+type panickyValue struct {
+	set bool
+}
+
+func (v *panickyValue) Set(string) error { v.set = true; return nil }
+func (v *panickyValue) Type() string     { return "panicky" }
+
+func (v *panickyValue) String() string {
+	if v.set {
+		panic("cannot render value")
+	}
+	return ""
+}
+
+func TestPanickingValue(t *testing.T) {
+	ConfigureHelpFuncs()
+	c := &cobra.Command{Use: "get", Run: func(*cobra.Command, []string) {}}
+	c.Flags().Var(&panickyValue{}, "panicky", "a value that cannot be rendered")
+	ConfigureCommandHelp(c)
+
+	out := &strings.Builder{}
+	c.SetOut(out)
+	c.SetArgs([]string{"--panicky", "x", "--help"})
+	require.NoError(t, c.Execute())
+	require.Contains(t, out.String(), "--panicky panicky   a value that cannot be rendered")
+
+	require.Equal(t, "", ValueString(c.Flags().Lookup("panicky").Value))
+	require.NotPanics(t, func() { _ = CmdLine(c) })
+}
+
+func TestUsageWrapping(t *testing.T) {
+	type wrapIn struct {
+		Name string `cmd:"flag,name,the name of the object to create - it must be unique among all objects of the account"`
+		Path string `cmd:"arg,path,the path of the file holding the definition of the object to create,0"`
+	}
+	ConfigureHelpFuncs()
+	c := &cobra.Command{Use: "create", Run: func(*cobra.Command, []string) {}}
+	require.NoError(t, Bind(c, &wrapIn{}))
+	ConfigureCommandHelp(c)
+
+	argSet, err := GetCmdArgSet(c)
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"  path : the path of the file holding the\n"+
+		"         definition of the object to create",
+		argSet.ArgUsagesWrapped(50))
+	require.Equal(t, argSet.ArgUsagesWrapped(0), argSet.ArgUsages())
+
+	t.Setenv("COLUMNS", "60")
+	require.Equal(t, 60, TerminalWidth())
+	usage := c.UsageString()
+	for _, line := range strings.Split(usage, "\n") {
+		require.LessOrEqual(t, len(line), 60, line)
+	}
+	require.Contains(t, usage, "  path : the path of the file holding the definition of the\n         object to create\n")
+
+	t.Setenv("COLUMNS", "")
+	require.NotContains(t, c.UsageString(), "definition of the\n")
+
+	// explicit newlines are preserved
+	require.Equal(t, ""+
+		"first line\n"+
+		"    second line that is long enough to\n"+
+		"    be wrapped",
+		wrapText("first line\nsecond line that is long enough to be wrapped", 4, 40))
+}
+
+func TestFlagOrder(t *testing.T) {
+	type orderIn struct {
+		Zone  string `cmd:"flag,zone,the zone"`
+		Alpha string `cmd:"flag,alpha,alpha value"`
+		Mid   string `cmd:"flag,mid,mid value,m,false,true"`
+		Src   string `cmd:"arg,src,the source,0"`
+		Dst   string `cmd:"arg,dst,the destination,1,true"`
+		Aux   string `cmd:"arg,aux,auxiliary,2,true"`
+	}
+	ConfigureHelpFuncs()
+	root := &cobra.Command{Use: "cli"}
+	c := &cobra.Command{Use: "copy", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(c)
+	require.NoError(t, Bind(c, &orderIn{}))
+	ConfigureCommandHelp(c)
+
+	c.InitDefaultHelpFlag()
+	// names of the flags or args listed in the given section of the usage
+	section := func(name string) []string {
+		usage := c.UsageString()
+		i := strings.Index(usage, name+":\n")
+		require.True(t, i >= 0, usage)
+		var ret []string
+		for _, line := range strings.Split(usage[i+len(name)+2:], "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				break
+			}
+			for _, f := range fields {
+				if strings.HasPrefix(f, "--") {
+					fields[0] = strings.TrimPrefix(f, "--")
+					break
+				}
+			}
+			ret = append(ret, fields[0])
+		}
+		return ret
+	}
+	flagNames := func() []string { return section("Flags") }
+	require.Equal(t, []string{"alpha", "help", "mid", "zone"}, flagNames())
+	require.Equal(t, []string{"src", "dst", "aux"}, section("Arguments"))
+
+	SetFlagOrder(root, OrderDeclared)
+	require.Equal(t, OrderDeclared, GetFlagOrder(c))
+	require.Equal(t, []string{"zone", "alpha", "mid", "help"}, flagNames())
+	require.Equal(t, []string{"src", "dst", "aux"}, section("Arguments"))
+
+	SetFlagOrder(c, OrderRequiredFirst)
+	require.Equal(t, []string{"mid", "alpha", "help", "zone"}, flagNames())
+	require.Equal(t, []string{"src", "dst", "aux"}, section("Arguments"))
+
+	SetFlagOrder(c, OrderAlpha)
+	require.Equal(t, []string{"alpha", "help", "mid", "zone"}, flagNames())
+	require.Equal(t, []string{"aux", "dst", "src"}, section("Arguments"))
 }
@@ -0,0 +1,84 @@
+package bflags
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// RunFn is the function running a command bound with BindRunE. in is the input
+// bound to the command, with flags and args already set.
+type RunFn func(cmd *cobra.Command, in interface{}) error
+
+// Middleware wraps the run function of commands in order to add cross-cutting
+// behavior like timing, authentication or printing of results.
+type Middleware func(next RunFn) RunFn
+
+// BeforeRun returns a Middleware calling fn before the command runs. The
+// command does not run if fn returns an error.
+func BeforeRun(fn func(cmd *cobra.Command, in interface{}) error) Middleware {
+	return func(next RunFn) RunFn {
+		return func(cmd *cobra.Command, in interface{}) error {
+			err := fn(cmd, in)
+			if err != nil {
+				return err
+			}
+			return next(cmd, in)
+		}
+	}
+}
+
+// AfterRun returns a Middleware calling fn after the command ran with the error
+// returned by the command. The error returned by fn is returned by the command.
+func AfterRun(fn func(cmd *cobra.Command, in interface{}, err error) error) Middleware {
+	return func(next RunFn) RunFn {
+		return func(cmd *cobra.Command, in interface{}) error {
+			return fn(cmd, in, next(cmd, in))
+		}
+	}
+}
+
+// UseMiddleware registers the given middlewares with the given command. They
+// apply to commands bound with BindRunE: the command itself and all its
+// sub-commands. Middlewares of parent commands wrap those of their children and
+// middlewares registered first wrap those registered later.
+func UseMiddleware(cmd *cobra.Command, mw ...Middleware) {
+	if cmd == nil || len(mw) == 0 {
+		return
+	}
+	updateState(cmd, func(s *cmdState) {
+		s.middlewares = append(s.middlewares, mw...)
+	})
+}
+
+// withMiddlewares wraps run with the middlewares registered with the given
+// command and its parents.
+func withMiddlewares(cmd *cobra.Command, run RunFn) RunFn {
+	for c := cmd; c != nil; c = c.Parent() {
+		st := getState(c)
+		if st == nil {
+			continue
+		}
+		for i := len(st.middlewares) - 1; i >= 0; i-- {
+			run = st.middlewares[i](run)
+		}
+	}
+	return run
+}
+
+// Use registers the given middlewares with the command of this Binder. See
+// UseMiddleware.
+func (b *Binder) Use(mw ...Middleware) *Binder {
+	UseMiddleware(b.Command, mw...)
+	return b
+}
+
+// Before registers fn to be called before the command of this Binder - or any
+// of its sub-commands - runs. See BeforeRun.
+func (b *Binder) Before(fn func(cmd *cobra.Command, in interface{}) error) *Binder {
+	return b.Use(BeforeRun(fn))
+}
+
+// After registers fn to be called after the command of this Binder - or any of
+// its sub-commands - ran. See AfterRun.
+func (b *Binder) After(fn func(cmd *cobra.Command, in interface{}, err error) error) *Binder {
+	return b.Use(AfterRun(fn))
+}
@@ -0,0 +1,149 @@
+package bflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Optional is a tri-state value: it holds a value of type T and whether the
+// value was set. Bound as a flag, IsSet reports whether the flag was provided on
+// the command line. This is an alternative to pointer fields for expressing
+// "flag not provided":
+//
+//	type myInput struct {
+//		Timeout bflags.Optional[time.Duration] `cmd:"flag,timeout,request timeout"`
+//	}
+//
+// T may be any type supported by bflags for flags (see README).
+// Optional marshals to JSON as its value when set and as null otherwise. Since
+// Optional implements IsZero, unset values are omitted with the 'omitzero' json
+// option of Go 1.24+.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+// NewOptional returns an Optional set to the given value.
+func NewOptional[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+// IsSet returns true if the value was set.
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// Get returns the value - the zero value of T if not set.
+func (o Optional[T]) Get() T {
+	return o.value
+}
+
+// GetOr returns the value if set or def otherwise.
+func (o Optional[T]) GetOr(def T) T {
+	if o.set {
+		return o.value
+	}
+	return def
+}
+
+// SetValue sets the value.
+func (o *Optional[T]) SetValue(v T) {
+	o.value = v
+	o.set = true
+}
+
+// Unset clears the value.
+func (o *Optional[T]) Unset() {
+	var zero T
+	o.value = zero
+	o.set = false
+}
+
+// IsZero returns true if the value is not set.
+func (o Optional[T]) IsZero() bool {
+	return !o.set
+}
+
+// String returns the value as a string or the empty string if not set.
+func (o Optional[T]) String() string {
+	if !o.set {
+		return ""
+	}
+	return fmt.Sprintf("%v", o.value)
+}
+
+// MarshalJSON marshals the value if set or null otherwise.
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON unmarshals the value: null unsets the value.
+func (o *Optional[T]) UnmarshalJSON(bb []byte) error {
+	if string(bb) == "null" {
+		o.Unset()
+		return nil
+	}
+	var v T
+	err := json.Unmarshal(bb, &v)
+	if err != nil {
+		return err
+	}
+	o.SetValue(v)
+	return nil
+}
+
+// optional returns a pointer to the value and to the set-state of the Optional.
+func (o *Optional[T]) optional() (interface{}, *bool) {
+	return &o.value, &o.set
+}
+
+// optionalFlag is implemented by pointers to Optional.
+type optionalFlag interface {
+	optional() (interface{}, *bool)
+}
+
+var optionalFlagType = reflect.TypeOf((*optionalFlag)(nil)).Elem()
+
+// optionalValue is the flag.Value of an Optional: it delegates to the flag.Value
+// of the wrapped value and records that the value was set.
+type optionalValue struct {
+	flag.Value
+	set *bool
+}
+
+func (o *optionalValue) Set(s string) error {
+	err := o.Value.Set(s)
+	if err == nil {
+		*o.set = true
+	}
+	return err
+}
+
+func (o *optionalValue) String() string {
+	if !*o.set {
+		return ""
+	}
+	return o.Value.String()
+}
+
+// makeOptionalFlag registers a flag for the Optional of the given FlagBond.
+func (s CmdFlags) makeOptionalFlag(pflags *flag.FlagSet, v *FlagBond, opt optionalFlag) error {
+	ptr, set := opt.optional()
+	fb := *v
+	fb.Value = ptr
+	tmp := flag.NewFlagSet(string(v.Name), flag.ContinueOnError)
+	_, err := s.makeFlag(tmp, &fb)
+	if err != nil {
+		return err
+	}
+	inner := tmp.Lookup(string(v.Name))
+	fl := pflags.VarPF(&optionalValue{Value: inner.Value, set: set}, string(v.Name), v.Shorthand, v.Usage)
+	fl.NoOptDefVal = inner.NoOptDefVal
+	return nil
+}
@@ -0,0 +1,134 @@
+package bflags
+
+import (
+	"sort"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// FlagOrder is the order of flags and args in the usage of commands.
+type FlagOrder string
+
+const (
+	// OrderDefault lists flags sorted by name and args by position.
+	OrderDefault FlagOrder = ""
+	// OrderAlpha lists flags and args sorted by name.
+	OrderAlpha FlagOrder = "alpha"
+	// OrderDeclared lists flags in the order of their declaration in the
+	// bound input and args by position.
+	OrderDeclared FlagOrder = "declared"
+	// OrderRequiredFirst lists required flags and args first. Flags are then
+	// sorted by name and args by position.
+	OrderRequiredFirst FlagOrder = "required-first"
+)
+
+// SetFlagOrder sets the order of flags and args in the usage of the given
+// command and its sub-commands, unless overridden for a sub-command.
+func SetFlagOrder(c *cobra.Command, order FlagOrder) {
+	updateState(c, func(s *cmdState) {
+		s.flagOrder = order
+	})
+}
+
+// GetFlagOrder returns the order of flags and args in the usage of the given
+// command: the order set on the command or its nearest parent.
+func GetFlagOrder(c *cobra.Command) FlagOrder {
+	for ; c != nil; c = c.Parent() {
+		st := getState(c)
+		if st == nil {
+			continue
+		}
+		if st.flagOrder != OrderDefault {
+			return st.flagOrder
+		}
+	}
+	return OrderDefault
+}
+
+// flagUsages returns the usages of the given flags of the command in the order
+// of the command, wrapped to the terminal width. Flags whose value panics when
+// rendered are shown without default value.
+func flagUsages(c *cobra.Command, fs *flag.FlagSet) string {
+	cols := TerminalWidth()
+	order := GetFlagOrder(c)
+	reorder := order != OrderDefault && order != OrderAlpha && fs.SortFlags
+
+	var flags []*flag.Flag
+	safe := true
+	fs.VisitAll(func(f *flag.Flag) {
+		sf := safeFlag(f)
+		safe = safe && sf == f
+		flags = append(flags, sf)
+	})
+	if !reorder && safe {
+		return fs.FlagUsagesWrapped(cols)
+	}
+	if reorder {
+		switch order {
+		case OrderDeclared:
+			rank := declarationRanks(c)
+			sort.SliceStable(flags, func(i, j int) bool {
+				return rank(flags[i].Name) < rank(flags[j].Name)
+			})
+		case OrderRequiredFirst:
+			sort.SliceStable(flags, func(i, j int) bool {
+				return isRequired(flags[i]) && !isRequired(flags[j])
+			})
+		}
+	}
+	ordered := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	ordered.SortFlags = false
+	for _, f := range flags {
+		ordered.AddFlag(f)
+	}
+	return ordered.FlagUsagesWrapped(cols)
+}
+
+// declarationRanks returns a function ranking flags by order of declaration:
+// flags of the command first, then flags inherited from its parents. Flags not
+// bound by bflags - like 'help' - come last.
+func declarationRanks(c *cobra.Command) func(name string) int {
+	ranks := make(map[string]int)
+	offset := 0
+	for cmd := c; cmd != nil; cmd = cmd.Parent() {
+		flags, err := GetCmdFlagSet(cmd)
+		if err != nil {
+			continue
+		}
+		for _, fb := range flags {
+			if _, ok := ranks[string(fb.Name)]; !ok {
+				ranks[string(fb.Name)] = offset + fb.declOrder
+			}
+		}
+		offset += len(flags)
+	}
+	return func(name string) int {
+		if r, ok := ranks[name]; ok {
+			return r
+		}
+		return offset
+	}
+}
+
+func isRequired(f *flag.Flag) bool {
+	v := f.Annotations[cobra.BashCompOneRequiredFlag]
+	return len(v) > 0 && v[0] == "true"
+}
+
+// orderArgs returns the given args in the given order.
+func orderArgs(args []*FlagBond, order FlagOrder) []*FlagBond {
+	switch order {
+	case OrderAlpha:
+		args = append([]*FlagBond(nil), args...)
+		sort.SliceStable(args, func(i, j int) bool {
+			return args[i].Name < args[j].Name
+		})
+	case OrderRequiredFirst:
+		args = append([]*FlagBond(nil), args...)
+		sort.SliceStable(args, func(i, j int) bool {
+			return !args[i].isOptional() && args[j].isOptional()
+		})
+	}
+	return args
+}
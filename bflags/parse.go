@@ -0,0 +1,74 @@
+package bflags
+
+import (
+	"sort"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// ParseInto parses the given command line arguments into v, a pointer to a
+// struct that can be bound with Bind. Flags and args are bound to a throwaway
+// command, parsed and set to v as they would be for a command, but nothing is
+// executed:
+//
+//	in := &struct {
+//		Qid string `cmd:"flag,qid,content id"`
+//		Path string `cmd:"arg,path,the path,0"`
+//	}{}
+//	err := bflags.ParseInto(in, []string{"--qid", "iq__x", "/a"})
+//
+// Missing required flags, missing args and post processor errors are reported
+// as for commands. ParseInto does not panic on invalid input, which makes it
+// suitable for fuzzing harnesses, and allows reusing input structs of commands
+// in other code paths.
+func ParseInto(v interface{}, argv []string) error {
+	return parseInto(&cobra.Command{Use: "parse"}, v, argv)
+}
+
+// parseInto implements ParseInto with the given throwaway command, whose state
+// is cleared when done.
+func parseInto(cmd *cobra.Command, v interface{}, argv []string) (err error) {
+	e := errors.Template("ParseInto", errors.K.Invalid)
+	defer func() {
+		ClearCmdState(cmd)
+		if r := recover(); r != nil {
+			err = e("reason", "panic", "panic", r)
+		}
+	}()
+
+	if err = Bind(cmd, v); err != nil {
+		return e(err)
+	}
+	if err = cmd.ParseFlags(argv); err != nil {
+		return e(err)
+	}
+	args := cmd.Flags().Args()
+	if err = cmd.ValidateArgs(args); err != nil {
+		return e(err)
+	}
+	if err = checkRequiredFlags(cmd); err != nil {
+		return e(err)
+	}
+	if _, err = SetArgs(cmd, args); err != nil {
+		return e(err)
+	}
+	return nil
+}
+
+// checkRequiredFlags returns an error wrapping ErrMissingFlag if a required flag
+// of the command is not set.
+func checkRequiredFlags(cmd *cobra.Command) error {
+	var missing []string
+	cmd.Flags().VisitAll(func(f *flag.Flag) {
+		if isRequired(f) && !f.Changed {
+			missing = append(missing, f.Name)
+		}
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return errors.NoTrace("checkRequiredFlags", errors.K.Invalid, ErrMissingFlag, "missing", missing)
+}
@@ -0,0 +1,113 @@
+package bflags
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// PostProcessor is a function applied to the value of a bound field after the
+// command line was parsed and args were set in SetArgs. ptr is a pointer to the
+// field (the Value of the FlagBond).
+//
+// Post processors are declared on fields with the 'post' tag, followed by a
+// comma separated list of names of registered post processors that are applied
+// in order:
+//
+//	`cmd:"flag,config,config file" post:"trim,expandHome"`
+type PostProcessor func(ptr interface{}) error
+
+var postProcessors = struct {
+	mu  sync.RWMutex
+	fns map[string]PostProcessor
+}{
+	fns: map[string]PostProcessor{
+		"expandHome": StringPostProcessor(expandHome),
+		"lower":      StringPostProcessor(func(s string) (string, error) { return strings.ToLower(s), nil }),
+		"upper":      StringPostProcessor(func(s string) (string, error) { return strings.ToUpper(s), nil }),
+		"trim":       StringPostProcessor(func(s string) (string, error) { return strings.TrimSpace(s), nil }),
+	},
+}
+
+// RegisterPostProcessor registers the given post processor with the given name.
+// An already registered post processor with the same name is replaced.
+// Built-in post processors are:
+//   - expandHome: replace a leading '~' with the home directory of the user
+//   - lower, upper: change the case of the value
+//   - trim: remove leading and trailing white spaces
+func RegisterPostProcessor(name string, fn PostProcessor) {
+	postProcessors.mu.Lock()
+	defer postProcessors.mu.Unlock()
+	postProcessors.fns[name] = fn
+}
+
+func getPostProcessor(name string) (PostProcessor, bool) {
+	postProcessors.mu.RLock()
+	defer postProcessors.mu.RUnlock()
+	fn, ok := postProcessors.fns[name]
+	return fn, ok
+}
+
+// StringPostProcessor returns a PostProcessor applying the given function to
+// fields of type string, *string or []string.
+func StringPostProcessor(fn func(s string) (string, error)) PostProcessor {
+	return func(ptr interface{}) error {
+		var err error
+		switch val := ptr.(type) {
+		case *string:
+			*val, err = fn(*val)
+		case **string:
+			if *val != nil {
+				var s string
+				s, err = fn(**val)
+				*val = &s
+			}
+		case *[]string:
+			for i, s := range *val {
+				(*val)[i], err = fn(s)
+				if err != nil {
+					break
+				}
+			}
+		default:
+			err = errors.E("post processor", errors.K.Invalid, ErrUnsupportedType,
+				"reason", "unsupported type - expected string",
+				"type", errors.TypeOf(ptr))
+		}
+		return err
+	}
+}
+
+func expandHome(s string) (string, error) {
+	if s != "~" && !strings.HasPrefix(s, "~/") {
+		return s, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.E("expandHome", errors.K.Invalid, err)
+	}
+	return filepath.Join(home, s[1:]), nil
+}
+
+// postProcess applies the post processors of the flag to its value.
+func (f *FlagBond) postProcess() error {
+	for _, name := range f.PostProcessors {
+		fn, ok := getPostProcessor(name)
+		if !ok {
+			return errors.E("postProcess", errors.K.NotExist, ErrBadTag,
+				"reason", "post processor not registered",
+				"flag", f.Name,
+				"post_processor", name)
+		}
+		err := fn(f.Value)
+		if err != nil {
+			return errors.E("postProcess", errors.K.Invalid, err,
+				"flag", f.Name,
+				"post_processor", name)
+		}
+	}
+	return nil
+}
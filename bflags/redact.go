@@ -0,0 +1,95 @@
+package bflags
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces the value of secret flags in debug logs and in
+// reconstructed command lines.
+const RedactedValue = "***"
+
+// secretAnnotation is the 'meta' annotation marking a flag or arg as secret:
+//
+//	`cmd:"flag,api-key,the api key" meta:"secret"`
+const secretAnnotation = "secret"
+
+var redactPatterns = struct {
+	mu       sync.RWMutex
+	patterns []string
+}{
+	patterns: []string{"*password*", "*passwd*", "*secret*", "*token*", "*credential*"},
+}
+
+// SetRedactPatterns replaces the patterns of flag names whose values are
+// redacted. Patterns use the syntax of filepath.Match and are matched against the
+// lower-cased flag name. Default patterns are:
+//
+//	*password*, *passwd*, *secret*, *token*, *credential*
+//
+// Calling SetRedactPatterns without argument disables redaction by name.
+func SetRedactPatterns(patterns ...string) {
+	redactPatterns.mu.Lock()
+	defer redactPatterns.mu.Unlock()
+	redactPatterns.patterns = append([]string(nil), patterns...)
+}
+
+// IsSecretName returns true if the given name - of a flag, a query parameter
+// etc. - matches a pattern set with SetRedactPatterns.
+func IsSecretName(name string) bool {
+	return matchesRedactPattern(name)
+}
+
+func matchesRedactPattern(name string) bool {
+	redactPatterns.mu.RLock()
+	defer redactPatterns.mu.RUnlock()
+	name = strings.ToLower(name)
+	for _, p := range redactPatterns.patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSecret returns true if the value of the flag must not be logged. This is the
+// case if:
+//   - the Secret field is set, for example by a custom Flagger
+//   - the flag has a 'secret' annotation (see Annotations.GetBool)
+//   - the flag name matches a pattern set with SetRedactPatterns
+//   - the type of the value is secret (see SecretValue), like params.Secret
+func (f *FlagBond) IsSecret() bool {
+	if f == nil {
+		return false
+	}
+	return f.Secret ||
+		f.Annotations.GetBool(secretAnnotation) ||
+		matchesRedactPattern(string(f.Name)) ||
+		isSecretValue(f.Value)
+}
+
+// SecretValue is implemented by types whose values are secret.
+type SecretValue interface {
+	IsSecret() bool
+}
+
+// isSecretValue returns true if v - or the value v points to - is a
+// SecretValue reporting a secret.
+func isSecretValue(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return false
+		}
+		if sv, ok := rv.Interface().(SecretValue); ok {
+			return sv.IsSecret()
+		}
+		if rv.Kind() != reflect.Ptr {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package bflags
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// setCmdPristine records a copy of the input bound to the given command with
+// the given Flagger, such that ResetCommand can restore the input and re-bind
+// its flags.
+func setCmdPristine(cmd *cobra.Command, custom Flagger, v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return
+	}
+	pristine := deepCopy(rv, make(map[uintptr]reflect.Value))
+	updateState(cmd, func(st *cmdState) {
+		st.pristine = pristine.Interface()
+		st.flagger = custom
+	})
+}
+
+// ResetCommand resets the given command and all its sub-commands to the state
+// they had when their inputs were bound with Bind, such that the command tree
+// can be executed again - e.g. by a REPL, a server or tests - without values
+// leaking from one execution to the next:
+//   - inputs are restored to their values at bind time
+//   - the values of bound flags and args are re-created, such that slices are
+//     replaced rather than appended to on the next parse
+//   - other flags - like cobra's help flag - are set back to their default
+//   - all flags are marked as not changed
+//   - contexts set with SetCmdCtx are removed, such that the values of previous
+//     executions are released
+func ResetCommand(cmd *cobra.Command) error {
+	if cmd == nil {
+		return nil
+	}
+	if err := resetCommand(cmd); err != nil {
+		return errors.E("ResetCommand", errors.K.Invalid, err, "command", cmd.CommandPath())
+	}
+	for _, c := range cmd.Commands() {
+		if err := ResetCommand(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resetCommand(cmd *cobra.Command) error {
+	clearCmdCtx(cmd)
+	bound := make(map[string]bool)
+	if st := getState(cmd); st != nil && st.pristine != nil {
+		in := reflect.ValueOf(st.input)
+		if in.Kind() != reflect.Ptr || in.IsNil() || in.Type() != reflect.TypeOf(st.pristine) {
+			return errors.E("resetCommand", errors.K.Invalid, ErrInvalidInput, "reason", "input changed since bind")
+		}
+		restoreInto(in.Elem(), reflect.ValueOf(st.pristine).Elem())
+		fbs := make([]*FlagBond, 0, len(st.flags))
+		fbs = append(fbs, st.flags.declared()...)
+		if st.args != nil {
+			fbs = append(fbs, st.args.Flags...)
+		}
+		for _, fb := range fbs {
+			if err := st.flags.resetFlag(cmd, st.flagger, fb); err != nil {
+				return err
+			}
+			bound[string(fb.Name)] = true
+		}
+	}
+	reset := func(f *flag.Flag) {
+		if !bound[f.Name] && f.Changed {
+			if sv, ok := f.Value.(flag.SliceValue); ok {
+				_ = sv.Replace(parseSliceDefault(f.DefValue))
+			} else {
+				_ = f.Value.Set(f.DefValue)
+			}
+		}
+		f.Changed = false
+	}
+	cmd.LocalFlags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	return nil
+}
+
+// resetFlag replaces the value of the flag registered for the given FlagBond
+// with a fresh value bound to the same variable.
+func (s CmdFlags) resetFlag(cmd *cobra.Command, custom Flagger, fb *FlagBond) error {
+	name := string(fb.Name)
+	f := cmd.LocalFlags().Lookup(name)
+	if f == nil {
+		f = cmd.PersistentFlags().Lookup(name)
+	}
+	if f == nil {
+		return errors.E("resetFlag", errors.K.NotExist, "reason", "flag not found", "flag", name)
+	}
+	// create the value in a scratch flag set: unlike configureFlag, this has no
+	// effect on the command or the bond
+	pflags := flag.NewFlagSet(name, flag.ContinueOnError)
+	var flagged *Flagged
+	if custom != nil {
+		flagged = custom.Flag(fb.Value)
+	}
+	if flagged != nil {
+		pflags.VarPF(flagged.value(), name, "", "")
+	} else {
+		cp := *fb
+		if _, err := s.makeFlag(pflags, &cp); err != nil {
+			return err
+		}
+	}
+	nf := pflags.Lookup(name)
+	f.Value, f.DefValue = nf.Value, nf.DefValue
+	return nil
+}
+
+// parseSliceDefault parses the default value of a slice flag, e.g. "[a,b]".
+func parseSliceDefault(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" {
+		return []string{}
+	}
+	ret, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		return strings.Split(s, ",")
+	}
+	return ret
+}
+
+// CopyInput returns a deep copy of the given input, e.g. for isolating the
+// input of an invocation from the input bound to the command. If dst is a
+// non-nil pointer of the same type as src, exported fields of src are copied
+// into dst and its unexported fields are kept - e.g. as initialized by a
+// constructor - otherwise a new value is allocated.
+func CopyInput(dst, src interface{}) (interface{}, error) {
+	sv := reflect.ValueOf(src)
+	if sv.Kind() != reflect.Ptr || sv.IsNil() {
+		return nil, errors.E("CopyInput", errors.K.Invalid, ErrInvalidInput,
+			"reason", "input is not a pointer",
+			"type", fmt.Sprintf("%T", src))
+	}
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Type() != sv.Type() {
+		return deepCopy(sv, make(map[uintptr]reflect.Value)).Interface(), nil
+	}
+	copyExported(dv.Elem(), sv.Elem(), make(map[uintptr]reflect.Value))
+	return dst, nil
+}
+
+// copyExported sets dst to a deep copy of src, except unexported fields of
+// structs which are kept.
+func copyExported(dst, src reflect.Value, visited map[uintptr]reflect.Value) {
+	if dst.Kind() != reflect.Struct {
+		dst.Set(deepCopy(src, visited))
+		return
+	}
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Field(i).CanSet() {
+			copyExported(dst.Field(i), src.Field(i), visited)
+		}
+	}
+}
+
+// restoreInto sets dst to a deep copy of src. Structs referenced by non-nil
+// pointers in both dst and src are restored in place, such that flags bound to
+// their fields remain bound.
+func restoreInto(dst, src reflect.Value) {
+	if dst.Kind() != reflect.Struct {
+		dst.Set(deepCopy(src, make(map[uintptr]reflect.Value)))
+		return
+	}
+	c := reflect.New(dst.Type()).Elem()
+	c.Set(src)
+	for i := 0; i < dst.NumField(); i++ {
+		if !c.Field(i).CanSet() {
+			continue
+		}
+		df, sf := dst.Field(i), src.Field(i)
+		switch {
+		case df.Kind() == reflect.Ptr && !df.IsNil() && !sf.IsNil():
+			restoreInto(df.Elem(), sf.Elem())
+			c.Field(i).Set(df)
+		case df.Kind() == reflect.Struct:
+			restoreInto(df, sf)
+			c.Field(i).Set(df)
+		default:
+			c.Field(i).Set(deepCopy(sf, make(map[uintptr]reflect.Value)))
+		}
+	}
+	dst.Set(c)
+}
+
+// deepCopy returns a deep copy of the given value: pointers, slices, maps,
+// arrays and exported fields of structs are copied recursively. Unexported
+// fields are copied shallowly. visited maps the addresses of already copied
+// pointers to their copies.
+func deepCopy(v reflect.Value, visited map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := visited[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		visited[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), visited))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), visited))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i), visited))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), visited))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), visited))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value(), visited))
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package bflags
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const seeAlsoKey = "bflags_see_also" // key for commands annotation
+
+// SetSeeAlso declares commands related to the given command, rendered in a
+// 'See also' section of the help of the command. Paths are space separated
+// names of commands starting either at the root command or below it, e.g.
+// 'content list' or 'cli content list'.
+func SetSeeAlso(c *cobra.Command, paths ...string) {
+	if c == nil || len(paths) == 0 {
+		return
+	}
+	if c.Annotations == nil {
+		c.Annotations = make(map[string]string)
+	}
+	c.Annotations[seeAlsoKey] = strings.Join(paths, "\n")
+}
+
+// SeeAlso returns the paths of the commands related to the given command.
+func SeeAlso(c *cobra.Command) []string {
+	if c == nil || c.Annotations[seeAlsoKey] == "" {
+		return nil
+	}
+	return strings.Split(c.Annotations[seeAlsoKey], "\n")
+}
+
+// seeAlsoUsages returns the 'See also' section of the help of the given
+// command: the full path of each related command and its short description.
+// Paths that are not found are rendered as declared.
+func seeAlsoUsages(c *cobra.Command) string {
+	paths := SeeAlso(c)
+	if len(paths) == 0 {
+		return ""
+	}
+	root := c.Root()
+	type related struct {
+		path  string
+		short string
+	}
+	rels := make([]related, 0, len(paths))
+	width := 0
+	for _, p := range paths {
+		rel := related{path: p}
+		fields := strings.Fields(p)
+		if len(fields) > 0 && fields[0] == root.Name() {
+			fields = fields[1:]
+		}
+		if found, _, err := root.Find(fields); err == nil && (found != root || len(fields) == 0) {
+			rel = related{path: found.CommandPath(), short: found.Short}
+		}
+		if len(rel.path) > width {
+			width = len(rel.path)
+		}
+		rels = append(rels, rel)
+	}
+	sb := strings.Builder{}
+	for i, rel := range rels {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(strings.TrimRight(fmt.Sprintf("  %-*s %s", width, rel.path, rel.short), " "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package bflags
+
+import (
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// overrideAnnotation is the 'meta' annotation of a flag shadowing on purpose
+// a persistent flag of a parent command:
+//
+//	`cmd:"flag,output,output file" meta:"override"`
+//
+// Flags not bound with Bind are marked with a pflag annotation of the same key.
+const overrideAnnotation = "override"
+
+// CheckShadowing checks that the flags and args of the given command and of
+// all its sub-commands don't shadow persistent flags of their parent commands:
+// cobra silently ignores a persistent flag of a parent in a command declaring
+// a flag with the same name, and panics when shorthands collide.
+//
+// Shadowing a flag is allowed when the flag of the command is annotated with
+// 'override'. Errors wrap ErrDuplicateFlag and report the paths of the
+// conflicting commands.
+func CheckShadowing(cmd *cobra.Command) error {
+	if cmd == nil {
+		return nil
+	}
+	if err := checkShadowing(cmd); err != nil {
+		return err
+	}
+	for _, c := range cmd.Commands() {
+		if err := CheckShadowing(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkShadowing(cmd *cobra.Command) error {
+	if !cmd.HasParent() {
+		return nil
+	}
+	var err error
+	check := func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		for p := cmd.Parent(); p != nil && err == nil; p = p.Parent() {
+			err = checkFlagShadowing(cmd, f, p)
+		}
+	}
+	cmd.Flags().VisitAll(check)
+	cmd.PersistentFlags().VisitAll(check)
+	return err
+}
+
+// checkFlagShadowing checks the given flag of the command against the
+// persistent flags of the given parent.
+func checkFlagShadowing(cmd *cobra.Command, f *flag.Flag, parent *cobra.Command) error {
+	pflags := parent.PersistentFlags()
+	e := errors.Template("CheckShadowing", errors.K.Invalid, ErrDuplicateFlag,
+		"flag", f.Name,
+		"command", cmd.CommandPath(),
+		"parent", parent.CommandPath())
+	if pf := pflags.Lookup(f.Name); pf != nil && pf != f && !isOverride(cmd, f) {
+		return e("reason", "flag shadows a persistent flag of a parent command, annotate it with 'override' if intended")
+	}
+	if f.Shorthand != "" {
+		if pf := pflags.ShorthandLookup(f.Shorthand); pf != nil && pf != f && pf.Name != f.Name {
+			return e("reason", "shorthand collides with a persistent flag of a parent command",
+				"shorthand", f.Shorthand,
+				"parent_flag", pf.Name)
+		}
+	}
+	return nil
+}
+
+// isOverride returns true if the given flag of the command is annotated with
+// 'override'.
+func isOverride(cmd *cobra.Command, f *flag.Flag) bool {
+	if _, ok := f.Annotations[overrideAnnotation]; ok {
+		return true
+	}
+	if flags, err := GetCmdFlagSet(cmd); err == nil {
+		if fb, ok := flags.Get(f.Name); ok {
+			return fb.Annotations.GetBool(overrideAnnotation)
+		}
+	}
+	if args, err := GetCmdArgSet(cmd); err == nil {
+		for _, fb := range args.Flags {
+			if string(fb.Name) == f.Name {
+				return fb.Annotations.GetBool(overrideAnnotation)
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package bflags
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// separator returns the separator of slice values of the flag.
+func (f *FlagBond) separator() string {
+	if f.Separator == "" {
+		return ","
+	}
+	return f.Separator
+}
+
+// sepSliceValue is a flag.Value for slices using a custom separator. Unlike
+// pflag slices, values are not parsed as CSV: they are split on the separator,
+// hence may contain commas.
+type sepSliceValue[T any] struct {
+	value   *[]T
+	sep     string
+	typ     string
+	parse   func(string) (T, error)
+	format  func(T) string
+	changed bool
+}
+
+// valueString returns the value of the flag as a single string, with values of
+// repeatable flags joined with the separator and secret values redacted.
+func (f *FlagBond) valueString() string {
+	ss := f.cmdString(true, true)
+	if f.isArg {
+		return strings.Join(ss, f.separator())
+	}
+	values := make([]string, 0, len(ss)/2)
+	for i := 1; i < len(ss); i += 2 {
+		values = append(values, ss[i])
+	}
+	if len(values) == 0 && len(ss) == 1 {
+		// should not happen since we ask for full flag
+		if ndx := strings.Index(ss[0], "="); ndx > 0 {
+			return ss[0][ndx+1:]
+		}
+	}
+	return strings.Join(values, f.separator())
+}
+
+// newSepSliceValue returns a flag.Value for the given pointer to a slice and
+// true, or false if the type of slice is not supported. An empty separator is
+// used for repeatable flags: values are not split and the type of the value
+// ends with 'Array' instead of 'Slice', like pflag.StringArray.
+func newSepSliceValue(ptr interface{}, sep string) (flag.Value, bool) {
+	suffix := "Slice"
+	if sep == "" {
+		suffix = "Array"
+	}
+	switch p := ptr.(type) {
+	case *[]string:
+		return &sepSliceValue[string]{
+			value:  p,
+			sep:    sep,
+			typ:    "string" + suffix,
+			parse:  func(s string) (string, error) { return s, nil },
+			format: func(s string) string { return s },
+		}, true
+	case *[]int:
+		return &sepSliceValue[int]{
+			value:  p,
+			sep:    sep,
+			typ:    "int" + suffix,
+			parse:  strconv.Atoi,
+			format: strconv.Itoa,
+		}, true
+	case *[]uint:
+		return &sepSliceValue[uint]{
+			value: p,
+			sep:   sep,
+			typ:   "uint" + suffix,
+			parse: func(s string) (uint, error) {
+				u, err := strconv.ParseUint(s, 0, 0)
+				return uint(u), err
+			},
+			format: func(u uint) string { return strconv.FormatUint(uint64(u), 10) },
+		}, true
+	case *[]bool:
+		return &sepSliceValue[bool]{
+			value:  p,
+			sep:    sep,
+			typ:    "bool" + suffix,
+			parse:  strconv.ParseBool,
+			format: strconv.FormatBool,
+		}, true
+	case *[]time.Duration:
+		return &sepSliceValue[time.Duration]{
+			value:  p,
+			sep:    sep,
+			typ:    "duration" + suffix,
+			parse:  time.ParseDuration,
+			format: time.Duration.String,
+		}, true
+	case *[]net.IP:
+		return &sepSliceValue[net.IP]{
+			value: p,
+			sep:   sep,
+			typ:   "ip" + suffix,
+			parse: func(s string) (net.IP, error) {
+				ip := net.ParseIP(strings.TrimSpace(s))
+				if ip == nil {
+					return nil, errors.E("parse ip", errors.K.Invalid, "ip", s)
+				}
+				return ip, nil
+			},
+			format: net.IP.String,
+		}, true
+	}
+	return nil, false
+}
+
+func (v *sepSliceValue[T]) Set(s string) error {
+	parts := []string{s}
+	if v.sep != "" {
+		parts = strings.Split(s, v.sep)
+	}
+	vals := make([]T, 0, len(parts))
+	for _, part := range parts {
+		val, err := v.parse(part)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, val)
+	}
+	if v.changed {
+		*v.value = append(*v.value, vals...)
+	} else {
+		*v.value = vals
+	}
+	v.changed = true
+	return nil
+}
+
+func (v *sepSliceValue[T]) Type() string {
+	return v.typ
+}
+
+func (v *sepSliceValue[T]) String() string {
+	ss := make([]string, 0, len(*v.value))
+	for _, val := range *v.value {
+		ss = append(ss, v.format(val))
+	}
+	sep := v.sep
+	if sep == "" {
+		sep = ","
+	}
+	return "[" + strings.Join(ss, sep) + "]"
+}
+
+// arrayValue is a flag.Value for fixed-size arrays: the count of values must
+// match the length of the array. Arrays of bytes are hex-encoded.
+type arrayValue struct {
+	arr reflect.Value // addressable array
+	sep string
+}
+
+// newArrayValue returns a flag.Value for the given pointer to an array and
+// true, or false if ptr is not a pointer to an array of supported elements.
+func newArrayValue(ptr interface{}, sep string) (flag.Value, bool) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Array {
+		return nil, false
+	}
+	if !isByteArray(v.Elem()) {
+		if _, ok := elemParser(v.Elem().Type().Elem()); !ok {
+			return nil, false
+		}
+	}
+	return &arrayValue{arr: v.Elem(), sep: sep}, true
+}
+
+func isByteArray(v reflect.Value) bool {
+	return v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8
+}
+
+// elemParser returns a function parsing a string to a value of the given type.
+func elemParser(t reflect.Type) (func(s string) (reflect.Value, error), bool) {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return func(s string) (reflect.Value, error) {
+			d, err := time.ParseDuration(s)
+			return reflect.ValueOf(d), err
+		}, true
+	}
+	var parse func(s string) (interface{}, error)
+	switch t.Kind() {
+	case reflect.String:
+		parse = func(s string) (interface{}, error) { return s, nil }
+	case reflect.Bool:
+		parse = func(s string) (interface{}, error) { return strconv.ParseBool(s) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parse = func(s string) (interface{}, error) { return strconv.ParseInt(s, 0, t.Bits()) }
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parse = func(s string) (interface{}, error) { return strconv.ParseUint(s, 0, t.Bits()) }
+	case reflect.Float32, reflect.Float64:
+		parse = func(s string) (interface{}, error) { return strconv.ParseFloat(s, t.Bits()) }
+	default:
+		return nil, false
+	}
+	return func(s string) (reflect.Value, error) {
+		val, err := parse(strings.TrimSpace(s))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(val).Convert(t), nil
+	}, true
+}
+
+func (a *arrayValue) Set(s string) error {
+	e := errors.Template("arrayValue.Set", errors.K.Invalid, "expected_count", a.arr.Len())
+	if isByteArray(a.arr) {
+		bb, err := hex.DecodeString(s)
+		if err != nil {
+			return e(err, "reason", "invalid hex value")
+		}
+		if len(bb) != a.arr.Len() {
+			return e("reason", "wrong count of bytes", "count", len(bb))
+		}
+		reflect.Copy(a.arr, reflect.ValueOf(bb))
+		return nil
+	}
+	parts := strings.Split(s, a.sep)
+	if len(parts) != a.arr.Len() {
+		return e("reason", "wrong count of values", "count", len(parts))
+	}
+	parse, _ := elemParser(a.arr.Type().Elem())
+	vals := make([]reflect.Value, 0, len(parts))
+	for _, part := range parts {
+		val, err := parse(part)
+		if err != nil {
+			return e(err)
+		}
+		vals = append(vals, val)
+	}
+	for i, val := range vals {
+		a.arr.Index(i).Set(val)
+	}
+	return nil
+}
+
+func (a *arrayValue) Type() string {
+	if isByteArray(a.arr) {
+		return "hex"
+	}
+	return a.arr.Type().Elem().Kind().String() + "Array" + strconv.Itoa(a.arr.Len())
+}
+
+func (a *arrayValue) String() string {
+	return arrayString(a.arr, a.sep)
+}
+
+// arrayString returns the string representation of an array: values joined
+// with the separator or hex-encoded bytes for arrays of bytes.
+func arrayString(v reflect.Value, sep string) string {
+	if isByteArray(v) {
+		bb := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(bb), v)
+		return hex.EncodeToString(bb)
+	}
+	ss := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		ss = append(ss, fmt.Sprintf("%v", v.Index(i)))
+	}
+	return strings.Join(ss, sep)
+}
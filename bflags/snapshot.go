@@ -0,0 +1,144 @@
+package bflags
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// Snapshot is the bound state of a command: the values of its flags and args
+// and the names of the flags and args set on the command line. It is obtained
+// with TakeSnapshot and restored into a - possibly fresh - cobra tree with
+// Restore, e.g. by a REPL or a server re-running commands.
+//
+// Snapshots marshal to json. Values of secret flags are redacted (see
+// IsSecret) and are therefore not restored.
+type Snapshot struct {
+	Command string          `json:"command"`           // path of the command
+	Flags   json.RawMessage `json:"flags,omitempty"`   // json of the CmdFlags of the command
+	Args    json.RawMessage `json:"args,omitempty"`    // json of the ArgSet of the command
+	Changed []string        `json:"changed,omitempty"` // names of flags and args set on the command line
+}
+
+// TakeSnapshot returns the bound state of the given command.
+func TakeSnapshot(c *cobra.Command) (*Snapshot, error) {
+	e := errors.Template("TakeSnapshot", errors.K.Invalid)
+	if c == nil {
+		return nil, e("reason", "cmd is nil")
+	}
+	ret := &Snapshot{Command: c.CommandPath()}
+	var err error
+	if flags, ferr := GetCmdFlagSet(c); ferr == nil {
+		if ret.Flags, err = json.Marshal(flags); err != nil {
+			return nil, e(err, "command", ret.Command)
+		}
+	}
+	if args, aerr := GetCmdArgSet(c); aerr == nil {
+		if ret.Args, err = json.Marshal(args); err != nil {
+			return nil, e(err, "command", ret.Command)
+		}
+	}
+	c.Flags().VisitAll(func(f *flag.Flag) {
+		if f.Changed {
+			ret.Changed = append(ret.Changed, f.Name)
+		}
+	})
+	sort.Strings(ret.Changed)
+	return ret, nil
+}
+
+// Restore sets the values of the flags and args bound to the given command to
+// the values of the snapshot and marks the flags and args that were set on the
+// command line as changed, except secret flags whose values were redacted. The
+// command is expected to be bound to the same input as the command of the
+// snapshot, but not necessarily to have the same path.
+func Restore(c *cobra.Command, s *Snapshot) error {
+	e := errors.Template("Restore", errors.K.Invalid)
+	if c == nil || s == nil {
+		return e("reason", "cmd or snapshot is nil")
+	}
+	e = e.Add("command", c.CommandPath())
+	if len(s.Flags) > 0 {
+		flags, err := GetCmdFlagSet(c)
+		if err == nil {
+			err = flags.Set(string(s.Flags))
+		}
+		if err != nil {
+			return e(err)
+		}
+	}
+	if len(s.Args) > 0 {
+		args, err := GetCmdArgSet(c)
+		if err == nil {
+			err = args.Set(string(s.Args))
+		}
+		if err != nil {
+			return e(err)
+		}
+	}
+	fas := GetFlagArgs(c)
+	for _, name := range s.Changed {
+		f := c.Flags().Lookup(name)
+		if f == nil {
+			return e(errors.K.NotExist, "reason", "unknown flag", "flag", name)
+		}
+		if fa := fas[name]; fa != nil && fa.Secret {
+			continue
+		}
+		f.Changed = true
+	}
+	return nil
+}
+
+// setBondValues sets the values of the given flags to the values of the flags
+// with the same names in the given json representation of flags.
+func setBondValues(op string, fbs map[cmdFlag]*FlagBond, values map[string]json.RawMessage) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fb, ok := fbs[cmdFlag(name)]
+		if !ok {
+			return errors.E(op, errors.K.NotExist, "reason", "unknown flag", "flag", name)
+		}
+		var v struct {
+			Value json.RawMessage `json:"value"`
+		}
+		err := json.Unmarshal(values[name], &v)
+		if err == nil {
+			err = fb.setJSON(v.Value)
+		}
+		if err != nil {
+			return errors.E(op, errors.K.Invalid, err, "flag", name)
+		}
+	}
+	return nil
+}
+
+// setJSON sets the value of the flag to the given json value, as produced by
+// MarshalJSON. Absent and redacted values are ignored. Values implementing
+// flag.Value are set from their string representation if the json value is a
+// string.
+func (f *FlagBond) setJSON(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var s string
+	isString := json.Unmarshal(raw, &s) == nil
+	if isString && s == RedactedValue && f.IsSecret() {
+		return nil
+	}
+	if isNil(f.Value) {
+		return errors.E("setJSON", errors.K.Invalid, ErrUnsupportedType, "reason", "no bound value")
+	}
+	if fv, ok := f.Value.(flag.Value); ok && isString {
+		return fv.Set(s)
+	}
+	return json.Unmarshal(raw, f.Value)
+}
@@ -0,0 +1,99 @@
+package bflags
+
+import (
+	"reflect"
+
+	"github.com/spf13/cobra"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// Unmarshaler is implemented by values of flags with the 'splat' tag, like
+// params.Json:
+//
+//	`cmd:"flag,config,config file" splat:"true" json:"-"`
+type Unmarshaler interface {
+	// Unmarshal unmarshals the value into v
+	Unmarshal(v interface{}) error
+}
+
+// splat unmarshals the values of flags with the 'splat' tag into the input
+// bound to the command. The precedence is:
+//   - explicitly set flags and args
+//   - values unmarshaled from splat flags, in the order of their names
+//   - default values of the input
+func splat(c *cobra.Command) error {
+	cmdflags, err := GetCmdFlagSet(c)
+	if err != nil {
+		return nil
+	}
+	var splats []*FlagBond
+	for _, fb := range cmdflags.sorted() {
+		if fb.Splat {
+			splats = append(splats, fb)
+		}
+	}
+	if len(splats) == 0 {
+		return nil
+	}
+	in, ok := GetCmdInput(c)
+	if !ok || in == nil {
+		return nil
+	}
+
+	// save values of explicitly set flags and args
+	explicit := make(map[*FlagBond]reflect.Value)
+	save := func(fb *FlagBond) {
+		fl := c.Flags().Lookup(string(fb.Name))
+		if fl == nil || !fl.Changed {
+			return
+		}
+		if v := reflect.ValueOf(fb.Value); v.Kind() == reflect.Ptr && !v.IsNil() {
+			explicit[fb] = copyValue(v.Elem())
+		}
+	}
+	for _, fb := range cmdflags {
+		save(fb)
+	}
+	if argset, err := GetCmdArgSet(c); err == nil {
+		for _, fb := range argset.Flags {
+			save(fb)
+		}
+	}
+
+	for _, fb := range splats {
+		fl := c.Flags().Lookup(string(fb.Name))
+		if fl == nil || ValueString(fl.Value) == "" {
+			continue
+		}
+		u, ok := fb.Value.(Unmarshaler)
+		if !ok {
+			return errors.E("splat", errors.K.Invalid, ErrUnsupportedType,
+				"reason", "splat flag does not implement Unmarshal",
+				"flag", fb.Name,
+				"type", errors.TypeOf(fb.Value))
+		}
+		err = u.Unmarshal(in)
+		if err != nil {
+			return errors.E("splat", errors.K.Invalid, err, "flag", fb.Name)
+		}
+	}
+
+	for fb, v := range explicit {
+		reflect.ValueOf(fb.Value).Elem().Set(v)
+	}
+	return nil
+}
+
+// copyValue returns a copy of v, with slices copied such that unmarshaling
+// into the original value does not modify the copy.
+func copyValue(v reflect.Value) reflect.Value {
+	ret := reflect.New(v.Type()).Elem()
+	if v.Kind() == reflect.Slice && !v.IsNil() {
+		ret.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		reflect.Copy(ret, v)
+		return ret
+	}
+	ret.Set(v)
+	return ret
+}
@@ -0,0 +1,139 @@
+package bflags
+
+import (
+	"maps"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+)
+
+// cmdState holds the state attached to a command by the binding: the bound
+// flags and args, the input, the context, other named values, middlewares,
+// templates and the order of flags in usages.
+type cmdState struct {
+	flags     CmdFlags
+	args      *ArgSet
+	input     interface{}
+	hasInput  bool
+	ctx       interface{}
+	hasCtx    bool
+	values    map[string]interface{}
+	pristine  interface{} // copy of the input at bind time
+	flagger   Flagger     // custom Flagger used at bind time
+	envPrefix string      // prefix of environment variables of flags, see BindEnv
+
+	middlewares []Middleware
+	exampleVars map[string]interface{}
+	templates   Templates
+	flagOrder   FlagOrder
+}
+
+// cmdStates is the registry of states keyed by the address of their command.
+// The registry does not keep commands alive: the state of a command is
+// released when the flag set of the command - owned by the command only - is
+// garbage collected. The finalizer is set on the flag set rather than on the
+// command since commands are in cycles with their parent, for which finalizers
+// are not guaranteed to run.
+var cmdStates = struct {
+	mu sync.RWMutex
+	m  map[uintptr]*cmdEntry
+}{
+	m: make(map[uintptr]*cmdEntry),
+}
+
+// cmdEntry is the entry of a command in the registry.
+type cmdEntry struct {
+	state *cmdState
+	flags uintptr // address of the flag set of the command
+}
+
+func address(p interface{}) uintptr {
+	return reflect.ValueOf(p).Pointer()
+}
+
+// lookupState returns the state of the given command or nil. The lock of the
+// registry must be held. An entry whose flag set is not the flag set of the
+// command is stale: the command was collected and its address reused before
+// the finalizer of its flag set ran, or its flags were reset.
+func lookupState(cmd *cobra.Command) *cmdState {
+	e, ok := cmdStates.m[address(cmd)]
+	if !ok || e.flags != address(cmd.Flags()) {
+		return nil
+	}
+	return e.state
+}
+
+// releaseState is the finalizer of the flag set of commands in the registry.
+func releaseState(key uintptr) func(*flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		cmdStates.mu.Lock()
+		defer cmdStates.mu.Unlock()
+		if e, ok := cmdStates.m[key]; ok && e.flags == address(fs) {
+			delete(cmdStates.m, key)
+		}
+	}
+}
+
+// getState returns a copy of the state of the given command or nil. The copy
+// is made under the lock of the registry, with maps cloned, such that it can be
+// read while the state is updated.
+func getState(cmd *cobra.Command) *cmdState {
+	cmdStates.mu.RLock()
+	defer cmdStates.mu.RUnlock()
+	s := lookupState(cmd)
+	if s == nil {
+		return nil
+	}
+	ret := *s
+	ret.values = maps.Clone(s.values)
+	ret.exampleVars = maps.Clone(s.exampleVars)
+	return &ret
+}
+
+// updateState calls fn with the state of the given command, creating it if
+// needed.
+func updateState(cmd *cobra.Command, fn func(s *cmdState)) {
+	cmdStates.mu.Lock()
+	defer cmdStates.mu.Unlock()
+	s := lookupState(cmd)
+	if s == nil {
+		s = &cmdState{}
+		key, fs := address(cmd), cmd.Flags()
+		cmdStates.m[key] = &cmdEntry{state: s, flags: address(fs)}
+		runtime.SetFinalizer(fs, releaseState(key))
+	}
+	fn(s)
+}
+
+// clearCmdCtx removes the context set to the given command with SetCmdCtx.
+func clearCmdCtx(cmd *cobra.Command) {
+	cmdStates.mu.Lock()
+	defer cmdStates.mu.Unlock()
+	if s := lookupState(cmd); s != nil {
+		s.ctx = nil
+		s.hasCtx = false
+	}
+}
+
+// ClearCmdState removes the state attached to the given command and all its
+// sub-commands: bound flags and args, input, context, middlewares and values
+// added with AddToCmdCtx. The state is released anyway when the command is
+// garbage collected: ClearCmdState is only needed to reuse a command without
+// its state.
+func ClearCmdState(cmd *cobra.Command) {
+	if cmd == nil {
+		return
+	}
+	cmdStates.mu.Lock()
+	if lookupState(cmd) != nil {
+		delete(cmdStates.m, address(cmd))
+		runtime.SetFinalizer(cmd.Flags(), nil)
+	}
+	cmdStates.mu.Unlock()
+	for _, c := range cmd.Commands() {
+		ClearCmdState(c)
+	}
+}
@@ -0,0 +1,60 @@
+package bflags
+
+import (
+	"reflect"
+)
+
+// StaticBinder is implemented by inputs that provide the flags and args to bind
+// without reflection. The Value of each returned FlagBond is a pointer to the
+// corresponding field of the input.
+//
+// Implementations are usually generated by the bflags-gen tool from the 'cmd',
+// 'meta' and 'post' tags of the input struct:
+//
+//	//go:generate bflags-gen -type myInput
+//
+// Bind uses StaticBonds when the input implements StaticBinder and no custom
+// Flagger is used, and falls back to reflection otherwise.
+type StaticBinder interface {
+	StaticBonds() (flags []*FlagBond, args []*FlagBond)
+}
+
+// FlagBondFromTag returns the FlagBond declared by the given tag of a struct
+// field with the given name, or nil if the tag does not declare a flag or an
+// arg. The Value of the returned FlagBond is nil and isArg reports whether the
+// tag declares an arg.
+func FlagBondFromTag(fieldName string, tag reflect.StructTag) (fb *FlagBond, isArg bool) {
+	spec := parseFieldTag(reflect.StructField{Name: fieldName, Tag: tag})
+	if spec == nil {
+		return nil, false
+	}
+	fb = &FlagBond{
+		Name:           cmdFlag(spec.getName()),
+		Usage:          spec.getDescription(),
+		ArgOrder:       -1,
+		Annotations:    spec.getAnnotations(),
+		PostProcessors: spec.getPostProcessors(),
+		Separator:      spec.getSeparator(),
+		Repeat:         spec.getRepeat(),
+		Choices:        spec.getChoices(),
+		Env:            spec.getEnv(),
+		Groups:         spec.getGroups(),
+		Complete:       spec.getComplete(),
+		Layout:         spec.getLayout(),
+		Validate:       spec.getValidate(),
+	}
+	switch sp := spec.(type) {
+	case *flagSpec:
+		fb.Shorthand = sp.shorthand
+		fb.Persistent = sp.persistent
+		fb.Required = sp.required
+		fb.Hidden = sp.hidden
+		fb.Count = sp.count
+		fb.Splat = sp.splat
+	case *argSpec:
+		fb.isArg = true
+		fb.ArgOrder = sp.order
+		fb.Optional = sp.optional
+	}
+	return fb, fb.isArg
+}
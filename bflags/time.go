@@ -0,0 +1,109 @@
+package bflags
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// layout returns the layout of time values of the flag: the 'layout' tag or
+// time.RFC3339 if empty.
+func (f *FlagBond) layout() string {
+	if f.Layout == "" {
+		return time.RFC3339
+	}
+	return f.Layout
+}
+
+// checkLayout returns an error if the flag declares a layout but is not bound
+// to a time.Time.
+func checkLayout(fb *FlagBond) error {
+	if fb.Layout == "" {
+		return nil
+	}
+	switch fb.Value.(type) {
+	case *time.Time, **time.Time:
+		return nil
+	}
+	return errors.E("checkLayout", errors.K.Invalid, ErrBadTag,
+		"reason", "layout of a value that is not a time.Time",
+		"flag", fb.Name,
+		"type", reflect.TypeOf(fb.Value))
+}
+
+func timeBinder(e *flagsBinder, v reflect.Value, spec cmdSpec, _ bindOpts) {
+	ex := specError("timeBinder", spec)
+
+	iface := v.Addr().Interface()
+	ptr, ok := iface.(*time.Time)
+	if !ok {
+		e.error(ex(ErrUnsupportedType, "wrong type, expected *time.Time, got", reflect.TypeOf(iface)))
+	}
+	e.setFlagBound(ptr, spec)
+}
+
+// -- time.Time value
+type timeValue struct {
+	p      *time.Time
+	layout string
+}
+
+func newTimeValue(p *time.Time, layout string) *timeValue {
+	return &timeValue{p: p, layout: layout}
+}
+
+func (b *timeValue) Set(s string) error {
+	v, err := time.Parse(b.layout, s)
+	if err == nil {
+		*b.p = v
+	}
+	return err
+}
+
+func (b *timeValue) Type() string {
+	return "time"
+}
+
+func (b *timeValue) String() string {
+	return formatTime(*b.p, b.layout)
+}
+
+// -- ptr time.Time value
+type ptrTimeValue struct {
+	p      **time.Time
+	layout string
+}
+
+func newPtrTimeValue(p **time.Time, layout string) *ptrTimeValue {
+	return &ptrTimeValue{p: p, layout: layout}
+}
+
+func (b *ptrTimeValue) Set(s string) error {
+	v, err := time.Parse(b.layout, s)
+	if err == nil {
+		*b.p = &v
+	}
+	return err
+}
+
+func (b *ptrTimeValue) Type() string {
+	return "time"
+}
+
+func (b *ptrTimeValue) String() string {
+	ret := *b.p
+	if ret == nil {
+		return ""
+	}
+	return formatTime(*ret, b.layout)
+}
+
+// formatTime formats t with the given layout. The zero time is formatted as an
+// empty string such that it is not shown as default value of flags.
+func formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,241 @@
+package bflags
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/spf13/cobra"
+)
+
+// rules of the 'validate' tag
+const (
+	ruleMin      = "min"      // min=1: minimum of numbers, or length of strings and slices
+	ruleMax      = "max"      // max=10: maximum of numbers, or length of strings and slices
+	ruleOneOf    = "oneof"    // oneof=a|b|c: allowed values
+	ruleRegexp   = "regexp"   // regexp=^[a-z]+$: regular expression matched by values - must be the last rule
+	ruleNonEmpty = "nonempty" // nonempty: the value must not be the zero value or empty
+)
+
+// validationRule is a rule of the 'validate' tag of a flag.
+type validationRule struct {
+	name  string
+	arg   string
+	bound float64        // bound of min and max
+	re    *regexp.Regexp // regular expression of regexp
+}
+
+// splitRules splits the value of a 'validate' tag into rules as 'name=arg'.
+// The argument of the regexp rule extends to the end of the tag such that it
+// may contain commas.
+func splitRules(tag string) []string {
+	var ret []string
+	rest := strings.TrimSpace(tag)
+	for rest != "" {
+		var rule string
+		if strings.HasPrefix(rest, ruleRegexp+"=") {
+			rule, rest = rest, ""
+		} else {
+			rule, rest, _ = strings.Cut(rest, ",")
+		}
+		ret = append(ret, strings.TrimSpace(rule))
+		rest = strings.TrimSpace(rest)
+	}
+	return ret
+}
+
+// validationRules returns the rules of the 'validate' tag of the flag or an
+// error if a rule is unknown, has an invalid argument or does not apply to the
+// type of the flag.
+func (f *FlagBond) validationRules() ([]*validationRule, error) {
+	if f.Validate == "" {
+		return nil, nil
+	}
+	e := errors.Template("validationRules", errors.K.Invalid, ErrBadTag, "flag", f.Name)
+	ret := make([]*validationRule, 0)
+	for _, r := range splitRules(f.Validate) {
+		name, arg, _ := strings.Cut(r, "=")
+		rule := &validationRule{name: name, arg: arg}
+		switch name {
+		case ruleMin, ruleMax:
+			kind := validatedValue(f.Value).Kind()
+			switch {
+			case isDuration(f.Value):
+				d, err := time.ParseDuration(arg)
+				if err != nil {
+					return nil, e("reason", "invalid duration", "rule", r)
+				}
+				rule.bound = float64(d)
+			case isNumberKind(kind) || hasLength(kind):
+				b, err := strconv.ParseFloat(arg, 64)
+				if err != nil {
+					return nil, e("reason", "invalid number", "rule", r)
+				}
+				rule.bound = b
+			default:
+				return nil, e("reason", "rule not applicable to the type of the value",
+					"rule", r,
+					"type", reflect.TypeOf(f.Value))
+			}
+		case ruleOneOf:
+			if arg == "" {
+				return nil, e("reason", "missing values", "rule", r)
+			}
+		case ruleRegexp:
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, e("reason", "invalid regexp", "rule", r, "error", err.Error())
+			}
+			rule.re = re
+		case ruleNonEmpty:
+			if arg != "" {
+				return nil, e("reason", "unexpected argument", "rule", r)
+			}
+		default:
+			return nil, e("reason", "unknown validation rule", "rule", r)
+		}
+		ret = append(ret, rule)
+	}
+	return ret, nil
+}
+
+// validatedValue returns the value bound to a flag, with pointers followed.
+// The returned value is invalid for nil pointers.
+func validatedValue(v interface{}) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+func isDuration(v interface{}) bool {
+	rv := validatedValue(v)
+	return rv.IsValid() && rv.Type() == reflect.TypeOf(time.Duration(0))
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func hasLength(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// number returns the number or the length of the given value used by the min
+// and max rules.
+func number(rv reflect.Value) float64 {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return float64(rv.Len())
+}
+
+// checkRule returns the reason why the value bound to the flag breaks the
+// given rule or an empty string.
+func (f *FlagBond) checkRule(rule *validationRule) string {
+	rv := validatedValue(f.Value)
+	switch rule.name {
+	case ruleNonEmpty:
+		if !rv.IsValid() || rv.IsZero() || (hasLength(rv.Kind()) && rv.Len() == 0) {
+			return "must not be empty"
+		}
+	case ruleMin:
+		if rv.IsValid() && number(rv) < rule.bound {
+			return "must be at least " + rule.arg
+		}
+	case ruleMax:
+		if rv.IsValid() && number(rv) > rule.bound {
+			return "must be at most " + rule.arg
+		}
+	case ruleOneOf:
+		choices := strings.Split(rule.arg, "|")
+		for _, val := range choiceValues(f.Value) {
+			if !containsString(choices, val) {
+				return "must be one of " + rule.arg
+			}
+		}
+	case ruleRegexp:
+		for _, val := range choiceValues(f.Value) {
+			if !rule.re.MatchString(val) {
+				return "must match " + rule.arg
+			}
+		}
+	}
+	return ""
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateValues checks the values of the flags and args of the command
+// against the rules of their 'validate' tag. The nonempty rule applies to all
+// values, other rules to values that were set or are not the zero value. All
+// failing flags are reported: the returned error is an errors.ErrorList if
+// several flags fail, each error wrapping ErrInvalidValue.
+func validateValues(c *cobra.Command) error {
+	var bonds []*FlagBond
+	if cmdflags, err := GetCmdFlagSet(c); err == nil {
+		bonds = append(bonds, cmdflags.declared()...)
+	}
+	if argflags, err := GetCmdArgSet(c); err == nil {
+		bonds = append(bonds, argflags.Flags...)
+	}
+	var ret error
+	for _, fb := range bonds {
+		rules, err := fb.validationRules()
+		if err != nil {
+			return err
+		}
+		f := c.Flags().Lookup(string(fb.Name))
+		if f == nil {
+			continue
+		}
+		rv := validatedValue(fb.Value)
+		isSet := f.Changed || (rv.IsValid() && !rv.IsZero())
+		for _, rule := range rules {
+			if rule.name != ruleNonEmpty && !isSet {
+				continue
+			}
+			if reason := fb.checkRule(rule); reason != "" {
+				value := ValueString(f.Value)
+				if fb.IsSecret() {
+					value = RedactedValue
+				}
+				ret = errors.Append(ret, errors.NoTrace("validateValues", errors.K.Invalid, ErrInvalidValue,
+					"reason", reason,
+					"flag", fb.Name,
+					"value", value))
+				break
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,60 @@
+package bflags
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TerminalWidth returns the width used to wrap usages in help: the value of the
+// COLUMNS environment variable if set or the width of the terminal attached to
+// the standard output. Zero - no wrapping - is returned if neither is available,
+// e.g. when the output is piped.
+func TerminalWidth() int {
+	if s := os.Getenv("COLUMNS"); s != "" {
+		if cols, err := strconv.Atoi(s); err == nil && cols > 0 {
+			return cols
+		}
+	}
+	return terminalWidth(os.Stdout)
+}
+
+// wrapText wraps s on word boundaries such that lines - prefixed with indent
+// spaces after the first one - do not exceed cols. Explicit newlines are
+// preserved and words longer than a line are not split. s is returned
+// unchanged if cols is too small to leave room for at least 24 characters per
+// line.
+func wrapText(s string, indent, cols int) string {
+	width := cols - indent
+	if cols <= 0 || width < 24 {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = wrapLine(line, indent, width)
+	}
+	return strings.Join(lines, "\n"+strings.Repeat(" ", indent))
+}
+
+// wrapLine wraps the given line - without newline - to the given width.
+func wrapLine(s string, indent, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	sb := strings.Builder{}
+	lineLen := 0
+	for i, word := range strings.Fields(s) {
+		if i > 0 {
+			if lineLen+1+len(word) > width {
+				sb.WriteString("\n" + strings.Repeat(" ", indent))
+				lineLen = 0
+			} else {
+				sb.WriteString(" ")
+				lineLen++
+			}
+		}
+		sb.WriteString(word)
+		lineLen += len(word)
+	}
+	return sb.String()
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package bflags
+
+import (
+	"os"
+)
+
+// terminalWidth returns zero: the width of terminals is not detected on this
+// platform. Set the COLUMNS environment variable to wrap usages.
+func terminalWidth(*os.File) int {
+	return 0
+}
@@ -0,0 +1,129 @@
+// Package credentials stores and retrieves named secrets - like API tokens -
+// in the keyring of the OS or, where no keyring is available, in a file
+// readable by the user only.
+package credentials
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// ErrNotFound is the cause of errors reporting a credential not found in a
+// store.
+var ErrNotFound = errors.Str("credential not found")
+
+// Store stores named secrets.
+type Store interface {
+	// Get returns the secret with the given name or an error wrapping
+	// ErrNotFound if there is none.
+	Get(name string) (string, error)
+	// Set stores the secret with the given name.
+	Set(name, secret string) error
+	// Delete removes the secret with the given name. Deleting a secret that
+	// does not exist is not an error.
+	Delete(name string) error
+}
+
+// Default returns the keyring store of the given service if a keyring is
+// available (see KeyringAvailable) and the file store with the given path
+// otherwise.
+func Default(service, file string) Store {
+	if KeyringAvailable() {
+		return Keyring(service)
+	}
+	return File(file)
+}
+
+// File returns a store keeping secrets in the JSON file with the given path.
+// The file is created with permissions 0600 in a directory with permissions
+// 0700.
+func File(path string) Store {
+	return &fileStore{path: path}
+}
+
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) load() (map[string]string, error) {
+	e := errors.Template("credentials.load", errors.K.IO, "file", s.path)
+	ret := make(map[string]string)
+	bb, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, e(err)
+	}
+	if len(bb) == 0 {
+		return ret, nil
+	}
+	if err = json.Unmarshal(bb, &ret); err != nil {
+		return nil, e(errors.K.Invalid, err)
+	}
+	return ret, nil
+}
+
+func (s *fileStore) save(m map[string]string) error {
+	e := errors.Template("credentials.save", errors.K.IO, "file", s.path)
+	bb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return e(errors.K.Invalid, err)
+	}
+	dir := filepath.Dir(s.path)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return e(err)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(s.path)+".*")
+	if err != nil {
+		return e(err)
+	}
+	_, err = f.Write(append(bb, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp creates files with permissions 0600
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return e(err)
+	}
+	return nil
+}
+
+func (s *fileStore) Get(name string) (string, error) {
+	m, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := m[name]
+	if !ok {
+		return "", errors.E("credentials.Get", errors.K.NotExist, ErrNotFound, "name", name)
+	}
+	return secret, nil
+}
+
+func (s *fileStore) Set(name, secret string) error {
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	m[name] = secret
+	return s.save(m)
+}
+
+func (s *fileStore) Delete(name string) error {
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := m[name]; !ok {
+		return nil
+	}
+	delete(m, name)
+	return s.save(m)
+}
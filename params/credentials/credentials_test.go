@@ -0,0 +1,77 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/eluv-io/errors-go"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, s Store) {
+	_, err := s.Get("token")
+	require.True(t, errors.Is(err, ErrNotFound), err)
+	require.True(t, errors.IsNotExist(err), err)
+
+	require.NoError(t, s.Set("token", "s3cr3t"))
+	require.NoError(t, s.Set("api-key", "k3y"))
+	secret, err := s.Get("token")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", secret)
+
+	require.NoError(t, s.Set("token", "other"))
+	secret, err = s.Get("token")
+	require.NoError(t, err)
+	require.Equal(t, "other", secret)
+
+	require.NoError(t, s.Delete("token"))
+	require.NoError(t, s.Delete("token"))
+	_, err = s.Get("token")
+	require.True(t, errors.Is(err, ErrNotFound), err)
+	secret, err = s.Get("api-key")
+	require.NoError(t, err)
+	require.Equal(t, "k3y", secret)
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app", "credentials.json")
+	testStore(t, File(path))
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	fi, err = os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+}
+
+func TestKeyring(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake secret-tool requires linux")
+	}
+	// fake secret-tool keeping each secret in a file named after the account
+	bin := t.TempDir()
+	items := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+store) cat > "` + items + `/$7" ;;
+lookup) [ -f "` + items + `/$5" ] || exit 1; cat "` + items + `/$5" ;;
+clear) rm -f "` + items + `/$5" ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	require.False(t, KeyringAvailable())
+	require.IsType(t, &fileStore{}, Default("my-cli", filepath.Join(items, "credentials.json")))
+	_, err := Keyring("my-cli").Get("token")
+	require.True(t, errors.IsKind(errors.K.Unavailable, err), err)
+
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/dev/null")
+	require.True(t, KeyringAvailable())
+	s := Default("my-cli", filepath.Join(items, "credentials.json"))
+	require.IsType(t, &keyring{}, s)
+	testStore(t, s)
+}
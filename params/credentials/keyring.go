@@ -0,0 +1,124 @@
+package credentials
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/eluv-io/errors-go"
+)
+
+// KeyringAvailable returns true if the keyring of the OS can be used: through
+// the 'security' tool on macOS and the 'secret-tool' tool of libsecret in a
+// D-Bus session on other unix systems.
+func KeyringAvailable() bool {
+	return keyringTool() != ""
+}
+
+func keyringTool() string {
+	var tool string
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "windows", "plan9", "js":
+		return ""
+	default:
+		if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+			return ""
+		}
+		tool = "secret-tool"
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return ""
+	}
+	return tool
+}
+
+// Keyring returns a store keeping secrets in the keyring of the OS under the
+// given service name. Operations of the store fail if no keyring is available
+// (see KeyringAvailable).
+func Keyring(service string) Store {
+	return &keyring{service: service}
+}
+
+type keyring struct {
+	service string
+}
+
+// run runs the keyring tool with the given args and input and returns its
+// output. notFound is true if the tool reported an item not found.
+func (k *keyring) run(op, name, input string, args ...string) (out string, notFound bool, err error) {
+	e := errors.Template(op, errors.K.IO, "service", k.service, "name", name)
+	tool := keyringTool()
+	if tool == "" {
+		return "", false, e(errors.K.Unavailable, "reason", "no keyring available")
+	}
+	cmd := exec.Command(tool, args...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	if xerr, ok := err.(*exec.ExitError); ok {
+		switch {
+		case tool == "security" && xerr.ExitCode() == 44:
+			return "", true, nil
+		case tool == "secret-tool" && xerr.ExitCode() == 1 && stderr.Len() == 0:
+			return "", true, nil
+		}
+	}
+	if err != nil {
+		return "", false, e(err, "tool", tool, "stderr", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), false, nil
+}
+
+func (k *keyring) Get(name string) (string, error) {
+	args := []string{"lookup", "service", k.service, "account", name}
+	if runtime.GOOS == "darwin" {
+		args = []string{"find-generic-password", "-s", k.service, "-a", name, "-w"}
+	}
+	secret, notFound, err := k.run("credentials.Get", name, "", args...)
+	if err != nil {
+		return "", err
+	}
+	if notFound {
+		return "", errors.E("credentials.Get", errors.K.NotExist, ErrNotFound, "service", k.service, "name", name)
+	}
+	return secret, nil
+}
+
+func (k *keyring) Set(name, secret string) error {
+	input := secret
+	args := []string{"store", "--label", k.service + " " + name, "service", k.service, "account", name}
+	if runtime.GOOS == "darwin" {
+		// the security tool reads secrets from the terminal or the command line
+		// only: the command is passed on stdin in interactive mode such that the
+		// secret does not show up in the process list
+		input = strings.Join([]string{"add-generic-password", "-U",
+			"-s", securityQuote(k.service),
+			"-a", securityQuote(name),
+			"-w", securityQuote(secret)}, " ") + "\n"
+		args = []string{"-i"}
+	}
+	_, _, err := k.run("credentials.Set", name, input, args...)
+	return err
+}
+
+func (k *keyring) Delete(name string) error {
+	args := []string{"clear", "service", k.service, "account", name}
+	if runtime.GOOS == "darwin" {
+		args = []string{"delete-generic-password", "-s", k.service, "-a", name}
+	}
+	_, _, err := k.run("credentials.Delete", name, "", args...)
+	return err
+}
+
+// securityQuote quotes s for the interactive mode of the security tool, which
+// splits commands like a shell: s is enclosed in single quotes and its single
+// quotes are enclosed in double quotes.
+func securityQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -4,6 +4,11 @@ import (
 	"encoding/json"
 
 	"github.com/eluv-io/errors-go"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	jsonValueType = "json"
 )
 
 // Json is a string meant to hold a json value.
@@ -12,6 +17,21 @@ import (
 // - from piped input: "-"
 type Json string
 
+var _ flag.Value = (*Json)(nil)
+
+func (j *Json) String() string {
+	return string(*j)
+}
+
+func (j *Json) Set(val string) error {
+	*j = Json(val)
+	return nil
+}
+
+func (j *Json) Type() string {
+	return jsonValueType
+}
+
 // Interface unmarshals this JSON string into an empty interface{}.
 // If the string value starts with '@', it looks for a file with that name and
 // uses the content of the file.
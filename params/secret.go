@@ -0,0 +1,46 @@
+package params
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	secretValueType = "secret"
+)
+
+// Secret is a string holding a secret like a password or an API token. Flags
+// and args of this type are always redacted in logs and reconstructed command
+// lines (see bflags.FlagBond.IsSecret) and String does not reveal the secret,
+// such that it is not printed accidentally.
+type Secret string
+
+var _ flag.Value = (*Secret)(nil)
+
+// IsSecret returns true: the value is secret.
+func (s Secret) IsSecret() bool {
+	return true
+}
+
+// String returns the redacted secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "***"
+}
+
+// Set sets the secret.
+func (s *Secret) Set(val string) error {
+	*s = Secret(val)
+	return nil
+}
+
+// Type returns the type of the flag value.
+func (s *Secret) Type() string {
+	return secretValueType
+}
+
+// Value returns the secret.
+func (s Secret) Value() string {
+	return string(s)
+}